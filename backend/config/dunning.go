@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DunningConfig holds the failed payment retry schedule
+type DunningConfig struct {
+	RetryDays []int // days after the first failure, e.g. 1, 3, 7
+}
+
+// defaultDunningRetryDays is used when DUNNING_RETRY_DAYS is unset or invalid
+var defaultDunningRetryDays = []int{1, 3, 7}
+
+// InitDunningConfig initializes the dunning configuration from environment.
+// DUNNING_RETRY_DAYS is a comma separated, increasing list of days.
+func InitDunningConfig() *DunningConfig {
+	return &DunningConfig{
+		RetryDays: parseRetryDays(os.Getenv("DUNNING_RETRY_DAYS")),
+	}
+}
+
+func parseRetryDays(value string) []int {
+	if strings.TrimSpace(value) == "" {
+		return defaultDunningRetryDays
+	}
+
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || day <= 0 || (len(days) > 0 && day <= days[len(days)-1]) {
+			return defaultDunningRetryDays
+		}
+		days = append(days, day)
+	}
+	return days
+}
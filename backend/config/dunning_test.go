@@ -0,0 +1,25 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRetryDays(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+	}{
+		{"", []int{1, 3, 7}},
+		{"2, 5, 10, 14", []int{2, 5, 10, 14}},
+		{"1,x,7", []int{1, 3, 7}},
+		{"3,1", []int{1, 3, 7}},
+		{"0,2", []int{1, 3, 7}},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryDays(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRetryDays(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
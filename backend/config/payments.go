@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+)
+
+// PaymentsConfig holds payment provider configuration
+type PaymentsConfig struct {
+	Provider      string
+	WebhookSecret string
+}
+
+// InitPaymentsConfig initializes payment provider configuration from environment
+func InitPaymentsConfig() *PaymentsConfig {
+	provider := os.Getenv("PAYMENT_PROVIDER")
+	if provider == "" {
+		provider = "fake"
+	}
+
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		webhookSecret = "change-this-webhook-secret"
+	}
+
+	return &PaymentsConfig{
+		Provider:      provider,
+		WebhookSecret: webhookSecret,
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// ProxyConfig holds the reverse proxies whose X-Forwarded-For is believed
+type ProxyConfig struct {
+	TrustedProxies []*net.IPNet
+}
+
+// InitProxyConfig initializes proxy configuration from environment.
+// TRUSTED_PROXIES is a comma separated list of addresses or CIDR ranges;
+// when unset no proxy is trusted and callers are known by their address.
+func InitProxyConfig() *ProxyConfig {
+	return &ProxyConfig{
+		TrustedProxies: parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")),
+	}
+}
+
+func parseTrustedProxies(value string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			if ip := net.ParseIP(part); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				part = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+			}
+		}
+		_, network, err := net.ParseCIDR(part)
+		if err != nil {
+			log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q", part)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies := parseTrustedProxies(" 10.0.0.0/8, 192.168.1.5 ,::1, not-an-ip,")
+	var got []string
+	for _, network := range proxies {
+		got = append(got, network.String())
+	}
+
+	want := []string{"10.0.0.0/8", "192.168.1.5/32", "::1/128"}
+	if len(got) != len(want) {
+		t.Fatalf("parseTrustedProxies = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseTrustedProxies = %v, want %v", got, want)
+		}
+	}
+
+	if proxies := parseTrustedProxies(""); len(proxies) != 0 {
+		t.Errorf("parseTrustedProxies(\"\") = %v, want none", proxies)
+	}
+}
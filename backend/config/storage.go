@@ -0,0 +1,22 @@
+package config
+
+import (
+	"os"
+)
+
+// StorageConfig holds blob storage configuration
+type StorageConfig struct {
+	LocalPath string
+}
+
+// InitStorageConfig initializes blob storage configuration from environment
+func InitStorageConfig() *StorageConfig {
+	localPath := os.Getenv("BLOB_STORAGE_PATH")
+	if localPath == "" {
+		localPath = "./data/blobs"
+	}
+
+	return &StorageConfig{
+		LocalPath: localPath,
+	}
+}
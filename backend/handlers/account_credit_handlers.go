@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInsufficientCredit = errors.New("insufficient account credit")
+
+// AccountCreditHandler exposes the member account credit ledger. Credit comes
+// from credit notes, referral rewards and manual adjustments, and is applied
+// automatically to the member's next invoice when it is issued.
+type AccountCreditHandler struct {
+	db *mongo.Database
+}
+
+func NewAccountCreditHandler(db *mongo.Database) *AccountCreditHandler {
+	return &AccountCreditHandler{db: db}
+}
+
+// GetMemberAccountCredit returns a member's account credit balance and ledger, newest first
+func (h *AccountCreditHandler) GetMemberAccountCredit(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var member models.Member
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(200)
+	cursor, err := h.db.Collection("account_credit_transactions").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []models.AccountCreditTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if transactions == nil {
+		transactions = []models.AccountCreditTransaction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"balance":      member.AccountCredit,
+		"transactions": transactions,
+	})
+}
+
+// AdjustAccountCredit posts a manual credit or debit to a member's balance
+func (h *AccountCreditHandler) AdjustAccountCredit(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can adjust account credit", http.StatusForbidden)
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Amount models.Money `json:"amount"` // negative to debit
+		Reason string       `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Amount.IsZero() || requestData.Reason == "" {
+		http.Error(w, "amount and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	posted, err := postAccountCredit(ctx, h.db, models.AccountCreditTransaction{
+		MemberID:    memberID,
+		Amount:      requestData.Amount,
+		Source:      models.AccountCreditSourceManual,
+		Description: requestData.Reason,
+		CreatedBy:   &user.ID,
+	})
+	if err != nil {
+		switch err {
+		case errInsufficientCredit, models.ErrCurrencyMismatch:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Member not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(posted)
+}
+
+// postAccountCredit appends an entry to the account credit ledger. The
+// member's cached balance is updated first, conditionally for debits so the
+// balance can never go negative, and the resulting balance is stored on the
+// entry. A balance holds one currency; it can only change currency while empty.
+func postAccountCredit(ctx context.Context, db *mongo.Database, txn models.AccountCreditTransaction) (*models.AccountCreditTransaction, error) {
+	currency := txn.Amount.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	filter := bson.M{"_id": txn.MemberID}
+	update := bson.M{"$inc": bson.M{"account_credit.amount": txn.Amount.Amount}}
+	if txn.Amount.IsNegative() {
+		filter["account_credit.currency"] = currency
+		filter["account_credit.amount"] = bson.M{"$gte": -txn.Amount.Amount}
+	} else {
+		filter["$or"] = bson.A{
+			bson.M{"account_credit.currency": currency},
+			bson.M{"account_credit.amount": bson.M{"$in": bson.A{0, nil}}},
+		}
+		update["$set"] = bson.M{"account_credit.currency": currency}
+	}
+
+	if txn.CreatedAt.IsZero() {
+		txn.CreatedAt = time.Now()
+	}
+
+	var member models.Member
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.Collection("members").FindOneAndUpdate(ctx, filter, update, opts).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := db.Collection("members").CountDocuments(ctx, bson.M{"_id": txn.MemberID})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count > 0 {
+			if txn.Amount.IsNegative() {
+				return nil, errInsufficientCredit
+			}
+			return nil, models.ErrCurrencyMismatch
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	txn.BalanceAfter = member.AccountCredit
+	result, err := db.Collection("account_credit_transactions").InsertOne(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	txn.ID = result.InsertedID.(primitive.ObjectID)
+	return &txn, nil
+}
+
+// applyAccountCredit pays as much of an open invoice as the member's account
+// credit covers. It returns the updated invoice, or nil when no credit was applied.
+func applyAccountCredit(ctx context.Context, db *mongo.Database, invoiceID primitive.ObjectID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := db.Collection("invoices").FindOne(ctx, bson.M{"_id": invoiceID}).Decode(&invoice); err != nil {
+		return nil, err
+	}
+	if invoice.MemberID == nil || !invoice.AmountDue.IsPositive() {
+		return nil, nil
+	}
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		return nil, nil
+	}
+
+	var member models.Member
+	if err := db.Collection("members").FindOne(ctx, bson.M{"_id": *invoice.MemberID}).Decode(&member); err != nil {
+		return nil, err
+	}
+	if !member.AccountCredit.IsPositive() || !member.AccountCredit.SameCurrency(invoice.AmountDue) {
+		return nil, nil
+	}
+
+	amount := member.AccountCredit.Min(invoice.AmountDue)
+	debit, err := postAccountCredit(ctx, db, models.AccountCreditTransaction{
+		MemberID:    member.ID,
+		Amount:      amount.Neg(),
+		Source:      models.AccountCreditSourceInvoice,
+		SourceID:    &invoice.ID,
+		Description: "Applied to invoice " + invoice.Number,
+	})
+	if err == errInsufficientCredit {
+		// Spent concurrently; the next invoice will pick up whatever is left
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := applyPayment(ctx, db, models.Payment{
+		InvoiceID: invoice.ID,
+		Amount:    amount,
+		Method:    "account_credit",
+		Status:    models.PaymentStatusSucceeded,
+		Reference: debit.ID.Hex(),
+		Notes:     "Account credit applied",
+	})
+	if err != nil {
+		if _, reverseErr := postAccountCredit(ctx, db, models.AccountCreditTransaction{
+			MemberID:    member.ID,
+			Amount:      amount,
+			Source:      models.AccountCreditSourceInvoice,
+			SourceID:    &invoice.ID,
+			Description: "Reversed: could not apply to invoice " + invoice.Number,
+		}); reverseErr != nil {
+			log.Printf("account credit: failed to reverse debit %s for member %s: %v", debit.ID.Hex(), member.ID.Hex(), reverseErr)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// tryApplyAccountCredit applies account credit to a newly issued invoice.
+// Errors are logged; the invoice stays open for the full amount.
+func tryApplyAccountCredit(db *mongo.Database, invoiceID primitive.ObjectID) *models.Invoice {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoice, err := applyAccountCredit(ctx, db, invoiceID)
+	if err != nil {
+		log.Printf("account credit: failed to apply credit to invoice %s: %v", invoiceID.Hex(), err)
+		return nil
+	}
+	return invoice
+}
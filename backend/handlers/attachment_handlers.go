@@ -0,0 +1,550 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upload limits
+const (
+	maxPhotoSize      = 5 << 20
+	maxAttachmentSize = 10 << 20
+	maxImageDimension = 8000
+	thumbnailSize     = 256
+)
+
+var photoContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var attachmentContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+var attachmentCategories = map[string]bool{
+	"medical":        true,
+	"identification": true,
+	"other":          true,
+}
+
+type AttachmentHandler struct {
+	db    *mongo.Database
+	store storage.BlobStore
+}
+
+func NewAttachmentHandler(db *mongo.Database, store storage.BlobStore) *AttachmentHandler {
+	return &AttachmentHandler{db: db, store: store}
+}
+
+// UploadMemberPhoto replaces a member's profile photo
+func (h *AttachmentHandler) UploadMemberPhoto(w http.ResponseWriter, r *http.Request) {
+	h.uploadPhoto(w, r, "member")
+}
+
+// UploadInstructorPhoto replaces an instructor's profile photo
+func (h *AttachmentHandler) UploadInstructorPhoto(w http.ResponseWriter, r *http.Request) {
+	h.uploadPhoto(w, r, "instructor")
+}
+
+func (h *AttachmentHandler) uploadPhoto(w http.ResponseWriter, r *http.Request, ownerType string) {
+	ownerID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid "+ownerType+" ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	clubIDs, previousPhoto, err := h.lookupOwner(ctx, ownerType, ownerID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, ownerNotFoundMessage(ownerType), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := currentUser(r)
+	if !canAccessClubs(user, clubIDs) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data, fileName, contentType, err := readUpload(w, r, maxPhotoSize, photoContentTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	thumb, err := makeThumbnail(data, thumbnailSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.saveAttachment(ctx, user, ownerType, ownerID, "photo", fileName, contentType, data, thumb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Collection(ownerType+"s").UpdateOne(ctx, bson.M{"_id": ownerID}, bson.M{
+		"$set": bson.M{"photo_id": attachment.ID, "updated_at": time.Now()},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if previousPhoto != nil {
+		h.removeAttachment(ctx, *previousPhoto)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// UploadMemberAttachment stores a document such as a medical note or ID scan against a member
+func (h *AttachmentHandler) UploadMemberAttachment(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	clubIDs, _, err := h.lookupOwner(ctx, "member", memberID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := currentUser(r)
+	if !canManageSensitiveFiles(user) || !canAccessClubs(user, clubIDs) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data, fileName, contentType, err := readUpload(w, r, maxAttachmentSize, attachmentContentTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category := r.FormValue("category")
+	if category == "" {
+		category = "other"
+	}
+	if !attachmentCategories[category] {
+		http.Error(w, "Category must be one of medical, identification, other", http.StatusBadRequest)
+		return
+	}
+
+	var thumb []byte
+	if strings.HasPrefix(contentType, "image/") {
+		if thumb, err = makeThumbnail(data, thumbnailSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	attachment, err := h.saveAttachment(ctx, user, "member", memberID, category, fileName, contentType, data, thumb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// GetMemberAttachments lists the files the caller may see for a member
+func (h *AttachmentHandler) GetMemberAttachments(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clubIDs, _, err := h.lookupOwner(ctx, "member", memberID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := currentUser(r)
+	if !canAccessClubs(user, clubIDs) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	filter := bson.M{"owner_type": "member", "owner_id": memberID}
+	if !canManageSensitiveFiles(user) {
+		filter["category"] = "photo"
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("attachments").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var attachments []models.Attachment
+	if err := cursor.All(ctx, &attachments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if attachments == nil {
+		attachments = []models.Attachment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment serves the original file after an access check
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, false)
+}
+
+// DownloadThumbnail serves the generated thumbnail of an image attachment
+func (h *AttachmentHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, true)
+}
+
+func (h *AttachmentHandler) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	attachment, ok := h.authorizedAttachment(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	key, contentType := attachment.BlobKey, attachment.ContentType
+	if thumbnail {
+		if !attachment.HasThumbnail {
+			http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	}
+
+	blob, err := h.store.Get(ctx, key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !thumbnail {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.FileName))
+	}
+	io.Copy(w, blob)
+}
+
+// DeleteAttachment removes a file and, for photos, clears the owner's photo reference
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attachment, ok := h.authorizedAttachment(ctx, w, r)
+	if !ok {
+		return
+	}
+	if attachment.Category != "photo" && !canManageSensitiveFiles(currentUser(r)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if attachment.Category == "photo" {
+		h.db.Collection(attachment.OwnerType+"s").UpdateOne(ctx,
+			bson.M{"_id": attachment.OwnerID, "photo_id": attachment.ID},
+			bson.M{"$unset": bson.M{"photo_id": ""}, "$set": bson.M{"updated_at": time.Now()}})
+	}
+
+	if err := h.removeAttachment(ctx, attachment.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizedAttachment loads the attachment named in the path and checks the
+// caller may see it, writing an error response when not
+func (h *AttachmentHandler) authorizedAttachment(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var attachment models.Attachment
+	if err := h.db.Collection("attachments").FindOne(ctx, bson.M{"_id": id}).Decode(&attachment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	clubIDs, _, err := h.lookupOwner(ctx, attachment.OwnerType, attachment.OwnerID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user := currentUser(r)
+	if !canAccessClubs(user, clubIDs) || (attachment.Category != "photo" && !canManageSensitiveFiles(user)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return &attachment, true
+}
+
+// lookupOwner returns the clubs and current photo of a member or instructor
+func (h *AttachmentHandler) lookupOwner(ctx context.Context, ownerType string, ownerID primitive.ObjectID) ([]primitive.ObjectID, *primitive.ObjectID, error) {
+	var owner struct {
+		ClubIDs []primitive.ObjectID `bson:"club_ids"`
+		PhotoID *primitive.ObjectID  `bson:"photo_id"`
+	}
+	err := h.db.Collection(ownerType+"s").FindOne(ctx, bson.M{"_id": ownerID}).Decode(&owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	return owner.ClubIDs, owner.PhotoID, nil
+}
+
+// saveAttachment writes the file and optional thumbnail to blob storage and records it
+func (h *AttachmentHandler) saveAttachment(ctx context.Context, user *models.User, ownerType string, ownerID primitive.ObjectID, category, fileName, contentType string, data, thumb []byte) (*models.Attachment, error) {
+	attachment := models.Attachment{
+		ID:          primitive.NewObjectID(),
+		OwnerType:   ownerType,
+		OwnerID:     ownerID,
+		Category:    category,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now(),
+	}
+	if user != nil {
+		attachment.UploadedBy = &user.ID
+	}
+	attachment.BlobKey = fmt.Sprintf("attachments/%s/%s/%s", ownerType, ownerID.Hex(), attachment.ID.Hex())
+
+	if thumb != nil {
+		attachment.ThumbnailKey = attachment.BlobKey + "-thumb.jpg"
+		attachment.HasThumbnail = true
+		if err := h.store.Put(ctx, attachment.ThumbnailKey, bytes.NewReader(thumb)); err != nil {
+			return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+	}
+
+	if err := h.store.Put(ctx, attachment.BlobKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	if _, err := h.db.Collection("attachments").InsertOne(ctx, attachment); err != nil {
+		h.store.Delete(ctx, attachment.BlobKey)
+		h.store.Delete(ctx, attachment.ThumbnailKey)
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// removeAttachment deletes an attachment record and its blobs
+func (h *AttachmentHandler) removeAttachment(ctx context.Context, id primitive.ObjectID) error {
+	var attachment models.Attachment
+	if err := h.db.Collection("attachments").FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&attachment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	h.store.Delete(ctx, attachment.BlobKey)
+	if attachment.HasThumbnail {
+		h.store.Delete(ctx, attachment.ThumbnailKey)
+	}
+	return nil
+}
+
+// readUpload reads the multipart "file" field, enforcing the size limit and
+// checking the sniffed content type rather than the one the client claims
+func readUpload(w http.ResponseWriter, r *http.Request, limit int64, allowed map[string]bool) ([]byte, string, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit+(1<<20))
+	if err := r.ParseMultipartForm(limit); err != nil {
+		return nil, "", "", fmt.Errorf("upload must be multipart form data no larger than %d MB", limit>>20)
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("missing 'file' field")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if int64(len(data)) > limit {
+		return nil, "", "", fmt.Errorf("file exceeds the %d MB limit", limit>>20)
+	}
+	if len(data) == 0 {
+		return nil, "", "", fmt.Errorf("file is empty")
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowed[contentType] {
+		return nil, "", "", fmt.Errorf("unsupported file type %s", contentType)
+	}
+
+	return data, filepath.Base(header.Filename), contentType, nil
+}
+
+// makeThumbnail decodes an image and box-filters it down to fit within size x size, encoded as JPEG
+func makeThumbnail(data []byte, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return nil, fmt.Errorf("image dimensions exceed %dx%d", maxImageDimension, maxImageDimension)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, b.Dy()*size/b.Dx())
+		} else {
+			width, height = max(1, b.Dx()*size/b.Dy()), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/width)
+
+			var rs, gs, bs, as, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					rs, gs, bs, as = rs+uint64(cr), gs+uint64(cg), bs+uint64(cb), as+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(rs / n), uint16(gs / n), uint16(bs / n), uint16(as / n)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// currentUser returns the authenticated staff user added by the auth middleware
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value("user").(*models.User)
+	return user
+}
+
+// canAccessClubs reports whether a staff user works at any of the given clubs.
+// Admins see everything; records not tied to a club are limited to admins.
+func canAccessClubs(user *models.User, clubIDs []primitive.ObjectID) bool {
+	if user == nil {
+		return false
+	}
+	if user.Role == "admin" {
+		return true
+	}
+	for _, assigned := range user.AssignedClubIDs {
+		for _, clubID := range clubIDs {
+			if assigned == clubID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canManageSensitiveFiles limits medical notes and ID scans to managers
+func canManageSensitiveFiles(user *models.User) bool {
+	return isManager(user)
+}
+
+// isManager reports whether the user is an admin or club manager
+func isManager(user *models.User) bool {
+	return user != nil && (user.Role == "admin" || user.Role == "club_manager")
+}
+
+func ownerNotFoundMessage(ownerType string) string {
+	if ownerType == "instructor" {
+		return "Instructor not found"
+	}
+	return "Member not found"
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for y := 0; y < 500; y++ {
+		for x := 0; x < 1000; x++ {
+			src.Set(x, y, color.RGBA{200, 100, 50, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	thumb, err := makeThumbnail(buf.Bytes(), 256)
+	if err != nil {
+		t.Fatalf("makeThumbnail failed: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("Thumbnail is not a JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 256 || img.Bounds().Dy() != 128 {
+		t.Errorf("Expected 256x128 thumbnail, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	if _, err := makeThumbnail([]byte("not an image"), 256); err == nil {
+		t.Error("Expected an error for invalid image data")
+	}
+}
+
+func TestCanAccessClubs(t *testing.T) {
+	clubA, clubB := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		user    *models.User
+		clubIDs []primitive.ObjectID
+		want    bool
+	}{
+		{"no user", nil, []primitive.ObjectID{clubA}, false},
+		{"admin sees everything", &models.User{Role: "admin"}, nil, true},
+		{"assigned club", &models.User{Role: "all_services", AssignedClubIDs: []primitive.ObjectID{clubA}}, []primitive.ObjectID{clubA}, true},
+		{"other club", &models.User{Role: "club_manager", AssignedClubIDs: []primitive.ObjectID{clubB}}, []primitive.ObjectID{clubA}, false},
+		{"owner without clubs", &models.User{Role: "club_manager", AssignedClubIDs: []primitive.ObjectID{clubA}}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canAccessClubs(tt.user, tt.clubIDs); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
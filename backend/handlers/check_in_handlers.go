@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CheckInHandler struct {
+	db *mongo.Database
+}
+
+func NewCheckInHandler(db *mongo.Database) *CheckInHandler {
+	return &CheckInHandler{db: db}
+}
+
+// GetCheckIns returns check-ins, newest first, optionally filtered by member_id or club_id
+func (h *CheckInHandler) GetCheckIns(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if memberID := r.URL.Query().Get("member_id"); memberID != "" {
+		objID, err := primitive.ObjectIDFromHex(memberID)
+		if err != nil {
+			http.Error(w, "Invalid member ID", http.StatusBadRequest)
+			return
+		}
+		filter["member_id"] = objID
+	}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = objID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "checked_in_at", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("check_ins").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var checkIns []models.CheckIn
+	if err := cursor.All(ctx, &checkIns); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if checkIns == nil {
+		checkIns = []models.CheckIn{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkIns)
+}
+
+// CreateCheckIn records a member arriving at a club
+func (h *CheckInHandler) CreateCheckIn(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		MemberID string `json:"member_id"`
+		ClubID   string `json:"club_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(requestData.MemberID)
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+	clubID, err := primitive.ObjectIDFromHex(requestData.ClubID)
+	if err != nil {
+		http.Error(w, "Invalid club ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var member models.Member
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := checkClubAccess(member); err != nil {
+		writeClubAccessError(w, err)
+		return
+	}
+
+	if err := requireWaiver(ctx, h.db, &clubID, memberID); err != nil {
+		if err == errWaiverRequired {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	checkIn := models.CheckIn{
+		MemberID:    memberID,
+		ClubID:      clubID,
+		CheckedInAt: now,
+		CreatedAt:   now,
+	}
+	if user, ok := r.Context().Value("user").(*models.User); ok {
+		checkIn.StaffUserID = &user.ID
+	}
+
+	result, err := h.db.Collection("check_ins").InsertOne(ctx, checkIn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	checkIn.ID = result.InsertedID.(primitive.ObjectID)
+	tryAwardPoints(h.db, memberID, &clubID, models.PointsSourceCheckIn, checkIn.ID, models.Money{})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(checkIn)
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// churnScoredStatuses are the statuses of members who can still churn
+var churnScoredStatuses = []string{
+	models.MemberStatusActive,
+	models.MemberStatusFrozen,
+	models.MemberStatusPastDue,
+}
+
+type ChurnHandler struct {
+	db *mongo.Database
+}
+
+func NewChurnHandler(db *mongo.Database) *ChurnHandler {
+	return &ChurnHandler{db: db}
+}
+
+// GetAtRiskMembers returns a club's scored members, highest risk first.
+// min_level (low, medium, high; default medium) and limit narrow the list.
+func (h *ChurnHandler) GetAtRiskMembers(w http.ResponseWriter, r *http.Request) {
+	clubID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid club ID", http.StatusBadRequest)
+		return
+	}
+
+	user := currentUser(r)
+	if user == nil || !canAccessClubs(user, []primitive.ObjectID{clubID}) {
+		http.Error(w, "You do not have access to this club", http.StatusForbidden)
+		return
+	}
+
+	minScore := 30
+	switch r.URL.Query().Get("min_level") {
+	case "", models.ChurnRiskMedium:
+	case models.ChurnRiskLow:
+		minScore = 0
+	case models.ChurnRiskHigh:
+		minScore = 60
+	default:
+		http.Error(w, "min_level must be 'low', 'medium' or 'high'", http.StatusBadRequest)
+		return
+	}
+
+	limit := int64(100)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.ParseInt(limitStr, 10, 64); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"club_ids":         clubID,
+		"status":           bson.M{"$in": churnScoredStatuses},
+		"churn_risk.score": bson.M{"$gte": minScore},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "churn_risk.score", Value: -1}, {Key: "last_name", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := h.db.Collection("members").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var members []models.Member
+	if err := cursor.All(ctx, &members); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if members == nil {
+		members = []models.Member{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// ScoreMembers runs the scoring job on demand
+func (h *ChurnHandler) ScoreMembers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	scored, err := scoreChurnRisks(ctx, h.db, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"scored": scored})
+}
+
+// ScoreChurnRisks is the scheduled entry point for the scoring job
+func ScoreChurnRisks(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := scoreChurnRisks(ctx, db, time.Now())
+		return err
+	}
+}
+
+// scoreChurnRisks recomputes the churn risk of every member who can still churn
+func scoreChurnRisks(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	checkIns, err := countCheckIns(ctx, db, now)
+	if err != nil {
+		return 0, err
+	}
+	bookings, err := countBookings(ctx, db, now)
+	if err != nil {
+		return 0, err
+	}
+	failedPayments, err := countFailedPayments(ctx, db, now)
+	if err != nil {
+		return 0, err
+	}
+
+	members := db.Collection("members")
+	cursor, err := members.Find(ctx, bson.M{"status": bson.M{"$in": churnScoredStatuses}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	scored := 0
+	for cursor.Next(ctx) {
+		var member models.Member
+		if err := cursor.Decode(&member); err != nil {
+			return scored, err
+		}
+
+		inputs := models.ChurnInputs{
+			JoinDate:         member.JoinDate,
+			ExpiryDate:       member.ExpiryDate,
+			AutoRenewal:      member.AutoRenewal,
+			CheckInsLast30:   checkIns[member.ID].recent,
+			CheckInsPrior60:  checkIns[member.ID].prior,
+			Bookings90:       bookings[member.ID].total,
+			Cancellations90:  bookings[member.ID].cancelled,
+			FailedPayments90: failedPayments[member.ID],
+		}
+
+		risk := models.ScoreChurnRisk(inputs, now)
+		if _, err := members.UpdateOne(ctx, bson.M{"_id": member.ID}, bson.M{
+			"$set": bson.M{"churn_risk": risk},
+		}); err != nil {
+			return scored, err
+		}
+		scored++
+	}
+	return scored, cursor.Err()
+}
+
+type checkInCounts struct {
+	recent int
+	prior  int
+}
+
+// countCheckIns counts each member's check-ins in the last 30 days and the 60 days before
+func countCheckIns(ctx context.Context, db *mongo.Database, now time.Time) (map[primitive.ObjectID]checkInCounts, error) {
+	since30 := now.AddDate(0, 0, -30)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"checked_in_at": bson.M{"$gte": now.AddDate(0, 0, -90), "$lte": now}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$member_id",
+			"recent": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$checked_in_at", since30}}, 1, 0}}},
+			"prior":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$checked_in_at", since30}}, 1, 0}}},
+		}}},
+	}
+
+	cursor, err := db.Collection("check_ins").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		MemberID primitive.ObjectID `bson:"_id"`
+		Recent   int                `bson:"recent"`
+		Prior    int                `bson:"prior"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]checkInCounts, len(rows))
+	for _, row := range rows {
+		counts[row.MemberID] = checkInCounts{recent: row.Recent, prior: row.Prior}
+	}
+	return counts, nil
+}
+
+type bookingCounts struct {
+	total     int
+	cancelled int
+}
+
+// countBookings counts each member's class bookings in the last 90 days and
+// how many of them were cancelled or missed
+func countBookings(ctx context.Context, db *mongo.Database, now time.Time) (map[primitive.ObjectID]bookingCounts, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"member_id": bson.M{"$ne": nil},
+			"booked_at": bson.M{"$gte": now.AddDate(0, 0, -90), "$lte": now},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$member_id",
+			"total":     bson.M{"$sum": 1},
+			"cancelled": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$status", bson.A{"cancelled", "no-show"}}}, 1, 0}}},
+		}}},
+	}
+
+	cursor, err := db.Collection("class_bookings").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		MemberID  primitive.ObjectID `bson:"_id"`
+		Total     int                `bson:"total"`
+		Cancelled int                `bson:"cancelled"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]bookingCounts, len(rows))
+	for _, row := range rows {
+		counts[row.MemberID] = bookingCounts{total: row.Total, cancelled: row.Cancelled}
+	}
+	return counts, nil
+}
+
+// countFailedPayments counts each member's failed payments in the last 90 days
+func countFailedPayments(ctx context.Context, db *mongo.Database, now time.Time) (map[primitive.ObjectID]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"member_id":   bson.M{"$ne": nil},
+			"status":      models.PaymentStatusFailed,
+			"received_at": bson.M{"$gte": now.AddDate(0, 0, -90), "$lte": now},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$member_id", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := db.Collection("payments").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		MemberID primitive.ObjectID `bson:"_id"`
+		Count    int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		counts[row.MemberID] = row.Count
+	}
+	return counts, nil
+}
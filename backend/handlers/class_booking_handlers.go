@@ -1,21 +1,33 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-api-mongo/models"
 )
 
+var (
+	errAlreadyEnrolled   = errors.New("member already enrolled in this class")
+	errAlreadyWaitlisted = errors.New("member already on the waitlist for this class")
+	errBookingInProgress = errors.New("member is being booked into this class by another request")
+)
+
 type ClassBookingHandler struct {
 	Collection *mongo.Collection
 }
 
+// Create books a member into a class. The booking is confirmed when the
+// class has a free place and nobody is waiting for one; otherwise it joins
+// the end of the waitlist.
 func (h *ClassBookingHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var booking models.ClassBooking
 	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
@@ -23,23 +35,48 @@ func (h *ClassBookingHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	booking.ID = primitive.NewObjectID()
-	booking.CreatedAt = time.Now()
-	booking.UpdatedAt = time.Now()
-	booking.BookedAt = time.Now()
+	if booking.ClassID == nil || booking.MemberID == nil {
+		http.Error(w, "class_id and member_id are required", http.StatusBadRequest)
+		return
+	}
+
+	db := h.Collection.Database()
+	var class models.Class
+	if err := db.Collection("classes").FindOne(r.Context(), bson.M{"_id": *booking.ClassID}).Decode(&class); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Class not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if class.Status == "cancelled" {
+		http.Error(w, "Class has been cancelled", http.StatusConflict)
+		return
+	}
 
-	if booking.Status == "" {
-		booking.Status = "confirmed"
+	if err := requireClubAccess(r.Context(), db, *booking.MemberID); err != nil {
+		writeClubAccessError(w, err)
+		return
 	}
 
-	_, err := h.Collection.InsertOne(r.Context(), booking)
-	if err != nil {
+	if err := requireWaiver(r.Context(), db, class.ClubID, *booking.MemberID); err != nil {
+		if err == errWaiverRequired {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	created, err := bookClass(r.Context(), db, *booking.ClassID, *booking.MemberID, booking.Notes)
+	if err != nil {
+		writeClassBookingError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(booking)
+	json.NewEncoder(w).Encode(created)
 }
 
 func (h *ClassBookingHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +137,10 @@ func (h *ClassBookingHandler) Get(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(booking)
 }
 
+// Update changes a booking's notes and records attendance. A seated booking
+// can move between confirmed, attended and no-show; setting it to cancelled
+// cancels it. Waitlisted bookings are only confirmed when a place comes
+// free, and cancelled ones cannot be reopened.
 func (h *ClassBookingHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -108,25 +149,91 @@ func (h *ClassBookingHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var booking models.ClassBooking
-	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
+	var requestData struct {
+		Status string  `json:"status"`
+		Notes  *string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	booking.UpdatedAt = time.Now()
+	db := h.Collection.Database()
+	var previous models.ClassBooking
+	if err := h.Collection.FindOne(r.Context(), bson.M{"_id": objID}).Decode(&previous); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	update := bson.M{"$set": booking}
-	_, err = h.Collection.UpdateOne(r.Context(), bson.M{"_id": objID}, update)
-	if err != nil {
+	if requestData.Status != "" && requestData.Status != previous.Status {
+		switch {
+		case requestData.Status == models.ClassBookingCancelled:
+			if _, err := cancelClassBooking(r.Context(), db, bson.M{"_id": objID}); err != nil {
+				if err == mongo.ErrNoDocuments {
+					http.Error(w, "Booking is "+previous.Status+" and cannot be cancelled", http.StatusConflict)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case !(models.ClassBooking{Status: requestData.Status}).IsSeated() && requestData.Status != models.ClassBookingWaitlist:
+			http.Error(w, "status must be confirmed, waitlist, cancelled, attended or no-show", http.StatusBadRequest)
+			return
+		case previous.Status == models.ClassBookingWaitlist:
+			http.Error(w, "Waitlisted bookings are confirmed when a place comes free", http.StatusConflict)
+			return
+		case !previous.IsSeated():
+			http.Error(w, "Booking is "+previous.Status+" and cannot be changed", http.StatusConflict)
+			return
+		case requestData.Status == models.ClassBookingWaitlist:
+			http.Error(w, "A confirmed booking cannot go back on the waitlist", http.StatusConflict)
+			return
+		default:
+			// Conditional on the status, so a concurrent cancellation wins
+			result, err := h.Collection.UpdateOne(r.Context(), bson.M{"_id": objID, "status": previous.Status},
+				bson.M{"$set": bson.M{"status": requestData.Status, "updated_at": time.Now()}})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if result.ModifiedCount == 0 {
+				http.Error(w, "Booking changed concurrently, please retry", http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	if requestData.Notes != nil {
+		if _, err := h.Collection.UpdateOne(r.Context(), bson.M{"_id": objID},
+			bson.M{"$set": bson.M{"notes": *requestData.Notes, "updated_at": time.Now()}}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var booking models.ClassBooking
+	if err := h.Collection.FindOne(r.Context(), bson.M{"_id": objID}).Decode(&booking); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Attendance earns loyalty points once per booking
+	if booking.Status == models.ClassBookingAttended && previous.Status != models.ClassBookingAttended && previous.MemberID != nil && previous.ClassID != nil {
+		var class models.Class
+		if err := db.Collection("classes").FindOne(r.Context(), bson.M{"_id": *previous.ClassID}).Decode(&class); err == nil {
+			tryAwardPoints(db, *previous.MemberID, class.ClubID, models.PointsSourceClassAttendance, objID, models.Money{})
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(booking)
 }
 
+// Delete removes a booking, giving its place to the waitlist
 func (h *ClassBookingHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -135,16 +242,25 @@ func (h *ClassBookingHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.Collection.DeleteOne(r.Context(), bson.M{"_id": objID})
-	if err != nil {
+	var booking models.ClassBooking
+	err = h.Collection.FindOneAndDelete(r.Context(), bson.M{"_id": objID}).Decode(&booking)
+	if err != nil && err != mongo.ErrNoDocuments {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err == nil && booking.IsSeated() && booking.ClassID != nil {
+		if err := releaseClassPlace(r.Context(), h.Collection.Database(), *booking.ClassID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Cancel cancels a class booking (soft delete by updating status)
+// Cancel cancels a class booking (soft delete by updating status). A
+// confirmed booking's place goes to the first member on the waitlist.
 func (h *ClassBookingHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -153,24 +269,289 @@ func (h *ClassBookingHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"status":     "cancelled",
-			"updated_at": time.Now(),
+	if _, err := cancelClassBooking(r.Context(), h.Collection.Database(), bson.M{"_id": objID}); err != nil {
+		if err != mongo.ErrNoDocuments {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var booking models.ClassBooking
+		if err := h.Collection.FindOne(r.Context(), bson.M{"_id": objID}).Decode(&booking); err != nil {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Booking is already "+booking.Status, http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Booking cancelled"})
+}
+
+// EnsureClassBookingIndexes creates the indexes class bookings rely on. The
+// unique one allows a member a single open booking per class: open
+// bookings have no cancelled_at, and cancelled ones each have their own.
+func EnsureClassBookingIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("class_bookings").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "class_id", Value: 1}, {Key: "member_id", Value: 1}, {Key: "cancelled_at", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("one_open_booking_per_member"),
+		},
+		{
+			Keys:    bson.D{{Key: "class_id", Value: 1}, {Key: "status", Value: 1}, {Key: "booked_at", Value: 1}},
+			Options: options.Index().SetName("class_roster"),
 		},
+	})
+	return err
+}
+
+// bookClass books a member into a class. Every booking joins the waitlist
+// and is then promoted if a place is free, so members are seated in the
+// order they booked and nobody gets ahead of those already waiting.
+func bookClass(ctx context.Context, db *mongo.Database, classID, memberID primitive.ObjectID, notes string) (*models.ClassBooking, error) {
+	if err := openBookingConflict(ctx, db, classID, memberID); err != nil {
+		return nil, err
 	}
 
-	result, err := h.Collection.UpdateOne(r.Context(), bson.M{"_id": objID}, update)
+	now := time.Now()
+	booking := models.ClassBooking{
+		ID:        primitive.NewObjectID(),
+		ClassID:   &classID,
+		MemberID:  &memberID,
+		Status:    models.ClassBookingWaitlist,
+		BookedAt:  now,
+		Notes:     notes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	bookings := db.Collection("class_bookings")
+	_, err := bookings.InsertOne(ctx, booking)
+	if mongo.IsDuplicateKeyError(err) {
+		// Booked by a concurrent request, whose booking may have been
+		// cancelled since; then there is room to try once more
+		if err := openBookingConflict(ctx, db, classID, memberID); err != nil {
+			return nil, err
+		}
+		_, err = bookings.InsertOne(ctx, booking)
+		if mongo.IsDuplicateKeyError(err) {
+			if err := openBookingConflict(ctx, db, classID, memberID); err != nil {
+				return nil, err
+			}
+			return nil, errBookingInProgress
+		}
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	if result.MatchedCount == 0 {
-		http.Error(w, "Booking not found", http.StatusNotFound)
-		return
+	if err := promoteWaitlist(ctx, db, classID); err != nil {
+		return nil, err
+	}
+	if err := bookings.FindOne(ctx, bson.M{"_id": booking.ID}).Decode(&booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// openBookingConflict returns errAlreadyEnrolled or errAlreadyWaitlisted
+// when the member already has an open booking for the class
+func openBookingConflict(ctx context.Context, db *mongo.Database, classID, memberID primitive.ObjectID) error {
+	var existing models.ClassBooking
+	err := db.Collection("class_bookings").FindOne(ctx, bson.M{
+		"class_id":  classID,
+		"member_id": memberID,
+		"status":    bson.M{"$ne": models.ClassBookingCancelled},
+	}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Status == models.ClassBookingWaitlist {
+		return errAlreadyWaitlisted
 	}
+	return errAlreadyEnrolled
+}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Booking cancelled"})
+// cancelClassBooking cancels the confirmed or waitlisted booking matching
+// filter, giving a confirmed booking's place to the waitlist. It returns
+// mongo.ErrNoDocuments when there is no such booking.
+func cancelClassBooking(ctx context.Context, db *mongo.Database, match bson.M) (*models.ClassBooking, error) {
+	filter := bson.M{"status": bson.M{"$in": []string{models.ClassBookingConfirmed, models.ClassBookingWaitlist}}}
+	for key, value := range match {
+		filter[key] = value
+	}
+
+	now := time.Now()
+	var previous models.ClassBooking
+	err := db.Collection("class_bookings").FindOneAndUpdate(ctx, filter, bson.M{
+		"$set": bson.M{"status": models.ClassBookingCancelled, "cancelled_at": now, "updated_at": now},
+	}).Decode(&previous)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous.Status == models.ClassBookingConfirmed && previous.ClassID != nil {
+		if err := releaseClassPlace(ctx, db, *previous.ClassID); err != nil {
+			return nil, err
+		}
+	}
+
+	cancelled := previous
+	cancelled.Status = models.ClassBookingCancelled
+	cancelled.CancelledAt = &now
+	cancelled.UpdatedAt = now
+	return &cancelled, nil
+}
+
+// cancelClassRosters cancels the confirmed and waitlisted bookings of
+// classes that are being cancelled and frees their places. The classes
+// must already be cancelled, so the places are not offered to anyone.
+func cancelClassRosters(ctx context.Context, db *mongo.Database, classIDs []primitive.ObjectID) (int64, error) {
+	if len(classIDs) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	result, err := db.Collection("class_bookings").UpdateMany(ctx, bson.M{
+		"class_id": bson.M{"$in": classIDs},
+		"status":   bson.M{"$in": []string{models.ClassBookingConfirmed, models.ClassBookingWaitlist}},
+	}, bson.M{"$set": bson.M{"status": models.ClassBookingCancelled, "cancelled_at": now, "updated_at": now}})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Collection("classes").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": classIDs}, "status": "cancelled"},
+		bson.M{"$set": bson.M{"booked_count": 0}}); err != nil {
+		return result.ModifiedCount, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// releaseClassPlace gives back a place taken by a booking and offers it to
+// the waitlist
+func releaseClassPlace(ctx context.Context, db *mongo.Database, classID primitive.ObjectID) error {
+	if _, err := db.Collection("classes").UpdateOne(ctx,
+		bson.M{"_id": classID, "booked_count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"booked_count": -1}}); err != nil {
+		return err
+	}
+	return promoteWaitlist(ctx, db, classID)
+}
+
+// promoteWaitlist confirms waitlisted bookings into a class's free places,
+// in the order they were booked. A place is taken on the class with a
+// single conditional update before a booking is confirmed into it, so
+// concurrent calls cannot overfill the class.
+func promoteWaitlist(ctx context.Context, db *mongo.Database, classID primitive.ObjectID) error {
+	classes := db.Collection("classes")
+	bookings := db.Collection("class_bookings")
+	placeFree := bson.M{
+		"_id":    classID,
+		"status": bson.M{"$ne": "cancelled"},
+		"$expr":  bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$booked_count", 0}}, "$capacity"}},
+	}
+	waiting := bson.M{"class_id": classID, "status": models.ClassBookingWaitlist}
+	firstBooked := options.FindOneAndUpdate().SetSort(bson.D{{Key: "booked_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	for {
+		result, err := classes.UpdateOne(ctx, placeFree, bson.M{"$inc": bson.M{"booked_count": 1}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return nil
+		}
+
+		var promoted models.ClassBooking
+		err = bookings.FindOneAndUpdate(ctx, waiting, bson.M{
+			"$set": bson.M{"status": models.ClassBookingConfirmed, "updated_at": time.Now()},
+		}, firstBooked).Decode(&promoted)
+		if err == nil {
+			continue
+		}
+
+		// Nobody took the place, so give it back
+		if _, releaseErr := classes.UpdateOne(ctx, bson.M{"_id": classID, "booked_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"booked_count": -1}}); releaseErr != nil {
+			return releaseErr
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+		// A member who joined the waitlist while the place was held could
+		// not take it themselves
+		count, err := bookings.CountDocuments(ctx, waiting, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+	}
+}
+
+// attachRosters fills in the enrolled members and waitlist of classes from
+// their bookings, in the order they were booked
+func attachRosters(ctx context.Context, db *mongo.Database, classes []models.Class) error {
+	if len(classes) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(classes))
+	index := make(map[primitive.ObjectID]int, len(classes))
+	for i := range classes {
+		classes[i].EnrolledMembers = []primitive.ObjectID{}
+		classes[i].WaitList = []primitive.ObjectID{}
+		ids = append(ids, classes[i].ID)
+		index[classes[i].ID] = i
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "booked_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := db.Collection("class_bookings").Find(ctx, bson.M{
+		"class_id": bson.M{"$in": ids},
+		"status":   bson.M{"$ne": models.ClassBookingCancelled},
+	}, opts)
+	if err != nil {
+		return err
+	}
+	var bookings []models.ClassBooking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		if booking.ClassID == nil || booking.MemberID == nil {
+			continue
+		}
+		i := index[*booking.ClassID]
+		if booking.Status == models.ClassBookingWaitlist {
+			classes[i].WaitList = append(classes[i].WaitList, *booking.MemberID)
+		} else if booking.IsSeated() {
+			classes[i].EnrolledMembers = append(classes[i].EnrolledMembers, *booking.MemberID)
+		}
+	}
+	return nil
+}
+
+// attachRoster fills in the enrolled members and waitlist of one class
+func attachRoster(ctx context.Context, db *mongo.Database, class *models.Class) error {
+	classes := []models.Class{*class}
+	if err := attachRosters(ctx, db, classes); err != nil {
+		return err
+	}
+	*class = classes[0]
+	return nil
+}
+
+// writeClassBookingError answers a failed booking
+func writeClassBookingError(w http.ResponseWriter, err error) {
+	switch err {
+	case errAlreadyEnrolled:
+		http.Error(w, "Member already enrolled in this class", http.StatusBadRequest)
+	case errAlreadyWaitlisted:
+		http.Error(w, "Member already on the waitlist for this class", http.StatusBadRequest)
+	case errBookingInProgress:
+		http.Error(w, "Member is already being booked into this class", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
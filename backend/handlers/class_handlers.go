@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ClassHandler struct {
@@ -53,6 +55,10 @@ func (h *ClassHandler) ClassHandler(w http.ResponseWriter, r *http.Request) {
 			h.GetClassWithMembers(w, r, id)
 			return
 		}
+		if parts[1] == "cancel" && r.Method == "POST" {
+			h.CancelClass(w, r, id)
+			return
+		}
 	}
 
 	// Handle basic CRUD
@@ -68,12 +74,44 @@ func (h *ClassHandler) ClassHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetClasses returns classes, optionally filtered by series_id and by date
+// with start_date and end_date (YYYY-MM-DD, inclusive)
 func (h *ClassHandler) GetClasses(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if seriesID := r.URL.Query().Get("series_id"); seriesID != "" {
+		objID, err := primitive.ObjectIDFromHex(seriesID)
+		if err != nil {
+			http.Error(w, "Invalid series ID", http.StatusBadRequest)
+			return
+		}
+		filter["series_id"] = objID
+	}
+	dates := bson.M{}
+	if value := r.URL.Query().Get("start_date"); value != "" {
+		startDate, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid start_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		dates["$gte"] = startDate
+	}
+	if value := r.URL.Query().Get("end_date"); value != "" {
+		endDate, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid end_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		dates["$lte"] = endDate
+	}
+	if len(dates) > 0 {
+		filter["date"] = dates
+	}
+
 	collection := h.db.Collection("classes")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -89,6 +127,10 @@ func (h *ClassHandler) GetClasses(w http.ResponseWriter, r *http.Request) {
 	if classes == nil {
 		classes = []models.Class{}
 	}
+	if err := attachRosters(ctx, h.db, classes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(classes)
@@ -111,6 +153,10 @@ func (h *ClassHandler) GetClass(w http.ResponseWriter, r *http.Request, idStr st
 		http.Error(w, "Class not found", http.StatusNotFound)
 		return
 	}
+	if err := attachRoster(ctx, h.db, &class); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(class)
@@ -133,6 +179,10 @@ func (h *ClassHandler) GetClassWithMembers(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Class not found", http.StatusNotFound)
 		return
 	}
+	if err := attachRoster(ctx, h.db, &class); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Fetch enrolled members details
 	memberCollection := h.db.Collection("members")
@@ -174,17 +224,18 @@ func (h *ClassHandler) GetClassWithMembers(w http.ResponseWriter, r *http.Reques
 
 func (h *ClassHandler) CreateClass(w http.ResponseWriter, r *http.Request) {
 	var requestData struct {
-		Name          string   `json:"name"`
-		Description   string   `json:"description"`
-		Instructor    string   `json:"instructor"`
-		Date          string   `json:"date"`
-		StartTime     string   `json:"start_time"`
-		EndTime       string   `json:"end_time"`
-		Duration      int      `json:"duration"`
-		Capacity      int      `json:"capacity"`
-		Recurring     bool     `json:"recurring"`
-		RecurringDays []string `json:"recurring_days"`
-		Status        string   `json:"status"`
+		ClubID        *primitive.ObjectID `json:"club_id"`
+		Name          string              `json:"name"`
+		Description   string              `json:"description"`
+		InstructorID  *primitive.ObjectID `json:"instructor_id"`
+		Date          string              `json:"date"`
+		StartTime     string              `json:"start_time"`
+		EndTime       string              `json:"end_time"`
+		Duration      int                 `json:"duration"`
+		Capacity      int                 `json:"capacity"`
+		Recurring     bool                `json:"recurring"`
+		RecurringDays []string            `json:"recurring_days"`
+		Status        string              `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -192,6 +243,12 @@ func (h *ClassHandler) CreateClass(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The instructor's name is filled in from their record
+	if requestData.InstructorID == nil || requestData.InstructorID.IsZero() {
+		http.Error(w, "instructor_id is required", http.StatusBadRequest)
+		return
+	}
+
 	// Parse date string (YYYY-MM-DD) to time.Time
 	classDate, err := time.Parse("2006-01-02", requestData.Date)
 	if err != nil {
@@ -200,9 +257,10 @@ func (h *ClassHandler) CreateClass(w http.ResponseWriter, r *http.Request) {
 	}
 
 	class := models.Class{
+		ClubID:        requestData.ClubID,
 		Name:          requestData.Name,
 		Description:   requestData.Description,
-		Instructor:    requestData.Instructor,
+		InstructorID:  requestData.InstructorID,
 		Date:          classDate,
 		StartTime:     requestData.StartTime,
 		EndTime:       requestData.EndTime,
@@ -213,22 +271,24 @@ func (h *ClassHandler) CreateClass(w http.ResponseWriter, r *http.Request) {
 		Status:        requestData.Status,
 	}
 
+	collection := h.db.Collection("classes")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The instructor must be free to teach at the class's club
+	instructor, err := checkInstructorSchedule(ctx, h.db, *class.InstructorID, class.ClubID, []models.Class{class})
+	if err != nil {
+		writeInstructorError(w, err)
+		return
+	}
+	class.Instructor = instructor.Name
+
 	class.CreatedAt = time.Now()
 	class.UpdatedAt = time.Now()
-	if class.EnrolledMembers == nil {
-		class.EnrolledMembers = []primitive.ObjectID{}
-	}
-	if class.WaitList == nil {
-		class.WaitList = []primitive.ObjectID{}
-	}
 	if class.Status == "" {
 		class.Status = "scheduled"
 	}
 
-	collection := h.db.Collection("classes")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	result, err := collection.InsertOne(ctx, class)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -236,11 +296,19 @@ func (h *ClassHandler) CreateClass(w http.ResponseWriter, r *http.Request) {
 	}
 
 	class.ID = result.InsertedID.(primitive.ObjectID)
+	if err := attachRoster(ctx, h.db, &class); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(class)
 }
 
+// UpdateClass edits a class. For a class in a series, scope=following also
+// applies the edit to the series' later scheduled classes and scope=all to
+// all of them; their dates stay as they are. The default, scope=this,
+// edits only this class.
 func (h *ClassHandler) UpdateClass(w http.ResponseWriter, r *http.Request, idStr string) {
 	id, err := primitive.ObjectIDFromHex(idStr)
 	if err != nil {
@@ -248,18 +316,28 @@ func (h *ClassHandler) UpdateClass(w http.ResponseWriter, r *http.Request, idStr
 		return
 	}
 
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = seriesScopeThis
+	}
+	if scope != seriesScopeThis && scope != seriesScopeFollowing && scope != seriesScopeAll {
+		http.Error(w, "scope must be this, following or all", http.StatusBadRequest)
+		return
+	}
+
 	var requestData struct {
-		Name          string   `json:"name"`
-		Description   string   `json:"description"`
-		Instructor    string   `json:"instructor"`
-		Date          string   `json:"date"`
-		StartTime     string   `json:"start_time"`
-		EndTime       string   `json:"end_time"`
-		Duration      int      `json:"duration"`
-		Capacity      int      `json:"capacity"`
-		Recurring     bool     `json:"recurring"`
-		RecurringDays []string `json:"recurring_days"`
-		Status        string   `json:"status"`
+		ClubID        *primitive.ObjectID `json:"club_id"`
+		Name          string              `json:"name"`
+		Description   string              `json:"description"`
+		InstructorID  *primitive.ObjectID `json:"instructor_id"`
+		Date          string              `json:"date"`
+		StartTime     string              `json:"start_time"`
+		EndTime       string              `json:"end_time"`
+		Duration      int                 `json:"duration"`
+		Capacity      int                 `json:"capacity"`
+		Recurring     bool                `json:"recurring"`
+		RecurringDays []string            `json:"recurring_days"`
+		Status        string              `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -275,9 +353,11 @@ func (h *ClassHandler) UpdateClass(w http.ResponseWriter, r *http.Request, idStr
 	}
 
 	class := models.Class{
+		ID:            id,
+		ClubID:        requestData.ClubID,
 		Name:          requestData.Name,
 		Description:   requestData.Description,
-		Instructor:    requestData.Instructor,
+		InstructorID:  requestData.InstructorID,
 		Date:          classDate,
 		StartTime:     requestData.StartTime,
 		EndTime:       requestData.EndTime,
@@ -294,10 +374,114 @@ func (h *ClassHandler) UpdateClass(w http.ResponseWriter, r *http.Request, idStr
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	var current models.Class
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Class not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if class.ClubID == nil {
+		class.ClubID = current.ClubID
+	}
+	// The class keeps its instructor unless another is given
+	if class.InstructorID == nil || class.InstructorID.IsZero() {
+		class.InstructorID = current.InstructorID
+		class.Instructor = current.Instructor
+	}
+
+	if scope != seriesScopeThis {
+		if current.SeriesID == nil {
+			http.Error(w, "Class is not part of a series", http.StatusBadRequest)
+			return
+		}
+
+		var from *time.Time
+		if scope == seriesScopeFollowing {
+			from = &current.Date
+		}
+		fields := bson.M{
+			"name":          class.Name,
+			"description":   class.Description,
+			"instructor_id": class.InstructorID,
+			"instructor":    class.Instructor,
+			"start_time":    class.StartTime,
+			"end_time":      class.EndTime,
+			"duration":      class.Duration,
+			"capacity":      class.Capacity,
+			"updated_at":    class.UpdatedAt,
+		}
+
+		occurrences, err := scheduledOccurrences(ctx, h.db, *current.SeriesID, from)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, occurrence := range occurrences {
+			if !occurrence.FitsCapacity(class.Capacity) {
+				http.Error(w, fmt.Sprintf("%s: the class on %s has %d places booked", models.ErrCapacityBelowBooked,
+					occurrence.Date.Format("2006-01-02"), occurrence.BookedCount), http.StatusConflict)
+				return
+			}
+		}
+
+		// The instructor must be free for every class the edit applies to
+		if class.InstructorID != nil {
+			for i := range occurrences {
+				occurrences[i].StartTime = class.StartTime
+				occurrences[i].EndTime = class.EndTime
+				occurrences[i].Duration = class.Duration
+			}
+			instructor, err := checkInstructorSchedule(ctx, h.db, *class.InstructorID, class.ClubID, occurrences)
+			if err != nil {
+				writeInstructorError(w, err)
+				return
+			}
+			fields["instructor"] = instructor.Name
+		}
+
+		_, err = updateSeriesOccurrences(ctx, h.db, *current.SeriesID, from, fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var updated models.Class
+		if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&updated); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := attachRoster(ctx, h.db, &updated); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+		return
+	}
+
+	if class.InstructorID != nil {
+		// A cancelled class takes up none of the instructor's time
+		scheduled := []models.Class{class}
+		if class.Status == "cancelled" {
+			scheduled = nil
+		}
+		instructor, err := checkInstructorSchedule(ctx, h.db, *class.InstructorID, class.ClubID, scheduled)
+		if err != nil {
+			writeInstructorError(w, err)
+			return
+		}
+		class.Instructor = instructor.Name
+	}
+
 	update := bson.M{
 		"$set": bson.M{
+			"club_id":        class.ClubID,
 			"name":           class.Name,
 			"description":    class.Description,
+			"instructor_id":  class.InstructorID,
 			"instructor":     class.Instructor,
 			"date":           class.Date,
 			"start_time":     class.StartTime,
@@ -311,18 +495,53 @@ func (h *ClassHandler) UpdateClass(w http.ResponseWriter, r *http.Request, idStr
 		},
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	// Members keep their places; a cancelled class frees them all anyway
+	filter := bson.M{"_id": id}
+	if class.Status != "cancelled" {
+		if !current.FitsCapacity(class.Capacity) {
+			http.Error(w, fmt.Sprintf("%s: %d places are booked", models.ErrCapacityBelowBooked, current.BookedCount), http.StatusConflict)
+			return
+		}
+		filter["booked_count"] = bson.M{"$not": bson.M{"$gt": class.Capacity}}
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	if result.MatchedCount == 0 {
-		http.Error(w, "Class not found", http.StatusNotFound)
+		// Either gone, or booked up past the new capacity since it was read
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case count > 0:
+			http.Error(w, models.ErrCapacityBelowBooked.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Class not found", http.StatusNotFound)
+		}
 		return
 	}
 
-	class.ID = id
+	if class.Status == "cancelled" {
+		// Members booked into a cancelled class lose their places
+		if _, err := cancelClassRosters(ctx, h.db, []primitive.ObjectID{id}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if err := promoteWaitlist(ctx, h.db, id); err != nil {
+		// Places added by raising the capacity go to the waitlist
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	class.CreatedAt = current.CreatedAt
+	class.SeriesID = current.SeriesID
+	if err := attachRoster(ctx, h.db, &class); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(class)
 }
@@ -338,6 +557,22 @@ func (h *ClassHandler) DeleteClass(w http.ResponseWriter, r *http.Request, idStr
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Members still booked in have to be told, so the class is cancelled
+	// rather than deleted under them
+	bookings := h.db.Collection("class_bookings")
+	open, err := bookings.CountDocuments(ctx, bson.M{
+		"class_id": id,
+		"status":   bson.M{"$in": []string{models.ClassBookingConfirmed, models.ClassBookingWaitlist}},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if open > 0 {
+		http.Error(w, "Class has open bookings; cancel it before deleting it", http.StatusConflict)
+		return
+	}
+
 	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -349,9 +584,60 @@ func (h *ClassHandler) DeleteClass(w http.ResponseWriter, r *http.Request, idStr
 		return
 	}
 
+	if _, err := bookings.DeleteMany(ctx, bson.M{"class_id": id}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// CancelClass cancels a single class, such as one occurrence of a series,
+// and the bookings for it. Completed classes cannot be cancelled.
+func (h *ClassHandler) CancelClass(w http.ResponseWriter, r *http.Request, idStr string) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid class ID", http.StatusBadRequest)
+		return
+	}
+
+	collection := h.db.Collection("classes")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var class models.Class
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": bson.M{"$nin": []string{"completed", "cancelled"}}},
+		bson.M{"$set": bson.M{"status": "cancelled", "updated_at": time.Now()}}, opts).Decode(&class)
+	if err == mongo.ErrNoDocuments {
+		if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&class); err != nil {
+			http.Error(w, "Class not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Class is already "+class.Status, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := cancelClassRosters(ctx, h.db, []primitive.ObjectID{id}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	class.BookedCount = 0
+	if err := attachRoster(ctx, h.db, &class); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(class)
+}
+
+// EnrollMember books a member into a class, or onto its waitlist when it is
+// full
 func (h *ClassHandler) EnrollMember(w http.ResponseWriter, r *http.Request, classIDStr string) {
 	classID, err := primitive.ObjectIDFromHex(classIDStr)
 	if err != nil {
@@ -384,46 +670,37 @@ func (h *ClassHandler) EnrollMember(w http.ResponseWriter, r *http.Request, clas
 		http.Error(w, "Class not found", http.StatusNotFound)
 		return
 	}
+	if class.Status == "cancelled" {
+		http.Error(w, "Class has been cancelled", http.StatusConflict)
+		return
+	}
 
-	// Check if member is already enrolled
-	for _, id := range class.EnrolledMembers {
-		if id == memberID {
-			http.Error(w, "Member already enrolled in this class", http.StatusBadRequest)
-			return
-		}
+	if err := requireClubAccess(ctx, h.db, memberID); err != nil {
+		writeClubAccessError(w, err)
+		return
 	}
 
-	// Check capacity
-	if len(class.EnrolledMembers) >= class.Capacity {
-		// Add to waitlist
-		update := bson.M{
-			"$addToSet": bson.M{"wait_list": memberID},
-			"$set":      bson.M{"updated_at": time.Now()},
-		}
-		_, err = collection.UpdateOne(ctx, bson.M{"_id": classID}, update)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := requireWaiver(ctx, h.db, class.ClubID, memberID); err != nil {
+		if err == errWaiverRequired {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"message": "Class is full. Member added to waitlist."})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Enroll member
-	update := bson.M{
-		"$addToSet": bson.M{"enrolled_members": memberID},
-		"$set":      bson.M{"updated_at": time.Now()},
-	}
-
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": classID}, update)
+	booking, err := bookClass(ctx, h.db, classID, memberID, "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeClassBookingError(w, err)
 		return
 	}
 
+	message, status := "Member enrolled successfully", "enrolled"
+	if booking.Status == models.ClassBookingWaitlist {
+		message, status = "Class is full. Member added to waitlist.", "waitlisted"
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Member enrolled successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "status": status, "booking": booking})
 }
 
 func (h *ClassHandler) UnenrollMember(w http.ResponseWriter, r *http.Request, classIDStr string, memberIDStr string) {
@@ -443,35 +720,20 @@ func (h *ClassHandler) UnenrollMember(w http.ResponseWriter, r *http.Request, cl
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Remove member from enrolled list
-	update := bson.M{
-		"$pull": bson.M{"enrolled_members": memberID, "wait_list": memberID},
-		"$set":  bson.M{"updated_at": time.Now()},
-	}
-
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": classID}, update)
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": classID})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	if result.MatchedCount == 0 {
+	if count == 0 {
 		http.Error(w, "Class not found", http.StatusNotFound)
 		return
 	}
 
-	// Check if we can move someone from waitlist
-	var class models.Class
-	err = collection.FindOne(ctx, bson.M{"_id": classID}).Decode(&class)
-	if err == nil && len(class.WaitList) > 0 && len(class.EnrolledMembers) < class.Capacity {
-		// Move first person from waitlist to enrolled
-		firstWaitlistMember := class.WaitList[0]
-		update := bson.M{
-			"$pull":     bson.M{"wait_list": firstWaitlistMember},
-			"$addToSet": bson.M{"enrolled_members": firstWaitlistMember},
-			"$set":      bson.M{"updated_at": time.Now()},
-		}
-		collection.UpdateOne(ctx, bson.M{"_id": classID}, update)
+	// Cancel the member's booking; its place goes to the first member waiting
+	if _, err := cancelClassBooking(ctx, h.db, bson.M{"class_id": classID, "member_id": memberID}); err != nil && err != mongo.ErrNoDocuments {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
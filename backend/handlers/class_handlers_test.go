@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,19 +19,30 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// setupTestDB creates a test database connection
+// setupTestDB creates a test database connection. The tests that need one
+// skip when MongoDB is not running locally; with MONGODB_TEST_URI set they
+// run against that server and fail if it cannot be reached.
 func setupTestDB(t *testing.T) *mongo.Database {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	uri, required := os.LookupEnv("MONGODB_TEST_URI")
+	if !required {
+		uri = "mongodb://localhost:27017"
+	}
+	unavailable := t.Skipf
+	if required {
+		unavailable = t.Fatalf
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
-		t.Skipf("Skipping test: MongoDB not available: %v", err)
+		unavailable("MongoDB not available: %v", err)
 		return nil
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		t.Skipf("Skipping test: MongoDB not responding: %v", err)
+		unavailable("MongoDB not responding: %v", err)
 		return nil
 	}
 
@@ -152,18 +165,19 @@ func TestCreateClass(t *testing.T) {
 	}
 
 	handler := NewClassHandler(db)
+	instructor := insertTestInstructor(t, db, "John Doe")
 
 	newClass := map[string]interface{}{
-		"name":        "New Yoga Class",
-		"description": "A relaxing yoga session",
-		"instructor":  "John Doe",
-		"date":        time.Now().Format("2006-01-02"),
-		"start_time":  "09:00",
-		"end_time":    "10:00",
-		"duration":    60,
-		"capacity":    20,
-		"status":      "scheduled",
-		"recurring":   false,
+		"name":          "New Yoga Class",
+		"description":   "A relaxing yoga session",
+		"instructor_id": instructor.ID.Hex(),
+		"date":          time.Now().Format("2006-01-02"),
+		"start_time":    "09:00",
+		"end_time":      "10:00",
+		"duration":      60,
+		"capacity":      20,
+		"status":        "scheduled",
+		"recurring":     false,
 	}
 
 	body, _ := json.Marshal(newClass)
@@ -186,6 +200,10 @@ func TestCreateClass(t *testing.T) {
 		t.Errorf("Expected class name 'New Yoga Class', got '%s'", created.Name)
 	}
 
+	if created.Instructor != "John Doe" {
+		t.Errorf("Expected instructor 'John Doe', got '%s'", created.Instructor)
+	}
+
 	if created.ID.IsZero() {
 		t.Error("Expected non-zero ID")
 	}
@@ -361,6 +379,9 @@ func TestEnrollMember(t *testing.T) {
 	// Verify enrollment
 	var updated models.Class
 	classCollection.FindOne(ctx, bson.M{"_id": testClass.ID}).Decode(&updated)
+	if err := attachRoster(ctx, db, &updated); err != nil {
+		t.Fatalf("Failed to load roster: %v", err)
+	}
 
 	if len(updated.EnrolledMembers) != 1 {
 		t.Errorf("Expected 1 enrolled member, got %d", len(updated.EnrolledMembers))
@@ -397,11 +418,22 @@ func TestUnenrollMember(t *testing.T) {
 		Recurring:       false,
 		EnrolledMembers: []primitive.ObjectID{memberID},
 		WaitList:        []primitive.ObjectID{},
+		BookedCount:     1,
 	}
 	_, err := classCollection.InsertOne(ctx, testClass)
 	if err != nil {
 		t.Fatalf("Failed to insert test class: %v", err)
 	}
+	_, err = db.Collection("class_bookings").InsertOne(ctx, models.ClassBooking{
+		ID:       primitive.NewObjectID(),
+		ClassID:  &testClass.ID,
+		MemberID: &memberID,
+		Status:   models.ClassBookingConfirmed,
+		BookedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert test booking: %v", err)
+	}
 
 	handler := NewClassHandler(db)
 	req := httptest.NewRequest(http.MethodDelete, "/api/classes/"+testClass.ID.Hex()+"/unenroll/"+memberID.Hex(), nil)
@@ -416,8 +448,468 @@ func TestUnenrollMember(t *testing.T) {
 	// Verify unenrollment
 	var updated models.Class
 	classCollection.FindOne(ctx, bson.M{"_id": testClass.ID}).Decode(&updated)
+	if err := attachRoster(ctx, db, &updated); err != nil {
+		t.Fatalf("Failed to load roster: %v", err)
+	}
 
 	if len(updated.EnrolledMembers) != 0 {
 		t.Errorf("Expected 0 enrolled members, got %d", len(updated.EnrolledMembers))
 	}
 }
+
+// insertEnrollmentClass inserts a scheduled class for the enrollment tests,
+// with confirmed bookings for the enrolled members and waitlisted ones for
+// the waitlist, booked in order
+func insertEnrollmentClass(t *testing.T, db *mongo.Database, capacity int, enrolled, waitList []primitive.ObjectID) primitive.ObjectID {
+	ctx := context.Background()
+	if err := EnsureClassBookingIndexes(ctx, db); err != nil {
+		t.Fatalf("Failed to create class booking indexes: %v", err)
+	}
+
+	class := models.Class{
+		ID:          primitive.NewObjectID(),
+		Name:        "Concurrency Test",
+		Date:        time.Now(),
+		StartTime:   "09:00",
+		EndTime:     "10:00",
+		Duration:    60,
+		Capacity:    capacity,
+		Status:      "scheduled",
+		BookedCount: len(enrolled),
+	}
+	if _, err := db.Collection("classes").InsertOne(ctx, class); err != nil {
+		t.Fatalf("Failed to insert test class: %v", err)
+	}
+
+	bookedAt := time.Now().Add(-time.Hour)
+	for i, memberID := range append(append([]primitive.ObjectID{}, enrolled...), waitList...) {
+		status := models.ClassBookingConfirmed
+		if i >= len(enrolled) {
+			status = models.ClassBookingWaitlist
+		}
+		memberID := memberID
+		booking := models.ClassBooking{
+			ID:       primitive.NewObjectID(),
+			ClassID:  &class.ID,
+			MemberID: &memberID,
+			Status:   status,
+			BookedAt: bookedAt.Add(time.Duration(i) * time.Second),
+		}
+		if _, err := db.Collection("class_bookings").InsertOne(ctx, booking); err != nil {
+			t.Fatalf("Failed to insert test booking: %v", err)
+		}
+	}
+	return class.ID
+}
+
+// loadEnrollmentClass loads a class with its roster
+func loadEnrollmentClass(t *testing.T, db *mongo.Database, classID primitive.ObjectID) models.Class {
+	ctx := context.Background()
+	var class models.Class
+	if err := db.Collection("classes").FindOne(ctx, bson.M{"_id": classID}).Decode(&class); err != nil {
+		t.Fatalf("Failed to load class: %v", err)
+	}
+	if err := attachRoster(ctx, db, &class); err != nil {
+		t.Fatalf("Failed to load roster: %v", err)
+	}
+	return class
+}
+
+func TestEnrollConcurrentNeverExceedsCapacity(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	classID := insertEnrollmentClass(t, db, 5, nil, nil)
+
+	members := make([]primitive.ObjectID, 40)
+	for i := range members {
+		members[i] = primitive.NewObjectID()
+	}
+
+	var wg sync.WaitGroup
+	for _, memberID := range members {
+		wg.Add(1)
+		go func(memberID primitive.ObjectID) {
+			defer wg.Done()
+			if _, err := bookClass(ctx, db, classID, memberID, ""); err != nil {
+				t.Errorf("Failed to enroll %s: %v", memberID.Hex(), err)
+			}
+		}(memberID)
+	}
+	wg.Wait()
+
+	class := loadEnrollmentClass(t, db, classID)
+	if len(class.EnrolledMembers) != 5 {
+		t.Errorf("Expected 5 enrolled members, got %d", len(class.EnrolledMembers))
+	}
+	if len(class.WaitList) != 35 {
+		t.Errorf("Expected 35 members on the waitlist, got %d", len(class.WaitList))
+	}
+	if class.BookedCount != 5 {
+		t.Errorf("Expected 5 places taken, got %d", class.BookedCount)
+	}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range append(class.EnrolledMembers, class.WaitList...) {
+		if seen[id] {
+			t.Errorf("Member %s is listed twice", id.Hex())
+		}
+		seen[id] = true
+	}
+}
+
+func TestEnrollConcurrentSameMember(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	classID := insertEnrollmentClass(t, db, 5, nil, nil)
+	memberID := primitive.NewObjectID()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	enrolled := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			booking, err := bookClass(ctx, db, classID, memberID, "")
+			if err != nil && err != errAlreadyEnrolled && err != errAlreadyWaitlisted {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if err == nil && booking.Status == models.ClassBookingConfirmed {
+				mu.Lock()
+				enrolled++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if enrolled != 1 {
+		t.Errorf("Expected one request to enroll the member, got %d", enrolled)
+	}
+	class := loadEnrollmentClass(t, db, classID)
+	if len(class.EnrolledMembers) != 1 || len(class.WaitList) != 0 {
+		t.Errorf("Expected the member enrolled once, got %v enrolled and %v waitlisted", class.EnrolledMembers, class.WaitList)
+	}
+}
+
+func TestUnenrollConcurrentPromotesWaitlistInOrder(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	enrolled := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	waitList := make([]primitive.ObjectID, 5)
+	for i := range waitList {
+		waitList[i] = primitive.NewObjectID()
+	}
+	classID := insertEnrollmentClass(t, db, 3, enrolled, waitList)
+
+	handler := NewClassHandler(db)
+	var wg sync.WaitGroup
+	for _, memberID := range enrolled {
+		wg.Add(1)
+		go func(memberID primitive.ObjectID) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodDelete, "/api/classes/"+classID.Hex()+"/unenroll/"+memberID.Hex(), nil)
+			w := httptest.NewRecorder()
+			handler.UnenrollMember(w, req, classID.Hex(), memberID.Hex())
+			if w.Code != http.StatusNoContent {
+				t.Errorf("Expected status 204, got %d", w.Code)
+			}
+		}(memberID)
+	}
+	wg.Wait()
+
+	class := loadEnrollmentClass(t, db, classID)
+	if len(class.EnrolledMembers) != 3 {
+		t.Fatalf("Expected 3 enrolled members, got %d", len(class.EnrolledMembers))
+	}
+	for i, id := range class.EnrolledMembers {
+		if id != waitList[i] {
+			t.Errorf("Expected waitlisted member %d to be enrolled at position %d", i, i)
+		}
+	}
+	if len(class.WaitList) != 2 || class.WaitList[0] != waitList[3] || class.WaitList[1] != waitList[4] {
+		t.Errorf("Expected the last two waitlisted members to still be waiting, got %v", class.WaitList)
+	}
+}
+
+func TestCancelClassBookingFreesPlace(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	seated, waiting := primitive.NewObjectID(), primitive.NewObjectID()
+	classID := insertEnrollmentClass(t, db, 1, []primitive.ObjectID{seated}, []primitive.ObjectID{waiting})
+
+	var booking models.ClassBooking
+	if err := db.Collection("class_bookings").FindOne(ctx, bson.M{"class_id": classID, "member_id": seated}).Decode(&booking); err != nil {
+		t.Fatalf("Failed to load booking: %v", err)
+	}
+
+	handler := &ClassBookingHandler{Collection: db.Collection("class_bookings")}
+	req := httptest.NewRequest(http.MethodPost, "/api/class-bookings/"+booking.ID.Hex()+"/cancel", nil)
+	req.SetPathValue("id", booking.ID.Hex())
+	w := httptest.NewRecorder()
+	handler.Cancel(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	class := loadEnrollmentClass(t, db, classID)
+	if len(class.EnrolledMembers) != 1 || class.EnrolledMembers[0] != waiting {
+		t.Errorf("Expected the waitlisted member to take the place, got %v", class.EnrolledMembers)
+	}
+	if class.BookedCount != 1 {
+		t.Errorf("Expected 1 place taken, got %d", class.BookedCount)
+	}
+
+	// Booking again puts the member back on the waitlist
+	rebooked, err := bookClass(ctx, db, classID, seated, "")
+	if err != nil {
+		t.Fatalf("Failed to book again: %v", err)
+	}
+	if rebooked.Status != models.ClassBookingWaitlist {
+		t.Errorf("Expected the new booking to be waitlisted, got %s", rebooked.Status)
+	}
+}
+
+func TestCreateClassChecksInstructorSchedule(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	clubID, otherClubID := primitive.NewObjectID(), primitive.NewObjectID()
+	instructor := insertTestInstructor(t, db, "Jane Doe", clubID)
+
+	handler := NewClassHandler(db)
+	create := func(club primitive.ObjectID, startTime, endTime string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"club_id":       club.Hex(),
+			"name":          "Spin",
+			"instructor_id": instructor.ID.Hex(),
+			"date":          "2024-06-03",
+			"start_time":    startTime,
+			"end_time":      endTime,
+			"capacity":      20,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.CreateClass(w, req)
+		return w
+	}
+
+	w := create(clubID, "09:00", "10:00")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var created models.Class
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Instructor != "Jane Doe" {
+		t.Errorf("Expected the instructor's name on the class, got %q", created.Instructor)
+	}
+
+	if w := create(clubID, "09:30", "10:30"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an overlapping class, got %d", w.Code)
+	}
+	if w := create(clubID, "10:00", "11:00"); w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for a class right after, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w := create(otherClubID, "12:00", "13:00"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a club the instructor is not assigned to, got %d", w.Code)
+	}
+
+	// An instructor named without an ID is checked against nothing
+	body, _ := json.Marshal(map[string]interface{}{
+		"club_id":    clubID.Hex(),
+		"name":       "Spin",
+		"instructor": "Jane Doe",
+		"date":       "2024-06-03",
+		"start_time": "09:00",
+		"end_time":   "10:00",
+		"capacity":   20,
+	})
+	w = httptest.NewRecorder()
+	handler.CreateClass(w, httptest.NewRequest(http.MethodPost, "/api/classes", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without instructor_id, got %d", w.Code)
+	}
+}
+
+// insertTestInstructor adds an active instructor assigned to clubs
+func insertTestInstructor(t *testing.T, db *mongo.Database, name string, clubIDs ...primitive.ObjectID) models.Instructor {
+	instructor := models.Instructor{
+		ID:      primitive.NewObjectID(),
+		ClubIDs: clubIDs,
+		Name:    name,
+		Active:  true,
+	}
+	if _, err := db.Collection("instructors").InsertOne(context.Background(), instructor); err != nil {
+		t.Fatalf("Failed to insert instructor: %v", err)
+	}
+	return instructor
+}
+
+func TestCancellingClassEmptiesRoster(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	handler := NewClassHandler(db)
+	assertRosterCancelled := func(name string, classID primitive.ObjectID) {
+		t.Helper()
+		class := loadEnrollmentClass(t, db, classID)
+		if len(class.EnrolledMembers) != 0 || len(class.WaitList) != 0 {
+			t.Errorf("%s: expected an empty roster, got %v enrolled and %v waiting", name, class.EnrolledMembers, class.WaitList)
+		}
+		if class.BookedCount != 0 {
+			t.Errorf("%s: expected no places taken, got %d", name, class.BookedCount)
+		}
+		open, err := db.Collection("class_bookings").CountDocuments(ctx, bson.M{
+			"class_id":     classID,
+			"cancelled_at": bson.M{"$exists": false},
+		})
+		if err != nil {
+			t.Fatalf("Failed to count bookings: %v", err)
+		}
+		if open != 0 {
+			t.Errorf("%s: expected every booking cancelled, %d are not", name, open)
+		}
+	}
+
+	// Cancelling the class
+	classID := insertEnrollmentClass(t, db, 1, []primitive.ObjectID{primitive.NewObjectID()}, []primitive.ObjectID{primitive.NewObjectID()})
+	req := httptest.NewRequest(http.MethodPost, "/api/classes/"+classID.Hex()+"/cancel", nil)
+	w := httptest.NewRecorder()
+	handler.CancelClass(w, req, classID.Hex())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	assertRosterCancelled("CancelClass", classID)
+
+	// Updating its status to cancelled
+	classID = insertEnrollmentClass(t, db, 1, []primitive.ObjectID{primitive.NewObjectID()}, []primitive.ObjectID{primitive.NewObjectID()})
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":       "Concurrency Test",
+		"date":       time.Now().Format("2006-01-02"),
+		"start_time": "09:00",
+		"end_time":   "10:00",
+		"duration":   60,
+		"capacity":   1,
+		"status":     "cancelled",
+	})
+	req = httptest.NewRequest(http.MethodPut, "/api/classes/"+classID.Hex(), bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.UpdateClass(w, req, classID.Hex())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	assertRosterCancelled("UpdateClass", classID)
+
+	// Cancelling the series it belongs to
+	seriesID := primitive.NewObjectID()
+	if _, err := db.Collection("class_series").InsertOne(ctx, models.ClassSeries{ID: seriesID, Status: models.ClassSeriesActive}); err != nil {
+		t.Fatalf("Failed to insert series: %v", err)
+	}
+	classID = insertEnrollmentClass(t, db, 1, []primitive.ObjectID{primitive.NewObjectID()}, []primitive.ObjectID{primitive.NewObjectID()})
+	if _, err := db.Collection("classes").UpdateOne(ctx, bson.M{"_id": classID}, bson.M{"$set": bson.M{"series_id": seriesID}}); err != nil {
+		t.Fatalf("Failed to add class to series: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/class-series/"+seriesID.Hex()+"/cancel", nil)
+	req.SetPathValue("id", seriesID.Hex())
+	w = httptest.NewRecorder()
+	handler.CancelSeries(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	assertRosterCancelled("CancelSeries", classID)
+
+	// A series can only be cancelled once
+	w = httptest.NewRecorder()
+	handler.CancelSeries(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 cancelling a cancelled series, got %d", w.Code)
+	}
+}
+
+func TestDeleteClassWithOpenBookings(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	handler := NewClassHandler(db)
+	classID := insertEnrollmentClass(t, db, 2, []primitive.ObjectID{primitive.NewObjectID()}, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/classes/"+classID.Hex(), nil)
+	w := httptest.NewRecorder()
+	handler.DeleteClass(w, req, classID.Hex())
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 deleting a booked class, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.CancelClass(w, httptest.NewRequest(http.MethodPost, "/api/classes/"+classID.Hex()+"/cancel", nil), classID.Hex())
+	w = httptest.NewRecorder()
+	handler.DeleteClass(w, req, classID.Hex())
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	remaining, err := db.Collection("class_bookings").CountDocuments(ctx, bson.M{"class_id": classID})
+	if err != nil {
+		t.Fatalf("Failed to count bookings: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected the class's bookings to be deleted, %d remain", remaining)
+	}
+}
+
+func TestUpdateClassCapacityBelowBooked(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	classID := insertEnrollmentClass(t, db, 3, []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}, nil)
+	handler := NewClassHandler(db)
+	update := func(capacity int) int {
+		body, _ := json.Marshal(map[string]interface{}{
+			"name":       "Concurrency Test",
+			"date":       time.Now().Format("2006-01-02"),
+			"start_time": "09:00",
+			"end_time":   "10:00",
+			"duration":   60,
+			"capacity":   capacity,
+			"status":     "scheduled",
+		})
+		req := httptest.NewRequest(http.MethodPut, "/api/classes/"+classID.Hex(), bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.UpdateClass(w, req, classID.Hex())
+		return w.Code
+	}
+
+	if code := update(1); code != http.StatusConflict {
+		t.Errorf("Expected status 409 lowering capacity below 2 booked places, got %d", code)
+	}
+	if class := loadEnrollmentClass(t, db, classID); class.Capacity != 3 || len(class.EnrolledMembers) != 2 {
+		t.Errorf("Expected capacity 3 with 2 enrolled, got %d with %d", class.Capacity, len(class.EnrolledMembers))
+	}
+	if code := update(2); code != http.StatusOK {
+		t.Errorf("Expected status 200 lowering capacity to the booked places, got %d", code)
+	}
+}
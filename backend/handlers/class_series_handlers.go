@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Scopes of an edit to a class in a series
+const (
+	seriesScopeThis      = "this"
+	seriesScopeFollowing = "following"
+	seriesScopeAll       = "all"
+)
+
+// GetSeries returns class series, optionally filtered by club_id and status
+func (h *ClassHandler) GetSeries(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = objID
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := h.db.Collection("class_series").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var series []models.ClassSeries
+	if err := cursor.All(ctx, &series); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if series == nil {
+		series = []models.ClassSeries{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// GetSeriesByID returns a class series with its occurrences, by date
+func (h *ClassHandler) GetSeriesByID(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var series models.ClassSeries
+	if err := h.db.Collection("class_series").FindOne(ctx, bson.M{"_id": id}).Decode(&series); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Class series not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	occurrences, err := seriesOccurrences(ctx, h.db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"series":      series,
+		"occurrences": occurrences,
+	})
+}
+
+// CreateSeries defines a repeating class and creates all of its occurrences
+func (h *ClassHandler) CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		ClubID       *primitive.ObjectID `json:"club_id"`
+		Name         string              `json:"name"`
+		Description  string              `json:"description"`
+		InstructorID *primitive.ObjectID `json:"instructor_id"`
+		StartDate    string              `json:"start_date"`
+		RRule        string              `json:"rrule"`
+		StartTime    string              `json:"start_time"`
+		EndTime      string              `json:"end_time"`
+		Duration     int                 `json:"duration"`
+		Capacity     int                 `json:"capacity"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(requestData.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	// The instructor's name is filled in from their record
+	if requestData.InstructorID == nil || requestData.InstructorID.IsZero() {
+		http.Error(w, "instructor_id is required", http.StatusBadRequest)
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", requestData.StartDate)
+	if err != nil {
+		http.Error(w, "Invalid start_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := models.ParseRecurrenceRule(requestData.RRule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dates, err := rule.Dates(startDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(dates) == 0 {
+		http.Error(w, "The rule has no dates on or after start_date", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	series := models.ClassSeries{
+		ID:           primitive.NewObjectID(),
+		ClubID:       requestData.ClubID,
+		Name:         strings.TrimSpace(requestData.Name),
+		Description:  requestData.Description,
+		InstructorID: requestData.InstructorID,
+		StartDate:    startDate,
+		RRule:        strings.ToUpper(strings.TrimSpace(requestData.RRule)),
+		StartTime:    requestData.StartTime,
+		EndTime:      requestData.EndTime,
+		Duration:     requestData.Duration,
+		Capacity:     requestData.Capacity,
+		Status:       models.ClassSeriesActive,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	days := rule.WeekdayNames(startDate)
+	occurrences := make([]models.Class, 0, len(dates))
+	documents := make([]interface{}, 0, len(dates))
+	for _, date := range dates {
+		class := series.Occurrence(date, days)
+		class.ID = primitive.NewObjectID()
+		class.CreatedAt = now
+		class.UpdatedAt = now
+		occurrences = append(occurrences, class)
+		documents = append(documents, class)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The instructor must be free for every class in the series
+	instructor, err := checkInstructorSchedule(ctx, h.db, *series.InstructorID, series.ClubID, occurrences)
+	if err != nil {
+		writeInstructorError(w, err)
+		return
+	}
+	series.Instructor = instructor.Name
+	for i := range occurrences {
+		occurrences[i].Instructor = instructor.Name
+		documents[i] = occurrences[i]
+	}
+
+	if _, err := h.db.Collection("class_series").InsertOne(ctx, series); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Collection("classes").InsertMany(ctx, documents); err != nil {
+		// Don't leave part of a series behind
+		h.db.Collection("classes").DeleteMany(ctx, bson.M{"series_id": series.ID})
+		h.db.Collection("class_series").DeleteOne(ctx, bson.M{"_id": series.ID})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := attachRosters(ctx, h.db, occurrences); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"series":      series,
+		"occurrences": occurrences,
+	})
+}
+
+// CancelSeries ends an active class series, cancelling its scheduled
+// occurrences from today on and their bookings. Earlier classes, and later
+// ones already under way or completed, are left as they are and counted as
+// skipped. Cancelling a series that is not active is a 409.
+func (h *ClassHandler) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var series models.ClassSeries
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("class_series").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.ClassSeriesActive},
+		bson.M{"$set": bson.M{"status": models.ClassSeriesCancelled, "updated_at": now}}, opts).Decode(&series)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := h.db.Collection("class_series").CountDocuments(ctx, bson.M{"_id": id})
+		switch {
+		case countErr != nil:
+			http.Error(w, countErr.Error(), http.StatusInternalServerError)
+		case count > 0:
+			http.Error(w, "Class series is not active", http.StatusConflict)
+		default:
+			http.Error(w, "Class series not found", http.StatusNotFound)
+		}
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	classes := h.db.Collection("classes")
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	upcoming := bson.M{"series_id": id, "status": "scheduled", "date": bson.M{"$gte": today}}
+	scheduled, err := classes.Distinct(ctx, "_id", upcoming)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	upcoming["_id"] = bson.M{"$in": scheduled}
+	if _, err := classes.UpdateMany(ctx, upcoming,
+		bson.M{"$set": bson.M{"status": "cancelled", "updated_at": now}}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only cancelled classes lose their bookings; one that started in the
+	// meantime keeps them
+	ids, err := classes.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": scheduled}, "status": "cancelled"})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	classIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, value := range ids {
+		if classID, ok := value.(primitive.ObjectID); ok {
+			classIDs = append(classIDs, classID)
+		}
+	}
+	if _, err := cancelClassRosters(ctx, h.db, classIDs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	skipped, err := classes.CountDocuments(ctx, bson.M{
+		"series_id": id,
+		"status":    bson.M{"$ne": "cancelled"},
+		"date":      bson.M{"$gte": today},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"series":    series,
+		"cancelled": len(classIDs),
+		"skipped":   skipped,
+	})
+}
+
+// updateSeriesOccurrences applies an edit to the scheduled classes of a
+// series: those on or after from, or all of them when from is nil. Each
+// class keeps its own date. Editing all of them also changes the series,
+// so the edit shows on the series itself.
+func updateSeriesOccurrences(ctx context.Context, db *mongo.Database, seriesID primitive.ObjectID, from *time.Time, fields bson.M) (int64, error) {
+	filter := scheduledOccurrencesFilter(seriesID, from)
+	// Classes booked past a new capacity since they were checked keep theirs
+	if capacity, ok := fields["capacity"].(int); ok {
+		filter["booked_count"] = bson.M{"$not": bson.M{"$gt": capacity}}
+	}
+	result, err := db.Collection("classes").UpdateMany(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return 0, err
+	}
+
+	// Places added by raising the capacity go to each class's waitlist
+	ids, err := db.Collection("classes").Distinct(ctx, "_id", filter)
+	if err != nil {
+		return result.ModifiedCount, err
+	}
+	for _, id := range ids {
+		if classID, ok := id.(primitive.ObjectID); ok {
+			if err := promoteWaitlist(ctx, db, classID); err != nil {
+				return result.ModifiedCount, err
+			}
+		}
+	}
+	if from == nil {
+		if _, err := db.Collection("class_series").UpdateOne(ctx, bson.M{"_id": seriesID}, bson.M{"$set": fields}); err != nil {
+			return result.ModifiedCount, err
+		}
+	}
+	return result.ModifiedCount, nil
+}
+
+// scheduledOccurrences returns the scheduled classes of a series on or
+// after from, or all of them when from is nil
+func scheduledOccurrences(ctx context.Context, db *mongo.Database, seriesID primitive.ObjectID, from *time.Time) ([]models.Class, error) {
+	cursor, err := db.Collection("classes").Find(ctx, scheduledOccurrencesFilter(seriesID, from))
+	if err != nil {
+		return nil, err
+	}
+	var classes []models.Class
+	if err := cursor.All(ctx, &classes); err != nil {
+		return nil, err
+	}
+	return classes, nil
+}
+
+func scheduledOccurrencesFilter(seriesID primitive.ObjectID, from *time.Time) bson.M {
+	filter := bson.M{"series_id": seriesID, "status": "scheduled"}
+	if from != nil {
+		filter["date"] = bson.M{"$gte": *from}
+	}
+	return filter
+}
+
+// seriesOccurrences returns the classes of a series by date
+func seriesOccurrences(ctx context.Context, db *mongo.Database, seriesID primitive.ObjectID) ([]models.Class, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := db.Collection("classes").Find(ctx, bson.M{"series_id": seriesID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var classes []models.Class
+	if err := cursor.All(ctx, &classes); err != nil {
+		return nil, err
+	}
+	if classes == nil {
+		classes = []models.Class{}
+	}
+	if err := attachRosters(ctx, db, classes); err != nil {
+		return nil, err
+	}
+	return classes, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClassSeries(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	handler := NewClassHandler(db)
+	ctx := context.Background()
+	instructor := insertTestInstructor(t, db, "Jane Doe")
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":          "Morning Yoga",
+		"instructor_id": instructor.ID.Hex(),
+		"start_date":    "2030-06-03",
+		"rrule":         "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+		"start_time":    "09:00",
+		"end_time":      "10:00",
+		"duration":      60,
+		"capacity":      20,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/class-series", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.CreateSeries(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Series      models.ClassSeries `json:"series"`
+		Occurrences []models.Class     `json:"occurrences"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	if len(created.Occurrences) != 4 {
+		t.Fatalf("Expected 4 occurrences, got %d", len(created.Occurrences))
+	}
+
+	// Rename the third class and the ones after it
+	third := created.Occurrences[2]
+	body, _ = json.Marshal(map[string]interface{}{
+		"name":       "Power Yoga",
+		"date":       third.Date.Format("2006-01-02"),
+		"start_time": "09:00",
+		"end_time":   "10:00",
+		"duration":   60,
+		"capacity":   15,
+	})
+	req = httptest.NewRequest(http.MethodPut, "/api/classes/"+third.ID.Hex()+"?scope=following", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.UpdateClass(w, req, third.ID.Hex())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	occurrences, err := seriesOccurrences(ctx, db, created.Series.ID)
+	if err != nil {
+		t.Fatalf("Failed to load occurrences: %v", err)
+	}
+	for i, class := range occurrences {
+		want := "Morning Yoga"
+		if i >= 2 {
+			want = "Power Yoga"
+		}
+		if class.Name != want {
+			t.Errorf("Occurrence %d: expected name %q, got %q", i+1, want, class.Name)
+		}
+		if !class.Date.Equal(created.Occurrences[i].Date) {
+			t.Errorf("Occurrence %d: date moved from %v to %v", i+1, created.Occurrences[i].Date, class.Date)
+		}
+	}
+
+	// Cancel the second class only; it can no longer be enrolled in
+	second := occurrences[1]
+	req = httptest.NewRequest(http.MethodPost, "/api/classes/"+second.ID.Hex()+"/cancel", nil)
+	w = httptest.NewRecorder()
+	handler.CancelClass(w, req, second.ID.Hex())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body, _ = json.Marshal(map[string]string{"member_id": primitive.NewObjectID().Hex()})
+	req = httptest.NewRequest(http.MethodPost, "/api/classes/"+second.ID.Hex()+"/enroll", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.EnrollMember(w, req, second.ID.Hex())
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 enrolling in a cancelled class, got %d", w.Code)
+	}
+
+	occurrences, _ = seriesOccurrences(ctx, db, created.Series.ID)
+	for i, class := range occurrences {
+		want := "scheduled"
+		if i == 1 {
+			want = "cancelled"
+		}
+		if class.Status != want {
+			t.Errorf("Occurrence %d: expected status %q, got %q", i+1, want, class.Status)
+		}
+	}
+}
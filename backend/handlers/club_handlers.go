@@ -159,15 +159,16 @@ func (h *ClubHandler) UpdateClub(w http.ResponseWriter, r *http.Request) {
 
 	update := bson.M{
 		"$set": bson.M{
-			"name":       club.Name,
-			"address":    club.Address,
-			"city":       club.City,
-			"state":      club.State,
-			"zip_code":   club.ZipCode,
-			"phone":      club.Phone,
-			"email":      club.Email,
-			"active":     club.Active,
-			"updated_at": club.UpdatedAt,
+			"name":           club.Name,
+			"address":        club.Address,
+			"city":           club.City,
+			"state":          club.State,
+			"zip_code":       club.ZipCode,
+			"phone":          club.Phone,
+			"email":          club.Email,
+			"active":         club.Active,
+			"require_waiver": club.RequireWaiver,
+			"updated_at":     club.UpdatedAt,
 		},
 	}
 
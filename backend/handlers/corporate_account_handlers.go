@@ -0,0 +1,769 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errMemberAlreadySponsored = errors.New("member is already sponsored by a company")
+	errSponsorCapReached      = errors.New("the company has reached its cap on sponsored members")
+	errCorporateAccountClosed = errors.New("the corporate account is inactive")
+)
+
+// CorporateAccountHandler manages companies paying for their employees'
+// memberships and bills them monthly
+type CorporateAccountHandler struct {
+	db *mongo.Database
+}
+
+func NewCorporateAccountHandler(db *mongo.Database) *CorporateAccountHandler {
+	return &CorporateAccountHandler{db: db}
+}
+
+// GetCorporateAccounts returns corporate accounts by name, optionally filtered by status
+func (h *CorporateAccountHandler) GetCorporateAccounts(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := h.db.Collection("corporate_accounts").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []models.CorporateAccount
+	if err := cursor.All(ctx, &accounts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if accounts == nil {
+		accounts = []models.CorporateAccount{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+// GetCorporateAccount returns a single corporate account
+func (h *CorporateAccountHandler) GetCorporateAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid corporate account ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var account models.CorporateAccount
+	if err := h.db.Collection("corporate_accounts").FindOne(ctx, bson.M{"_id": id}).Decode(&account); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Corporate account not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// CreateCorporateAccount adds a company with its contract terms
+func (h *CorporateAccountHandler) CreateCorporateAccount(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage corporate accounts", http.StatusForbidden)
+		return
+	}
+
+	var account models.CorporateAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCorporateAccount(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	account.ID = primitive.NilObjectID
+	account.SponsoredCount = 0
+	account.Status = models.CorporateAccountActive
+	account.CreatedAt = now
+	account.UpdatedAt = now
+
+	result, err := h.db.Collection("corporate_accounts").InsertOne(ctx, account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account.ID = result.InsertedID.(primitive.ObjectID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// UpdateCorporateAccount changes a company's details and contract terms.
+// New terms apply from the next monthly invoice. An account can only be
+// made inactive once its employees have been removed.
+func (h *CorporateAccountHandler) UpdateCorporateAccount(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage corporate accounts", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid corporate account ID", http.StatusBadRequest)
+		return
+	}
+
+	var account models.CorporateAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCorporateAccount(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if account.Status != models.CorporateAccountActive && account.Status != models.CorporateAccountInactive {
+		http.Error(w, "status must be active or inactive", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	if account.Status == models.CorporateAccountInactive {
+		filter["sponsored_count"] = 0
+	} else if account.MaxSponsored > 0 {
+		filter["sponsored_count"] = bson.M{"$lte": account.MaxSponsored}
+	}
+
+	var updated models.CorporateAccount
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("corporate_accounts").FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{
+		"name":           account.Name,
+		"club_id":        account.ClubID,
+		"contact_name":   account.ContactName,
+		"billing_email":  account.BillingEmail,
+		"contract_rate":  account.ContractRate,
+		"employer_share": account.EmployerShare,
+		"max_sponsored":  account.MaxSponsored,
+		"status":         account.Status,
+		"updated_at":     time.Now(),
+	}}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := h.db.Collection("corporate_accounts").CountDocuments(ctx, bson.M{"_id": id})
+		if countErr != nil {
+			http.Error(w, countErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "Corporate account not found", http.StatusNotFound)
+			return
+		}
+		if account.Status == models.CorporateAccountInactive {
+			http.Error(w, "Remove the account's employees before making it inactive", http.StatusConflict)
+			return
+		}
+		http.Error(w, "max_sponsored cannot be below the number of employees on the roster", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// GetEmployees returns a company's roster, optionally filtered by status
+func (h *CorporateAccountHandler) GetEmployees(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid corporate account ID", http.StatusBadRequest)
+		return
+	}
+	filter := bson.M{"corporate_account_id": id}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := h.db.Collection("corporate_employees").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var employees []models.CorporateEmployee
+	if err := cursor.All(ctx, &employees); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if employees == nil {
+		employees = []models.CorporateEmployee{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(employees)
+}
+
+// AddEmployee puts a member on a company's roster. Sponsorship starts now
+// and is billed on the company's next monthly invoice, prorated.
+func (h *CorporateAccountHandler) AddEmployee(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage corporate accounts", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid corporate account ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		MemberID      primitive.ObjectID `json:"member_id"`
+		EmployeeRef   string             `json:"employee_ref"`
+		EmployerShare *float64           `json:"employer_share"` // defaults to the account's share
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.MemberID.IsZero() {
+		http.Error(w, "member_id is required", http.StatusBadRequest)
+		return
+	}
+	if requestData.EmployerShare != nil && !validShare(*requestData.EmployerShare) {
+		http.Error(w, "employer_share must be a percentage from 0 to 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	employee, err := enrollEmployee(ctx, h.db, id, requestData.MemberID, strings.TrimSpace(requestData.EmployeeRef), requestData.EmployerShare, time.Now())
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Corporate account or member not found", http.StatusNotFound)
+		case errMemberAlreadySponsored, errSponsorCapReached, errCorporateAccountClosed:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(employee)
+}
+
+// UpdateEmployee changes an employee's reference or how their membership is
+// split with the company, from the next monthly invoice
+func (h *CorporateAccountHandler) UpdateEmployee(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage corporate accounts", http.StatusForbidden)
+		return
+	}
+
+	accountID, employeeID, ok := corporateEmployeePath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		EmployeeRef   string  `json:"employee_ref"`
+		EmployerShare float64 `json:"employer_share"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validShare(requestData.EmployerShare) {
+		http.Error(w, "employer_share must be a percentage from 0 to 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var updated models.CorporateEmployee
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.db.Collection("corporate_employees").FindOneAndUpdate(ctx,
+		bson.M{"_id": employeeID, "corporate_account_id": accountID, "status": models.CorporateEmployeeActive},
+		bson.M{"$set": bson.M{
+			"employee_ref":   strings.TrimSpace(requestData.EmployeeRef),
+			"employer_share": requestData.EmployerShare,
+			"updated_at":     time.Now(),
+		}}, opts).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Employee not found on the roster", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// RemoveEmployee takes a member off a company's roster. Time already billed
+// is not credited; time since the last invoice is billed on the next one.
+func (h *CorporateAccountHandler) RemoveEmployee(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage corporate accounts", http.StatusForbidden)
+		return
+	}
+
+	accountID, employeeID, ok := corporateEmployeePath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var employee models.CorporateEmployee
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.db.Collection("corporate_employees").FindOneAndUpdate(ctx,
+		bson.M{"_id": employeeID, "corporate_account_id": accountID, "status": models.CorporateEmployeeActive},
+		bson.M{"$set": bson.M{"status": models.CorporateEmployeeRemoved, "end_date": now, "updated_at": now}},
+		opts).Decode(&employee)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Employee not found on the roster", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.db.Collection("corporate_accounts").UpdateOne(ctx, bson.M{"_id": accountID},
+		bson.M{"$inc": bson.M{"sponsored_count": -1}, "$set": bson.M{"updated_at": now}}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Collection("members").UpdateOne(ctx,
+		bson.M{"_id": employee.MemberID, "corporate_account_id": accountID},
+		bson.M{"$unset": bson.M{"corporate_account_id": ""}, "$set": bson.M{"updated_at": now}}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(employee)
+}
+
+// RunCorporateBilling issues this month's company invoices now instead of
+// waiting for the daily job
+func (h *CorporateAccountHandler) RunCorporateBilling(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can run corporate billing", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	issued, err := issueCorporateInvoices(ctx, h.db, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"issued": issued})
+}
+
+// IssueCorporateInvoices is the scheduled entry point for corporate billing
+func IssueCorporateInvoices(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := issueCorporateInvoices(ctx, db, time.Now())
+		return err
+	}
+}
+
+// enrollEmployee links the member to the company and counts them against
+// its cap, undoing the link if the cap has been reached
+func enrollEmployee(ctx context.Context, db *mongo.Database, accountID, memberID primitive.ObjectID, employeeRef string, share *float64, now time.Time) (*models.CorporateEmployee, error) {
+	var account models.CorporateAccount
+	if err := db.Collection("corporate_accounts").FindOne(ctx, bson.M{"_id": accountID}).Decode(&account); err != nil {
+		return nil, err
+	}
+	if account.Status != models.CorporateAccountActive {
+		return nil, errCorporateAccountClosed
+	}
+
+	members := db.Collection("members")
+	result, err := members.UpdateOne(ctx,
+		bson.M{"_id": memberID, "corporate_account_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"corporate_account_id": accountID, "updated_at": now}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		count, err := members.CountDocuments(ctx, bson.M{"_id": memberID})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		return nil, errMemberAlreadySponsored
+	}
+	release := func() {
+		if _, err := members.UpdateOne(ctx, bson.M{"_id": memberID, "corporate_account_id": accountID},
+			bson.M{"$unset": bson.M{"corporate_account_id": ""}}); err != nil {
+			log.Printf("corporate: failed to release member %s: %v", memberID.Hex(), err)
+		}
+	}
+
+	// The count is only taken while it is under the cap, so concurrent
+	// enrollments cannot go over it
+	result, err = db.Collection("corporate_accounts").UpdateOne(ctx, bson.M{
+		"_id":    accountID,
+		"status": models.CorporateAccountActive,
+		"$or": bson.A{
+			bson.M{"max_sponsored": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$sponsored_count", "$max_sponsored"}}},
+		},
+	}, bson.M{"$inc": bson.M{"sponsored_count": 1}, "$set": bson.M{"updated_at": now}})
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		release()
+		return nil, errSponsorCapReached
+	}
+
+	employee := models.CorporateEmployee{
+		ID:                 primitive.NewObjectID(),
+		CorporateAccountID: accountID,
+		MemberID:           memberID,
+		EmployeeRef:        employeeRef,
+		EmployerShare:      account.EmployerShare,
+		Status:             models.CorporateEmployeeActive,
+		StartDate:          now,
+		BilledThrough:      now,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if share != nil {
+		employee.EmployerShare = *share
+	}
+	if _, err := db.Collection("corporate_employees").InsertOne(ctx, employee); err != nil {
+		if _, undoErr := db.Collection("corporate_accounts").UpdateOne(ctx, bson.M{"_id": accountID},
+			bson.M{"$inc": bson.M{"sponsored_count": -1}}); undoErr != nil {
+			log.Printf("corporate: failed to release a sponsored place on account %s: %v", accountID.Hex(), undoErr)
+		}
+		release()
+		return nil, err
+	}
+	return &employee, nil
+}
+
+// issueCorporateInvoices bills every active company for the current month,
+// unless it already has an invoice for it
+func issueCorporateInvoices(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+
+	cursor, err := db.Collection("corporate_accounts").Find(ctx, bson.M{"status": models.CorporateAccountActive})
+	if err != nil {
+		return 0, err
+	}
+	var accounts []models.CorporateAccount
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return 0, err
+	}
+
+	issued := 0
+	for _, account := range accounts {
+		count, err := db.Collection("invoices").CountDocuments(ctx, bson.M{
+			"corporate_account_id": account.ID,
+			"statement_month":      start.Format("2006-01"),
+			"status":               bson.M{"$ne": models.InvoiceStatusVoid},
+		})
+		if err != nil {
+			return issued, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		ok, err := issueCorporateInvoice(ctx, db, account, start, end, now)
+		if err != nil {
+			return issued, err
+		}
+		if ok {
+			issued++
+		}
+	}
+	return issued, nil
+}
+
+// claimedSponsorship is an employee's time claimed for a company invoice
+type claimedSponsorship struct {
+	employee models.CorporateEmployee
+	until    time.Time
+	chargeID *primitive.ObjectID // the employee's share on their own account
+}
+
+// issueCorporateInvoice bills a company in advance for its employees to the
+// end of the month, including time not yet billed since they joined. Each
+// employee's share is charged to their own account, and sponsored members'
+// expiry dates move to the end of the time billed. Employees are claimed
+// before the invoice is written and released if that fails.
+func issueCorporateInvoice(ctx context.Context, db *mongo.Database, account models.CorporateAccount, start, end, now time.Time) (bool, error) {
+	employees := db.Collection("corporate_employees")
+	cursor, err := employees.Find(ctx, bson.M{
+		"corporate_account_id": account.ID,
+		"billed_through":       bson.M{"$lt": end},
+		"$or": bson.A{
+			bson.M{"status": models.CorporateEmployeeActive},
+			bson.M{"$expr": bson.M{"$gt": bson.A{"$end_date", "$billed_through"}}},
+		},
+	}, options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}}))
+	if err != nil {
+		return false, err
+	}
+	var roster []models.CorporateEmployee
+	if err := cursor.All(ctx, &roster); err != nil {
+		return false, err
+	}
+	if len(roster) == 0 {
+		return false, nil
+	}
+	names, err := memberNames(ctx, db, roster)
+	if err != nil {
+		return false, err
+	}
+
+	invoiceID := primitive.NewObjectID()
+	claimed := []claimedSponsorship{}
+	release := func() {
+		for _, claim := range claimed {
+			if _, err := employees.UpdateOne(ctx, bson.M{"_id": claim.employee.ID, "billed_through": claim.until},
+				bson.M{"$set": bson.M{"billed_through": claim.employee.BilledThrough}}); err != nil {
+				log.Printf("corporate: failed to release employee %s: %v", claim.employee.ID.Hex(), err)
+			}
+			if claim.chargeID != nil {
+				if _, err := db.Collection("account_charges").DeleteOne(ctx, bson.M{"_id": *claim.chargeID, "status": models.AccountChargeStatusPending}); err != nil {
+					log.Printf("corporate: failed to remove employee share %s: %v", claim.chargeID.Hex(), err)
+				}
+			}
+		}
+	}
+
+	lines := []models.InvoiceLine{}
+	for _, employee := range roster {
+		until := employee.BillableUntil(end)
+		if !until.After(employee.BilledThrough) {
+			continue
+		}
+		result, err := employees.UpdateOne(ctx,
+			bson.M{"_id": employee.ID, "billed_through": employee.BilledThrough},
+			bson.M{"$set": bson.M{"billed_through": until, "updated_at": now}})
+		if err != nil {
+			release()
+			return false, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		claim := claimedSponsorship{employee: employee, until: until}
+		claimed = append(claimed, claim)
+
+		dates := fmt.Sprintf("%s to %s", employee.BilledThrough.Format("2006-01-02"), until.Format("2006-01-02"))
+		charge := models.ContractCharge(account.ContractRate, employee.BilledThrough, until)
+		employerShare, employeeShare := models.SplitContractCharge(charge, employee.EmployerShare)
+		if employerShare.IsPositive() {
+			description := fmt.Sprintf("%s, %s", names[employee.MemberID], dates)
+			if employee.EmployeeRef != "" {
+				description = fmt.Sprintf("%s (%s), %s", names[employee.MemberID], employee.EmployeeRef, dates)
+			}
+			serviceStart, serviceEnd := employee.BilledThrough, until
+			lines = append(lines, models.InvoiceLine{
+				Description:  description,
+				ProductType:  models.ProductTypeMembership,
+				Quantity:     1,
+				UnitPrice:    employerShare,
+				ServiceStart: &serviceStart,
+				ServiceEnd:   &serviceEnd,
+			})
+		}
+		if employeeShare.IsPositive() {
+			chargeID := primitive.NewObjectID()
+			if _, err := db.Collection("account_charges").InsertOne(ctx, models.AccountCharge{
+				ID:          chargeID,
+				MemberID:    employee.MemberID,
+				ClubID:      account.ClubID,
+				Source:      models.ProductTypeMembership,
+				SourceID:    employee.ID,
+				Description: fmt.Sprintf("Membership through %s, your share, %s", account.Name, dates),
+				Amount:      employeeShare,
+				Status:      models.AccountChargeStatusPending,
+				ChargedAt:   employee.BilledThrough,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}); err != nil {
+				release()
+				return false, err
+			}
+			claimed[len(claimed)-1].chargeID = &chargeID
+		}
+	}
+	if len(claimed) == 0 {
+		return false, nil
+	}
+
+	if len(lines) > 0 {
+		invoice := models.Invoice{
+			ID:                 invoiceID,
+			CorporateAccountID: &account.ID,
+			ClubID:             account.ClubID,
+			Status:             models.InvoiceStatusOpen,
+			Lines:              lines,
+			IssuedAt:           &now,
+			DueDate:            now.AddDate(0, 0, 14),
+			Notes:              fmt.Sprintf("Sponsored memberships for %s, %s", account.Name, start.Format("January 2006")),
+			StatementMonth:     start.Format("2006-01"),
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		}
+		if err := applyTaxRules(ctx, db, account.ClubID, invoice.Lines); err != nil {
+			release()
+			return false, err
+		}
+		invoice.Recalculate()
+		number, err := nextInvoiceNumber(ctx, db, now)
+		if err != nil {
+			release()
+			return false, err
+		}
+		invoice.Number = number
+		if _, err := db.Collection("invoices").InsertOne(ctx, invoice); err != nil {
+			release()
+			return false, err
+		}
+	}
+
+	// Sponsorship keeps the membership current through the time billed
+	for _, claim := range claimed {
+		if claim.employee.Status != models.CorporateEmployeeActive {
+			continue
+		}
+		if _, err := db.Collection("members").UpdateOne(ctx, bson.M{"_id": claim.employee.MemberID},
+			bson.M{"$max": bson.M{"expiry_date": claim.until}, "$set": bson.M{"updated_at": now}}); err != nil {
+			log.Printf("corporate: failed to extend membership of member %s: %v", claim.employee.MemberID.Hex(), err)
+		}
+	}
+	return len(lines) > 0, nil
+}
+
+// memberNames returns the names of the members on a roster
+func memberNames(ctx context.Context, db *mongo.Database, roster []models.CorporateEmployee) (map[primitive.ObjectID]string, error) {
+	ids := make([]primitive.ObjectID, 0, len(roster))
+	for _, employee := range roster {
+		ids = append(ids, employee.MemberID)
+	}
+	cursor, err := db.Collection("members").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"first_name": 1, "last_name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var members []models.Member
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	names := make(map[primitive.ObjectID]string, len(members))
+	for _, member := range members {
+		names[member.ID] = strings.TrimSpace(member.FirstName + " " + member.LastName)
+	}
+	return names, nil
+}
+
+func corporateEmployeePath(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	accountID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid corporate account ID", http.StatusBadRequest)
+		return accountID, accountID, false
+	}
+	employeeID, err := primitive.ObjectIDFromHex(r.PathValue("employeeId"))
+	if err != nil {
+		http.Error(w, "Invalid employee ID", http.StatusBadRequest)
+		return accountID, employeeID, false
+	}
+	return accountID, employeeID, true
+}
+
+// validateCorporateAccount checks and normalizes a company's details and terms
+func validateCorporateAccount(account *models.CorporateAccount) error {
+	account.Name = strings.TrimSpace(account.Name)
+	account.ContactName = strings.TrimSpace(account.ContactName)
+	account.BillingEmail = strings.TrimSpace(account.BillingEmail)
+	if account.Name == "" || account.BillingEmail == "" {
+		return errors.New("name and billing_email are required")
+	}
+	if !account.ContractRate.IsPositive() {
+		return errors.New("contract_rate must be positive")
+	}
+	if account.ContractRate.Currency == "" {
+		account.ContractRate.Currency = models.DefaultCurrency
+	}
+	if !validShare(account.EmployerShare) {
+		return errors.New("employer_share must be a percentage from 0 to 100")
+	}
+	if account.MaxSponsored < 0 {
+		return errors.New("max_sponsored cannot be negative")
+	}
+	return nil
+}
+
+func validShare(share float64) bool {
+	return share >= 0 && share <= 100
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestValidateCorporateAccount(t *testing.T) {
+	account := models.CorporateAccount{Name: " Acme ", BillingEmail: " ap@acme.test ", ContractRate: models.Money{Amount: 3000}, EmployerShare: 75}
+	if err := validateCorporateAccount(&account); err != nil {
+		t.Fatalf("validateCorporateAccount error: %v", err)
+	}
+	if account.Name != "Acme" || account.BillingEmail != "ap@acme.test" {
+		t.Errorf("account not normalized: %+v", account)
+	}
+	if account.ContractRate.Currency != models.DefaultCurrency {
+		t.Errorf("contract rate currency = %q, want %q", account.ContractRate.Currency, models.DefaultCurrency)
+	}
+
+	invalid := []models.CorporateAccount{
+		{BillingEmail: "ap@acme.test", ContractRate: models.Cents(3000)},
+		{Name: "Acme", ContractRate: models.Cents(3000)},
+		{Name: "Acme", BillingEmail: "ap@acme.test"},
+		{Name: "Acme", BillingEmail: "ap@acme.test", ContractRate: models.Cents(3000), EmployerShare: 120},
+		{Name: "Acme", BillingEmail: "ap@acme.test", ContractRate: models.Cents(3000), MaxSponsored: -1},
+	}
+	for _, a := range invalid {
+		if err := validateCorporateAccount(&a); err == nil {
+			t.Errorf("validateCorporateAccount(%+v) should fail", a)
+		}
+	}
+}
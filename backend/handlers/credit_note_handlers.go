@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/payments"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errOverCredit          = errors.New("credit exceeds what was paid on the invoice and not yet credited")
+	errNoRefundablePayment = errors.New("no payment on the invoice has enough left to refund")
+	errCreditNeedsMember   = errors.New("account credit needs an invoice with a member")
+	errUnknownCreditMethod = errors.New("method must be 'refund' or 'account_credit'")
+)
+
+// CreditNoteHandler issues credit notes against paid invoices, refunding the
+// original payment or crediting the member's account
+type CreditNoteHandler struct {
+	db       *mongo.Database
+	provider payments.Provider
+}
+
+func NewCreditNoteHandler(db *mongo.Database, provider payments.Provider) *CreditNoteHandler {
+	return &CreditNoteHandler{db: db, provider: provider}
+}
+
+// GetCreditNotes returns credit notes, newest first, optionally filtered by invoice_id or member_id
+func (h *CreditNoteHandler) GetCreditNotes(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	for _, param := range []string{"invoice_id", "member_id"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			objID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			filter[param] = objID
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("credit_notes").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var notes []models.CreditNote
+	if err := cursor.All(ctx, &notes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if notes == nil {
+		notes = []models.CreditNote{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+// CreateCreditNote refunds or credits part or all of what was paid on an invoice
+func (h *CreditNoteHandler) CreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can issue refunds and credit notes", http.StatusForbidden)
+		return
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Amount    models.Money        `json:"amount"` // defaults to everything that can still be credited
+		Method    string              `json:"method"` // refund, account_credit
+		Reason    string              `json:"reason"`
+		PaymentID *primitive.ObjectID `json:"payment_id"` // payment to refund; defaults to the latest one that covers the amount
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if requestData.Amount.IsNegative() {
+		http.Error(w, "amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	note, err := issueCreditNote(ctx, h.db, h.provider, models.CreditNote{
+		InvoiceID: invoiceID,
+		Amount:    requestData.Amount,
+		Method:    requestData.Method,
+		Reason:    requestData.Reason,
+		PaymentID: requestData.PaymentID,
+		CreatedBy: &user.ID,
+	})
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Invoice or payment not found", http.StatusNotFound)
+		case errUnknownCreditMethod, errCreditNeedsMember:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errOverCredit, errNoRefundablePayment, errInvoiceChanged, models.ErrCurrencyMismatch:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// issueCreditNote credits an invoice and settles the credit. The invoice's
+// amount credited and the payment's amount refunded are reserved with
+// conditional updates first, so concurrent credit notes cannot exceed what
+// was paid, and released again if the refund fails. A note that already
+// carries a RefundID records a refund made at the provider and does not call it.
+func issueCreditNote(ctx context.Context, db *mongo.Database, provider payments.Provider, note models.CreditNote) (*models.CreditNote, error) {
+	if note.Method != models.CreditNoteRefund && note.Method != models.CreditNoteAccountCredit {
+		return nil, errUnknownCreditMethod
+	}
+
+	invoices := db.Collection("invoices")
+	var invoice models.Invoice
+	if err := invoices.FindOne(ctx, bson.M{"_id": note.InvoiceID}).Decode(&invoice); err != nil {
+		return nil, err
+	}
+	if note.Method == models.CreditNoteAccountCredit && invoice.MemberID == nil {
+		return nil, errCreditNeedsMember
+	}
+
+	creditable := invoice.AmountPaid.Sub(invoice.AmountCredited)
+	if note.Amount.IsZero() {
+		note.Amount = creditable
+	}
+	if !note.Amount.SameCurrency(invoice.Total) {
+		return nil, models.ErrCurrencyMismatch
+	}
+	if !note.Amount.IsPositive() || note.Amount.Cmp(creditable) > 0 {
+		return nil, errOverCredit
+	}
+
+	var payment *models.Payment
+	if note.Method == models.CreditNoteRefund {
+		var err error
+		payment, err = refundablePayment(ctx, db, invoice.ID, note.PaymentID, note.Amount)
+		if err != nil {
+			return nil, err
+		}
+		note.PaymentID = &payment.ID
+		if payment.Method == "account_credit" {
+			note.Method = models.CreditNoteAccountCredit
+		}
+	}
+
+	now := time.Now()
+	note.ID = primitive.NewObjectID()
+	note.MemberID = invoice.MemberID
+	note.ClubID = invoice.ClubID
+	note.Amount.Currency = invoice.Total.Currency
+	note.CreatedAt = now
+
+	number, err := nextCreditNoteNumber(ctx, db, now)
+	if err != nil {
+		return nil, err
+	}
+	note.Number = number
+
+	// Reserve the credit on the invoice
+	result, err := invoices.UpdateOne(ctx,
+		bson.M{"_id": invoice.ID, "amount_credited.amount": moneyAmountFilter(invoice.AmountCredited)},
+		bson.M{"$set": bson.M{"amount_credited": invoice.AmountCredited.Add(note.Amount), "updated_at": now}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errInvoiceChanged
+	}
+	release := func() {
+		if _, err := invoices.UpdateOne(ctx, bson.M{"_id": invoice.ID},
+			bson.M{"$inc": bson.M{"amount_credited.amount": -note.Amount.Amount}}); err != nil {
+			log.Printf("credit notes: failed to release credit on invoice %s: %v", invoice.ID.Hex(), err)
+		}
+	}
+
+	if err := settleCreditNote(ctx, db, provider, &note, payment); err != nil {
+		release()
+		return nil, err
+	}
+
+	if _, err := db.Collection("credit_notes").InsertOne(ctx, note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// settleCreditNote refunds the payment or posts the account credit. Account
+// credit spent on the invoice is refunded back onto the account and gift
+// card payments back onto the card; cash, bank transfer and other payments
+// are refunded by staff outside the system.
+func settleCreditNote(ctx context.Context, db *mongo.Database, provider payments.Provider, note *models.CreditNote, payment *models.Payment) error {
+	credit := models.AccountCreditTransaction{
+		Amount:      note.Amount,
+		Source:      models.AccountCreditSourceCreditNote,
+		SourceID:    &note.ID,
+		Description: "Credit note " + note.Number + ": " + note.Reason,
+		CreatedBy:   note.CreatedBy,
+	}
+	if note.MemberID != nil {
+		credit.MemberID = *note.MemberID
+	}
+
+	if payment == nil {
+		_, err := postAccountCredit(ctx, db, credit)
+		return err
+	}
+
+	paymentsCollection := db.Collection("payments")
+	refunded := payment.AmountRefunded.Add(note.Amount)
+	set := bson.M{"amount_refunded": refunded}
+	if refunded.Cmp(payment.Amount) >= 0 {
+		set["status"] = models.PaymentStatusRefunded
+	}
+	result, err := paymentsCollection.UpdateOne(ctx,
+		bson.M{"_id": payment.ID, "status": models.PaymentStatusSucceeded, "amount_refunded.amount": moneyAmountFilter(payment.AmountRefunded)},
+		bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errInvoiceChanged
+	}
+
+	switch {
+	case note.RefundID != "":
+		// Already refunded at the provider
+	case note.Method == models.CreditNoteAccountCredit:
+		_, err = postAccountCredit(ctx, db, credit)
+	case payment.Method == "gift_card":
+		err = refundToGiftCard(ctx, db, *payment, *note)
+	case payment.ChargeID != "":
+		if provider == nil || payment.Provider != provider.Name() {
+			err = fmt.Errorf("payment was made through %q, which is not the configured provider", payment.Provider)
+			break
+		}
+		var refund *payments.Refund
+		refund, err = provider.Refund(ctx, payments.RefundRequest{ChargeID: payment.ChargeID, Amount: note.Amount, Reason: note.Reason})
+		if err == nil {
+			note.RefundID = refund.ID
+		}
+	}
+
+	if err != nil {
+		if _, undoErr := paymentsCollection.UpdateOne(ctx, bson.M{"_id": payment.ID},
+			bson.M{"$set": bson.M{"amount_refunded": payment.AmountRefunded, "status": models.PaymentStatusSucceeded}}); undoErr != nil {
+			log.Printf("credit notes: failed to release refund on payment %s: %v", payment.ID.Hex(), undoErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// refundablePayment returns the payment to refund: the requested one, or the
+// latest succeeded payment on the invoice with enough left to refund
+func refundablePayment(ctx context.Context, db *mongo.Database, invoiceID primitive.ObjectID, paymentID *primitive.ObjectID, amount models.Money) (*models.Payment, error) {
+	filter := bson.M{"invoice_id": invoiceID, "status": models.PaymentStatusSucceeded}
+	if paymentID != nil {
+		filter["_id"] = *paymentID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: -1}})
+	cursor, err := db.Collection("payments").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []models.Payment
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	for _, payment := range candidates {
+		if payment.Amount.Sub(payment.AmountRefunded).Cmp(amount) >= 0 {
+			return &payment, nil
+		}
+	}
+	return nil, errNoRefundablePayment
+}
+
+// moneyAmountFilter matches a stored money amount, treating a missing field as zero
+func moneyAmountFilter(m models.Money) interface{} {
+	if m.Amount == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return m.Amount
+}
+
+// creditCancelledBooking puts the paid price of a cancelled office booking on
+// the member's account. Bookings that were not invoiced, or not paid, have
+// nothing to credit, and each booking is credited once.
+func creditCancelledBooking(ctx context.Context, db *mongo.Database, bookingID primitive.ObjectID) error {
+	count, err := db.Collection("credit_notes").CountDocuments(ctx, bson.M{"product_id": bookingID})
+	if err != nil || count > 0 {
+		return err
+	}
+
+	var invoice models.Invoice
+	err = db.Collection("invoices").FindOne(ctx, bson.M{
+		"lines.product_id": bookingID,
+		"status":           bson.M{"$in": []string{models.InvoiceStatusPartiallyPaid, models.InvoiceStatusPaid}},
+	}).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if invoice.MemberID == nil {
+		return nil
+	}
+
+	var amount models.Money
+	for _, line := range invoice.Lines {
+		if line.ProductID != nil && *line.ProductID == bookingID {
+			amount = amount.Add(line.Amount).Add(line.TaxAmount)
+		}
+	}
+	amount = amount.Min(invoice.AmountPaid.Sub(invoice.AmountCredited))
+	if !amount.IsPositive() {
+		return nil
+	}
+
+	_, err = issueCreditNote(ctx, db, nil, models.CreditNote{
+		InvoiceID: invoice.ID,
+		Amount:    amount,
+		Method:    models.CreditNoteAccountCredit,
+		Reason:    "Office booking cancelled",
+		ProductID: &bookingID,
+	})
+	return err
+}
+
+// tryCreditCancelledBooking credits a cancelled office booking. Errors are
+// logged; the cancellation itself has already been saved.
+func tryCreditCancelledBooking(db *mongo.Database, bookingID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := creditCancelledBooking(ctx, db, bookingID); err != nil {
+		log.Printf("credit notes: failed to credit cancelled office booking %s: %v", bookingID.Hex(), err)
+	}
+}
+
+// nextCreditNoteNumber allocates the next sequential number for the year, e.g. CN-2024-000007
+func nextCreditNoteNumber(ctx context.Context, db *mongo.Database, now time.Time) (string, error) {
+	seq, err := nextSequence(ctx, db, fmt.Sprintf("credit-note-%d", now.Year()))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("CN-%d-%06d", now.Year(), seq), nil
+}
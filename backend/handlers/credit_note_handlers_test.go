@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIssueCreditNoteRejectsUnknownMethods(t *testing.T) {
+	for _, method := range []string{"", "cash", "store_credit"} {
+		_, err := issueCreditNote(context.Background(), nil, nil, models.CreditNote{Method: method, Amount: models.Cents(500)})
+		if err != errUnknownCreditMethod {
+			t.Errorf("issueCreditNote with method %q: err = %v, want %v", method, err, errUnknownCreditMethod)
+		}
+	}
+}
+
+func TestMoneyAmountFilter(t *testing.T) {
+	if got := moneyAmountFilter(models.Cents(1250)); got != int64(1250) {
+		t.Errorf("moneyAmountFilter(12.50) = %v, want 1250", got)
+	}
+
+	// Documents written before the field existed must match a zero amount
+	want := bson.M{"$in": bson.A{0, nil}}
+	if got := moneyAmountFilter(models.Money{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("moneyAmountFilter(0) = %v, want %v", got, want)
+	}
+}
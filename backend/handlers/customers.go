@@ -10,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-api-mongo/models"
 )
@@ -107,11 +108,24 @@ func (h *MemberHandler) GetMember(w http.ResponseWriter, r *http.Request, idStr
 }
 
 func (h *MemberHandler) CreateMember(w http.ResponseWriter, r *http.Request) {
-	var member models.Member
-	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+	var requestData struct {
+		models.Member
+		ReferredByCode string `json:"referred_by_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	member := requestData.Member
+
+	// Referral, loyalty, churn and sponsorship fields are maintained by the server
+	member.ReferralCode = ""
+	member.ReferredBy = nil
+	member.AccountCredit = models.Money{}
+	member.LoyaltyPoints = 0
+	member.ClassCredits = 0
+	member.ChurnRisk = nil
+	member.CorporateAccountID = nil
 
 	member.CreatedAt = time.Now()
 	member.UpdatedAt = time.Now()
@@ -120,13 +134,36 @@ func (h *MemberHandler) CreateMember(w http.ResponseWriter, r *http.Request) {
 		member.JoinDate = time.Now()
 	}
 
+	// New members start as a prospect or active; every later change goes
+	// through the lifecycle actions
 	if member.Status == "" {
-		member.Status = "active"
+		member.Status = models.MemberStatusActive
 	}
+	status, ok := models.NormalizeMemberStatus(member.Status)
+	if !ok || (status != models.MemberStatusProspect && status != models.MemberStatusActive) {
+		http.Error(w, "New members must have status 'prospect' or 'active'", http.StatusBadRequest)
+		return
+	}
+	member.Status = status
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var referrer *models.Member
+	if requestData.ReferredByCode != "" {
+		found, err := findReferrer(ctx, h.collection.Database(), requestData.ReferredByCode)
+		if err != nil {
+			if err == errInvalidReferralCode {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		referrer = found
+		member.ReferredBy = &referrer.ID
+	}
+
 	result, err := h.collection.InsertOne(ctx, member)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -134,6 +171,17 @@ func (h *MemberHandler) CreateMember(w http.ResponseWriter, r *http.Request) {
 	}
 
 	member.ID = result.InsertedID.(primitive.ObjectID)
+
+	if referrer != nil {
+		if _, err := attributeReferral(ctx, h.collection.Database(), *referrer, member); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if code, err := ensureReferralCode(ctx, h.collection.Database(), member.ID); err == nil {
+		member.ReferralCode = code
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(member)
@@ -164,7 +212,6 @@ func (h *MemberHandler) UpdateMember(w http.ResponseWriter, r *http.Request, idS
 			"email":             member.Email,
 			"phone":             member.Phone,
 			"membership_type":   member.MembershipType,
-			"status":            member.Status,
 			"join_date":         member.JoinDate,
 			"expiry_date":       member.ExpiryDate,
 			"auto_renewal":      member.AutoRenewal,
@@ -174,20 +221,21 @@ func (h *MemberHandler) UpdateMember(w http.ResponseWriter, r *http.Request, idS
 		},
 	}
 
-	result, err := h.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	// Status is deliberately not writable here; use the lifecycle actions
+	var updated models.Member
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&updated)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		http.Error(w, "Member not found", http.StatusNotFound)
-		return
-	}
-
-	member.ID = id
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(member)
+	json.NewEncoder(w).Encode(updated)
 }
 
 func (h *MemberHandler) DeleteMember(w http.ResponseWriter, r *http.Request, idStr string) {
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/pdf"
+	"go-api-mongo/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Document template types
+const (
+	DocumentTypeWaiver             = "waiver"
+	DocumentTypeMembershipContract = "membership_contract"
+)
+
+// errWaiverRequired is returned when a club requires a waiver the member has not signed
+var errWaiverRequired = errors.New("member must sign the current liability waiver")
+
+type DocumentHandler struct {
+	db             *mongo.Database
+	store          storage.BlobStore
+	trustedProxies []*net.IPNet
+}
+
+// NewDocumentHandler creates a DocumentHandler. Signatures record the
+// address of the caller, read from X-Forwarded-For only when the request
+// comes through one of trustedProxies.
+func NewDocumentHandler(db *mongo.Database, store storage.BlobStore, trustedProxies []*net.IPNet) *DocumentHandler {
+	return &DocumentHandler{db: db, store: store, trustedProxies: trustedProxies}
+}
+
+// GetTemplates returns document templates, optionally filtered by type, club_id or active
+func (h *DocumentHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if docType := r.URL.Query().Get("type"); docType != "" {
+		filter["type"] = docType
+	}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = objID
+	}
+	if r.URL.Query().Get("active") == "true" {
+		filter["active"] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "type", Value: 1}, {Key: "version", Value: -1}})
+	cursor, err := h.db.Collection("document_templates").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var templates []models.DocumentTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if templates == nil {
+		templates = []models.DocumentTemplate{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// GetTemplate returns a single template version
+func (h *DocumentHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var template models.DocumentTemplate
+	err = h.db.Collection("document_templates").FindOne(ctx, bson.M{"_id": id}).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// CreateTemplate publishes a new version of a document template. Templates are
+// never edited in place so that every signature points at the exact text signed.
+func (h *DocumentHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var template models.DocumentTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if template.Type != DocumentTypeWaiver && template.Type != DocumentTypeMembershipContract {
+		http.Error(w, "Type must be 'waiver' or 'membership_contract'", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(template.Title) == "" || strings.TrimSpace(template.Body) == "" {
+		http.Error(w, "Title and body are required", http.StatusBadRequest)
+		return
+	}
+	if template.ValidDays < 0 {
+		http.Error(w, "valid_days cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	collection := h.db.Collection("document_templates")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope := bson.M{"type": template.Type, "club_id": template.ClubID}
+	if template.ClubID == nil {
+		scope["club_id"] = bson.M{"$exists": false}
+	}
+
+	var latest models.DocumentTemplate
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := collection.FindOne(ctx, scope, opts).Decode(&latest)
+	if err != nil && err != mongo.ErrNoDocuments {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	template.ID = primitive.NilObjectID
+	template.Version = latest.Version + 1
+	template.Active = true
+	template.CreatedAt = time.Now()
+
+	// The version is unique per type and club, so of two publishes racing
+	// for it one is refused. Earlier versions are retired only once the new
+	// one is in, and never a later one published meanwhile.
+	result, err := collection.InsertOne(ctx, template)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "Another version of this template was published at the same time, reload and try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	template.ID = result.InsertedID.(primitive.ObjectID)
+
+	scope["version"] = bson.M{"$lt": template.Version}
+	if _, err := collection.UpdateMany(ctx, scope, bson.M{"$set": bson.M{"active": false}}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+// EnsureDocumentTemplateIndexes creates the unique index that gives each
+// template type one of each version per club, and globally
+func EnsureDocumentTemplateIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("document_templates").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "type", Value: 1}, {Key: "club_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("one_template_per_version"),
+	})
+	return err
+}
+
+// SignDocument records a member's signature of an active template and stores
+// a PDF copy of what was signed
+func (h *DocumentHandler) SignDocument(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		TemplateID string `json:"template_id"`
+		SignedName string `json:"signed_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	templateID, err := primitive.ObjectIDFromHex(requestData.TemplateID)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+	signedName := strings.TrimSpace(requestData.SignedName)
+	if signedName == "" {
+		http.Error(w, "Typed signature name is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var member models.Member
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var template models.DocumentTemplate
+	if err := h.db.Collection("document_templates").FindOne(ctx, bson.M{"_id": templateID}).Decode(&template); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !template.Active {
+		http.Error(w, "Template has been superseded by a newer version", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	signed := models.SignedDocument{
+		ID:              primitive.NewObjectID(),
+		TemplateID:      template.ID,
+		TemplateType:    template.Type,
+		TemplateVersion: template.Version,
+		MemberID:        memberID,
+		ClubID:          template.ClubID,
+		SignedName:      signedName,
+		SignedAt:        now,
+		IPAddress:       clientIP(r, h.trustedProxies),
+		UserAgent:       r.UserAgent(),
+		DocumentHash:    templateHash(template),
+		CreatedAt:       now,
+	}
+	if template.ValidDays > 0 {
+		expires := now.AddDate(0, 0, template.ValidDays)
+		signed.ExpiresAt = &expires
+	}
+	signed.PDFKey = fmt.Sprintf("signed-documents/%s/%s.pdf", memberID.Hex(), signed.ID.Hex())
+
+	if err := h.store.Put(ctx, signed.PDFKey, bytes.NewReader(renderSignedDocument(template, member, signed))); err != nil {
+		http.Error(w, "Failed to store signed document", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.db.Collection("signed_documents").InsertOne(ctx, signed); err != nil {
+		h.store.Delete(ctx, signed.PDFKey)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(signed)
+}
+
+// GetMemberDocuments returns every document a member has signed, newest first
+func (h *DocumentHandler) GetMemberDocuments(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "signed_at", Value: -1}})
+	cursor, err := h.db.Collection("signed_documents").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var documents []models.SignedDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if documents == nil {
+		documents = []models.SignedDocument{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(documents)
+}
+
+// GetWaiverStatus reports whether the member has signed the waiver currently in force for a club
+func (h *DocumentHandler) GetWaiverStatus(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var clubID *primitive.ObjectID
+	if clubIDStr := r.URL.Query().Get("club_id"); clubIDStr != "" {
+		objID, err := primitive.ObjectIDFromHex(clubIDStr)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		clubID = &objID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	current, err := hasCurrentWaiver(ctx, h.db, clubID, memberID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"current": current})
+}
+
+// DownloadSignedDocument streams the stored PDF copy of a signed document
+func (h *DocumentHandler) DownloadSignedDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var signed models.SignedDocument
+	if err := h.db.Collection("signed_documents").FindOne(ctx, bson.M{"_id": id}).Decode(&signed); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	blob, err := h.store.Get(ctx, signed.PDFKey)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			http.Error(w, "Document file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-v%d-%s.pdf\"", signed.TemplateType, signed.TemplateVersion, signed.ID.Hex()))
+	io.Copy(w, blob)
+}
+
+// findActiveTemplate returns the template of the given type in force for a
+// club, preferring a club specific template over the global one
+func findActiveTemplate(ctx context.Context, db *mongo.Database, docType string, clubID *primitive.ObjectID) (*models.DocumentTemplate, error) {
+	collection := db.Collection("document_templates")
+
+	// A version being published is active alongside the one it replaces
+	// until that is retired; the newer one is in force
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+
+	var template models.DocumentTemplate
+	if clubID != nil {
+		err := collection.FindOne(ctx, bson.M{"type": docType, "club_id": *clubID, "active": true}, opts).Decode(&template)
+		if err == nil {
+			return &template, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	err := collection.FindOne(ctx, bson.M{"type": docType, "club_id": bson.M{"$exists": false}, "active": true}, opts).Decode(&template)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// hasCurrentWaiver reports whether the member has an unexpired signature of
+// the waiver currently in force. With no waiver published there is nothing to sign.
+func hasCurrentWaiver(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID, memberID primitive.ObjectID) (bool, error) {
+	template, err := findActiveTemplate(ctx, db, DocumentTypeWaiver, clubID)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"member_id":   memberID,
+		"template_id": template.ID,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$exists": false}},
+			{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}
+	count, err := db.Collection("signed_documents").CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// requireWaiver returns errWaiverRequired when the club enforces waivers and
+// the member has not signed the current one
+func requireWaiver(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID, memberID primitive.ObjectID) error {
+	if clubID == nil {
+		return nil
+	}
+
+	var club models.Club
+	err := db.Collection("clubs").FindOne(ctx, bson.M{"_id": *clubID}).Decode(&club)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !club.RequireWaiver {
+		return nil
+	}
+
+	current, err := hasCurrentWaiver(ctx, db, clubID, memberID)
+	if err != nil {
+		return err
+	}
+	if !current {
+		return errWaiverRequired
+	}
+	return nil
+}
+
+// templateHash fingerprints the exact content of a template version
+func templateHash(t models.DocumentTemplate) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%s\n%s", t.Type, t.Version, t.Title, t.Body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderSignedDocument produces the PDF copy of a signed template
+func renderSignedDocument(t models.DocumentTemplate, member models.Member, signed models.SignedDocument) []byte {
+	doc := pdf.New(fmt.Sprintf("%s (version %d)", t.Title, t.Version))
+	flow := doc.NewFlow(54)
+	flow.Paragraph(t.Title, 18, pdf.Bold)
+	flow.Paragraph(fmt.Sprintf("Version %d", t.Version), 9, pdf.Regular)
+	flow.Rule()
+	flow.Paragraph(t.Body, 10, pdf.Regular)
+	flow.Gap(12)
+	flow.Rule()
+	flow.Paragraph("Signature", 12, pdf.Bold)
+	flow.Paragraph(fmt.Sprintf("Member: %s %s (%s)", member.FirstName, member.LastName, member.ID.Hex()), 10, pdf.Regular)
+	flow.Paragraph(fmt.Sprintf("Signed as: %s", signed.SignedName), 10, pdf.Regular)
+	flow.Paragraph(fmt.Sprintf("Signed at: %s", signed.SignedAt.UTC().Format(time.RFC3339)), 10, pdf.Regular)
+	flow.Paragraph(fmt.Sprintf("IP address: %s", signed.IPAddress), 10, pdf.Regular)
+	flow.Paragraph(fmt.Sprintf("Document SHA-256: %s", signed.DocumentHash), 8, pdf.Regular)
+	return doc.Bytes()
+}
+
+// clientIP returns the caller's address. X-Forwarded-For can be set by
+// anyone, so it is only read when the request comes from a trusted proxy,
+// and then from the right: the caller is the last hop no trusted proxy
+// added.
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+func isTrustedProxy(address string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		trusted    []*net.IPNet
+		want       string
+	}{
+		{"direct", "203.0.113.7:5123", "", trusted, "203.0.113.7"},
+		{"forwarded by an untrusted caller", "203.0.113.7:5123", "198.51.100.1", trusted, "203.0.113.7"},
+		{"no trusted proxies", "10.0.0.2:5123", "198.51.100.1", nil, "10.0.0.2"},
+		{"through a trusted proxy", "10.0.0.2:5123", "198.51.100.1", trusted, "198.51.100.1"},
+		{"spoofed first hop", "10.0.0.2:5123", "192.0.2.99, 198.51.100.1, 10.0.0.3", trusted, "198.51.100.1"},
+		{"trusted proxy without a header", "10.0.0.2:5123", "", trusted, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientIP(req, tt.trusted); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTemplateConcurrentPublish(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := EnsureDocumentTemplateIndexes(ctx, db); err != nil {
+		t.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	handler := NewDocumentHandler(db, nil, nil)
+	body := []byte(`{"type": "waiver", "title": "Liability waiver", "body": "I accept the risks."}`)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			handler.CreateTemplate(rr, httptest.NewRequest(http.MethodPost, "/api/document-templates", bytes.NewReader(body)))
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusCreated && code != http.StatusConflict {
+			t.Errorf("Expected status 201 or 409, got %d", code)
+		}
+	}
+
+	active, err := db.Collection("document_templates").CountDocuments(ctx, bson.M{"type": "waiver", "active": true})
+	if err != nil {
+		t.Fatalf("Failed to count templates: %v", err)
+	}
+	if active != 1 {
+		t.Errorf("Expected one active waiver, got %d", active)
+	}
+}
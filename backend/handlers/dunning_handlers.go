@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/notify"
+	"go-api-mongo/payments"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// unresolvedDunningStatuses are the case statuses that keep a member past due or suspended
+var unresolvedDunningStatuses = []string{models.DunningStatusOpen, models.DunningStatusExhausted}
+
+// DunningHandler recovers failed membership payments. A failed payment opens
+// a case and marks the member past due; payment is retried on the configured
+// schedule with the member's default card; when every retry has failed the
+// member is suspended. Paying the invoice by any means reactivates them.
+type DunningHandler struct {
+	db       *mongo.Database
+	provider payments.Provider
+	notifier notify.Notifier
+	schedule models.DunningSchedule
+}
+
+func NewDunningHandler(db *mongo.Database, provider payments.Provider, notifier notify.Notifier, retryDays []int) *DunningHandler {
+	return &DunningHandler{db: db, provider: provider, notifier: notifier, schedule: retryDays}
+}
+
+// GetCases returns dunning cases, newest first, optionally filtered by status, member_id or club_id
+func (h *DunningHandler) GetCases(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	for _, param := range []string{"member_id", "club_id"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			objID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			filter[param] = objID
+		}
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("dunning_cases").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var cases []models.DunningCase
+	if err := cursor.All(ctx, &cases); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if cases == nil {
+		cases = []models.DunningCase{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cases)
+}
+
+// RunRetries runs the retry job on demand
+func (h *DunningHandler) RunRetries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	retried, err := h.retryDuePayments(ctx, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"retried": retried})
+}
+
+// RetryDuePayments is the scheduled entry point for the retry job
+func (h *DunningHandler) RetryDuePayments(ctx context.Context) error {
+	_, err := h.retryDuePayments(ctx, time.Now())
+	return err
+}
+
+// retryDuePayments retries every open case whose next retry is due
+func (h *DunningHandler) retryDuePayments(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := h.db.Collection("dunning_cases").Find(ctx, bson.M{
+		"status":        models.DunningStatusOpen,
+		"next_retry_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var cases []models.DunningCase
+	if err := cursor.All(ctx, &cases); err != nil {
+		return 0, err
+	}
+
+	retried := 0
+	for _, dc := range cases {
+		if err := h.retry(ctx, dc, now); err != nil {
+			log.Printf("dunning: failed to retry case %s: %v", dc.ID.Hex(), err)
+			continue
+		}
+		retried++
+	}
+	return retried, nil
+}
+
+// retry charges the member's default card for the amount still due
+func (h *DunningHandler) retry(ctx context.Context, dc models.DunningCase, now time.Time) error {
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": dc.InvoiceID}).Decode(&invoice); err != nil {
+		return err
+	}
+	switch invoice.Status {
+	case models.InvoiceStatusPaid:
+		return h.invoicePaid(ctx, invoice.ID)
+	case models.InvoiceStatusVoid, models.InvoiceStatusUncollectible:
+		return h.invoiceClosed(ctx, invoice.ID)
+	}
+
+	// A charge still settling with the provider is given until the next run
+	pending, err := h.db.Collection("payments").CountDocuments(ctx, bson.M{"invoice_id": invoice.ID, "status": models.PaymentStatusPending})
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	attempt := models.DunningAttempt{AttemptedAt: now, Status: models.PaymentStatusFailed}
+
+	var method models.PaymentMethod
+	err = h.db.Collection("payment_methods").FindOne(ctx, bson.M{"member_id": dc.MemberID, "is_default": true}).Decode(&method)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		attempt.FailureCode = "no_payment_method"
+	case err != nil:
+		return err
+	default:
+		charge, err := h.provider.Charge(ctx, payments.ChargeRequest{
+			Amount:         invoice.AmountDue,
+			CardToken:      method.Token,
+			Description:    "Invoice " + invoice.Number,
+			IdempotencyKey: fmt.Sprintf("dunning:%s:%d", dc.ID.Hex(), dc.RetriesMade+1),
+			Metadata:       map[string]string{"invoice_id": invoice.ID.Hex(), "dunning_case_id": dc.ID.Hex()},
+		})
+		if err != nil {
+			return err
+		}
+
+		payment := models.Payment{
+			ID:              primitive.NewObjectID(),
+			InvoiceID:       invoice.ID,
+			Amount:          invoice.AmountDue,
+			Method:          "card",
+			Status:          paymentStatusForCharge(charge.Status),
+			Reference:       charge.ID,
+			Notes:           fmt.Sprintf("Automatic retry %d of %d", dc.RetriesMade+1, len(h.schedule)),
+			Provider:        h.provider.Name(),
+			ChargeID:        charge.ID,
+			PaymentMethodID: &method.ID,
+			FailureCode:     charge.FailureCode,
+			FailureMessage:  charge.FailureMessage,
+		}
+		if _, err := applyPayment(ctx, h.db, payment); err != nil {
+			if charge.Status == payments.ChargeSucceeded {
+				if _, refundErr := h.provider.Refund(ctx, payments.RefundRequest{ChargeID: charge.ID, Amount: payment.Amount, Reason: "invoice changed"}); refundErr != nil {
+					log.Printf("dunning: failed to refund charge %s for invoice %s: %v", charge.ID, invoice.ID.Hex(), refundErr)
+				}
+			}
+			return err
+		}
+		attempt.PaymentID = &payment.ID
+		attempt.Status = payment.Status
+		attempt.FailureCode = charge.FailureCode
+	}
+
+	retriesMade := dc.RetriesMade + 1
+	set := bson.M{"retries_made": retriesMade, "updated_at": now}
+	next, more := h.schedule.NextRetry(dc.FirstFailedAt, retriesMade)
+	if attempt.Status == models.PaymentStatusSucceeded {
+		more = false
+	}
+	if more {
+		set["next_retry_at"] = next
+	} else if attempt.Status != models.PaymentStatusSucceeded {
+		set["status"] = models.DunningStatusExhausted
+	}
+
+	update := bson.M{"$set": set, "$push": bson.M{"attempts": attempt}}
+	if !more {
+		update["$unset"] = bson.M{"next_retry_at": ""}
+	}
+	result, err := h.db.Collection("dunning_cases").UpdateOne(ctx,
+		bson.M{"_id": dc.ID, "status": models.DunningStatusOpen, "retries_made": dc.RetriesMade}, update)
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+
+	member, err := h.findMember(ctx, dc.MemberID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case attempt.Status == models.PaymentStatusSucceeded:
+		return h.invoicePaid(ctx, invoice.ID)
+	case more && attempt.Status == models.PaymentStatusPending:
+		return nil
+	case more:
+		h.notify(ctx, member,
+			"Payment retry failed",
+			fmt.Sprintf("We could not collect %s for invoice %s. We will try again on %s. Please update your card if it has changed.", invoice.AmountDue, invoice.Number, next.Format("January 2")),
+			fmt.Sprintf("Retry %d for %s %s (invoice %s) failed.", retriesMade, member.FirstName, member.LastName, invoice.Number))
+		return nil
+	}
+
+	if err := h.transition(ctx, member.ID, "suspend", "Membership payment for invoice "+invoice.Number+" failed after all retries"); err != nil {
+		return err
+	}
+	h.notify(ctx, member,
+		"Membership suspended",
+		fmt.Sprintf("We could not collect %s for invoice %s after several attempts, so your membership is suspended. It will be reactivated as soon as the invoice is paid.", invoice.AmountDue, invoice.Number),
+		fmt.Sprintf("%s %s has been suspended: invoice %s is unpaid after all retries.", member.FirstName, member.LastName, invoice.Number))
+	return nil
+}
+
+// tryOpenCase opens a dunning case for a failed membership payment and
+// marks the member past due. Later failures on the same invoice are part of
+// the open case. Errors are logged; the payment has already been recorded.
+func (h *DunningHandler) tryOpenCase(invoiceID primitive.ObjectID) {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.openCase(ctx, invoiceID, time.Now()); err != nil {
+		log.Printf("dunning: failed to open case for invoice %s: %v", invoiceID.Hex(), err)
+	}
+}
+
+func (h *DunningHandler) openCase(ctx context.Context, invoiceID primitive.ObjectID, now time.Time) error {
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": invoiceID}).Decode(&invoice); err != nil {
+		return err
+	}
+	if invoice.MemberID == nil || !isMembershipInvoice(invoice) {
+		return nil
+	}
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		return nil
+	}
+
+	dc := models.DunningCase{
+		InvoiceID:     invoice.ID,
+		MemberID:      *invoice.MemberID,
+		ClubID:        invoice.ClubID,
+		Status:        models.DunningStatusOpen,
+		FirstFailedAt: now,
+		Attempts:      []models.DunningAttempt{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	next, ok := h.schedule.NextRetry(now, 0)
+	if ok {
+		dc.NextRetryAt = &next
+	} else {
+		dc.Status = models.DunningStatusExhausted
+	}
+
+	// One case per invoice while it is unresolved
+	result, err := h.db.Collection("dunning_cases").UpdateOne(ctx,
+		bson.M{"invoice_id": invoice.ID, "status": bson.M{"$in": unresolvedDunningStatuses}},
+		bson.M{"$setOnInsert": dc},
+		options.Update().SetUpsert(true))
+	if err != nil || result.UpsertedCount == 0 {
+		return err
+	}
+
+	member, err := h.findMember(ctx, dc.MemberID)
+	if err != nil {
+		return err
+	}
+	reason := "Membership payment for invoice " + invoice.Number + " failed"
+	if member.Status == models.MemberStatusActive {
+		if err := h.transition(ctx, member.ID, "mark-past-due", reason); err != nil {
+			return err
+		}
+	}
+	if dc.Status == models.DunningStatusExhausted {
+		if err := h.transition(ctx, member.ID, "suspend", reason); err != nil {
+			return err
+		}
+	}
+
+	memberBody := fmt.Sprintf("Your payment of %s for invoice %s failed.", invoice.AmountDue, invoice.Number)
+	if ok {
+		memberBody += fmt.Sprintf(" We will try again on %s. Please update your card if it has changed.", next.Format("January 2"))
+	}
+	h.notify(ctx, member, "Payment failed", memberBody,
+		fmt.Sprintf("Membership payment for %s %s (invoice %s) failed; the member is now past due.", member.FirstName, member.LastName, invoice.Number))
+	return nil
+}
+
+// tryRecoverCase reactivates the member when a payment settled the
+// invoice. Errors are logged; the payment has already been recorded.
+func (h *DunningHandler) tryRecoverCase(invoiceID primitive.ObjectID) {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.invoicePaid(ctx, invoiceID); err != nil {
+		log.Printf("dunning: failed to recover case for invoice %s: %v", invoiceID.Hex(), err)
+	}
+}
+
+// invoicePaid marks the invoice's case recovered and, once the member has no
+// other unpaid cases, returns them to active
+func (h *DunningHandler) invoicePaid(ctx context.Context, invoiceID primitive.ObjectID) error {
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": invoiceID}).Decode(&invoice); err != nil {
+		return err
+	}
+	if invoice.Status != models.InvoiceStatusPaid {
+		return nil
+	}
+
+	dc, err := h.resolveCase(ctx, invoiceID, models.DunningStatusRecovered)
+	if err != nil || dc == nil {
+		return err
+	}
+
+	remaining, err := h.db.Collection("dunning_cases").CountDocuments(ctx, bson.M{
+		"member_id": dc.MemberID,
+		"status":    bson.M{"$in": unresolvedDunningStatuses},
+	})
+	if err != nil || remaining > 0 {
+		return err
+	}
+
+	member, err := h.findMember(ctx, dc.MemberID)
+	if err != nil {
+		return err
+	}
+	if member.Status != models.MemberStatusPastDue && member.Status != models.MemberStatusSuspended {
+		return nil
+	}
+	if _, _, err := transitionMember(ctx, h.db, member.ID, "settle", "Payment received for invoice "+invoice.Number, nil); err != nil {
+		return err
+	}
+
+	h.notify(ctx, member, "Membership reactivated",
+		fmt.Sprintf("Thank you, we received your payment for invoice %s. Your membership is active again.", invoice.Number),
+		fmt.Sprintf("%s %s paid invoice %s and has been reactivated.", member.FirstName, member.LastName, invoice.Number))
+	return nil
+}
+
+// tryCloseCase closes the case of a voided or written off invoice. The
+// member's status is left for staff to decide.
+func (h *DunningHandler) tryCloseCase(invoiceID primitive.ObjectID) {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.invoiceClosed(ctx, invoiceID); err != nil {
+		log.Printf("dunning: failed to close case for invoice %s: %v", invoiceID.Hex(), err)
+	}
+}
+
+func (h *DunningHandler) invoiceClosed(ctx context.Context, invoiceID primitive.ObjectID) error {
+	_, err := h.resolveCase(ctx, invoiceID, models.DunningStatusClosed)
+	return err
+}
+
+// resolveCase moves the invoice's unresolved case to status; it returns nil
+// when there was no such case
+func (h *DunningHandler) resolveCase(ctx context.Context, invoiceID primitive.ObjectID, status string) (*models.DunningCase, error) {
+	now := time.Now()
+	var dc models.DunningCase
+	err := h.db.Collection("dunning_cases").FindOneAndUpdate(ctx,
+		bson.M{"invoice_id": invoiceID, "status": bson.M{"$in": unresolvedDunningStatuses}},
+		bson.M{
+			"$set":   bson.M{"status": status, "resolved_at": now, "updated_at": now},
+			"$unset": bson.M{"next_retry_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&dc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
+
+// transition applies a lifecycle action on the system's behalf. A member
+// whose status does not allow it (e.g. already frozen or cancelled) is left as is.
+func (h *DunningHandler) transition(ctx context.Context, memberID primitive.ObjectID, action, reason string) error {
+	_, _, err := transitionMember(ctx, h.db, memberID, action, reason, nil)
+	if _, invalid := err.(*invalidTransitionError); invalid {
+		return nil
+	}
+	return err
+}
+
+func (h *DunningHandler) findMember(ctx context.Context, memberID primitive.ObjectID) (*models.Member, error) {
+	var member models.Member
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// notify sends one message to the member and one to each manager of their clubs
+func (h *DunningHandler) notify(ctx context.Context, member *models.Member, subject, memberBody, managerBody string) {
+	messages := []notify.Message{{To: member.Email, Subject: subject, Body: memberBody}}
+
+	managers, err := clubManagerEmails(ctx, h.db, member.ClubIDs)
+	if err != nil {
+		log.Printf("dunning: failed to find club managers for member %s: %v", member.ID.Hex(), err)
+	}
+	for _, email := range managers {
+		messages = append(messages, notify.Message{To: email, Subject: subject + ": " + member.FirstName + " " + member.LastName, Body: managerBody})
+	}
+
+	for _, msg := range messages {
+		if msg.To == "" {
+			continue
+		}
+		if err := h.notifier.Notify(ctx, msg); err != nil {
+			log.Printf("dunning: failed to notify %s: %v", msg.To, err)
+		}
+	}
+}
+
+// clubManagerEmails returns the email addresses of active managers of any of the clubs
+func clubManagerEmails(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID) ([]string, error) {
+	if len(clubIDs) == 0 {
+		return nil, nil
+	}
+	cursor, err := db.Collection("users").Find(ctx, bson.M{
+		"role":              "club_manager",
+		"active":            true,
+		"assigned_club_ids": bson.M{"$in": clubIDs},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, 0, len(users))
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+	return emails, nil
+}
+
+// isMembershipInvoice reports whether an invoice charges for a membership
+func isMembershipInvoice(invoice models.Invoice) bool {
+	for _, line := range invoice.Lines {
+		if line.ProductType == models.ProductTypeMembership {
+			return true
+		}
+	}
+	return false
+}
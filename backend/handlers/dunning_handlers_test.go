@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestIsMembershipInvoice(t *testing.T) {
+	membership := models.Invoice{Lines: []models.InvoiceLine{
+		{ProductType: models.ProductTypeClassPack},
+		{ProductType: models.ProductTypeMembership},
+	}}
+	if !isMembershipInvoice(membership) {
+		t.Error("Expected an invoice with a membership line to be a membership invoice")
+	}
+
+	other := models.Invoice{Lines: []models.InvoiceLine{{ProductType: models.ProductTypeOfficeBooking}}}
+	if isMembershipInvoice(other) {
+		t.Error("Expected an office booking invoice not to be a membership invoice")
+	}
+}
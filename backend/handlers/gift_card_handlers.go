@@ -0,0 +1,899 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errGiftCardNotFound            = errors.New("gift card not found")
+	errGiftCardVoid                = errors.New("gift card has been voided")
+	errGiftCardExpired             = errors.New("gift card has expired")
+	errInsufficientGiftCardBalance = errors.New("insufficient gift card balance")
+	errGiftCardNotAccepted         = errors.New("nothing left on this bill that a gift card can pay for")
+	errGiftCardOverAllowance       = errors.New("amount exceeds what gift cards can pay on this bill")
+	errGiftCardBillOnStatement     = errors.New("the bill is already on the member's statement; pay the statement instead")
+)
+
+// GiftCardHandler sells gift cards and tracks their balances. Cards pay for
+// membership and class pack invoices and restaurant bills.
+type GiftCardHandler struct {
+	db *mongo.Database
+}
+
+func NewGiftCardHandler(db *mongo.Database) *GiftCardHandler {
+	return &GiftCardHandler{db: db}
+}
+
+// giftCardRedemption is a request to pay a bill with a gift card
+type giftCardRedemption struct {
+	Code   string       `json:"code"`
+	Amount models.Money `json:"amount"` // defaults to as much as the card and the bill allow
+}
+
+// GetGiftCards returns gift cards, newest first, optionally filtered by
+// code, status, club_id or purchaser_member_id
+func (h *GiftCardHandler) GetGiftCards(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	if code := query.Get("code"); code != "" {
+		filter["code"] = normalizeGiftCardCode(code)
+	}
+	if status := query.Get("status"); status != "" {
+		filter["status"] = status
+	}
+	for _, param := range []string{"club_id", "purchaser_member_id"} {
+		if value := query.Get(param); value != "" {
+			objID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid "+strings.ReplaceAll(param, "_", " "), http.StatusBadRequest)
+				return
+			}
+			filter[param] = objID
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("gift_cards").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if cards == nil {
+		cards = []models.GiftCard{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
+}
+
+// GetGiftCard returns a gift card with its transactions, newest first
+func (h *GiftCardHandler) GetGiftCard(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var card models.GiftCard
+	if err := h.db.Collection("gift_cards").FindOne(ctx, bson.M{"_id": id}).Decode(&card); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Gift card not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := h.db.Collection("gift_card_transactions").Find(ctx, bson.M{"gift_card_id": id}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []models.GiftCardTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if transactions == nil {
+		transactions = []models.GiftCardTransaction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"gift_card":    card,
+		"transactions": transactions,
+	})
+}
+
+// IssueGiftCard sells a gift card with a new code for the amount paid
+func (h *GiftCardHandler) IssueGiftCard(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Amount            models.Money        `json:"amount"`
+		ClubID            *primitive.ObjectID `json:"club_id"`
+		ExpiresAt         *time.Time          `json:"expires_at"`
+		PurchaserName     string              `json:"purchaser_name"`
+		PurchaserMemberID *primitive.ObjectID `json:"purchaser_member_id"`
+		RecipientName     string              `json:"recipient_name"`
+		RecipientEmail    string              `json:"recipient_email"`
+		PaymentMethod     string              `json:"payment_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !requestData.Amount.IsPositive() {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if !validPaymentMethods[requestData.PaymentMethod] {
+		http.Error(w, "payment_method must be one of card, cash, bank_transfer, other", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if requestData.ExpiresAt != nil && !requestData.ExpiresAt.After(now) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	if requestData.Amount.Currency == "" {
+		requestData.Amount.Currency = models.DefaultCurrency
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code, err := newGiftCardCode(ctx, h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	card := models.GiftCard{
+		ID:                primitive.NewObjectID(),
+		Code:              code,
+		ClubID:            requestData.ClubID,
+		IssuedAmount:      requestData.Amount,
+		Balance:           requestData.Amount,
+		Status:            models.GiftCardStatusActive,
+		ExpiresAt:         requestData.ExpiresAt,
+		PurchaserName:     strings.TrimSpace(requestData.PurchaserName),
+		PurchaserMemberID: requestData.PurchaserMemberID,
+		RecipientName:     strings.TrimSpace(requestData.RecipientName),
+		RecipientEmail:    strings.TrimSpace(requestData.RecipientEmail),
+		PaymentMethod:     requestData.PaymentMethod,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if user := currentUser(r); user != nil {
+		card.IssuedBy = &user.ID
+	}
+
+	if _, err := h.db.Collection("gift_cards").InsertOne(ctx, card); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Collection("gift_card_transactions").InsertOne(ctx, models.GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         models.GiftCardTxnIssue,
+		Amount:       card.IssuedAmount,
+		BalanceAfter: card.Balance,
+		Description:  "Issued, paid by " + paymentMethodLabel(card.PaymentMethod),
+		CreatedBy:    card.IssuedBy,
+		CreatedAt:    now,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
+
+// AdjustGiftCard posts a manual credit or debit to a gift card's balance
+func (h *GiftCardHandler) AdjustGiftCard(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can adjust gift cards", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Amount models.Money `json:"amount"` // negative to debit
+		Reason string       `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Amount.IsZero() || requestData.Reason == "" {
+		http.Error(w, "amount and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	posted, err := postGiftCardTransaction(ctx, h.db, models.GiftCardTransaction{
+		GiftCardID:  id,
+		Type:        models.GiftCardTxnAdjust,
+		Amount:      requestData.Amount,
+		Description: requestData.Reason,
+		CreatedBy:   &user.ID,
+	})
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(posted)
+}
+
+// VoidGiftCard cancels a gift card, writing off whatever is left on it
+func (h *GiftCardHandler) VoidGiftCard(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can void gift cards", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var card models.GiftCard
+	err = h.db.Collection("gift_cards").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.GiftCardStatusActive},
+		bson.M{"$set": bson.M{"status": models.GiftCardStatusVoid, "balance.amount": 0, "updated_at": now}}).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		if _, findErr := findGiftCard(ctx, h.db, bson.M{"_id": id}); findErr != nil {
+			writeGiftCardError(w, findErr)
+			return
+		}
+		writeGiftCardError(w, errGiftCardVoid)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.db.Collection("gift_card_transactions").InsertOne(ctx, models.GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         models.GiftCardTxnVoid,
+		Amount:       card.Balance.Neg(),
+		BalanceAfter: models.NewMoney(0, card.Balance.Currency),
+		Description:  requestData.Reason,
+		CreatedBy:    &user.ID,
+		CreatedAt:    now,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	card.Status = models.GiftCardStatusVoid
+	card.Balance = models.NewMoney(0, card.Balance.Currency)
+	card.UpdatedAt = now
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// PayReservation pays part or all of a restaurant bill with a gift card. A
+// member's completed bill is charged to their account for what is left.
+func (h *GiftCardHandler) PayReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData giftCardRedemption
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.Amount.IsNegative() {
+		http.Error(w, "amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservations := h.db.Collection("reservations")
+	var reservation models.Reservation
+	if err := reservations.FindOne(ctx, bson.M{"_id": id}).Decode(&reservation); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Reservation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reservation.Status == "cancelled" || reservation.Status == "no-show" {
+		http.Error(w, "Gift cards can only pay bills of open or completed reservations", http.StatusConflict)
+		return
+	}
+	billed, err := h.db.Collection("account_charges").CountDocuments(ctx, bson.M{
+		"source":    models.ProductTypeRestaurant,
+		"source_id": id,
+		"status":    models.AccountChargeStatusBilled,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if billed > 0 {
+		writeGiftCardError(w, errGiftCardBillOnStatement)
+		return
+	}
+
+	allowance := reservation.BillAmount.Sub(reservation.Discount).Sub(reservation.GiftCardPaid)
+	if !allowance.IsPositive() {
+		writeGiftCardError(w, errGiftCardNotAccepted)
+		return
+	}
+
+	card, err := findGiftCard(ctx, h.db, bson.M{"code": normalizeGiftCardCode(requestData.Code)})
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+	amount, err := redemptionAmount(*card, requestData.Amount, allowance)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	// Reserve the amount on the bill, so concurrent redemptions cannot pay more than it
+	now := time.Now()
+	paid := reservation.GiftCardPaid.Add(amount)
+	result, err := reservations.UpdateOne(ctx,
+		bson.M{"_id": id, "gift_card_paid.amount": moneyAmountFilter(reservation.GiftCardPaid)},
+		bson.M{"$set": bson.M{"gift_card_paid": paid, "updated_at": now}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Reservation changed concurrently, please retry", http.StatusConflict)
+		return
+	}
+
+	var createdBy *primitive.ObjectID
+	if user := currentUser(r); user != nil {
+		createdBy = &user.ID
+	}
+	posted, err := postGiftCardTransaction(ctx, h.db, models.GiftCardTransaction{
+		GiftCardID:    card.ID,
+		Type:          models.GiftCardTxnRedeem,
+		Amount:        amount.Neg(),
+		ReservationID: &id,
+		Description:   "Restaurant bill for " + reservation.DateTime.Format("2006-01-02"),
+		CreatedBy:     createdBy,
+	})
+	if err != nil {
+		if _, releaseErr := reservations.UpdateOne(ctx, bson.M{"_id": id},
+			bson.M{"$inc": bson.M{"gift_card_paid.amount": -amount.Amount}}); releaseErr != nil {
+			log.Printf("gift cards: failed to release %s on reservation %s: %v", amount, id.Hex(), releaseErr)
+		}
+		writeGiftCardError(w, err)
+		return
+	}
+
+	reservation.GiftCardPaid = paid
+	trySyncReservationCharge(h.db, reservation)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reservation": reservation,
+		"transaction": posted,
+	})
+}
+
+// PayWithGiftCard pays the membership, class pack and restaurant lines of an
+// invoice with a gift card. The payment is recorded with method gift_card.
+func (h *InvoiceHandler) PayWithGiftCard(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData giftCardRedemption
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.Amount.IsNegative() {
+		http.Error(w, "amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var createdBy *primitive.ObjectID
+	if user := currentUser(r); user != nil {
+		createdBy = &user.ID
+	}
+	invoice, err := redeemGiftCardOnInvoice(ctx, h.db, id, requestData, createdBy)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		case errInvoiceNotPayable, errOverpayment, errInvoiceChanged:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			writeGiftCardError(w, err)
+		}
+		return
+	}
+
+	h.dunning.tryRecoverCase(invoice.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// GetLiabilityReport returns the value outstanding on gift cards, which the
+// clubs owe card holders, with lifetime totals per currency. Cards past
+// their expiry count as expired even before the expiry job has run.
+func (h *GiftCardHandler) GetLiabilityReport(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if value := r.URL.Query().Get("club_id"); value != "" {
+		clubID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = clubID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := h.db.Collection("gift_cards").Find(ctx, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	liabilities := map[string]*models.GiftCardLiability{}
+	liabilityFor := func(currency string) *models.GiftCardLiability {
+		if currency == "" {
+			currency = models.DefaultCurrency
+		}
+		if _, ok := liabilities[currency]; !ok {
+			liability := models.NewGiftCardLiability(currency)
+			liabilities[currency] = &liability
+		}
+		return liabilities[currency]
+	}
+
+	cardIDs := make([]primitive.ObjectID, 0, len(cards))
+	for _, card := range cards {
+		cardIDs = append(cardIDs, card.ID)
+		if card.Status != models.GiftCardStatusActive || !card.Balance.IsPositive() {
+			continue
+		}
+		liability := liabilityFor(card.Balance.Currency)
+		if card.ExpiredAt(now) {
+			liability.Expired = liability.Expired.Add(card.Balance)
+			continue
+		}
+		liability.Outstanding = liability.Outstanding.Add(card.Balance)
+		liability.OutstandingCards++
+	}
+
+	match := bson.M{}
+	if len(filter) > 0 {
+		match["gift_card_id"] = bson.M{"$in": cardIDs}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"type": "$type", "currency": "$amount.currency"},
+			"amount": bson.M{"$sum": "$amount.amount"},
+		}}},
+	}
+	cursor, err = h.db.Collection("gift_card_transactions").Aggregate(ctx, pipeline)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var totals []struct {
+		ID struct {
+			Type     string `bson:"type"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Amount int64 `bson:"amount"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, total := range totals {
+		liability := liabilityFor(total.ID.Currency)
+		liability.AddTransactions(total.ID.Type, models.NewMoney(total.Amount, liability.Currency))
+	}
+
+	result := []models.GiftCardLiability{}
+	for _, liability := range liabilities {
+		result = append(result, *liability)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Currency < result[j].Currency })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generated_at": now,
+		"totals":       result,
+	})
+}
+
+// ExpireGiftCards is the scheduled entry point for gift card expiry
+func ExpireGiftCards(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := expireGiftCards(ctx, db, time.Now())
+		return err
+	}
+}
+
+// expireGiftCards takes the balance off cards past their expiry date and
+// records it as expired
+func expireGiftCards(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	cursor, err := db.Collection("gift_cards").Find(ctx, bson.M{
+		"status":         models.GiftCardStatusActive,
+		"expires_at":     bson.M{"$lte": now},
+		"balance.amount": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, card := range cards {
+		result, err := db.Collection("gift_cards").UpdateOne(ctx,
+			bson.M{"_id": card.ID, "balance.amount": card.Balance.Amount},
+			bson.M{"$set": bson.M{"balance.amount": 0, "updated_at": now}})
+		if err != nil {
+			return expired, err
+		}
+		if result.ModifiedCount == 0 {
+			// Spent or adjusted since it was read; the next run picks it up
+			continue
+		}
+		if _, err := db.Collection("gift_card_transactions").InsertOne(ctx, models.GiftCardTransaction{
+			GiftCardID:   card.ID,
+			Type:         models.GiftCardTxnExpire,
+			Amount:       card.Balance.Neg(),
+			BalanceAfter: models.NewMoney(0, card.Balance.Currency),
+			Description:  "Expired on " + card.ExpiresAt.Format("2006-01-02"),
+			CreatedAt:    now,
+		}); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// redeemGiftCardOnInvoice debits the card and records the payment, putting
+// the amount back on the card if the payment cannot be applied
+func redeemGiftCardOnInvoice(ctx context.Context, db *mongo.Database, invoiceID primitive.ObjectID, req giftCardRedemption, createdBy *primitive.ObjectID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := db.Collection("invoices").FindOne(ctx, bson.M{"_id": invoiceID}).Decode(&invoice); err != nil {
+		return nil, err
+	}
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		return nil, errInvoiceNotPayable
+	}
+
+	paid, err := giftCardPaidOnInvoice(ctx, db, invoice)
+	if err != nil {
+		return nil, err
+	}
+	allowance := models.GiftCardAllowance(invoice, paid)
+	if !allowance.IsPositive() {
+		return nil, errGiftCardNotAccepted
+	}
+
+	card, err := findGiftCard(ctx, db, bson.M{"code": normalizeGiftCardCode(req.Code)})
+	if err != nil {
+		return nil, err
+	}
+	amount, err := redemptionAmount(*card, req.Amount, allowance)
+	if err != nil {
+		return nil, err
+	}
+
+	debit, err := postGiftCardTransaction(ctx, db, models.GiftCardTransaction{
+		GiftCardID:  card.ID,
+		Type:        models.GiftCardTxnRedeem,
+		Amount:      amount.Neg(),
+		InvoiceID:   &invoice.ID,
+		Description: "Paid invoice " + invoice.Number,
+		CreatedBy:   createdBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := applyPayment(ctx, db, models.Payment{
+		InvoiceID: invoice.ID,
+		Amount:    amount,
+		Method:    "gift_card",
+		Status:    models.PaymentStatusSucceeded,
+		Reference: card.Code,
+		Notes:     "Gift card " + card.Code,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		if _, reverseErr := postGiftCardTransaction(ctx, db, models.GiftCardTransaction{
+			GiftCardID:  card.ID,
+			Type:        models.GiftCardTxnRefund,
+			Amount:      amount,
+			InvoiceID:   &invoice.ID,
+			Description: "Reversed: could not pay invoice " + invoice.Number,
+		}); reverseErr != nil {
+			log.Printf("gift cards: failed to reverse debit %s on card %s: %v", debit.ID.Hex(), card.Code, reverseErr)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// giftCardPaidOnInvoice returns what gift cards have paid on an invoice, net of refunds
+func giftCardPaidOnInvoice(ctx context.Context, db *mongo.Database, invoice models.Invoice) (models.Money, error) {
+	paid := models.NewMoney(0, invoice.Total.Currency)
+	cursor, err := db.Collection("payments").Find(ctx, bson.M{
+		"invoice_id": invoice.ID,
+		"method":     "gift_card",
+		"status":     bson.M{"$in": []string{models.PaymentStatusSucceeded, models.PaymentStatusRefunded}},
+	})
+	if err != nil {
+		return paid, err
+	}
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return paid, err
+	}
+	for _, payment := range payments {
+		paid = paid.Add(payment.Amount).Sub(payment.AmountRefunded)
+	}
+	return paid, nil
+}
+
+// redemptionAmount checks the amount to take off a card against the card
+// and the bill. No amount means as much as both allow.
+func redemptionAmount(card models.GiftCard, requested, allowance models.Money) (models.Money, error) {
+	if card.Status == models.GiftCardStatusVoid {
+		return models.Money{}, errGiftCardVoid
+	}
+	if card.ExpiredAt(time.Now()) {
+		return models.Money{}, errGiftCardExpired
+	}
+	if !card.Balance.SameCurrency(allowance) || !requested.SameCurrency(allowance) {
+		return models.Money{}, models.ErrCurrencyMismatch
+	}
+
+	amount := requested
+	if amount.IsZero() {
+		amount = card.Balance.Min(allowance)
+	}
+	if amount.Currency == "" {
+		amount.Currency = allowance.Currency
+	}
+	if amount.Cmp(allowance) > 0 {
+		return models.Money{}, errGiftCardOverAllowance
+	}
+	if !amount.IsPositive() || amount.Cmp(card.Balance) > 0 {
+		return models.Money{}, errInsufficientGiftCardBalance
+	}
+	return amount, nil
+}
+
+// refundToGiftCard puts a refund of a gift card payment back on the card it was paid with
+func refundToGiftCard(ctx context.Context, db *mongo.Database, payment models.Payment, note models.CreditNote) error {
+	card, err := findGiftCard(ctx, db, bson.M{"code": payment.Reference})
+	if err != nil {
+		return err
+	}
+	_, err = postGiftCardTransaction(ctx, db, models.GiftCardTransaction{
+		GiftCardID:  card.ID,
+		Type:        models.GiftCardTxnRefund,
+		Amount:      note.Amount,
+		InvoiceID:   &payment.InvoiceID,
+		Description: "Credit note " + note.Number + ": " + note.Reason,
+		CreatedBy:   note.CreatedBy,
+	})
+	return err
+}
+
+// postGiftCardTransaction appends an entry to a gift card's history. The
+// card's balance is updated first: only active cards change, debits are
+// conditional so the balance can never go negative, and redemptions are
+// refused once the card has expired. The resulting balance is stored on
+// the entry.
+func postGiftCardTransaction(ctx context.Context, db *mongo.Database, txn models.GiftCardTransaction) (*models.GiftCardTransaction, error) {
+	if txn.CreatedAt.IsZero() {
+		txn.CreatedAt = time.Now()
+	}
+
+	filter := bson.M{"_id": txn.GiftCardID, "status": models.GiftCardStatusActive}
+	if txn.Amount.Currency != "" {
+		filter["balance.currency"] = txn.Amount.Currency
+	}
+	if txn.Amount.IsNegative() {
+		filter["balance.amount"] = bson.M{"$gte": -txn.Amount.Amount}
+	}
+	if txn.Type == models.GiftCardTxnRedeem {
+		filter["$or"] = bson.A{
+			bson.M{"expires_at": nil},
+			bson.M{"expires_at": bson.M{"$gt": txn.CreatedAt}},
+		}
+	}
+
+	var card models.GiftCard
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.Collection("gift_cards").FindOneAndUpdate(ctx, filter, bson.M{
+		"$inc": bson.M{"balance.amount": txn.Amount.Amount},
+		"$set": bson.M{"updated_at": txn.CreatedAt},
+	}, opts).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		current, findErr := findGiftCard(ctx, db, bson.M{"_id": txn.GiftCardID})
+		switch {
+		case findErr != nil:
+			return nil, findErr
+		case current.Status == models.GiftCardStatusVoid:
+			return nil, errGiftCardVoid
+		case txn.Type == models.GiftCardTxnRedeem && current.ExpiredAt(txn.CreatedAt):
+			return nil, errGiftCardExpired
+		case !current.Balance.SameCurrency(txn.Amount):
+			return nil, models.ErrCurrencyMismatch
+		}
+		return nil, errInsufficientGiftCardBalance
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	txn.Amount.Currency = card.Balance.Currency
+	txn.BalanceAfter = card.Balance
+	result, err := db.Collection("gift_card_transactions").InsertOne(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	txn.ID = result.InsertedID.(primitive.ObjectID)
+	return &txn, nil
+}
+
+func findGiftCard(ctx context.Context, db *mongo.Database, filter bson.M) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := db.Collection("gift_cards").FindOne(ctx, filter).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, errGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// newGiftCardCode returns an unused code like "GC-7K3P-QX2M-9HTA"
+func newGiftCardCode(ctx context.Context, db *mongo.Database) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		var code strings.Builder
+		code.WriteString("GC")
+		for group := 0; group < 3; group++ {
+			code.WriteByte('-')
+			for i := 0; i < 4; i++ {
+				n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeAlphabet))))
+				if err != nil {
+					return "", err
+				}
+				code.WriteByte(referralCodeAlphabet[n.Int64()])
+			}
+		}
+
+		count, err := db.Collection("gift_cards").CountDocuments(ctx, bson.M{"code": code.String()})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return code.String(), nil
+		}
+	}
+	return "", errors.New("could not generate a unique gift card code")
+}
+
+// normalizeGiftCardCode accepts codes typed in lower case or with spaces
+func normalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+func writeGiftCardError(w http.ResponseWriter, err error) {
+	switch err {
+	case errGiftCardNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errGiftCardVoid, errGiftCardExpired, errInsufficientGiftCardBalance, errGiftCardBillOnStatement, models.ErrCurrencyMismatch:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errGiftCardNotAccepted, errGiftCardOverAllowance:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+)
+
+func TestRedemptionAmount(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	active := models.GiftCard{Status: models.GiftCardStatusActive, Balance: models.Cents(5000)}
+	expired := active
+	expired.ExpiresAt = &past
+	voided := active
+	voided.Status = models.GiftCardStatusVoid
+
+	tests := []struct {
+		name      string
+		card      models.GiftCard
+		requested models.Money
+		allowance models.Money
+		want      models.Money
+		err       error
+	}{
+		{"defaults to the whole balance", active, models.Money{}, models.Cents(8000), models.Cents(5000), nil},
+		{"defaults to what the bill allows", active, models.Money{}, models.Cents(3000), models.Cents(3000), nil},
+		{"requested amount", active, models.Cents(1200), models.Cents(3000), models.Cents(1200), nil},
+		{"more than the bill allows", active, models.Cents(4000), models.Cents(3000), models.Money{}, errGiftCardOverAllowance},
+		{"more than the balance", active, models.Cents(6000), models.Cents(8000), models.Money{}, errInsufficientGiftCardBalance},
+		{"other currency", active, models.Money{}, models.NewMoney(3000, "EUR"), models.Money{}, models.ErrCurrencyMismatch},
+		{"expired", expired, models.Money{}, models.Cents(3000), models.Money{}, errGiftCardExpired},
+		{"voided", voided, models.Money{}, models.Cents(3000), models.Money{}, errGiftCardVoid},
+	}
+
+	for _, tt := range tests {
+		got, err := redemptionAmount(tt.card, tt.requested, tt.allowance)
+		if err != tt.err {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && got.Cmp(tt.want) != 0 {
+			t.Errorf("%s: amount = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGiftCardCode(t *testing.T) {
+	if got := normalizeGiftCardCode(" gc-7k3p-qx2m 9hta "); got != "GC-7K3P-QX2M9HTA" {
+		t.Errorf("normalizeGiftCardCode = %q", got)
+	}
+}
@@ -177,6 +177,15 @@ func (h *InstructorHandler) UpdateInstructor(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Classes linked to the instructor show their current name
+	for _, collection := range []string{"classes", "class_series"} {
+		if _, err := h.collection.Database().Collection(collection).UpdateMany(ctx,
+			bson.M{"instructor_id": id}, bson.M{"$set": bson.M{"instructor": instructor.Name}}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	instructor.ID = id
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(instructor)
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errInstructorNotFound  = errors.New("instructor not found")
+	errInstructorInactive  = errors.New("instructor is not active")
+	errInstructorNotAtClub = errors.New("instructor is not assigned to the class's club")
+)
+
+// instructorConflictError is returned when an instructor already teaches
+// a class at the time of another
+type instructorConflictError struct {
+	class models.Class
+}
+
+func (e *instructorConflictError) Error() string {
+	return fmt.Sprintf("Instructor already teaches %s on %s from %s to %s",
+		e.class.Name, e.class.Date.Format("2006-01-02"), e.class.StartTime, e.class.EndTime)
+}
+
+// ScheduleConflict is a pair of an instructor's classes that overlap
+type ScheduleConflict struct {
+	ClassID      primitive.ObjectID `json:"class_id"`
+	OtherClassID primitive.ObjectID `json:"other_class_id"`
+}
+
+// GetSchedule returns an instructor's classes from start_date to end_date
+// (YYYY-MM-DD, inclusive; default the next four weeks) by date and time,
+// leaving out cancelled ones. Classes that overlap, such as double bookings
+// made before they were checked, are listed under conflicts.
+func (h *InstructorHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid instructor ID", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	startDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	endDate := startDate.AddDate(0, 0, 27)
+	if value := r.URL.Query().Get("start_date"); value != "" {
+		startDate, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid start_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("end_date"); value != "" {
+		endDate, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid end_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		http.Error(w, "start_date cannot be after end_date", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var instructor models.Instructor
+	if err := h.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&instructor); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Instructor not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	db := h.collection.Database()
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "start_time", Value: 1}})
+	cursor, err := db.Collection("classes").Find(ctx, bson.M{
+		"instructor_id": id,
+		"status":        bson.M{"$ne": "cancelled"},
+		"date":          bson.M{"$gte": startDate, "$lt": endDate.AddDate(0, 0, 1)},
+	}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var classes []models.Class
+	if err := cursor.All(ctx, &classes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if classes == nil {
+		classes = []models.Class{}
+	}
+	if err := attachRosters(ctx, db, classes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conflicts := []ScheduleConflict{}
+	for i := range classes {
+		for j := i + 1; j < len(classes); j++ {
+			if classes[i].Overlaps(classes[j]) {
+				conflicts = append(conflicts, ScheduleConflict{ClassID: classes[i].ID, OtherClassID: classes[j].ID})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"instructor": instructor,
+		"start_date": startDate.Format("2006-01-02"),
+		"end_date":   endDate.Format("2006-01-02"),
+		"classes":    classes,
+		"conflicts":  conflicts,
+	})
+}
+
+// checkInstructorSchedule checks that an instructor can teach classes at a
+// club: they exist, are active, are assigned to the club when the classes
+// have one, and teach nothing else at the same time. The classes themselves
+// are left out of the check, so they can be checked before or after they
+// are saved. It returns the instructor.
+//
+// The check and the write that follows it are separate, so two classes
+// saved at the same moment can still both be given the same time. Such
+// double bookings show up in the conflicts of the instructor's schedule.
+func checkInstructorSchedule(ctx context.Context, db *mongo.Database, instructorID primitive.ObjectID, clubID *primitive.ObjectID, classes []models.Class) (*models.Instructor, error) {
+	var instructor models.Instructor
+	if err := db.Collection("instructors").FindOne(ctx, bson.M{"_id": instructorID}).Decode(&instructor); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errInstructorNotFound
+		}
+		return nil, err
+	}
+	if !instructor.Active {
+		return nil, errInstructorInactive
+	}
+	if clubID != nil && !instructor.TeachesAt(*clubID) {
+		return nil, errInstructorNotAtClub
+	}
+	if len(classes) == 0 {
+		return &instructor, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(classes))
+	first, last := classes[0].Date, classes[0].Date
+	for _, class := range classes {
+		if _, _, err := class.Period(); err != nil {
+			return nil, err
+		}
+		ids = append(ids, class.ID)
+		if class.Date.Before(first) {
+			first = class.Date
+		}
+		if class.Date.After(last) {
+			last = class.Date
+		}
+	}
+
+	cursor, err := db.Collection("classes").Find(ctx, bson.M{
+		"_id":           bson.M{"$nin": ids},
+		"instructor_id": instructorID,
+		"status":        bson.M{"$ne": "cancelled"},
+		"date":          bson.M{"$gte": first.AddDate(0, 0, -1), "$lt": last.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var others []models.Class
+	if err := cursor.All(ctx, &others); err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		for _, other := range others {
+			if class.Overlaps(other) {
+				return nil, &instructorConflictError{class: other}
+			}
+		}
+	}
+	return &instructor, nil
+}
+
+// writeInstructorError answers a class whose instructor cannot teach it
+func writeInstructorError(w http.ResponseWriter, err error) {
+	var conflict *instructorConflictError
+	switch {
+	case errors.As(err, &conflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err == errInstructorNotFound:
+		http.Error(w, "Instructor not found", http.StatusBadRequest)
+	case err == errInstructorInactive, err == errInstructorNotAtClub,
+		err == models.ErrInvalidClassTime, err == models.ErrClassEndsBeforeStart:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
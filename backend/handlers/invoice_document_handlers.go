@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/pdf"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errNoReceipt = errors.New("receipts are only available for payments that were received")
+
+// DownloadInvoicePDF renders an invoice as a PDF with the club's details,
+// its lines, tax, totals and the payments received against it
+func (h *InvoiceHandler) DownloadInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	club, member, err := loadInvoiceParties(ctx, h.db, invoice)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := h.db.Collection("payments").Find(ctx, bson.M{
+		"invoice_id": invoice.ID,
+		"status":     bson.M{"$in": []string{models.PaymentStatusSucceeded, models.PaymentStatusRefunded}},
+	}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", invoice.Number))
+	w.Write(renderInvoicePDF(club, member, invoice, payments))
+}
+
+// DownloadReceipt renders the receipt for a payment as a PDF. The receipt
+// number is allocated the first time the receipt is downloaded.
+func (h *InvoiceHandler) DownloadReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var payment models.Payment
+	if err := h.db.Collection("payments").FindOne(ctx, bson.M{"_id": id}).Decode(&payment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Payment not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusRefunded {
+		http.Error(w, errNoReceipt.Error(), http.StatusConflict)
+		return
+	}
+
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": payment.InvoiceID}).Decode(&invoice); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	club, member, err := loadInvoiceParties(ctx, h.db, invoice)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := assignReceiptNumber(ctx, h.db, &payment); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", payment.ReceiptNumber))
+	w.Write(renderReceiptPDF(club, member, invoice, payment))
+}
+
+// loadInvoiceParties returns the club an invoice is issued by and the
+// member it is billed to, or a company standing in for one. Either is nil
+// when the invoice has none.
+func loadInvoiceParties(ctx context.Context, db *mongo.Database, invoice models.Invoice) (*models.Club, *models.Member, error) {
+	var club *models.Club
+	if invoice.ClubID != nil {
+		var found models.Club
+		err := db.Collection("clubs").FindOne(ctx, bson.M{"_id": *invoice.ClubID}).Decode(&found)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, nil, err
+		}
+		if err == nil {
+			club = &found
+		}
+	}
+
+	var member *models.Member
+	if invoice.MemberID != nil {
+		var found models.Member
+		err := db.Collection("members").FindOne(ctx, bson.M{"_id": *invoice.MemberID}).Decode(&found)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, nil, err
+		}
+		if err == nil {
+			member = &found
+		}
+	}
+
+	// Company invoices are addressed to the company's billing contact
+	if invoice.CorporateAccountID != nil {
+		var account models.CorporateAccount
+		err := db.Collection("corporate_accounts").FindOne(ctx, bson.M{"_id": *invoice.CorporateAccountID}).Decode(&account)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, nil, err
+		}
+		if err == nil {
+			member = &models.Member{FirstName: account.Name, Email: account.BillingEmail}
+		}
+	}
+	return club, member, nil
+}
+
+// assignReceiptNumber gives a payment its receipt number if it has none yet.
+// When two downloads race, the number stored first wins.
+func assignReceiptNumber(ctx context.Context, db *mongo.Database, payment *models.Payment) error {
+	if payment.ReceiptNumber != "" {
+		return nil
+	}
+
+	seq, err := nextSequence(ctx, db, fmt.Sprintf("receipt-%d", payment.ReceivedAt.Year()))
+	if err != nil {
+		return err
+	}
+	number := fmt.Sprintf("RCT-%d-%06d", payment.ReceivedAt.Year(), seq)
+
+	result, err := db.Collection("payments").UpdateOne(ctx,
+		bson.M{"_id": payment.ID, "receipt_number": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"receipt_number": number}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return db.Collection("payments").FindOne(ctx, bson.M{"_id": payment.ID}).Decode(payment)
+	}
+	payment.ReceiptNumber = number
+	return nil
+}
+
+// invoiceStatusLabels are the payment statuses printed on documents
+var invoiceStatusLabels = map[string]string{
+	models.InvoiceStatusDraft:         "Draft",
+	models.InvoiceStatusOpen:          "Unpaid",
+	models.InvoiceStatusPartiallyPaid: "Partially paid",
+	models.InvoiceStatusPaid:          "Paid",
+	models.InvoiceStatusVoid:          "Void",
+	models.InvoiceStatusUncollectible: "Written off",
+}
+
+// documentDate formats dates on invoices and receipts. Dates are printed in
+// UTC so the same record always renders the same bytes.
+func documentDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// renderInvoicePDF produces an invoice document. It depends only on its
+// arguments, so a document can be regenerated byte for byte.
+func renderInvoicePDF(club *models.Club, member *models.Member, invoice models.Invoice, payments []models.Payment) []byte {
+	title := "Invoice " + invoice.Number
+	doc := pdf.New(title)
+	flow := doc.NewFlow(54)
+	right := flow.Width()
+
+	heading := "INVOICE"
+	if invoice.Status == models.InvoiceStatusDraft {
+		heading = "DRAFT INVOICE"
+	}
+	writeClubHeader(flow, club, heading)
+
+	flow.Row(10, pdf.Bold, pdf.Cell{X: 0, Text: "Bill to"}, pdf.Cell{X: 300, Text: "Invoice " + invoice.Number})
+	details := []string{"Status: " + invoiceStatusLabels[invoice.Status], "Due: " + documentDate(invoice.DueDate)}
+	if invoice.IssuedAt != nil {
+		details = append([]string{"Issued: " + documentDate(*invoice.IssuedAt)}, details...)
+	}
+	billTo := memberLines(member)
+	for i := 0; i < len(details) || i < len(billTo); i++ {
+		var cells []pdf.Cell
+		if i < len(billTo) {
+			cells = append(cells, pdf.Cell{X: 0, Text: billTo[i]})
+		}
+		if i < len(details) {
+			cells = append(cells, pdf.Cell{X: 300, Text: details[i]})
+		}
+		flow.Row(10, pdf.Regular, cells...)
+	}
+	flow.Gap(12)
+
+	flow.Row(9, pdf.Bold,
+		pdf.Cell{X: 0, Text: "Description"},
+		pdf.Cell{X: 310, Text: "Qty", Right: true},
+		pdf.Cell{X: 380, Text: "Unit price", Right: true},
+		pdf.Cell{X: 430, Text: "Tax", Right: true},
+		pdf.Cell{X: right, Text: "Amount", Right: true})
+	flow.Rule()
+	for _, line := range invoice.Lines {
+		tax := fmt.Sprintf("%g%%", line.TaxRate)
+		if line.TaxInclusive {
+			tax += " incl."
+		}
+		flow.Row(9, pdf.Regular,
+			pdf.Cell{X: 0, Text: line.Description, Width: 260},
+			pdf.Cell{X: 310, Text: fmt.Sprintf("%d", line.Quantity), Right: true},
+			pdf.Cell{X: 380, Text: line.UnitPrice.Major(), Right: true},
+			pdf.Cell{X: 430, Text: tax, Right: true},
+			pdf.Cell{X: right, Text: line.Amount.Major(), Right: true})
+	}
+	flow.Rule()
+
+	totals := [][2]string{
+		{"Subtotal", invoice.Subtotal.String()},
+		{"Tax", invoice.TaxTotal.String()},
+		{"Total", invoice.Total.String()},
+		{"Paid", invoice.AmountPaid.String()},
+	}
+	if !invoice.AmountCredited.IsZero() {
+		totals = append(totals, [2]string{"Credited", invoice.AmountCredited.String()})
+	}
+	totals = append(totals, [2]string{"Amount due", invoice.AmountDue.String()})
+	for _, total := range totals {
+		font := pdf.Regular
+		if total[0] == "Total" || total[0] == "Amount due" {
+			font = pdf.Bold
+		}
+		flow.Row(10, font, pdf.Cell{X: 380, Text: total[0], Right: true}, pdf.Cell{X: right, Text: total[1], Right: true})
+	}
+
+	if len(payments) > 0 {
+		flow.Gap(12)
+		flow.Paragraph("Payments", 11, pdf.Bold)
+		for _, payment := range payments {
+			text := fmt.Sprintf("%s  %s", documentDate(payment.ReceivedAt), paymentMethodLabel(payment.Method))
+			if payment.ReceiptNumber != "" {
+				text += "  receipt " + payment.ReceiptNumber
+			}
+			amount := payment.Amount.String()
+			if !payment.AmountRefunded.IsZero() {
+				amount += fmt.Sprintf(" (%s refunded)", payment.AmountRefunded.Major())
+			}
+			flow.Row(9, pdf.Regular, pdf.Cell{X: 0, Text: text}, pdf.Cell{X: right, Text: amount, Right: true})
+		}
+	}
+
+	if strings.TrimSpace(invoice.Notes) != "" {
+		flow.Gap(12)
+		flow.Paragraph(invoice.Notes, 9, pdf.Regular)
+	}
+	return doc.Bytes()
+}
+
+// renderReceiptPDF produces a receipt for one payment. Like invoices it
+// depends only on its arguments.
+func renderReceiptPDF(club *models.Club, member *models.Member, invoice models.Invoice, payment models.Payment) []byte {
+	doc := pdf.New("Receipt " + payment.ReceiptNumber)
+	flow := doc.NewFlow(54)
+	right := flow.Width()
+
+	writeClubHeader(flow, club, "RECEIPT")
+
+	flow.Row(10, pdf.Bold, pdf.Cell{X: 0, Text: "Received from"}, pdf.Cell{X: 300, Text: "Receipt " + payment.ReceiptNumber})
+	details := []string{
+		"Date: " + documentDate(payment.ReceivedAt),
+		"Invoice: " + invoice.Number,
+		"Invoice status: " + invoiceStatusLabels[invoice.Status],
+	}
+	from := memberLines(member)
+	for i := 0; i < len(details) || i < len(from); i++ {
+		var cells []pdf.Cell
+		if i < len(from) {
+			cells = append(cells, pdf.Cell{X: 0, Text: from[i]})
+		}
+		if i < len(details) {
+			cells = append(cells, pdf.Cell{X: 300, Text: details[i]})
+		}
+		flow.Row(10, pdf.Regular, cells...)
+	}
+	flow.Gap(12)
+
+	flow.Rule()
+	rows := [][2]string{
+		{"Payment method", paymentMethodLabel(payment.Method)},
+	}
+	if payment.Reference != "" {
+		rows = append(rows, [2]string{"Reference", payment.Reference})
+	}
+	rows = append(rows, [2]string{"Amount received", payment.Amount.String()})
+	if !payment.AmountRefunded.IsZero() {
+		rows = append(rows, [2]string{"Refunded", payment.AmountRefunded.String()})
+	}
+	rows = append(rows,
+		[2]string{"Invoice total", invoice.Total.String()},
+		[2]string{"Invoice tax", invoice.TaxTotal.String()},
+		[2]string{"Balance due", invoice.AmountDue.String()},
+	)
+	for _, row := range rows {
+		font := pdf.Regular
+		if row[0] == "Amount received" {
+			font = pdf.Bold
+		}
+		flow.Row(10, font, pdf.Cell{X: 0, Text: row[0]}, pdf.Cell{X: right, Text: row[1], Right: true})
+	}
+	flow.Rule()
+
+	flow.Gap(12)
+	flow.Paragraph("Thank you for your payment.", 10, pdf.Regular)
+	return doc.Bytes()
+}
+
+// writeClubHeader prints the club's name and contact details with the
+// document heading on the right
+func writeClubHeader(flow *pdf.Flow, club *models.Club, heading string) {
+	name := ""
+	var contact []string
+	if club != nil {
+		name = club.Name
+		if club.Address != "" {
+			contact = append(contact, club.Address)
+		}
+		place := club.City
+		if club.State != "" {
+			place = strings.TrimPrefix(place+", "+club.State, ", ")
+		}
+		if place = strings.TrimSpace(place + " " + club.ZipCode); place != "" {
+			contact = append(contact, place)
+		}
+		var reach []string
+		for _, s := range []string{club.Phone, club.Email} {
+			if s != "" {
+				reach = append(reach, s)
+			}
+		}
+		if len(reach) > 0 {
+			contact = append(contact, strings.Join(reach, " | "))
+		}
+	}
+
+	flow.Row(18, pdf.Bold, pdf.Cell{X: 0, Text: name}, pdf.Cell{X: flow.Width(), Text: heading, Right: true})
+	for _, line := range contact {
+		flow.Row(9, pdf.Regular, pdf.Cell{X: 0, Text: line})
+	}
+	flow.Rule()
+	flow.Gap(6)
+}
+
+// memberLines returns the name and email printed for the billed member
+func memberLines(member *models.Member) []string {
+	if member == nil {
+		return nil
+	}
+	lines := []string{strings.TrimSpace(member.FirstName + " " + member.LastName)}
+	if member.Email != "" {
+		lines = append(lines, member.Email)
+	}
+	return lines
+}
+
+func paymentMethodLabel(method string) string {
+	switch method {
+	case "bank_transfer":
+		return "Bank transfer"
+	case "account_credit":
+		return "Account credit"
+	case "gift_card":
+		return "Gift card"
+	case "":
+		return "Other"
+	}
+	return strings.ToUpper(method[:1]) + method[1:]
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRenderInvoiceDocuments(t *testing.T) {
+	issued := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	club := &models.Club{Name: "Downtown Fitness", Address: "1 Main St", City: "Springfield", State: "IL", ZipCode: "62701", Email: "billing@example.com"}
+	member := &models.Member{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}
+	invoice := models.Invoice{
+		ID:     primitive.NewObjectID(),
+		Number: "INV-2024-000042",
+		Status: models.InvoiceStatusPartiallyPaid,
+		Lines: []models.InvoiceLine{
+			{Description: "Premium membership (March)", ProductType: models.ProductTypeMembership, Quantity: 1, UnitPrice: models.Cents(8900), TaxRate: 8.875},
+			{Description: "Towel hire", ProductType: models.ProductTypeOther, Quantity: 2, UnitPrice: models.Cents(550), TaxRate: 10, TaxInclusive: true},
+		},
+		AmountPaid: models.Cents(5000),
+		IssuedAt:   &issued,
+		DueDate:    issued.AddDate(0, 0, 14),
+	}
+	invoice.Recalculate()
+	payment := models.Payment{ID: primitive.NewObjectID(), InvoiceID: invoice.ID, Amount: models.Cents(5000), Method: "card", Status: models.PaymentStatusSucceeded, ReceivedAt: issued, ReceiptNumber: "RCT-2024-000007"}
+
+	render := func() []byte { return renderInvoicePDF(club, member, invoice, []models.Payment{payment}) }
+	first := render()
+	if !bytes.Equal(first, render()) {
+		t.Error("Expected identical invoice PDFs for identical input")
+	}
+	for _, want := range []string{"Invoice INV-2024-000042", "Downtown Fitness", "Springfield, IL 62701", "Ada Lovelace", "Partially paid", "10% incl.", invoice.AmountDue.String(), "RCT-2024-000007"} {
+		if !bytes.Contains(first, []byte(want)) {
+			t.Errorf("Expected invoice PDF to contain %q", want)
+		}
+	}
+
+	invoice.Status = models.InvoiceStatusDraft
+	if !bytes.Contains(renderInvoicePDF(nil, nil, invoice, nil), []byte("DRAFT INVOICE")) {
+		t.Error("Expected drafts to be marked")
+	}
+
+	receipt := renderReceiptPDF(club, member, invoice, payment)
+	if !bytes.Equal(receipt, renderReceiptPDF(club, member, invoice, payment)) {
+		t.Error("Expected identical receipt PDFs for identical input")
+	}
+	for _, want := range []string{"Receipt RCT-2024-000007", "INV-2024-000042", "50.00 USD", "Card"} {
+		if !bytes.Contains(receipt, []byte(want)) {
+			t.Errorf("Expected receipt PDF to contain %q", want)
+		}
+	}
+}
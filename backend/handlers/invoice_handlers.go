@@ -0,0 +1,650 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errInvoiceNotPayable = errors.New("only open or partially paid invoices can take payments")
+	errOverpayment       = errors.New("payment exceeds the amount due")
+	errInvoiceChanged    = errors.New("invoice changed concurrently, please retry")
+	errPaymentPending    = errors.New("a card payment on this invoice is still pending, please retry once it settles")
+)
+
+var validProductTypes = map[string]bool{
+	models.ProductTypeMembership:    true,
+	models.ProductTypeClassPack:     true,
+	models.ProductTypeOfficeBooking: true,
+	models.ProductTypeRestaurant:    true,
+	models.ProductTypeRetail:        true,
+	models.ProductTypeOther:         true,
+	models.ProductTypeDiscount:      true,
+	models.ProductTypeCredit:        true,
+}
+
+var validPaymentMethods = map[string]bool{
+	"card":          true,
+	"cash":          true,
+	"bank_transfer": true,
+	"other":         true,
+}
+
+type InvoiceHandler struct {
+	db      *mongo.Database
+	dunning *DunningHandler
+}
+
+func NewInvoiceHandler(db *mongo.Database, dunning *DunningHandler) *InvoiceHandler {
+	return &InvoiceHandler{db: db, dunning: dunning}
+}
+
+// invoiceRequest is the editable part of an invoice
+type invoiceRequest struct {
+	MemberID  *primitive.ObjectID  `json:"member_id"`
+	ClubID    *primitive.ObjectID  `json:"club_id"`
+	Lines     []models.InvoiceLine `json:"lines"`
+	DueDate   time.Time            `json:"due_date"`
+	Notes     string               `json:"notes"`
+	Issue     bool                 `json:"issue"`      // issue immediately instead of saving a draft
+	PromoCode string               `json:"promo_code"` // only when creating
+}
+
+// GetInvoices returns invoices, newest first, optionally filtered by member_id, corporate_account_id, club_id or status
+func (h *InvoiceHandler) GetInvoices(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	for _, param := range []string{"member_id", "club_id", "corporate_account_id"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			objID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid "+strings.ReplaceAll(param, "_", " "), http.StatusBadRequest)
+				return
+			}
+			filter[param] = objID
+		}
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	h.writeInvoices(w, filter)
+}
+
+// GetMemberInvoices returns a member's invoices, newest first
+func (h *InvoiceHandler) GetMemberInvoices(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeInvoices(w, bson.M{"member_id": memberID})
+}
+
+func (h *InvoiceHandler) writeInvoices(w http.ResponseWriter, filter bson.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("invoices").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if invoices == nil {
+		invoices = []models.Invoice{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoices)
+}
+
+// GetInvoice returns an invoice with its payments
+func (h *InvoiceHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}})
+	cursor, err := h.db.Collection("payments").Find(ctx, bson.M{"invoice_id": id}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invoice":  invoice,
+		"payments": payments,
+	})
+}
+
+// CreateInvoice creates a draft invoice, or issues it straight away when "issue" is set
+func (h *InvoiceHandler) CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	var requestData invoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.MemberID == nil {
+		http.Error(w, "member_id is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateInvoiceLines(requestData.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	invoice := models.Invoice{
+		MemberID:  requestData.MemberID,
+		ClubID:    requestData.ClubID,
+		Status:    models.InvoiceStatusDraft,
+		Lines:     requestData.Lines,
+		DueDate:   requestData.DueDate,
+		Notes:     requestData.Notes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if invoice.DueDate.IsZero() {
+		invoice.DueDate = now.AddDate(0, 0, 14)
+	}
+	if err := applyTaxRules(ctx, h.db, invoice.ClubID, invoice.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invoice.Recalculate()
+
+	number, err := nextInvoiceNumber(ctx, h.db, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invoice.Number = number
+	if requestData.Issue {
+		invoice.Status = models.InvoiceStatusOpen
+		invoice.IssuedAt = &now
+	}
+
+	var promo *models.PromoCode
+	if strings.TrimSpace(requestData.PromoCode) != "" {
+		invoice.ID = primitive.NewObjectID()
+		promo, err = reservePromoCode(ctx, h.db, requestData.PromoCode, &invoice, now)
+		if err != nil {
+			writePromoError(w, err)
+			return
+		}
+	}
+
+	result, err := h.db.Collection("invoices").InsertOne(ctx, invoice)
+	if err != nil {
+		if promo != nil {
+			releasePromoCode(ctx, h.db, promo.ID)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invoice.ID = result.InsertedID.(primitive.ObjectID)
+	if promo != nil {
+		var createdBy *primitive.ObjectID
+		if user := currentUser(r); user != nil {
+			createdBy = &user.ID
+		}
+		if err := recordPromoRedemption(ctx, h.db, promo, invoice, createdBy, now); err != nil {
+			log.Printf("promo codes: failed to record redemption of %s on invoice %s: %v", promo.Code, invoice.ID.Hex(), err)
+		}
+	}
+	if invoice.Status == models.InvoiceStatusOpen {
+		if credited := tryApplyAccountCredit(h.db, invoice.ID); credited != nil {
+			invoice = *credited
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// UpdateInvoice replaces the lines, due date and notes of a draft invoice
+func (h *InvoiceHandler) UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData invoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateInvoiceLines(requestData.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var existing models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invoice := models.Invoice{Lines: requestData.Lines}
+	if err := applyTaxRules(ctx, h.db, existing.ClubID, invoice.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invoice.Recalculate()
+
+	set := bson.M{
+		"lines":      invoice.Lines,
+		"currency":   invoice.Currency,
+		"subtotal":   invoice.Subtotal,
+		"tax_total":  invoice.TaxTotal,
+		"total":      invoice.Total,
+		"amount_due": invoice.AmountDue,
+		"notes":      requestData.Notes,
+		"updated_at": time.Now(),
+	}
+	if !requestData.DueDate.IsZero() {
+		set["due_date"] = requestData.DueDate
+	}
+
+	var updated models.Invoice
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("invoices").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.InvoiceStatusDraft},
+		bson.M{"$set": set}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := h.db.Collection("invoices").CountDocuments(ctx, bson.M{"_id": id})
+		if countErr == nil && count > 0 {
+			http.Error(w, "Only draft invoices can be edited", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// ChangeInvoiceStatus issues, voids or writes off an invoice
+func (h *InvoiceHandler) ChangeInvoiceStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	action, ok := models.InvoiceStatusActions[r.PathValue("action")]
+	if !ok {
+		http.Error(w, "Unknown invoice action", http.StatusBadRequest)
+		return
+	}
+	if action.To != models.InvoiceStatusOpen && !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can void or write off invoices", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoices := h.db.Collection("invoices")
+	var invoice models.Invoice
+	if err := invoices.FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !action.Allows(invoice.Status) {
+		http.Error(w, fmt.Sprintf("cannot %s an invoice whose status is '%s'", action.Name, invoice.Status), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	set := bson.M{"status": action.To, "updated_at": now}
+	switch action.To {
+	case models.InvoiceStatusOpen:
+		set["issued_at"] = now
+	case models.InvoiceStatusVoid:
+		set["voided_at"] = now
+		set["amount_due"] = models.NewMoney(0, invoice.Total.Currency)
+	}
+
+	var updated models.Invoice
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = invoices.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": invoice.Status}, bson.M{"$set": set}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, errInvoiceChanged.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch updated.Status {
+	case models.InvoiceStatusOpen:
+		if credited := tryApplyAccountCredit(h.db, updated.ID); credited != nil {
+			updated = *credited
+		}
+	case models.InvoiceStatusVoid:
+		h.dunning.tryCloseCase(updated.ID)
+		tryReleasePromoRedemptions(h.db, updated.ID)
+	case models.InvoiceStatusUncollectible:
+		h.dunning.tryCloseCase(updated.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// RecordPayment records a payment against an invoice. Failed attempts are
+// kept for the record but do not reduce the amount due.
+func (h *InvoiceHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Amount     models.Money `json:"amount"`
+		Method     string       `json:"method"`
+		Reference  string       `json:"reference"`
+		Notes      string       `json:"notes"`
+		Status     string       `json:"status"`
+		ReceivedAt time.Time    `json:"received_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payment := models.Payment{
+		Amount:     requestData.Amount,
+		Method:     requestData.Method,
+		Reference:  requestData.Reference,
+		Notes:      requestData.Notes,
+		Status:     requestData.Status,
+		ReceivedAt: requestData.ReceivedAt,
+	}
+	if !payment.Amount.IsPositive() {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if !validPaymentMethods[payment.Method] {
+		http.Error(w, "method must be one of card, cash, bank_transfer, other", http.StatusBadRequest)
+		return
+	}
+	if payment.Status == "" {
+		payment.Status = models.PaymentStatusSucceeded
+	}
+	if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusFailed {
+		http.Error(w, "status must be 'succeeded' or 'failed'", http.StatusBadRequest)
+		return
+	}
+
+	payment.InvoiceID = id
+	if user := currentUser(r); user != nil {
+		payment.CreatedBy = &user.ID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoice, err := applyPayment(ctx, h.db, payment)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		case errInvoiceNotPayable, errOverpayment, errInvoiceChanged, errPaymentPending, models.ErrCurrencyMismatch:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch payment.Status {
+	case models.PaymentStatusFailed:
+		h.dunning.tryOpenCase(invoice.ID)
+	case models.PaymentStatusSucceeded:
+		h.dunning.tryRecoverCase(invoice.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// applyPayment records a payment and, when it succeeded, applies it to the
+// invoice. Pending payments are recorded and applied once settled. The
+// payment is inserted before the invoice is credited and removed again if
+// crediting fails, so an error means neither was changed.
+func applyPayment(ctx context.Context, db *mongo.Database, payment models.Payment) (*models.Invoice, error) {
+	invoices := db.Collection("invoices")
+	var invoice models.Invoice
+	if err := invoices.FindOne(ctx, bson.M{"_id": payment.InvoiceID}).Decode(&invoice); err != nil {
+		return nil, err
+	}
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		return nil, errInvoiceNotPayable
+	}
+	if !payment.Amount.SameCurrency(invoice.Total) {
+		return nil, models.ErrCurrencyMismatch
+	}
+	if payment.Status == models.PaymentStatusSucceeded {
+		pending, err := hasPendingPayment(ctx, db, invoice.ID)
+		if err != nil {
+			return nil, err
+		}
+		if pending {
+			return nil, errPaymentPending
+		}
+	}
+
+	now := time.Now()
+	if payment.ID.IsZero() {
+		payment.ID = primitive.NewObjectID()
+	}
+	payment.MemberID = invoice.MemberID
+	payment.ClubID = invoice.ClubID
+	payment.CreatedAt = now
+	if payment.ReceivedAt.IsZero() {
+		payment.ReceivedAt = now
+	}
+
+	paymentsCollection := db.Collection("payments")
+	if _, err := paymentsCollection.InsertOne(ctx, payment); err != nil {
+		return nil, err
+	}
+
+	if payment.Status == models.PaymentStatusSucceeded {
+		if err := creditInvoice(ctx, invoices, &invoice, payment.Amount, now); err != nil {
+			if _, deleteErr := paymentsCollection.DeleteOne(ctx, bson.M{"_id": payment.ID}); deleteErr != nil {
+				log.Printf("invoices: failed to remove payment %s not applied to invoice %s: %v", payment.ID.Hex(), invoice.ID.Hex(), deleteErr)
+			}
+			return nil, err
+		}
+	}
+	return &invoice, nil
+}
+
+// hasPendingPayment reports whether a card payment on the invoice is
+// waiting to settle. Its amount is not yet paid but cannot be paid twice.
+func hasPendingPayment(ctx context.Context, db *mongo.Database, invoiceID primitive.ObjectID) (bool, error) {
+	count, err := db.Collection("payments").CountDocuments(ctx,
+		bson.M{"invoice_id": invoiceID, "status": models.PaymentStatusPending},
+		options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// creditInvoice adds a succeeded payment to the invoice's amount paid and
+// updates invoice to match. The update is conditional on the amount paid
+// read, so concurrent payments cannot overpay.
+func creditInvoice(ctx context.Context, invoices *mongo.Collection, invoice *models.Invoice, amount models.Money, now time.Time) error {
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		return errInvoiceNotPayable
+	}
+	if amount.Cmp(invoice.AmountDue) > 0 {
+		return errOverpayment
+	}
+
+	amountPaid := invoice.AmountPaid.Add(amount)
+	amountDue := invoice.Total.Sub(amountPaid)
+	status := models.InvoiceStatusPartiallyPaid
+	set := bson.M{
+		"amount_paid": amountPaid,
+		"amount_due":  amountDue,
+		"updated_at":  now,
+	}
+	if !amountDue.IsPositive() {
+		status = models.InvoiceStatusPaid
+		set["paid_at"] = now
+	}
+	set["status"] = status
+
+	result, err := invoices.UpdateOne(ctx,
+		bson.M{"_id": invoice.ID, "status": invoice.Status, "amount_paid.amount": invoice.AmountPaid.Amount},
+		bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errInvoiceChanged
+	}
+
+	invoice.AmountPaid, invoice.AmountDue, invoice.Status, invoice.UpdatedAt = amountPaid, amountDue, status, now
+	if status == models.InvoiceStatusPaid {
+		invoice.PaidAt = &now
+	}
+	return nil
+}
+
+// validateInvoiceLines checks line items before totals are calculated
+func validateInvoiceLines(lines []models.InvoiceLine) error {
+	if len(lines) == 0 {
+		return errors.New("an invoice needs at least one line")
+	}
+	for i, line := range lines {
+		if !line.UnitPrice.SameCurrency(lines[0].UnitPrice) {
+			return fmt.Errorf("line %d: all lines must be in the same currency", i+1)
+		}
+		if strings.TrimSpace(line.Description) == "" {
+			return fmt.Errorf("line %d: description is required", i+1)
+		}
+		if !validProductTypes[line.ProductType] {
+			return fmt.Errorf("line %d: unknown product_type '%s'", i+1, line.ProductType)
+		}
+		if line.Quantity < 0 || line.TaxRate < 0 {
+			return fmt.Errorf("line %d: quantity and tax_rate cannot be negative", i+1)
+		}
+		if models.IsAdjustmentType(line.ProductType) {
+			if line.UnitPrice.IsPositive() {
+				return fmt.Errorf("line %d: a %s line's unit_price cannot be positive", i+1, line.ProductType)
+			}
+		} else if line.UnitPrice.IsNegative() {
+			return fmt.Errorf("line %d: unit_price cannot be negative", i+1)
+		}
+		if (line.ServiceStart != nil || line.ServiceEnd != nil) && !line.HasServicePeriod() {
+			return fmt.Errorf("line %d: service_start and service_end must be given together, with service_end after service_start", i+1)
+		}
+	}
+
+	totals := models.Invoice{Lines: append([]models.InvoiceLine(nil), lines...)}
+	totals.Recalculate()
+	if totals.Total.IsNegative() {
+		return errors.New("discounts cannot exceed the invoice total")
+	}
+	return nil
+}
+
+// nextInvoiceNumber allocates the next sequential number for the year, e.g. INV-2024-000042
+func nextInvoiceNumber(ctx context.Context, db *mongo.Database, now time.Time) (string, error) {
+	seq, err := nextSequence(ctx, db, fmt.Sprintf("invoice-%d", now.Year()))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV-%d-%06d", now.Year(), seq), nil
+}
+
+// nextSequence increments and returns the named counter
+func nextSequence(ctx context.Context, db *mongo.Database, key string) (int, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := db.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
@@ -0,0 +1,604 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errInsufficientPoints = errors.New("insufficient loyalty points")
+	errNoLoyaltyRule      = errors.New("no active loyalty rule for this club")
+)
+
+type LoyaltyHandler struct {
+	db *mongo.Database
+}
+
+func NewLoyaltyHandler(db *mongo.Database) *LoyaltyHandler {
+	return &LoyaltyHandler{db: db}
+}
+
+// GetRules returns all loyalty rules
+func (h *LoyaltyHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := h.db.Collection("loyalty_rules").Find(ctx, bson.M{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var rules []models.LoyaltyRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = []models.LoyaltyRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// SaveRule creates or replaces the loyalty rule for a club (or the default
+// rule when club_id is omitted)
+func (h *LoyaltyHandler) SaveRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.LoyaltyRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if rule.PointsPerCheckIn < 0 || rule.PointsPerClass < 0 || rule.PointsPerCurrencyUnit < 0 ||
+		rule.ClassCreditCost < 0 || rule.PointsPerDiscountUnit < 0 || rule.ExpiryMonths < 0 {
+		http.Error(w, "Loyalty rule values cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"club_id": rule.ClubID}
+	if rule.ClubID == nil {
+		filter["club_id"] = bson.M{"$exists": false}
+	}
+
+	now := time.Now()
+	setOnInsert := bson.M{"created_at": now}
+	if rule.ClubID != nil {
+		setOnInsert["club_id"] = rule.ClubID
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"points_per_check_in":      rule.PointsPerCheckIn,
+			"points_per_class":         rule.PointsPerClass,
+			"points_per_currency_unit": rule.PointsPerCurrencyUnit,
+			"class_credit_cost":        rule.ClassCreditCost,
+			"points_per_discount_unit": rule.PointsPerDiscountUnit,
+			"expiry_months":            rule.ExpiryMonths,
+			"active":                   rule.Active,
+			"updated_at":               now,
+		},
+		"$setOnInsert": setOnInsert,
+	}
+
+	var saved models.LoyaltyRule
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := h.db.Collection("loyalty_rules").FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// GetMemberLoyalty returns a member's points balance, class credits and ledger, newest first
+func (h *LoyaltyHandler) GetMemberLoyalty(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var member models.Member
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(200)
+	cursor, err := h.db.Collection("points_transactions").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []models.PointsTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if transactions == nil {
+		transactions = []models.PointsTransaction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"balance":       member.LoyaltyPoints,
+		"class_credits": member.ClassCredits,
+		"transactions":  transactions,
+	})
+}
+
+// RedeemPoints exchanges points for class credits or a restaurant discount
+func (h *LoyaltyHandler) RedeemPoints(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Reward        string       `json:"reward"`   // class_credit, restaurant_discount
+		Quantity      int          `json:"quantity"` // class credits
+		Amount        models.Money `json:"amount"`   // discount amount
+		ClubID        string       `json:"club_id"`
+		ReservationID string       `json:"reservation_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var clubID *primitive.ObjectID
+	if requestData.ClubID != "" {
+		objID, err := primitive.ObjectIDFromHex(requestData.ClubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		clubID = &objID
+	}
+
+	txn := models.PointsTransaction{
+		MemberID: memberID,
+		Type:     models.PointsRedeem,
+	}
+	if user := currentUser(r); user != nil {
+		txn.CreatedBy = &user.ID
+	}
+
+	var reservationID primitive.ObjectID
+	switch requestData.Reward {
+	case models.PointsSourceClassCredit:
+		if requestData.Quantity <= 0 {
+			http.Error(w, "quantity must be positive", http.StatusBadRequest)
+			return
+		}
+	case models.PointsSourceRestaurantDiscount:
+		if !requestData.Amount.IsPositive() {
+			http.Error(w, "amount must be positive", http.StatusBadRequest)
+			return
+		}
+		reservationID, err = primitive.ObjectIDFromHex(requestData.ReservationID)
+		if err != nil {
+			http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+			return
+		}
+		var reservation models.Reservation
+		if err := h.db.Collection("reservations").FindOne(ctx, bson.M{"_id": reservationID, "member_id": memberID}).Decode(&reservation); err != nil {
+			if err == mongo.ErrNoDocuments {
+				http.Error(w, "Reservation not found for this member", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if reservation.Status == "completed" || reservation.Status == "cancelled" {
+			http.Error(w, "Discounts can only be applied to open reservations", http.StatusConflict)
+			return
+		}
+		if !requestData.Amount.SameCurrency(reservation.BillAmount) || !requestData.Amount.SameCurrency(reservation.Discount) {
+			http.Error(w, models.ErrCurrencyMismatch.Error(), http.StatusConflict)
+			return
+		}
+		if clubID == nil {
+			clubID, err = restaurantClubID(ctx, h.db, reservation.RestaurantID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		txn.SourceID = &reservationID
+	default:
+		http.Error(w, "reward must be 'class_credit' or 'restaurant_discount'", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := findLoyaltyRule(ctx, h.db, clubID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rule == nil {
+		http.Error(w, errNoLoyaltyRule.Error(), http.StatusConflict)
+		return
+	}
+
+	txn.ClubID = clubID
+	txn.Source = requestData.Reward
+	switch requestData.Reward {
+	case models.PointsSourceClassCredit:
+		if rule.ClassCreditCost == 0 {
+			http.Error(w, "Class credits are not redeemable at this club", http.StatusConflict)
+			return
+		}
+		txn.Points = -rule.ClassCreditCost * requestData.Quantity
+	case models.PointsSourceRestaurantDiscount:
+		if rule.PointsPerDiscountUnit == 0 {
+			http.Error(w, "Restaurant discounts are not redeemable at this club", http.StatusConflict)
+			return
+		}
+		// Points per whole currency unit, rounded up to cover part units
+		txn.Points = -int((requestData.Amount.Amount*int64(rule.PointsPerDiscountUnit) + 99) / 100)
+	}
+
+	posted, err := postPoints(ctx, h.db, txn)
+	if err != nil {
+		if err == errInsufficientPoints {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch requestData.Reward {
+	case models.PointsSourceClassCredit:
+		_, err = h.db.Collection("members").UpdateOne(ctx, bson.M{"_id": memberID}, bson.M{
+			"$inc": bson.M{"class_credits": requestData.Quantity},
+		})
+	case models.PointsSourceRestaurantDiscount:
+		_, err = h.db.Collection("reservations").UpdateOne(ctx, bson.M{"_id": reservationID}, bson.M{
+			"$inc": bson.M{"discount.amount": requestData.Amount.Amount},
+			"$set": bson.M{"discount.currency": requestData.Amount.Currency, "updated_at": time.Now()},
+		})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(posted)
+}
+
+// AdjustPoints posts a manual correction to a member's balance
+func (h *LoyaltyHandler) AdjustPoints(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can adjust points", http.StatusForbidden)
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Points int    `json:"points"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Points == 0 || requestData.Reason == "" {
+		http.Error(w, "points and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	posted, err := postPoints(ctx, h.db, models.PointsTransaction{
+		MemberID:    memberID,
+		Type:        models.PointsAdjust,
+		Source:      models.PointsSourceManual,
+		Points:      requestData.Points,
+		Description: requestData.Reason,
+		CreatedBy:   &user.ID,
+	})
+	if err != nil {
+		switch err {
+		case errInsufficientPoints:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case mongo.ErrNoDocuments:
+			http.Error(w, "Member not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(posted)
+}
+
+// ExpirePoints runs the expiry job on demand
+func (h *LoyaltyHandler) ExpirePoints(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	expired, err := expireLoyaltyPoints(ctx, h.db, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"members": expired})
+}
+
+// ExpireLoyaltyPoints is the scheduled entry point for the expiry job
+func ExpireLoyaltyPoints(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := expireLoyaltyPoints(ctx, db, time.Now())
+		return err
+	}
+}
+
+// postPoints appends an entry to the ledger. The member's cached balance is
+// updated first, conditionally for debits so the balance can never go
+// negative, and the resulting balance is stored on the entry.
+func postPoints(ctx context.Context, db *mongo.Database, txn models.PointsTransaction) (*models.PointsTransaction, error) {
+	filter := bson.M{"_id": txn.MemberID}
+	if txn.Points < 0 {
+		filter["loyalty_points"] = bson.M{"$gte": -txn.Points}
+	}
+
+	if txn.CreatedAt.IsZero() {
+		txn.CreatedAt = time.Now()
+	}
+
+	var member models.Member
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.Collection("members").FindOneAndUpdate(ctx, filter, bson.M{
+		"$inc": bson.M{"loyalty_points": txn.Points},
+	}, opts).Decode(&member)
+	if err == mongo.ErrNoDocuments && txn.Points < 0 {
+		count, countErr := db.Collection("members").CountDocuments(ctx, bson.M{"_id": txn.MemberID})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count > 0 {
+			return nil, errInsufficientPoints
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	txn.BalanceAfter = member.LoyaltyPoints
+	result, err := db.Collection("points_transactions").InsertOne(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	txn.ID = result.InsertedID.(primitive.ObjectID)
+	return &txn, nil
+}
+
+// awardPoints credits points for an activity under the club's loyalty rule.
+// Each activity is only rewarded once.
+func awardPoints(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, clubID *primitive.ObjectID, source string, sourceID primitive.ObjectID, spend models.Money) error {
+	count, err := db.Collection("points_transactions").CountDocuments(ctx, bson.M{
+		"type":      models.PointsEarn,
+		"source":    source,
+		"source_id": sourceID,
+	})
+	if err != nil || count > 0 {
+		return err
+	}
+
+	rule, err := findLoyaltyRule(ctx, db, clubID)
+	if err != nil || rule == nil {
+		return err
+	}
+	points := rule.PointsFor(source, spend)
+	if points <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	_, err = postPoints(ctx, db, models.PointsTransaction{
+		MemberID:  memberID,
+		ClubID:    clubID,
+		Type:      models.PointsEarn,
+		Source:    source,
+		SourceID:  &sourceID,
+		Points:    points,
+		ExpiresAt: rule.ExpiresAt(now),
+		CreatedAt: now,
+	})
+	return err
+}
+
+// tryAwardPoints runs awardPoints for a request that has already succeeded;
+// failures are logged rather than failing the request
+func tryAwardPoints(db *mongo.Database, memberID primitive.ObjectID, clubID *primitive.ObjectID, source string, sourceID primitive.ObjectID, spend models.Money) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := awardPoints(ctx, db, memberID, clubID, source, sourceID, spend); err != nil {
+		log.Printf("loyalty: failed to award %s points for %s: %v", source, sourceID.Hex(), err)
+	}
+}
+
+// expireLoyaltyPoints posts expiry entries for points past their expiry date.
+// Debits consume the oldest points first, so the amount to expire is what
+// has been earned with an expiry before now, less everything already debited.
+func expireLoyaltyPoints(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	transactions := db.Collection("points_transactions")
+	memberIDs, err := transactions.Distinct(ctx, "member_id", bson.M{
+		"type":       models.PointsEarn,
+		"expires_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	expiredMembers := 0
+	for _, id := range memberIDs {
+		memberID, ok := id.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"member_id": memberID}}},
+			{{Key: "$group", Value: bson.M{
+				"_id": nil,
+				"expired_earned": bson.M{"$sum": bson.M{"$cond": bson.A{
+					bson.M{"$and": bson.A{
+						bson.M{"$gt": bson.A{"$points", 0}},
+						bson.M{"$lte": bson.A{"$expires_at", now}},
+						bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$expires_at", nil}}, nil}},
+					}},
+					"$points", 0,
+				}}},
+				"debited": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$points", 0}}, bson.M{"$abs": "$points"}, 0}}},
+			}}},
+		}
+		cursor, err := transactions.Aggregate(ctx, pipeline)
+		if err != nil {
+			return expiredMembers, err
+		}
+		var totals []struct {
+			ExpiredEarned int `bson:"expired_earned"`
+			Debited       int `bson:"debited"`
+		}
+		if err := cursor.All(ctx, &totals); err != nil {
+			return expiredMembers, err
+		}
+		if len(totals) == 0 {
+			continue
+		}
+
+		var member models.Member
+		if err := db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return expiredMembers, err
+		}
+
+		points := pointsToExpire(totals[0].ExpiredEarned, totals[0].Debited, member.LoyaltyPoints)
+		if points == 0 {
+			continue
+		}
+
+		_, err = postPoints(ctx, db, models.PointsTransaction{
+			MemberID:    memberID,
+			Type:        models.PointsExpire,
+			Source:      models.PointsSourceExpiry,
+			Points:      -points,
+			Description: "Points expired",
+			CreatedAt:   now,
+		})
+		if err != nil && err != errInsufficientPoints {
+			return expiredMembers, err
+		}
+		if err == nil {
+			expiredMembers++
+		}
+	}
+	return expiredMembers, nil
+}
+
+// pointsToExpire returns how many points lapse given the total earned with a
+// past expiry date, the total debited so far and the current balance
+func pointsToExpire(expiredEarned, debited, balance int) int {
+	points := expiredEarned - debited
+	if points > balance {
+		points = balance
+	}
+	if points < 0 {
+		return 0
+	}
+	return points
+}
+
+// findLoyaltyRule returns the active rule for a club, falling back to the default rule
+func findLoyaltyRule(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID) (*models.LoyaltyRule, error) {
+	collection := db.Collection("loyalty_rules")
+
+	var rule models.LoyaltyRule
+	if clubID != nil {
+		err := collection.FindOne(ctx, bson.M{"club_id": *clubID, "active": true}).Decode(&rule)
+		if err == nil {
+			return &rule, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	err := collection.FindOne(ctx, bson.M{"club_id": bson.M{"$exists": false}, "active": true}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// restaurantClubID returns the club a restaurant belongs to
+func restaurantClubID(ctx context.Context, db *mongo.Database, restaurantID *primitive.ObjectID) (*primitive.ObjectID, error) {
+	if restaurantID == nil {
+		return nil, nil
+	}
+	var restaurant models.Restaurant
+	err := db.Collection("restaurants").FindOne(ctx, bson.M{"_id": *restaurantID}).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restaurant.ClubID, nil
+}
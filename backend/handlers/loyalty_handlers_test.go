@@ -0,0 +1,27 @@
+package handlers
+
+import "testing"
+
+func TestPointsToExpire(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiredEarned int
+		debited       int
+		balance       int
+		want          int
+	}{
+		{"nothing spent", 100, 0, 150, 100},
+		{"partly spent", 100, 30, 120, 70},
+		{"spending covers expired points", 100, 100, 50, 0},
+		{"already expired", 100, 130, 20, 0},
+		{"capped at balance", 100, 0, 40, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pointsToExpire(tt.expiredEarned, tt.debited, tt.balance); got != tt.want {
+				t.Errorf("pointsToExpire(%d, %d, %d) = %d, want %d", tt.expiredEarned, tt.debited, tt.balance, got, tt.want)
+			}
+		})
+	}
+}
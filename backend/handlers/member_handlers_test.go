@@ -335,3 +335,111 @@ func TestUpdateMemberInvalidID(t *testing.T) {
 		t.Errorf("Expected status 400 for invalid ID, got %d", w.Code)
 	}
 }
+
+func TestReleaseFutureCommitments(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	memberID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	waitingID := primitive.NewObjectID()
+	upcomingID := insertEnrollmentClass(t, db, 2, []primitive.ObjectID{memberID, otherID}, []primitive.ObjectID{waitingID})
+	pastID := insertEnrollmentClass(t, db, 2, []primitive.ObjectID{memberID}, nil)
+	if _, err := db.Collection("classes").UpdateOne(ctx, bson.M{"_id": pastID},
+		bson.M{"$set": bson.M{"date": time.Now().AddDate(0, 0, -7)}}); err != nil {
+		t.Fatalf("Failed to move class into the past: %v", err)
+	}
+
+	effects, err := releaseFutureCommitments(ctx, db, memberID, time.Now())
+	if err != nil {
+		t.Fatalf("releaseFutureCommitments failed: %v", err)
+	}
+	if len(effects) != 1 || effects[0] != "cancelled 1 class bookings" {
+		t.Errorf("Expected one cancelled class booking, got %v", effects)
+	}
+
+	statuses := map[string]string{}
+	cursor, err := db.Collection("class_bookings").Find(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to read bookings: %v", err)
+	}
+	var bookings []models.ClassBooking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		t.Fatalf("Failed to read bookings: %v", err)
+	}
+	for _, booking := range bookings {
+		statuses[booking.ClassID.Hex()+"/"+booking.MemberID.Hex()] = booking.Status
+	}
+
+	want := map[string]string{
+		upcomingID.Hex() + "/" + memberID.Hex():  models.ClassBookingCancelled,
+		upcomingID.Hex() + "/" + otherID.Hex():   models.ClassBookingConfirmed,
+		upcomingID.Hex() + "/" + waitingID.Hex(): models.ClassBookingConfirmed,
+		pastID.Hex() + "/" + memberID.Hex():      models.ClassBookingConfirmed,
+	}
+	for key, status := range want {
+		if statuses[key] != status {
+			t.Errorf("Booking %s: expected status %s, got %s", key, status, statuses[key])
+		}
+	}
+}
+
+func TestTransitionMemberFinishesAbandonedChange(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+
+	ctx := context.Background()
+	memberID := primitive.NewObjectID()
+	classID := insertEnrollmentClass(t, db, 2, []primitive.ObjectID{memberID}, nil)
+
+	// A cancellation whose status was written but whose side effects and
+	// audit record were not finished
+	changedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	if _, err := db.Collection("members").InsertOne(ctx, models.Member{
+		ID:              memberID,
+		FirstName:       "Test",
+		Status:          models.MemberStatusCancelled,
+		StatusChangedAt: &changedAt,
+	}); err != nil {
+		t.Fatalf("Failed to insert member: %v", err)
+	}
+	if _, err := db.Collection("member_status_changes").InsertOne(ctx, models.MemberStatusChange{
+		MemberID:  memberID,
+		Action:    "cancel",
+		From:      models.MemberStatusActive,
+		To:        models.MemberStatusCancelled,
+		Reason:    "Moving away",
+		ChangedAt: changedAt,
+		Pending:   true,
+	}); err != nil {
+		t.Fatalf("Failed to insert status change: %v", err)
+	}
+
+	// Retrying the cancellation finishes it
+	member, change, err := transitionMember(ctx, db, memberID, "cancel", "Moving away", nil)
+	if err != nil {
+		t.Fatalf("transitionMember failed: %v", err)
+	}
+	if member.Status != models.MemberStatusCancelled || change.Pending {
+		t.Errorf("Expected a finished cancellation, got status %s, pending %v", member.Status, change.Pending)
+	}
+	if len(change.Effects) != 1 || change.Effects[0] != "cancelled 1 class bookings" {
+		t.Errorf("Expected the class booking to be cancelled, got effects %v", change.Effects)
+	}
+	if class := loadEnrollmentClass(t, db, classID); len(class.EnrolledMembers) != 0 {
+		t.Errorf("Expected the member to leave the class, got %v", class.EnrolledMembers)
+	}
+
+	pending, err := db.Collection("member_status_changes").CountDocuments(ctx, bson.M{"member_id": memberID, "pending": true})
+	if err != nil {
+		t.Fatalf("Failed to count changes: %v", err)
+	}
+	if pending != 0 {
+		t.Errorf("Expected no pending status changes, got %d", pending)
+	}
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errUnknownStatusAction = errors.New("unknown status action")
+	errReasonRequired      = errors.New("a reason is required for this status change")
+	errStatusChanged       = errors.New("member status changed concurrently, please retry")
+	errMemberSuspended     = errors.New("member is suspended for non-payment")
+)
+
+// memberAccessError is returned when a member's status does not let them
+// use the club
+type memberAccessError struct {
+	status string
+}
+
+func (e *memberAccessError) Error() string {
+	if e.status == models.MemberStatusSuspended {
+		return errMemberSuspended.Error()
+	}
+	return fmt.Sprintf("member status is '%s'; only active and past-due members can check in or book", e.status)
+}
+
+// requireClubAccess returns a *memberAccessError when the member's status
+// does not allow them to check in, book or charge to their account
+func requireClubAccess(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID) error {
+	var member models.Member
+	err := db.Collection("members").FindOne(ctx, bson.M{"_id": memberID},
+		options.FindOne().SetProjection(bson.M{"status": 1})).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return checkClubAccess(member)
+}
+
+// checkClubAccess is requireClubAccess for a member already loaded
+func checkClubAccess(member models.Member) error {
+	if !models.CanUseClub(member.Status) {
+		status, ok := models.NormalizeMemberStatus(member.Status)
+		if !ok {
+			status = member.Status
+		}
+		return &memberAccessError{status: status}
+	}
+	return nil
+}
+
+// writeClubAccessError answers a request refused by requireClubAccess
+func writeClubAccessError(w http.ResponseWriter, err error) {
+	var denied *memberAccessError
+	if errors.As(err, &denied) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// invalidTransitionError reports an action that is not allowed from the member's current status
+type invalidTransitionError struct {
+	action string
+	from   string
+}
+
+func (e *invalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot %s a member whose status is '%s'", e.action, e.from)
+}
+
+// ChangeMemberStatus applies a lifecycle action such as freeze or cancel
+func (h *MemberHandler) ChangeMemberStatus(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var changedBy *primitive.ObjectID
+	if user := currentUser(r); user != nil {
+		changedBy = &user.ID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	member, change, err := transitionMember(ctx, h.collection.Database(), memberID, r.PathValue("action"), requestData.Reason, changedBy)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"member": member,
+		"change": change,
+	})
+}
+
+// GetMemberStatusHistory returns a member's lifecycle transitions, newest first
+func (h *MemberHandler) GetMemberStatusHistory(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "changed_at", Value: -1}})
+	cursor, err := h.collection.Database().Collection("member_status_changes").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var changes []models.MemberStatusChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []models.MemberStatusChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// writeTransitionError maps lifecycle errors onto HTTP responses
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var invalid *invalidTransitionError
+	switch {
+	case err == mongo.ErrNoDocuments:
+		http.Error(w, "Member not found", http.StatusNotFound)
+	case err == errUnknownStatusAction, err == errReasonRequired:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &invalid), err == errStatusChanged:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// abandonedChangeAge is how old a pending status change must be before it
+// is taken to belong to a request that failed, rather than one in progress;
+// requests time out well before
+const abandonedChangeAge = 30 * time.Second
+
+// transitionMember applies a lifecycle action to a member, runs its side
+// effects and records the change. The change is recorded as pending before
+// the status is written and only completed once the side effects have run,
+// so a transition that fails part way is finished by the next one, or by
+// retrying it. The status write is conditional on the status read, so two
+// concurrent actions cannot both succeed.
+func transitionMember(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, actionName, reason string, changedBy *primitive.ObjectID) (*models.Member, *models.MemberStatusChange, error) {
+	action, ok := models.MemberStatusActions[actionName]
+	if !ok {
+		return nil, nil, errUnknownStatusAction
+	}
+	reason = strings.TrimSpace(reason)
+	if action.RequiresReason && reason == "" {
+		return nil, nil, errReasonRequired
+	}
+
+	members := db.Collection("members")
+	changes := db.Collection("member_status_changes")
+
+	var unfinished models.MemberStatusChange
+	err := changes.FindOne(ctx, bson.M{"member_id": memberID, "pending": true}).Decode(&unfinished)
+	switch {
+	case err == nil:
+		if time.Since(unfinished.ChangedAt) < abandonedChangeAge {
+			return nil, nil, errStatusChanged
+		}
+		finished, err := finishStatusChange(ctx, db, unfinished)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Retrying the failed action finishes it rather than failing
+		if finished != nil && finished.Action == action.Name {
+			var member models.Member
+			if err := members.FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+				return nil, nil, err
+			}
+			return &member, finished, nil
+		}
+	case err != mongo.ErrNoDocuments:
+		return nil, nil, err
+	}
+
+	var member models.Member
+	if err := members.FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		return nil, nil, err
+	}
+
+	from, ok := models.NormalizeMemberStatus(member.Status)
+	if !ok {
+		from = member.Status
+	}
+	if !action.Allows(from) {
+		return nil, nil, &invalidTransitionError{action: action.Name, from: from}
+	}
+
+	// Stored times keep milliseconds; the change is matched to the status
+	// write by its time
+	now := time.Now().Truncate(time.Millisecond)
+	set := bson.M{
+		"status":            action.To,
+		"status_reason":     reason,
+		"status_changed_at": now,
+		"updated_at":        now,
+	}
+	unset := bson.M{}
+
+	switch {
+	case action.To == models.MemberStatusFrozen:
+		set["frozen_at"] = now
+	case from == models.MemberStatusFrozen:
+		// Give back the time spent frozen
+		if member.FrozenAt != nil && !member.ExpiryDate.IsZero() {
+			set["expiry_date"] = member.ExpiryDate.Add(now.Sub(*member.FrozenAt))
+		}
+		unset["frozen_at"] = ""
+	}
+	if from == models.MemberStatusProspect && action.To == models.MemberStatusActive {
+		set["join_date"] = now
+	}
+	if action.To == models.MemberStatusCancelled || action.To == models.MemberStatusBanned {
+		set["auto_renewal"] = false
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	change := models.MemberStatusChange{
+		MemberID:  memberID,
+		Action:    action.Name,
+		From:      from,
+		To:        action.To,
+		Reason:    reason,
+		ChangedBy: changedBy,
+		ChangedAt: now,
+		Pending:   true,
+	}
+	insertResult, err := changes.InsertOne(ctx, change)
+	if err != nil {
+		return nil, nil, err
+	}
+	change.ID = insertResult.InsertedID.(primitive.ObjectID)
+
+	result, err := members.UpdateOne(ctx, bson.M{"_id": memberID, "status": member.Status}, update)
+	if err != nil {
+		// Whether the status was written is unknown; the pending change is
+		// finished or dropped once it is abandoned
+		return nil, nil, err
+	}
+	if result.MatchedCount == 0 {
+		changes.DeleteOne(ctx, bson.M{"_id": change.ID})
+		return nil, nil, errStatusChanged
+	}
+
+	finished, err := finishStatusChange(ctx, db, change)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := members.FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		return nil, nil, err
+	}
+	return &member, finished, nil
+}
+
+// finishStatusChange runs the side effects of a pending status change and
+// marks it complete. Side effects only act on what is left to do, so a
+// change can be finished again after failing part way. A change whose
+// status was never written is dropped, and nil returned.
+func finishStatusChange(ctx context.Context, db *mongo.Database, change models.MemberStatusChange) (*models.MemberStatusChange, error) {
+	changes := db.Collection("member_status_changes")
+
+	var member models.Member
+	if err := db.Collection("members").FindOne(ctx, bson.M{"_id": change.MemberID}).Decode(&member); err != nil {
+		return nil, err
+	}
+	if member.Status != change.To || member.StatusChangedAt == nil || !member.StatusChangedAt.Equal(change.ChangedAt) {
+		if _, err := changes.DeleteOne(ctx, bson.M{"_id": change.ID}); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var effects []string
+	if change.From == models.MemberStatusProspect && change.To == models.MemberStatusActive {
+		if err := startReferralQualification(ctx, db, change.MemberID, change.ChangedAt); err != nil {
+			return nil, err
+		}
+	}
+	switch change.To {
+	case models.MemberStatusCancelled, models.MemberStatusBanned, models.MemberStatusExpired:
+		released, err := releaseFutureCommitments(ctx, db, change.MemberID, change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		effects = released
+	}
+
+	if _, err := changes.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{
+		"$push":  bson.M{"effects": bson.M{"$each": append([]string{}, effects...)}},
+		"$unset": bson.M{"pending": ""},
+	}); err != nil {
+		return nil, err
+	}
+	change.Effects = append(change.Effects, effects...)
+	change.Pending = false
+	return &change, nil
+}
+
+// releaseFutureCommitments cancels a member's upcoming class and office
+// bookings, giving their class places to the waitlists
+func releaseFutureCommitments(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, now time.Time) ([]string, error) {
+	var effects []string
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// Only the classes the member is booked into are looked at, not every
+	// upcoming class
+	bookedIDs, err := db.Collection("class_bookings").Distinct(ctx, "class_id", bson.M{
+		"member_id": memberID,
+		"status":    bson.M{"$in": []string{models.ClassBookingConfirmed, models.ClassBookingWaitlist}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var upcomingIDs []interface{}
+	if len(bookedIDs) > 0 {
+		upcomingIDs, err = db.Collection("classes").Distinct(ctx, "_id", bson.M{
+			"_id":  bson.M{"$in": bookedIDs},
+			"date": bson.M{"$gte": today},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(upcomingIDs) > 0 {
+		cancelled := 0
+		for {
+			_, err := cancelClassBooking(ctx, db, bson.M{
+				"member_id": memberID,
+				"class_id":  bson.M{"$in": upcomingIDs},
+			})
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			cancelled++
+		}
+		if cancelled > 0 {
+			effects = append(effects, fmt.Sprintf("cancelled %d class bookings", cancelled))
+		}
+	}
+
+	officeResult, err := db.Collection("office_bookings").UpdateMany(ctx, bson.M{
+		"member_id":  memberID,
+		"start_time": bson.M{"$gt": now},
+		"status":     "confirmed",
+	}, bson.M{"$set": bson.M{"status": "cancelled", "updated_at": now}})
+	if err != nil {
+		return nil, err
+	}
+	if officeResult.ModifiedCount > 0 {
+		effects = append(effects, fmt.Sprintf("cancelled %d office bookings", officeResult.ModifiedCount))
+	}
+
+	return effects, nil
+}
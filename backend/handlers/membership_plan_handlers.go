@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errPlanNotFound       = errors.New("membership plan not found")
+	errPlanUnavailable    = errors.New("membership plan is not active or not offered at the member's club")
+	errSamePlan           = errors.New("member is already on this plan")
+	errPlanChangeInactive = errors.New("only active members can change plans")
+	errNoRenewalDate      = errors.New("member has no upcoming renewal date")
+	errUnknownTiming      = errors.New("timing must be 'now' or 'renewal'")
+	errPlanChanged        = errors.New("member's plan was changed at the same time; try again")
+)
+
+// MembershipPlanHandler manages membership plans and moves members between
+// them, with prorated billing for changes that take effect straight away
+type MembershipPlanHandler struct {
+	db *mongo.Database
+}
+
+func NewMembershipPlanHandler(db *mongo.Database) *MembershipPlanHandler {
+	return &MembershipPlanHandler{db: db}
+}
+
+// GetPlans returns membership plans, optionally only those offered at club_id or only active ones
+func (h *MembershipPlanHandler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["$or"] = bson.A{
+			bson.M{"club_id": objID},
+			bson.M{"club_id": bson.M{"$exists": false}},
+		}
+	}
+	if r.URL.Query().Get("active") == "true" {
+		filter["active"] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := h.db.Collection("membership_plans").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var plans []models.MembershipPlan
+	if err := cursor.All(ctx, &plans); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if plans == nil {
+		plans = []models.MembershipPlan{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+// CreatePlan adds a membership plan
+func (h *MembershipPlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage membership plans", http.StatusForbidden)
+		return
+	}
+
+	var plan models.MembershipPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePlan(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	plan.ID = primitive.NilObjectID
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+
+	result, err := h.db.Collection("membership_plans").InsertOne(ctx, plan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	plan.ID = result.InsertedID.(primitive.ObjectID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// UpdatePlan changes a plan's name, price and terms. Members already on the
+// plan keep their membership_type until their plan next changes.
+func (h *MembershipPlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage membership plans", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	var plan models.MembershipPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePlan(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":           plan.Name,
+			"description":    plan.Description,
+			"price":          plan.Price,
+			"billing_period": plan.BillingPeriod,
+			"active":         plan.Active,
+			"updated_at":     time.Now(),
+		},
+	}
+
+	var updated models.MembershipPlan
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("membership_plans").FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// planChangeRequest selects the new plan and when the change takes effect
+type planChangeRequest struct {
+	PlanID primitive.ObjectID `json:"plan_id"`
+	Timing string             `json:"timing"` // now (default), renewal
+}
+
+// PreviewPlanChange returns the credit, charge and invoice lines a plan
+// change would produce, without changing anything
+func (h *MembershipPlanHandler) PreviewPlanChange(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData planChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	change, _, _, err := quotePlanChange(ctx, h.db, memberID, requestData, time.Now())
+	if err != nil {
+		writePlanChangeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// ChangePlan moves a member to another plan. A change now switches the plan
+// at once and bills the prorated difference: an invoice when the member owes
+// money, account credit when they are owed. A change at renewal is scheduled
+// for the member's expiry date and replaces any change already scheduled.
+func (h *MembershipPlanHandler) ChangePlan(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData planChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	change, member, clubID, err := quotePlanChange(ctx, h.db, memberID, requestData, now)
+	if err != nil {
+		writePlanChangeError(w, err)
+		return
+	}
+	if user := currentUser(r); user != nil {
+		change.CreatedBy = &user.ID
+	}
+
+	if change.Timing == models.PlanChangeNow {
+		if err := switchMemberPlan(ctx, h.db, member.ID, change.FromPlanID, &change.ToPlanID, change.ToPlan); err != nil {
+			writePlanChangeError(w, err)
+			return
+		}
+		if err := billPlanChange(ctx, h.db, change, clubID, now); err != nil {
+			if revertErr := switchMemberPlan(ctx, h.db, member.ID, &change.ToPlanID, member.PlanID, member.MembershipType); revertErr != nil {
+				log.Printf("plan changes: failed to restore plan of member %s: %v", member.ID.Hex(), revertErr)
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		change.Status = models.PlanChangeStatusApplied
+		change.AppliedAt = &now
+	}
+
+	// A new change replaces whatever was scheduled for the renewal
+	if _, err := h.db.Collection("plan_changes").UpdateMany(ctx,
+		bson.M{"member_id": member.ID, "status": models.PlanChangeStatusScheduled},
+		bson.M{"$set": bson.M{"status": models.PlanChangeStatusCancelled, "cancelled_at": now}},
+	); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := h.db.Collection("plan_changes").InsertOne(ctx, change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	change.ID = result.InsertedID.(primitive.ObjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(change)
+}
+
+// GetMemberPlanChanges returns a member's plan changes, newest first
+func (h *MembershipPlanHandler) GetMemberPlanChanges(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("plan_changes").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var changes []models.PlanChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []models.PlanChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// CancelPlanChange cancels a change scheduled for the next renewal
+func (h *MembershipPlanHandler) CancelPlanChange(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid plan change ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var cancelled models.PlanChange
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("plan_changes").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.PlanChangeStatusScheduled},
+		bson.M{"$set": bson.M{"status": models.PlanChangeStatusCancelled, "cancelled_at": now}},
+		opts).Decode(&cancelled)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := h.db.Collection("plan_changes").CountDocuments(ctx, bson.M{"_id": id})
+		if countErr == nil && count > 0 {
+			http.Error(w, "Only scheduled plan changes can be cancelled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Plan change not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cancelled)
+}
+
+// ApplyScheduledPlanChanges is the scheduled entry point for renewal plan changes
+func ApplyScheduledPlanChanges(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := applyScheduledPlanChanges(ctx, db, time.Now())
+		return err
+	}
+}
+
+// applyScheduledPlanChanges switches members whose renewal date has arrived
+// to the plan scheduled for it. A change is cancelled instead when the
+// member's plan was changed some other way in the meantime.
+func applyScheduledPlanChanges(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	changes := db.Collection("plan_changes")
+	cursor, err := changes.Find(ctx, bson.M{"status": models.PlanChangeStatusScheduled, "effective_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	var due []models.PlanChange
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, change := range due {
+		status, stamp := models.PlanChangeStatusApplied, "applied_at"
+		err := switchMemberPlan(ctx, db, change.MemberID, change.FromPlanID, &change.ToPlanID, change.ToPlan)
+		if err == errPlanChanged {
+			status, stamp = models.PlanChangeStatusCancelled, "cancelled_at"
+		} else if err != nil {
+			return applied, err
+		}
+
+		if _, err := changes.UpdateOne(ctx, bson.M{"_id": change.ID, "status": models.PlanChangeStatusScheduled}, bson.M{
+			"$set": bson.M{"status": status, stamp: now},
+		}); err != nil {
+			return applied, err
+		}
+		if status == models.PlanChangeStatusApplied {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// quotePlanChange works out a plan change for a member, with tax on its
+// lines from the club's membership tax rule. It returns the change, the
+// member and the club the change is billed at.
+func quotePlanChange(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, req planChangeRequest, now time.Time) (*models.PlanChange, *models.Member, *primitive.ObjectID, error) {
+	if req.Timing == "" {
+		req.Timing = models.PlanChangeNow
+	}
+	if req.Timing != models.PlanChangeNow && req.Timing != models.PlanChangeAtRenewal {
+		return nil, nil, nil, errUnknownTiming
+	}
+
+	var member models.Member
+	if err := db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		return nil, nil, nil, err
+	}
+	if member.Status != models.MemberStatusActive {
+		return nil, nil, nil, errPlanChangeInactive
+	}
+
+	to, err := findPlan(ctx, db, req.PlanID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !to.Active || (to.ClubID != nil && !containsObjectID(member.ClubIDs, *to.ClubID)) {
+		return nil, nil, nil, errPlanUnavailable
+	}
+
+	var from *models.MembershipPlan
+	if member.PlanID != nil {
+		from, err = findPlan(ctx, db, *member.PlanID)
+		if err != nil && err != errPlanNotFound {
+			return nil, nil, nil, err
+		}
+	}
+	if from != nil && from.ID == to.ID {
+		return nil, nil, nil, errSamePlan
+	}
+	if from != nil && !from.Price.SameCurrency(to.Price) {
+		return nil, nil, nil, models.ErrCurrencyMismatch
+	}
+	if req.Timing == models.PlanChangeAtRenewal && !member.ExpiryDate.After(now) {
+		return nil, nil, nil, errNoRenewalDate
+	}
+
+	change := models.NewPlanChange(member.ID, from, *to, req.Timing, member.ExpiryDate, now)
+
+	clubID := to.ClubID
+	if clubID == nil && from != nil {
+		clubID = from.ClubID
+	}
+	if clubID == nil && len(member.ClubIDs) > 0 {
+		clubID = &member.ClubIDs[0]
+	}
+
+	// The credit and the charge are both membership, taxed under the same rule
+	if len(change.Lines) > 0 {
+		terms := []models.InvoiceLine{{ProductType: models.ProductTypeMembership}}
+		if err := applyTaxRules(ctx, db, clubID, terms); err != nil {
+			return nil, nil, nil, err
+		}
+		for i := range change.Lines {
+			change.Lines[i].TaxRate = terms[0].TaxRate
+			change.Lines[i].TaxInclusive = terms[0].TaxInclusive
+		}
+		change.Recalculate()
+	}
+	return &change, &member, clubID, nil
+}
+
+// billPlanChange invoices what the member owes for a change, or adds what
+// they are owed to their account credit
+func billPlanChange(ctx context.Context, db *mongo.Database, change *models.PlanChange, clubID *primitive.ObjectID, now time.Time) error {
+	description := "Plan change to " + change.ToPlan
+	if change.FromPlan != "" {
+		description = "Plan change from " + change.FromPlan + " to " + change.ToPlan
+	}
+
+	switch {
+	case change.Total.IsPositive():
+		invoice := models.Invoice{
+			MemberID:  &change.MemberID,
+			ClubID:    clubID,
+			Status:    models.InvoiceStatusOpen,
+			Lines:     change.Lines,
+			IssuedAt:  &now,
+			DueDate:   now.AddDate(0, 0, 14),
+			Notes:     description,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		invoice.Recalculate()
+
+		number, err := nextInvoiceNumber(ctx, db, now)
+		if err != nil {
+			return err
+		}
+		invoice.Number = number
+
+		result, err := db.Collection("invoices").InsertOne(ctx, invoice)
+		if err != nil {
+			return err
+		}
+		invoiceID := result.InsertedID.(primitive.ObjectID)
+		change.InvoiceID = &invoiceID
+		tryApplyAccountCredit(db, invoiceID)
+
+	case change.Total.IsNegative():
+		posted, err := postAccountCredit(ctx, db, models.AccountCreditTransaction{
+			MemberID:    change.MemberID,
+			Amount:      change.Total.Neg(),
+			Source:      models.AccountCreditSourcePlanChange,
+			Description: description,
+			CreatedBy:   change.CreatedBy,
+		})
+		if err != nil {
+			return err
+		}
+		change.AccountCreditID = &posted.ID
+	}
+	return nil
+}
+
+// switchMemberPlan moves a member from one plan to another, provided they
+// are still on the plan expected (none when from is nil)
+func switchMemberPlan(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, from, to *primitive.ObjectID, membershipType string) error {
+	filter := bson.M{"_id": memberID, "plan_id": from}
+	if from == nil {
+		filter["plan_id"] = bson.M{"$exists": false}
+	}
+
+	set := bson.M{"membership_type": membershipType, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if to != nil {
+		set["plan_id"] = *to
+	} else {
+		update["$unset"] = bson.M{"plan_id": ""}
+	}
+
+	result, err := db.Collection("members").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errPlanChanged
+	}
+	return nil
+}
+
+func findPlan(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.MembershipPlan, error) {
+	var plan models.MembershipPlan
+	err := db.Collection("membership_plans").FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return nil, errPlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func writePlanChangeError(w http.ResponseWriter, err error) {
+	switch err {
+	case mongo.ErrNoDocuments:
+		http.Error(w, "Member not found", http.StatusNotFound)
+	case errPlanNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errUnknownTiming:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errPlanUnavailable, errSamePlan, errPlanChangeInactive, errNoRenewalDate, models.ErrCurrencyMismatch:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errPlanChanged:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validatePlan checks and normalises a plan before it is saved
+func validatePlan(plan *models.MembershipPlan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return errors.New("name is required")
+	}
+	if plan.Price.IsNegative() {
+		return errors.New("price cannot be negative")
+	}
+	if plan.Price.Currency == "" {
+		plan.Price.Currency = models.DefaultCurrency
+	}
+	if plan.BillingPeriod == "" {
+		plan.BillingPeriod = models.PlanPeriodMonthly
+	}
+	if plan.BillingPeriod != models.PlanPeriodMonthly && plan.BillingPeriod != models.PlanPeriodAnnual {
+		return errors.New("billing_period must be 'monthly' or 'annual'")
+	}
+	return nil
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
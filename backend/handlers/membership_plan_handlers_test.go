@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestValidatePlan(t *testing.T) {
+	plan := models.MembershipPlan{Name: " Premium ", Price: models.Money{Amount: 6200}}
+	if err := validatePlan(&plan); err != nil {
+		t.Fatalf("validatePlan: %v", err)
+	}
+	if plan.Name != "Premium" || plan.BillingPeriod != models.PlanPeriodMonthly || plan.Price.Currency != models.DefaultCurrency {
+		t.Errorf("Expected name trimmed and defaults set, got %+v", plan)
+	}
+
+	invalid := map[string]models.MembershipPlan{
+		"no name":        {Price: models.Cents(100)},
+		"negative price": {Name: "Refund", Price: models.Cents(-100)},
+		"weekly":         {Name: "Weekly", Price: models.Cents(100), BillingPeriod: "weekly"},
+	}
+	for name, plan := range invalid {
+		if err := validatePlan(&plan); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -112,6 +112,18 @@ func CreateOfficeBooking(collection *mongo.Collection) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		if booking.MemberID != nil {
+			if err := requireClubAccess(ctx, collection.Database(), *booking.MemberID); err != nil {
+				writeClubAccessError(w, err)
+				return
+			}
+		}
+
+		if err := applyBookingTax(ctx, collection.Database(), &booking); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		result, err := collection.InsertOne(ctx, booking)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -119,6 +131,9 @@ func CreateOfficeBooking(collection *mongo.Collection) http.HandlerFunc {
 		}
 
 		booking.ID = result.InsertedID.(primitive.ObjectID)
+		if booking.Status == "completed" {
+			trySyncOfficeBookingCharge(collection.Database(), booking)
+		}
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(booking)
 	}
@@ -146,16 +161,25 @@ func UpdateOfficeBooking(collection *mongo.Collection) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		if err := applyBookingTax(ctx, collection.Database(), &booking); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		update := bson.M{
 			"$set": bson.M{
-				"office_id":  booking.OfficeID,
-				"member_id":  booking.MemberID,
-				"start_time": booking.StartTime,
-				"end_time":   booking.EndTime,
-				"status":     booking.Status,
-				"total_cost": booking.TotalCost,
-				"notes":      booking.Notes,
-				"updated_at": booking.UpdatedAt,
+				"office_id":      booking.OfficeID,
+				"member_id":      booking.MemberID,
+				"start_time":     booking.StartTime,
+				"end_time":       booking.EndTime,
+				"status":         booking.Status,
+				"total_cost":     booking.TotalCost,
+				"tax_rate":       booking.TaxRate,
+				"tax_inclusive":  booking.TaxInclusive,
+				"tax_amount":     booking.TaxAmount,
+				"total_with_tax": booking.TotalWithTax,
+				"notes":          booking.Notes,
+				"updated_at":     booking.UpdatedAt,
 			},
 		}
 
@@ -170,7 +194,12 @@ func UpdateOfficeBooking(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
+		if booking.Status == "cancelled" {
+			tryCreditCancelledBooking(collection.Database(), objectID)
+		}
+
 		booking.ID = objectID
+		trySyncOfficeBookingCharge(collection.Database(), booking)
 		json.NewEncoder(w).Encode(booking)
 	}
 }
@@ -200,6 +229,7 @@ func DeleteOfficeBooking(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
+		tryRemoveAccountCharge(collection.Database(), models.ProductTypeOfficeBooking, objectID)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
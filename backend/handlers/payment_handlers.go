@@ -0,0 +1,578 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/payments"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxWebhookBytes bounds the size of a provider webhook body
+const maxWebhookBytes = 1 << 20
+
+var errNoPaymentMethod = errors.New("provide payment_method_id or card, or save a default card for the member")
+
+type PaymentHandler struct {
+	db       *mongo.Database
+	provider payments.Provider
+	dunning  *DunningHandler
+}
+
+func NewPaymentHandler(db *mongo.Database, provider payments.Provider, dunning *DunningHandler) *PaymentHandler {
+	return &PaymentHandler{db: db, provider: provider, dunning: dunning}
+}
+
+// cardRequest is raw card details; they are passed to the provider and never stored
+type cardRequest struct {
+	Number   string `json:"number"`
+	ExpMonth int    `json:"exp_month"`
+	ExpYear  int    `json:"exp_year"`
+	CVC      string `json:"cvc"`
+}
+
+func (c cardRequest) details() payments.CardDetails {
+	return payments.CardDetails{Number: c.Number, ExpMonth: c.ExpMonth, ExpYear: c.ExpYear, CVC: c.CVC}
+}
+
+// GetPaymentMethods returns a member's saved cards, default first
+func (h *PaymentHandler) GetPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "is_default", Value: -1}, {Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("payment_methods").Find(ctx, bson.M{"member_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var methods []models.PaymentMethod
+	if err := cursor.All(ctx, &methods); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if methods == nil {
+		methods = []models.PaymentMethod{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
+
+// SavePaymentMethod saves a card with the provider for later charges. The
+// member's first card becomes their default.
+func (h *PaymentHandler) SavePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		cardRequest
+		Default bool `json:"default"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	method, err := h.saveCard(ctx, memberID, requestData.cardRequest, requestData.Default)
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidCard) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(method)
+}
+
+// DeletePaymentMethod removes a saved card
+func (h *PaymentHandler) DeletePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment method ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.db.Collection("payment_methods").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Payment method not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PayInvoice charges a card through the payment provider and applies the
+// payment to the invoice. The card is a saved payment method, new card
+// details (optionally saved) or, by default, the member's default card.
+// Declined charges are recorded and answered with 402.
+func (h *PaymentHandler) PayInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Amount          *models.Money `json:"amount"` // defaults to the amount due
+		PaymentMethodID string        `json:"payment_method_id"`
+		Card            *cardRequest  `json:"card"`
+		SaveCard        bool          `json:"save_card"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var invoice models.Invoice
+	if err := h.db.Collection("invoices").FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invoice.Status != models.InvoiceStatusOpen && invoice.Status != models.InvoiceStatusPartiallyPaid {
+		http.Error(w, errInvoiceNotPayable.Error(), http.StatusConflict)
+		return
+	}
+
+	amount := invoice.AmountDue
+	if requestData.Amount != nil {
+		amount = *requestData.Amount
+	}
+	if !amount.IsPositive() {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if !amount.SameCurrency(invoice.Total) {
+		http.Error(w, models.ErrCurrencyMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+	if amount.Cmp(invoice.AmountDue) > 0 {
+		http.Error(w, errOverpayment.Error(), http.StatusConflict)
+		return
+	}
+	pending, err := hasPendingPayment(ctx, h.db, invoice.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pending {
+		http.Error(w, errPaymentPending.Error(), http.StatusConflict)
+		return
+	}
+
+	method, err := h.resolveCard(ctx, invoice.MemberID, requestData.PaymentMethodID, requestData.Card, requestData.SaveCard)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrInvalidCard), err == errNoPaymentMethod:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err == mongo.ErrNoDocuments:
+			http.Error(w, "Payment method not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Retrying the same request while the invoice is unchanged must not charge twice
+	charge, err := h.provider.Charge(ctx, payments.ChargeRequest{
+		Amount:         amount,
+		CardToken:      method.Token,
+		Description:    "Invoice " + invoice.Number,
+		IdempotencyKey: fmt.Sprintf("%s:%d:%d:%s", invoice.ID.Hex(), invoice.AmountPaid.Amount, amount.Amount, method.Token),
+		Metadata:       map[string]string{"invoice_id": invoice.ID.Hex()},
+	})
+	if err != nil {
+		http.Error(w, "Payment provider error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	payment := models.Payment{
+		InvoiceID:      invoice.ID,
+		Amount:         amount,
+		Method:         "card",
+		Status:         paymentStatusForCharge(charge.Status),
+		Reference:      charge.ID,
+		Provider:       h.provider.Name(),
+		ChargeID:       charge.ID,
+		FailureCode:    charge.FailureCode,
+		FailureMessage: charge.FailureMessage,
+	}
+	if !method.ID.IsZero() {
+		payment.PaymentMethodID = &method.ID
+	}
+	if user := currentUser(r); user != nil {
+		payment.CreatedBy = &user.ID
+	}
+
+	updated, err := applyPayment(ctx, h.db, payment)
+	if err != nil {
+		// The card was charged but nothing was recorded; give the money back
+		if charge.Status == payments.ChargeSucceeded {
+			if _, refundErr := h.provider.Refund(ctx, payments.RefundRequest{ChargeID: charge.ID, Amount: amount, Reason: "invoice changed"}); refundErr != nil {
+				log.Printf("payments: failed to refund charge %s for invoice %s: %v", charge.ID, invoice.ID.Hex(), refundErr)
+			}
+		}
+		switch err {
+		case errInvoiceNotPayable, errOverpayment, errInvoiceChanged, errPaymentPending:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if charge.Status == payments.ChargeFailed {
+		h.dunning.tryOpenCase(invoice.ID)
+		http.Error(w, "Payment declined: "+charge.FailureMessage, http.StatusPaymentRequired)
+		return
+	}
+	h.dunning.tryRecoverCase(invoice.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// HandleWebhook receives provider notifications. It is public; requests are
+// authenticated by their signature. Events are recorded so redeliveries are
+// acknowledged without being processed twice.
+func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(payload, r.Header.Get(payments.SignatureHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	eventID := h.provider.Name() + ":" + event.ID
+	events := h.db.Collection("webhook_events")
+	if err := events.FindOne(ctx, bson.M{"_id": eventID}).Err(); err == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != mongo.ErrNoDocuments {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.processEvent(ctx, event); err != nil {
+		// A non-2xx answer makes the provider redeliver the event later
+		log.Printf("payments: failed to process webhook %s: %v", eventID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := events.InsertOne(ctx, bson.M{
+		"_id":         eventID,
+		"type":        event.Type,
+		"charge_id":   event.ChargeID,
+		"received_at": time.Now(),
+	}); err != nil && !mongo.IsDuplicateKeyError(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// processEvent settles pending payments. Updates are conditional on the
+// payment still being pending, so replays are harmless.
+func (h *PaymentHandler) processEvent(ctx context.Context, event *payments.Event) error {
+	var payment models.Payment
+	err := h.db.Collection("payments").FindOne(ctx, bson.M{
+		"provider":  h.provider.Name(),
+		"charge_id": event.ChargeID,
+	}).Decode(&payment)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("payments: webhook %s for unknown charge %s ignored", event.ID, event.ChargeID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case payments.EventChargeSucceeded:
+		if err := settlePendingPayment(ctx, h.db, h.provider, payment); err != nil {
+			return err
+		}
+		h.dunning.tryRecoverCase(payment.InvoiceID)
+	case payments.EventChargeFailed:
+		result, err := h.db.Collection("payments").UpdateOne(ctx,
+			bson.M{"_id": payment.ID, "status": models.PaymentStatusPending},
+			bson.M{"$set": bson.M{"status": models.PaymentStatusFailed, "failure_code": "charge_failed"}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			h.dunning.tryOpenCase(payment.InvoiceID)
+		}
+	case payments.EventChargeRefunded:
+		return recordProviderRefund(ctx, h.db, payment, event)
+	}
+	return nil
+}
+
+// recordProviderRefund issues a refund credit note for money refunded at the
+// provider rather than through a credit note, such as from its dashboard.
+// Refunds already recorded here are covered by the payment's amount refunded.
+func recordProviderRefund(ctx context.Context, db *mongo.Database, payment models.Payment, event *payments.Event) error {
+	if !event.Amount.SameCurrency(payment.Amount) {
+		return models.ErrCurrencyMismatch
+	}
+	unrecorded := event.Amount.Sub(payment.AmountRefunded)
+	if !unrecorded.IsPositive() {
+		return nil
+	}
+
+	_, err := issueCreditNote(ctx, db, nil, models.CreditNote{
+		InvoiceID: payment.InvoiceID,
+		Amount:    unrecorded,
+		Method:    models.CreditNoteRefund,
+		Reason:    "Refunded through " + payment.Provider,
+		PaymentID: &payment.ID,
+		RefundID:  event.ID,
+	})
+	if err == errOverCredit || err == errNoRefundablePayment {
+		// Nothing left to credit on our side; retrying would not change that
+		log.Printf("payments: refund webhook %s for charge %s not recorded: %v", event.ID, event.ChargeID, err)
+		return nil
+	}
+	return err
+}
+
+// settlePendingPayment marks a pending payment succeeded and applies it to
+// its invoice. The payment stays succeeded whatever the invoice can take, as
+// the money has been received; the excess is returned by returnOverpayment.
+// Once the payment is marked, failures are logged rather than returned: a
+// redelivered event would find nothing pending to settle.
+func settlePendingPayment(ctx context.Context, db *mongo.Database, provider payments.Provider, payment models.Payment) error {
+	now := time.Now()
+	result, err := db.Collection("payments").UpdateOne(ctx,
+		bson.M{"_id": payment.ID, "status": models.PaymentStatusPending},
+		bson.M{"$set": bson.M{"status": models.PaymentStatusSucceeded, "received_at": now}})
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+
+	excess, err := creditSettledPayment(ctx, db.Collection("invoices"), payment, now)
+	if err != nil {
+		log.Printf("payments: payment %s settled but could not be applied to invoice %s: %v", payment.ID.Hex(), payment.InvoiceID.Hex(), err)
+		return nil
+	}
+	if excess.IsPositive() {
+		returnOverpayment(ctx, db, provider, payment, excess)
+	}
+	return nil
+}
+
+// creditSettledPayment applies as much of a settled payment as its invoice
+// can take, retrying when the invoice changes concurrently, and returns the rest
+func creditSettledPayment(ctx context.Context, invoices *mongo.Collection, payment models.Payment, now time.Time) (models.Money, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		var invoice models.Invoice
+		err := invoices.FindOne(ctx, bson.M{"_id": payment.InvoiceID}).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			return payment.Amount, nil
+		}
+		if err != nil {
+			return models.Money{}, err
+		}
+
+		applied, excess := settlementSplit(invoice, payment.Amount)
+		if !applied.IsPositive() {
+			return excess, nil
+		}
+		err = creditInvoice(ctx, invoices, &invoice, applied, now)
+		if err == errInvoiceChanged {
+			continue
+		}
+		return excess, err
+	}
+	return models.Money{}, errInvoiceChanged
+}
+
+// settlementSplit divides a settled payment into the part its invoice can
+// still take and the excess, which is all of it when the invoice was paid,
+// closed or is in another currency in the meantime
+func settlementSplit(invoice models.Invoice, amount models.Money) (applied, excess models.Money) {
+	payable := invoice.Status == models.InvoiceStatusOpen || invoice.Status == models.InvoiceStatusPartiallyPaid
+	if !payable || !amount.SameCurrency(invoice.AmountDue) || !invoice.AmountDue.IsPositive() {
+		return models.NewMoney(0, amount.Currency), amount
+	}
+	applied = amount.Min(invoice.AmountDue)
+	return applied, amount.Sub(applied)
+}
+
+// returnOverpayment gives back the part of a settled payment its invoice
+// could not take: to the member's account credit, or else to the card
+func returnOverpayment(ctx context.Context, db *mongo.Database, provider payments.Provider, payment models.Payment, excess models.Money) {
+	if payment.MemberID != nil {
+		_, err := postAccountCredit(ctx, db, models.AccountCreditTransaction{
+			MemberID:    *payment.MemberID,
+			Amount:      excess,
+			Source:      models.AccountCreditSourceOverpayment,
+			SourceID:    &payment.ID,
+			Description: "Overpayment of charge " + payment.ChargeID,
+		})
+		if err == nil {
+			return
+		}
+		log.Printf("payments: failed to add overpayment of payment %s to account credit, refunding instead: %v", payment.ID.Hex(), err)
+	}
+
+	if _, err := provider.Refund(ctx, payments.RefundRequest{ChargeID: payment.ChargeID, Amount: excess, Reason: "overpayment"}); err != nil {
+		log.Printf("payments: failed to refund overpayment of %s on charge %s: %v", excess, payment.ChargeID, err)
+		return
+	}
+	// The provider's refund event is then already accounted for
+	if _, err := db.Collection("payments").UpdateOne(ctx, bson.M{"_id": payment.ID},
+		bson.M{"$set": bson.M{"amount_refunded": payment.AmountRefunded.Add(excess)}}); err != nil {
+		log.Printf("payments: failed to record refunded overpayment on payment %s: %v", payment.ID.Hex(), err)
+	}
+}
+
+// resolveCard picks the card to charge for an invoice
+func (h *PaymentHandler) resolveCard(ctx context.Context, memberID *primitive.ObjectID, paymentMethodID string, card *cardRequest, save bool) (*models.PaymentMethod, error) {
+	methods := h.db.Collection("payment_methods")
+	var method models.PaymentMethod
+
+	switch {
+	case paymentMethodID != "":
+		objID, err := primitive.ObjectIDFromHex(paymentMethodID)
+		if err != nil || memberID == nil {
+			return nil, mongo.ErrNoDocuments
+		}
+		if err := methods.FindOne(ctx, bson.M{"_id": objID, "member_id": *memberID}).Decode(&method); err != nil {
+			return nil, err
+		}
+		return &method, nil
+	case card != nil:
+		if save && memberID != nil {
+			return h.saveCard(ctx, *memberID, *card, false)
+		}
+		saved, err := h.provider.SaveCard(ctx, card.details())
+		if err != nil {
+			return nil, err
+		}
+		return &models.PaymentMethod{Provider: h.provider.Name(), Token: saved.Token, Brand: saved.Brand, Last4: saved.Last4}, nil
+	case memberID != nil:
+		err := methods.FindOne(ctx, bson.M{"member_id": *memberID, "is_default": true}).Decode(&method)
+		if err == mongo.ErrNoDocuments {
+			return nil, errNoPaymentMethod
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &method, nil
+	}
+	return nil, errNoPaymentMethod
+}
+
+// saveCard tokenizes a card with the provider and stores it for the member
+func (h *PaymentHandler) saveCard(ctx context.Context, memberID primitive.ObjectID, card cardRequest, makeDefault bool) (*models.PaymentMethod, error) {
+	saved, err := h.provider.SaveCard(ctx, card.details())
+	if err != nil {
+		return nil, err
+	}
+
+	methods := h.db.Collection("payment_methods")
+	existing, err := methods.CountDocuments(ctx, bson.M{"member_id": memberID})
+	if err != nil {
+		return nil, err
+	}
+
+	method := models.PaymentMethod{
+		MemberID:  memberID,
+		Provider:  h.provider.Name(),
+		Token:     saved.Token,
+		Brand:     saved.Brand,
+		Last4:     saved.Last4,
+		ExpMonth:  saved.ExpMonth,
+		ExpYear:   saved.ExpYear,
+		IsDefault: makeDefault || existing == 0,
+		CreatedAt: time.Now(),
+	}
+	if method.IsDefault {
+		if _, err := methods.UpdateMany(ctx, bson.M{"member_id": memberID}, bson.M{"$set": bson.M{"is_default": false}}); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := methods.InsertOne(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	method.ID = result.InsertedID.(primitive.ObjectID)
+	return &method, nil
+}
+
+// paymentStatusForCharge maps a provider charge status onto a payment status
+func paymentStatusForCharge(status string) string {
+	switch status {
+	case payments.ChargeSucceeded:
+		return models.PaymentStatusSucceeded
+	case payments.ChargePending:
+		return models.PaymentStatusPending
+	}
+	return models.PaymentStatusFailed
+}
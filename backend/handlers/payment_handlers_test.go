@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/payments"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHandleWebhookRejectsBadSignatures(t *testing.T) {
+	handler := NewPaymentHandler(nil, payments.NewFakeProvider("whsec_test"), nil)
+	payload := `{"id":"evt_1","type":"charge.succeeded","charge_id":"fake_ch_1","amount":{"amount":100,"currency":"USD"}}`
+
+	signatures := map[string]string{
+		"missing":      "",
+		"wrong secret": payments.SignPayload("other", []byte(payload), time.Now()),
+		"stale":        payments.SignPayload("whsec_test", []byte(payload), time.Now().Add(-time.Hour)),
+	}
+	for name, signature := range signatures {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", strings.NewReader(payload))
+			req.Header.Set(payments.SignatureHeader, signature)
+			rec := httptest.NewRecorder()
+
+			handler.HandleWebhook(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestPaymentStatusForCharge(t *testing.T) {
+	tests := map[string]string{
+		payments.ChargeSucceeded: "succeeded",
+		payments.ChargePending:   "pending",
+		payments.ChargeFailed:    "failed",
+	}
+	for charge, want := range tests {
+		if got := paymentStatusForCharge(charge); got != want {
+			t.Errorf("paymentStatusForCharge(%q) = %q, want %q", charge, got, want)
+		}
+	}
+}
+
+func TestSettlementSplit(t *testing.T) {
+	open := models.Invoice{Status: models.InvoiceStatusPartiallyPaid, Total: models.Cents(10000), AmountDue: models.Cents(3000)}
+	paid := models.Invoice{Status: models.InvoiceStatusPaid, Total: models.Cents(10000)}
+	void := models.Invoice{Status: models.InvoiceStatusVoid, Total: models.Cents(10000), AmountDue: models.Cents(10000)}
+
+	tests := []struct {
+		name            string
+		invoice         models.Invoice
+		amount          models.Money
+		applied, excess models.Money
+	}{
+		{"within amount due", open, models.Cents(2000), models.Cents(2000), models.Cents(0)},
+		{"exactly amount due", open, models.Cents(3000), models.Cents(3000), models.Cents(0)},
+		{"overpays", open, models.Cents(5000), models.Cents(3000), models.Cents(2000)},
+		{"invoice paid meanwhile", paid, models.Cents(5000), models.Cents(0), models.Cents(5000)},
+		{"invoice voided meanwhile", void, models.Cents(5000), models.Cents(0), models.Cents(5000)},
+		{"other currency", open, models.NewMoney(2000, "EUR"), models.NewMoney(0, "EUR"), models.NewMoney(2000, "EUR")},
+	}
+	for _, tt := range tests {
+		applied, excess := settlementSplit(tt.invoice, tt.amount)
+		if applied != tt.applied || excess != tt.excess {
+			t.Errorf("%s: settlementSplit = (%v, %v), want (%v, %v)", tt.name, applied, excess, tt.applied, tt.excess)
+		}
+	}
+}
+
+func TestSettlePendingPaymentReturnsOverpayment(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("whsec_test")
+
+	member := models.Member{ID: primitive.NewObjectID(), Status: models.MemberStatusActive}
+	if _, err := db.Collection("members").InsertOne(ctx, member); err != nil {
+		t.Fatalf("Failed to insert member: %v", err)
+	}
+
+	settle := func(memberID *primitive.ObjectID, due, charged models.Money) (models.Invoice, models.Payment) {
+		t.Helper()
+		invoice := models.Invoice{
+			ID:         primitive.NewObjectID(),
+			MemberID:   memberID,
+			Status:     models.InvoiceStatusPartiallyPaid,
+			Total:      models.Cents(10000),
+			AmountPaid: models.Cents(10000).Sub(due),
+			AmountDue:  due,
+		}
+		payment := models.Payment{
+			ID:        primitive.NewObjectID(),
+			InvoiceID: invoice.ID,
+			MemberID:  memberID,
+			Amount:    charged,
+			Method:    "card",
+			Status:    models.PaymentStatusPending,
+			Provider:  provider.Name(),
+			ChargeID:  "fake_ch_" + primitive.NewObjectID().Hex(),
+		}
+		if _, err := db.Collection("invoices").InsertOne(ctx, invoice); err != nil {
+			t.Fatalf("Failed to insert invoice: %v", err)
+		}
+		if _, err := db.Collection("payments").InsertOne(ctx, payment); err != nil {
+			t.Fatalf("Failed to insert payment: %v", err)
+		}
+
+		if err := settlePendingPayment(ctx, db, provider, payment); err != nil {
+			t.Fatalf("settlePendingPayment: %v", err)
+		}
+		if err := db.Collection("invoices").FindOne(ctx, bson.M{"_id": invoice.ID}).Decode(&invoice); err != nil {
+			t.Fatalf("Failed to read invoice: %v", err)
+		}
+		if err := db.Collection("payments").FindOne(ctx, bson.M{"_id": payment.ID}).Decode(&payment); err != nil {
+			t.Fatalf("Failed to read payment: %v", err)
+		}
+		if payment.Status != models.PaymentStatusSucceeded {
+			t.Errorf("Payment status = %q, want succeeded", payment.Status)
+		}
+		if invoice.Status != models.InvoiceStatusPaid || !invoice.AmountDue.IsZero() {
+			t.Errorf("Invoice status = %q with %v due, want paid in full", invoice.Status, invoice.AmountDue)
+		}
+		return invoice, payment
+	}
+
+	// A member's excess goes to their account credit
+	settle(&member.ID, models.Cents(3000), models.Cents(5000))
+	if err := db.Collection("members").FindOne(ctx, bson.M{"_id": member.ID}).Decode(&member); err != nil {
+		t.Fatalf("Failed to read member: %v", err)
+	}
+	if member.AccountCredit != models.Cents(2000) {
+		t.Errorf("Account credit = %v, want 20.00 USD", member.AccountCredit)
+	}
+
+	// Without a member it is refunded to the card
+	_, payment := settle(nil, models.Cents(1000), models.Cents(2500))
+	if payment.AmountRefunded != models.Cents(1500) {
+		t.Errorf("Amount refunded = %v, want 15.00 USD", payment.AmountRefunded)
+	}
+}
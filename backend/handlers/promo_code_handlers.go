@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errPromoNotFound       = errors.New("promo code not found")
+	errPromoNotValid       = errors.New("promo code is not valid for this invoice's date or club")
+	errPromoNotApplicable  = errors.New("promo code does not apply to anything on this invoice")
+	errPromoExhausted      = errors.New("promo code has reached its usage limit")
+	errPromoMemberLimit    = errors.New("member has already used this promo code as often as allowed")
+	errPromoNewMembersOnly = errors.New("promo code is for new members only")
+	errPromoAlreadyApplied = errors.New("promo code is already applied to this invoice")
+	errPromoInvoicePaid    = errors.New("promo codes can only be added to unpaid draft or open invoices")
+)
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+type PromoCodeHandler struct {
+	db *mongo.Database
+}
+
+func NewPromoCodeHandler(db *mongo.Database) *PromoCodeHandler {
+	return &PromoCodeHandler{db: db}
+}
+
+// GetPromoCodes returns promo codes, optionally only those usable at club_id or only active ones
+func (h *PromoCodeHandler) GetPromoCodes(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["$or"] = bson.A{
+			bson.M{"club_ids": objID},
+			bson.M{"club_ids": bson.M{"$size": 0}},
+		}
+	}
+	if r.URL.Query().Get("active") == "true" {
+		filter["active"] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "code", Value: 1}})
+	cursor, err := h.db.Collection("promo_codes").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var codes []models.PromoCode
+	if err := cursor.All(ctx, &codes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if codes == nil {
+		codes = []models.PromoCode{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+// CreatePromoCode adds a promo code
+func (h *PromoCodeHandler) CreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can manage promo codes", http.StatusForbidden)
+		return
+	}
+
+	var promo models.PromoCode
+	if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePromoCode(&promo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := h.db.Collection("promo_codes").CountDocuments(ctx, bson.M{"code": promo.Code})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "A promo code with this code already exists", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	promo.ID = primitive.NilObjectID
+	promo.Redemptions = 0
+	promo.CreatedBy = &user.ID
+	promo.CreatedAt = now
+	promo.UpdatedAt = now
+
+	result, err := h.db.Collection("promo_codes").InsertOne(ctx, promo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	promo.ID = result.InsertedID.(primitive.ObjectID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promo)
+}
+
+// UpdatePromoCode changes a promo code's terms. The code itself and its
+// redemption count cannot be changed.
+func (h *PromoCodeHandler) UpdatePromoCode(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage promo codes", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid promo code ID", http.StatusBadRequest)
+		return
+	}
+
+	var promo models.PromoCode
+	if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var existing models.PromoCode
+	if err := h.db.Collection("promo_codes").FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Promo code not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	promo.Code = existing.Code
+	if err := validatePromoCode(&promo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var updated models.PromoCode
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("promo_codes").FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"description":      promo.Description,
+		"discount_type":    promo.DiscountType,
+		"percent_off":      promo.PercentOff,
+		"amount_off":       promo.AmountOff,
+		"applies_to":       promo.AppliesTo,
+		"club_ids":         promo.ClubIDs,
+		"valid_from":       promo.ValidFrom,
+		"valid_until":      promo.ValidUntil,
+		"max_redemptions":  promo.MaxRedemptions,
+		"max_per_member":   promo.MaxPerMember,
+		"new_members_only": promo.NewMembersOnly,
+		"active":           promo.Active,
+		"updated_at":       time.Now(),
+	}}, opts).Decode(&updated)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// GetPromoRedemptions returns the invoices a promo code was used on, newest first
+func (h *PromoCodeHandler) GetPromoRedemptions(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid promo code ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := h.db.Collection("promo_redemptions").Find(ctx, bson.M{"promo_code_id": id}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var redemptions []models.PromoRedemption
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if redemptions == nil {
+		redemptions = []models.PromoRedemption{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redemptions)
+}
+
+// ApplyPromoCode adds a promo code's discount lines to an unpaid draft or open invoice
+func (h *PromoCodeHandler) ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoices := h.db.Collection("invoices")
+	var invoice models.Invoice
+	if err := invoices.FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if (invoice.Status != models.InvoiceStatusDraft && invoice.Status != models.InvoiceStatusOpen) || !invoice.AmountPaid.IsZero() {
+		http.Error(w, errPromoInvoicePaid.Error(), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	paid := invoice.AmountPaid
+	promo, err := reservePromoCode(ctx, h.db, requestData.Code, &invoice, now)
+	if err != nil {
+		writePromoError(w, err)
+		return
+	}
+
+	result, err := invoices.UpdateOne(ctx,
+		bson.M{"_id": invoice.ID, "status": invoice.Status, "amount_paid.amount": moneyAmountFilter(paid)},
+		bson.M{"$set": bson.M{
+			"lines":      invoice.Lines,
+			"subtotal":   invoice.Subtotal,
+			"tax_total":  invoice.TaxTotal,
+			"total":      invoice.Total,
+			"amount_due": invoice.AmountDue,
+			"updated_at": now,
+		}})
+	if err == nil && result.MatchedCount == 0 {
+		err = errInvoiceChanged
+	}
+	if err != nil {
+		releasePromoCode(ctx, h.db, promo.ID)
+		if err == errInvoiceChanged {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var createdBy *primitive.ObjectID
+	if user := currentUser(r); user != nil {
+		createdBy = &user.ID
+	}
+	if err := recordPromoRedemption(ctx, h.db, promo, invoice, createdBy, now); err != nil {
+		log.Printf("promo codes: failed to record redemption of %s on invoice %s: %v", promo.Code, invoice.ID.Hex(), err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// writePromoError answers a failed promo code reservation
+func writePromoError(w http.ResponseWriter, err error) {
+	switch err {
+	case errPromoNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errPromoNotValid, errPromoNotApplicable, errPromoExhausted, errPromoMemberLimit, errPromoNewMembersOnly, errPromoAlreadyApplied, models.ErrCurrencyMismatch:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// reservePromoCode checks a code against the invoice, takes one use of its
+// overall limit and adds its discount lines to the invoice in memory. The
+// caller saves the invoice and then records the redemption, or releases the
+// code if saving fails.
+func reservePromoCode(ctx context.Context, db *mongo.Database, code string, invoice *models.Invoice, now time.Time) (*models.PromoCode, error) {
+	var promo models.PromoCode
+	err := db.Collection("promo_codes").FindOne(ctx, bson.M{"code": strings.ToUpper(strings.TrimSpace(code))}).Decode(&promo)
+	if err == mongo.ErrNoDocuments {
+		return nil, errPromoNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !promo.ValidAt(now) || !promo.ValidForClub(invoice.ClubID) {
+		return nil, errPromoNotValid
+	}
+	for _, line := range invoice.Lines {
+		if line.ProductType == models.ProductTypeDiscount && line.ProductID != nil && *line.ProductID == promo.ID {
+			return nil, errPromoAlreadyApplied
+		}
+	}
+
+	invoice.Recalculate()
+	if promo.DiscountType == models.PromoDiscountFixed && !promo.AmountOff.SameCurrency(invoice.Total) {
+		return nil, models.ErrCurrencyMismatch
+	}
+	discounts := promo.DiscountLines(invoice.Lines)
+	if len(discounts) == 0 {
+		return nil, errPromoNotApplicable
+	}
+
+	if invoice.MemberID != nil {
+		if promo.MaxPerMember > 0 {
+			used, err := db.Collection("promo_redemptions").CountDocuments(ctx, bson.M{
+				"promo_code_id": promo.ID,
+				"member_id":     *invoice.MemberID,
+				"released_at":   nil,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if used >= int64(promo.MaxPerMember) {
+				return nil, errPromoMemberLimit
+			}
+		}
+		if promo.NewMembersOnly {
+			earlier, err := db.Collection("invoices").CountDocuments(ctx, bson.M{
+				"_id":                bson.M{"$ne": invoice.ID},
+				"member_id":          *invoice.MemberID,
+				"status":             bson.M{"$nin": []string{models.InvoiceStatusDraft, models.InvoiceStatusVoid}},
+				"lines.product_type": models.ProductTypeMembership,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if earlier > 0 {
+				return nil, errPromoNewMembersOnly
+			}
+		}
+	}
+
+	// Take one use, conditional on the limit so concurrent uses cannot exceed it
+	result, err := db.Collection("promo_codes").UpdateOne(ctx, bson.M{
+		"_id": promo.ID,
+		"$or": bson.A{
+			bson.M{"max_redemptions": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$redemptions", "$max_redemptions"}}},
+		},
+	}, bson.M{"$inc": bson.M{"redemptions": 1}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errPromoExhausted
+	}
+
+	invoice.Lines = append(invoice.Lines, discounts...)
+	invoice.Recalculate()
+	return &promo, nil
+}
+
+// releasePromoCode gives back a use taken by reservePromoCode
+func releasePromoCode(ctx context.Context, db *mongo.Database, promoID primitive.ObjectID) {
+	if _, err := db.Collection("promo_codes").UpdateOne(ctx,
+		bson.M{"_id": promoID, "redemptions": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"redemptions": -1}}); err != nil {
+		log.Printf("promo codes: failed to release a use of %s: %v", promoID.Hex(), err)
+	}
+}
+
+// recordPromoRedemption records the code's use once the invoice is saved
+func recordPromoRedemption(ctx context.Context, db *mongo.Database, promo *models.PromoCode, invoice models.Invoice, createdBy *primitive.ObjectID, now time.Time) error {
+	amount := models.NewMoney(0, invoice.Currency)
+	for _, line := range invoice.Lines {
+		if line.ProductType == models.ProductTypeDiscount && line.ProductID != nil && *line.ProductID == promo.ID {
+			amount = amount.Sub(line.Amount)
+		}
+	}
+
+	_, err := db.Collection("promo_redemptions").InsertOne(ctx, models.PromoRedemption{
+		PromoCodeID: promo.ID,
+		Code:        promo.Code,
+		MemberID:    invoice.MemberID,
+		ClubID:      invoice.ClubID,
+		InvoiceID:   invoice.ID,
+		Amount:      amount,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+	})
+	return err
+}
+
+// tryReleasePromoRedemptions gives back the promo code uses of a voided
+// invoice. Errors are logged; the invoice is already void.
+func tryReleasePromoRedemptions(db *mongo.Database, invoiceID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	redemptions := db.Collection("promo_redemptions")
+	cursor, err := redemptions.Find(ctx, bson.M{"invoice_id": invoiceID, "released_at": nil})
+	if err != nil {
+		log.Printf("promo codes: failed to find redemptions for invoice %s: %v", invoiceID.Hex(), err)
+		return
+	}
+	var found []models.PromoRedemption
+	if err := cursor.All(ctx, &found); err != nil {
+		log.Printf("promo codes: failed to find redemptions for invoice %s: %v", invoiceID.Hex(), err)
+		return
+	}
+
+	now := time.Now()
+	for _, redemption := range found {
+		result, err := redemptions.UpdateOne(ctx,
+			bson.M{"_id": redemption.ID, "released_at": nil},
+			bson.M{"$set": bson.M{"released_at": now}})
+		if err != nil {
+			log.Printf("promo codes: failed to release redemption %s: %v", redemption.ID.Hex(), err)
+			continue
+		}
+		if result.ModifiedCount > 0 {
+			releasePromoCode(ctx, db, redemption.PromoCodeID)
+		}
+	}
+}
+
+// validatePromoCode normalizes a promo code and checks its terms
+func validatePromoCode(promo *models.PromoCode) error {
+	promo.Code = strings.ToUpper(strings.TrimSpace(promo.Code))
+	if !promoCodePattern.MatchString(promo.Code) {
+		return errors.New("code must be 3 to 32 letters, digits, dashes or underscores")
+	}
+
+	switch promo.DiscountType {
+	case models.PromoDiscountPercent:
+		if promo.PercentOff <= 0 || promo.PercentOff > 100 {
+			return errors.New("percent_off must be above 0 and at most 100")
+		}
+		promo.AmountOff = models.Money{}
+	case models.PromoDiscountFixed:
+		if !promo.AmountOff.IsPositive() {
+			return errors.New("amount_off must be positive")
+		}
+		promo.PercentOff = 0
+	default:
+		return errors.New("discount_type must be 'percent' or 'fixed'")
+	}
+
+	for _, productType := range promo.AppliesTo {
+		if !validProductTypes[productType] || models.IsAdjustmentType(productType) {
+			return fmt.Errorf("applies_to: unknown product type '%s'", productType)
+		}
+	}
+	if promo.AppliesTo == nil {
+		promo.AppliesTo = []string{}
+	}
+	if promo.ClubIDs == nil {
+		promo.ClubIDs = []primitive.ObjectID{}
+	}
+
+	if promo.MaxRedemptions < 0 || promo.MaxPerMember < 0 {
+		return errors.New("max_redemptions and max_per_member cannot be negative")
+	}
+	if promo.ValidFrom != nil && promo.ValidUntil != nil && !promo.ValidUntil.After(*promo.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+	return nil
+}
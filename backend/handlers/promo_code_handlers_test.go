@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestValidatePromoCode(t *testing.T) {
+	promo := models.PromoCode{Code: " intro-50 ", DiscountType: models.PromoDiscountPercent, PercentOff: 50, AmountOff: models.Cents(100)}
+	if err := validatePromoCode(&promo); err != nil {
+		t.Fatalf("validatePromoCode: %v", err)
+	}
+	if promo.Code != "INTRO-50" {
+		t.Errorf("Code = %q, want INTRO-50", promo.Code)
+	}
+	if !promo.AmountOff.IsZero() || promo.AppliesTo == nil || promo.ClubIDs == nil {
+		t.Errorf("Expected amount_off cleared and empty lists, got %+v", promo)
+	}
+
+	invalid := map[string]models.PromoCode{
+		"short code":       {Code: "AB", DiscountType: models.PromoDiscountPercent, PercentOff: 10},
+		"spaces":           {Code: "TEN OFF", DiscountType: models.PromoDiscountPercent, PercentOff: 10},
+		"over 100 percent": {Code: "FREE", DiscountType: models.PromoDiscountPercent, PercentOff: 150},
+		"no amount":        {Code: "FIVER", DiscountType: models.PromoDiscountFixed},
+		"unknown type":     {Code: "BOGO", DiscountType: "bogo"},
+		"discount product": {Code: "META", DiscountType: models.PromoDiscountPercent, PercentOff: 10, AppliesTo: []string{models.ProductTypeDiscount}},
+		"negative limit":   {Code: "LIMIT", DiscountType: models.PromoDiscountPercent, PercentOff: 10, MaxPerMember: -1},
+	}
+	for name, promo := range invalid {
+		if err := validatePromoCode(&promo); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
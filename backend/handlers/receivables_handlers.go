@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReceivablesHandler reports money owed to the clubs
+type ReceivablesHandler struct {
+	db *mongo.Database
+}
+
+func NewReceivablesHandler(db *mongo.Database) *ReceivablesHandler {
+	return &ReceivablesHandler{db: db}
+}
+
+// AgingGroup is the aging of everything owed at one club or by one member
+type AgingGroup struct {
+	ID     *primitive.ObjectID `json:"id,omitempty"`
+	Name   string              `json:"name"`
+	Totals models.AgingTotals  `json:"totals"`
+}
+
+// GetAgingReport returns outstanding amounts in aging buckets, in total, by
+// club, by member and item by item. Items are unpaid balances of open and
+// partially paid invoices, aged from their due date, and confirmed or
+// completed office bookings that have ended without being invoiced, aged
+// from their end time. The report covers one currency (default USD) and can
+// be narrowed with club_id, member_id and bucket. With format=csv the items
+// are exported instead.
+func (h *ReceivablesHandler) GetAgingReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var clubID, memberID *primitive.ObjectID
+	if value := query.Get("club_id"); value != "" {
+		objID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		clubID = &objID
+	}
+	if value := query.Get("member_id"); value != "" {
+		objID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			http.Error(w, "Invalid member ID", http.StatusBadRequest)
+			return
+		}
+		memberID = &objID
+	}
+	bucket := query.Get("bucket")
+	if bucket != "" && !isAgingBucket(bucket) {
+		http.Error(w, "bucket must be one of "+strings.Join(models.AgingBuckets, ", "), http.StatusBadRequest)
+		return
+	}
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	items, err := receivableItems(ctx, h.db, clubID, memberID, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	selected := []models.ARItem{}
+	for _, item := range items {
+		if item.Amount.Currency != currency || (bucket != "" && item.Bucket != bucket) {
+			continue
+		}
+		selected = append(selected, item)
+	}
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"ar-aging-%s.csv\"", now.Format("2006-01-02")))
+		writeAgingCSV(w, selected)
+		return
+	}
+
+	totals := models.NewAgingTotals(currency)
+	byClub := newAgingGroups(currency)
+	byMember := newAgingGroups(currency)
+	for _, item := range selected {
+		totals.Add(item)
+		byClub.add(item.ClubID, item.ClubName, item)
+		byMember.add(item.MemberID, item.MemberName, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generated_at": now,
+		"currency":     currency,
+		"totals":       totals,
+		"by_club":      byClub.sorted(),
+		"by_member":    byMember.sorted(),
+		"items":        selected,
+	})
+}
+
+// receivableItems collects everything outstanding, oldest first
+func receivableItems(ctx context.Context, db *mongo.Database, clubID, memberID *primitive.ObjectID, now time.Time) ([]models.ARItem, error) {
+	items := []models.ARItem{}
+
+	invoiceFilter := bson.M{
+		"status":            bson.M{"$in": []string{models.InvoiceStatusOpen, models.InvoiceStatusPartiallyPaid}},
+		"amount_due.amount": bson.M{"$gt": 0},
+	}
+	if clubID != nil {
+		invoiceFilter["club_id"] = *clubID
+	}
+	if memberID != nil {
+		invoiceFilter["member_id"] = *memberID
+	}
+	cursor, err := db.Collection("invoices").Find(ctx, invoiceFilter)
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	for _, invoice := range invoices {
+		amount := invoice.AmountDue
+		if amount.Currency == "" {
+			amount.Currency = models.DefaultCurrency
+		}
+		bucket, days := models.AgingBucket(invoice.DueDate, now)
+		description := "Invoice " + invoice.Number
+		if len(invoice.Lines) > 0 {
+			description = invoice.Lines[0].Description
+			if len(invoice.Lines) > 1 {
+				description += fmt.Sprintf(" and %d more", len(invoice.Lines)-1)
+			}
+		}
+		items = append(items, models.ARItem{
+			Type:        models.ARItemInvoice,
+			ID:          invoice.ID,
+			Number:      invoice.Number,
+			Description: description,
+			MemberID:    invoice.MemberID,
+			ClubID:      invoice.ClubID,
+			DueDate:     invoice.DueDate,
+			DaysPastDue: days,
+			Bucket:      bucket,
+			Amount:      amount,
+		})
+	}
+
+	// Office bookings take their club from the office
+	officeFilter := bson.M{}
+	if clubID != nil {
+		officeFilter["club_id"] = *clubID
+	}
+	cursor, err = db.Collection("offices").Find(ctx, officeFilter)
+	if err != nil {
+		return nil, err
+	}
+	var offices []models.Office
+	if err := cursor.All(ctx, &offices); err != nil {
+		return nil, err
+	}
+	officesByID := make(map[primitive.ObjectID]models.Office)
+	officeIDs := []primitive.ObjectID{}
+	for _, office := range offices {
+		officesByID[office.ID] = office
+		officeIDs = append(officeIDs, office.ID)
+	}
+
+	bookingFilter := bson.M{
+		"status":   bson.M{"$in": []string{"confirmed", "completed"}},
+		"end_time": bson.M{"$lte": now},
+	}
+	if clubID != nil {
+		bookingFilter["office_id"] = bson.M{"$in": officeIDs}
+	}
+	if memberID != nil {
+		bookingFilter["member_id"] = *memberID
+	}
+	cursor, err = db.Collection("office_bookings").Find(ctx, bookingFilter)
+	if err != nil {
+		return nil, err
+	}
+	var bookings []models.OfficeBooking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+
+	invoiced, err := invoicedBookingIDs(ctx, db, bookings)
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range bookings {
+		amount := booking.TotalWithTax
+		if amount.IsZero() {
+			amount = booking.TotalCost
+		}
+		if invoiced[booking.ID] || !amount.IsPositive() {
+			continue
+		}
+		if amount.Currency == "" {
+			amount.Currency = models.DefaultCurrency
+		}
+
+		description := "Office booking"
+		var bookingClub *primitive.ObjectID
+		if booking.OfficeID != nil {
+			if office, ok := officesByID[*booking.OfficeID]; ok {
+				description = office.Name
+				bookingClub = office.ClubID
+			}
+		}
+		description += " on " + booking.StartTime.UTC().Format("2006-01-02")
+
+		bucket, days := models.AgingBucket(booking.EndTime, now)
+		items = append(items, models.ARItem{
+			Type:        models.ARItemBooking,
+			ID:          booking.ID,
+			Description: description,
+			MemberID:    booking.MemberID,
+			ClubID:      bookingClub,
+			DueDate:     booking.EndTime,
+			DaysPastDue: days,
+			Bucket:      bucket,
+			Amount:      amount,
+		})
+	}
+
+	if err := nameReceivableItems(ctx, db, items); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DueDate.Before(items[j].DueDate)
+	})
+	return items, nil
+}
+
+// nameReceivableItems fills in member and club names for display and export
+func nameReceivableItems(ctx context.Context, db *mongo.Database, items []models.ARItem) error {
+	memberIDs := []primitive.ObjectID{}
+	clubIDs := []primitive.ObjectID{}
+	for _, item := range items {
+		if item.MemberID != nil {
+			memberIDs = append(memberIDs, *item.MemberID)
+		}
+		if item.ClubID != nil {
+			clubIDs = append(clubIDs, *item.ClubID)
+		}
+	}
+
+	memberNames := make(map[primitive.ObjectID]string)
+	if len(memberIDs) > 0 {
+		cursor, err := db.Collection("members").Find(ctx, bson.M{"_id": bson.M{"$in": memberIDs}})
+		if err != nil {
+			return err
+		}
+		var members []models.Member
+		if err := cursor.All(ctx, &members); err != nil {
+			return err
+		}
+		for _, member := range members {
+			memberNames[member.ID] = strings.TrimSpace(member.FirstName + " " + member.LastName)
+		}
+	}
+
+	clubNames := make(map[primitive.ObjectID]string)
+	if len(clubIDs) > 0 {
+		cursor, err := db.Collection("clubs").Find(ctx, bson.M{"_id": bson.M{"$in": clubIDs}})
+		if err != nil {
+			return err
+		}
+		var clubs []models.Club
+		if err := cursor.All(ctx, &clubs); err != nil {
+			return err
+		}
+		for _, club := range clubs {
+			clubNames[club.ID] = club.Name
+		}
+	}
+
+	for i := range items {
+		if items[i].MemberID != nil {
+			items[i].MemberName = memberNames[*items[i].MemberID]
+		}
+		if items[i].ClubID != nil {
+			items[i].ClubName = clubNames[*items[i].ClubID]
+		}
+	}
+	return nil
+}
+
+// agingGroups accumulates aging totals per club or per member
+type agingGroups struct {
+	currency string
+	groups   map[primitive.ObjectID]*AgingGroup
+}
+
+func newAgingGroups(currency string) *agingGroups {
+	return &agingGroups{currency: currency, groups: map[primitive.ObjectID]*AgingGroup{}}
+}
+
+func (g *agingGroups) add(id *primitive.ObjectID, name string, item models.ARItem) {
+	var key primitive.ObjectID
+	if id != nil {
+		key = *id
+	}
+	group, ok := g.groups[key]
+	if !ok {
+		group = &AgingGroup{ID: id, Name: name, Totals: models.NewAgingTotals(g.currency)}
+		g.groups[key] = group
+	}
+	group.Totals.Add(item)
+}
+
+// sorted returns the groups, largest balance first
+func (g *agingGroups) sorted() []AgingGroup {
+	result := []AgingGroup{}
+	for _, group := range g.groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if c := result[i].Totals.Total.Cmp(result[j].Totals.Total); c != 0 {
+			return c > 0
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// writeAgingCSV writes one row per item, with its amount in its bucket's column
+func writeAgingCSV(w http.ResponseWriter, items []models.ARItem) {
+	out := csv.NewWriter(w)
+	header := []string{"type", "number", "description", "member", "club", "due_date", "days_past_due"}
+	header = append(header, models.AgingBuckets...)
+	header = append(header, "total", "currency")
+	out.Write(header)
+
+	for _, item := range items {
+		row := []string{
+			item.Type,
+			item.Number,
+			item.Description,
+			item.MemberName,
+			item.ClubName,
+			item.DueDate.UTC().Format("2006-01-02"),
+			strconv.Itoa(item.DaysPastDue),
+		}
+		for _, bucket := range models.AgingBuckets {
+			cell := ""
+			if bucket == item.Bucket {
+				cell = item.Amount.Major()
+			}
+			row = append(row, cell)
+		}
+		row = append(row, item.Amount.Major(), item.Amount.Currency)
+		out.Write(row)
+	}
+	out.Flush()
+}
+
+func isAgingBucket(bucket string) bool {
+	for _, b := range models.AgingBuckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWriteAgingCSV(t *testing.T) {
+	items := []models.ARItem{
+		{Type: models.ARItemInvoice, Number: "INV-2024-000001", Description: "Premium, March", MemberName: "Ada Lovelace", ClubName: "Downtown",
+			DueDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), DaysPastDue: 45, Bucket: models.Aging31To60, Amount: models.Cents(8900)},
+		{Type: models.ARItemBooking, Description: "Room 4 on 2024-04-02", DueDate: time.Date(2024, 4, 2, 17, 0, 0, 0, time.UTC), Bucket: models.AgingCurrent, Amount: models.Cents(2500)},
+	}
+	recorder := httptest.NewRecorder()
+	writeAgingCSV(recorder, items)
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 items", len(rows))
+	}
+	want := []string{"invoice", "INV-2024-000001", "Premium, March", "Ada Lovelace", "Downtown", "2024-03-01", "45", "", "", "89.00", "", "", "89.00", "USD"}
+	for i, cell := range want {
+		if rows[1][i] != cell {
+			t.Errorf("column %s = %q, want %q", rows[0][i], rows[1][i], cell)
+		}
+	}
+	if rows[2][7] != "25.00" {
+		t.Errorf("current = %q, want 25.00", rows[2][7])
+	}
+}
+
+func TestAgingGroupsSorted(t *testing.T) {
+	small, large := primitive.NewObjectID(), primitive.NewObjectID()
+	groups := newAgingGroups(models.DefaultCurrency)
+	groups.add(&small, "Small", models.ARItem{Bucket: models.AgingCurrent, Amount: models.Cents(100)})
+	groups.add(&large, "Large", models.ARItem{Bucket: models.Aging1To30, Amount: models.Cents(700)})
+	groups.add(&small, "Small", models.ARItem{Bucket: models.AgingOver90, Amount: models.Cents(200)})
+	groups.add(nil, "", models.ARItem{Bucket: models.AgingCurrent, Amount: models.Cents(50)})
+
+	sorted := groups.sorted()
+	if len(sorted) != 3 || sorted[0].Name != "Large" || sorted[1].Totals.Total != models.Cents(300) || sorted[2].ID != nil {
+		t.Errorf("unexpected groups %+v", sorted)
+	}
+}
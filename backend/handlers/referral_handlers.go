@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// referralCodeAlphabet omits characters that are easily confused (0/O, 1/I)
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var errInvalidReferralCode = errors.New("referral code not found")
+
+type ReferralHandler struct {
+	db *mongo.Database
+}
+
+func NewReferralHandler(db *mongo.Database) *ReferralHandler {
+	return &ReferralHandler{db: db}
+}
+
+// GetPrograms returns all referral programs
+func (h *ReferralHandler) GetPrograms(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := h.db.Collection("referral_programs").Find(ctx, bson.M{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var programs []models.ReferralProgram
+	if err := cursor.All(ctx, &programs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if programs == nil {
+		programs = []models.ReferralProgram{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(programs)
+}
+
+// SaveProgram creates or replaces the referral program for a club (or the
+// default program when club_id is omitted)
+func (h *ReferralHandler) SaveProgram(w http.ResponseWriter, r *http.Request) {
+	var program models.ReferralProgram
+	if err := json.NewDecoder(r.Body).Decode(&program); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch program.RewardType {
+	case models.ReferralRewardAccountCredit:
+		if !program.RewardAmount.IsPositive() {
+			http.Error(w, "reward_amount must be positive for account credit", http.StatusBadRequest)
+			return
+		}
+	case models.ReferralRewardFreeMonth:
+		program.RewardAmount = models.Money{}
+	default:
+		http.Error(w, "reward_type must be 'account_credit' or 'free_month'", http.StatusBadRequest)
+		return
+	}
+	if program.QualifyingDays < 0 {
+		http.Error(w, "qualifying_days cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"club_id": program.ClubID}
+	if program.ClubID == nil {
+		filter["club_id"] = bson.M{"$exists": false}
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"reward_type":     program.RewardType,
+			"reward_amount":   program.RewardAmount,
+			"qualifying_days": program.QualifyingDays,
+			"active":          program.Active,
+			"updated_at":      now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	if program.ClubID != nil {
+		update["$setOnInsert"] = bson.M{"created_at": now, "club_id": program.ClubID}
+	}
+
+	var saved models.ReferralProgram
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := h.db.Collection("referral_programs").FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// GetMemberReferrals returns a member's referral code and the referrals they have made
+func (h *ReferralHandler) GetMemberReferrals(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code, err := ensureReferralCode(ctx, h.db, memberID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "referred_at", Value: -1}})
+	cursor, err := h.db.Collection("referrals").Find(ctx, bson.M{"referrer_id": memberID}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var referrals []models.Referral
+	if err := cursor.All(ctx, &referrals); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if referrals == nil {
+		referrals = []models.Referral{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"referral_code": code,
+		"referrals":     referrals,
+	})
+}
+
+// ReferralLeaderboardEntry summarizes one referrer's results
+type ReferralLeaderboardEntry struct {
+	MemberID     primitive.ObjectID `json:"member_id" bson:"_id"`
+	FirstName    string             `json:"first_name" bson:"first_name"`
+	LastName     string             `json:"last_name" bson:"last_name"`
+	Referrals    int                `json:"referrals" bson:"referrals"`
+	Rewarded     int                `json:"rewarded" bson:"rewarded"`
+	Pending      int                `json:"pending" bson:"pending"`
+	CreditEarned models.Money       `json:"credit_earned" bson:"credit_earned"`
+}
+
+// GetLeaderboard ranks referrers by rewarded referrals, then by total referrals
+func (h *ReferralHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	match := bson.M{"status": bson.M{"$ne": "void"}}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		match["club_id"] = objID
+	}
+
+	referredAt := bson.M{}
+	if startDate := r.URL.Query().Get("start_date"); startDate != "" {
+		parsed, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			http.Error(w, "Invalid start_date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		referredAt["$gte"] = parsed
+	}
+	if endDate := r.URL.Query().Get("end_date"); endDate != "" {
+		parsed, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			http.Error(w, "Invalid end_date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		referredAt["$lt"] = parsed.AddDate(0, 0, 1)
+	}
+	if len(referredAt) > 0 {
+		match["referred_at"] = referredAt
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$referrer_id",
+			"referrals": bson.M{"$sum": 1},
+			"rewarded":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "rewarded"}}, 1, 0}}},
+			"pending":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "pending"}}, 1, 0}}},
+			"credit_earned": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$status", "rewarded"}},
+					bson.M{"$eq": bson.A{"$reward_type", models.ReferralRewardAccountCredit}},
+				}},
+				"$reward_amount.amount", 0,
+			}}},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"credit_earned": bson.M{"amount": "$credit_earned", "currency": models.DefaultCurrency},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "rewarded", Value: -1}, {Key: "referrals", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{"from": "members", "localField": "_id", "foreignField": "_id", "as": "member"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$member", "preserveNullAndEmptyArrays": true}}},
+		{{Key: "$addFields", Value: bson.M{"first_name": "$member.first_name", "last_name": "$member.last_name"}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := h.db.Collection("referrals").Aggregate(ctx, pipeline)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var entries []ReferralLeaderboardEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []ReferralLeaderboardEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ProcessRewards runs the reward job on demand
+func (h *ReferralHandler) ProcessRewards(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rewarded, voided, err := processReferralRewards(ctx, h.db, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"rewarded": rewarded, "voided": voided})
+}
+
+// ProcessReferralRewards is the scheduled entry point for the reward job
+func ProcessReferralRewards(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, _, err := processReferralRewards(ctx, db, time.Now())
+		return err
+	}
+}
+
+// processReferralRewards pays out referrals whose referee has stayed active
+// through the qualifying period, and voids those whose referee left
+func processReferralRewards(ctx context.Context, db *mongo.Database, now time.Time) (rewarded, voided int, err error) {
+	referrals := db.Collection("referrals")
+	cursor, err := referrals.Find(ctx, bson.M{"status": "pending", "qualifies_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, 0, err
+	}
+	var due []models.Referral
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, 0, err
+	}
+
+	members := db.Collection("members")
+	for _, referral := range due {
+		var referee models.Member
+		err := members.FindOne(ctx, bson.M{"_id": referral.RefereeID}).Decode(&referee)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return rewarded, voided, err
+		}
+		if err == mongo.ErrNoDocuments || referee.Status != models.MemberStatusActive {
+			reason := "referee is no longer a member"
+			if err == nil {
+				reason = "referee status is " + referee.Status
+			}
+			if _, err := referrals.UpdateOne(ctx, bson.M{"_id": referral.ID, "status": "pending"}, bson.M{
+				"$set": bson.M{"status": "void", "void_reason": reason},
+			}); err != nil {
+				return rewarded, voided, err
+			}
+			voided++
+			continue
+		}
+
+		// Claim the referral before paying so a concurrent run cannot pay twice
+		claim, err := referrals.UpdateOne(ctx, bson.M{"_id": referral.ID, "status": "pending"}, bson.M{
+			"$set": bson.M{"status": "rewarded", "rewarded_at": now},
+		})
+		if err != nil {
+			return rewarded, voided, err
+		}
+		if claim.ModifiedCount == 0 {
+			continue
+		}
+
+		if err := applyReferralReward(ctx, db, referral, now); err != nil {
+			referrals.UpdateOne(ctx, bson.M{"_id": referral.ID}, bson.M{
+				"$set":   bson.M{"status": "pending"},
+				"$unset": bson.M{"rewarded_at": ""},
+			})
+			return rewarded, voided, err
+		}
+		rewarded++
+	}
+	return rewarded, voided, nil
+}
+
+// applyReferralReward credits the referrer's account or extends their membership by a month
+func applyReferralReward(ctx context.Context, db *mongo.Database, referral models.Referral, now time.Time) error {
+	members := db.Collection("members")
+	switch referral.RewardType {
+	case models.ReferralRewardAccountCredit:
+		_, err := postAccountCredit(ctx, db, models.AccountCreditTransaction{
+			MemberID:    referral.ReferrerID,
+			Amount:      referral.RewardAmount,
+			Source:      models.AccountCreditSourceReferral,
+			SourceID:    &referral.ID,
+			Description: "Referral reward",
+			CreatedAt:   now,
+		})
+		return err
+	case models.ReferralRewardFreeMonth:
+		var referrer models.Member
+		if err := members.FindOne(ctx, bson.M{"_id": referral.ReferrerID}).Decode(&referrer); err != nil {
+			return err
+		}
+		expiry := referrer.ExpiryDate
+		if expiry.Before(now) {
+			expiry = now
+		}
+		_, err := members.UpdateOne(ctx, bson.M{"_id": referral.ReferrerID}, bson.M{
+			"$set": bson.M{"expiry_date": expiry.AddDate(0, 1, 0), "updated_at": now},
+		})
+		return err
+	}
+	return nil
+}
+
+// findReferrer returns the member who owns a referral code
+func findReferrer(ctx context.Context, db *mongo.Database, code string) (*models.Member, error) {
+	var referrer models.Member
+	err := db.Collection("members").FindOne(ctx, bson.M{"referral_code": strings.ToUpper(strings.TrimSpace(code))}).Decode(&referrer)
+	if err == mongo.ErrNoDocuments {
+		return nil, errInvalidReferralCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &referrer, nil
+}
+
+// attributeReferral records that a newly created member was referred by another,
+// copying the reward terms of the program in force at sign-up
+func attributeReferral(ctx context.Context, db *mongo.Database, referrer, referee models.Member) (*models.Referral, error) {
+	var clubID *primitive.ObjectID
+	if len(referee.ClubIDs) > 0 {
+		clubID = &referee.ClubIDs[0]
+	}
+	program, err := findReferralProgram(ctx, db, clubID)
+	if err != nil {
+		return nil, err
+	}
+
+	referral := models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  referee.ID,
+		ClubID:     clubID,
+		Code:       referrer.ReferralCode,
+		Status:     "pending",
+		ReferredAt: time.Now(),
+	}
+	if program == nil {
+		// No program configured: attribute only, with nothing to pay out
+		referral.Status = "void"
+		referral.VoidReason = "no active referral program"
+	} else {
+		referral.RewardType = program.RewardType
+		referral.RewardAmount = program.RewardAmount
+		referral.QualifyingDays = program.QualifyingDays
+		if referee.Status == models.MemberStatusActive {
+			qualifiesAt := referee.JoinDate.AddDate(0, 0, program.QualifyingDays)
+			referral.QualifiesAt = &qualifiesAt
+		}
+	}
+
+	result, err := db.Collection("referrals").InsertOne(ctx, referral)
+	if err != nil {
+		return nil, err
+	}
+	referral.ID = result.InsertedID.(primitive.ObjectID)
+	return &referral, nil
+}
+
+// startReferralQualification begins the qualifying period once a referred lead becomes active
+func startReferralQualification(ctx context.Context, db *mongo.Database, refereeID primitive.ObjectID, activatedAt time.Time) error {
+	cursor, err := db.Collection("referrals").Find(ctx, bson.M{
+		"referee_id":   refereeID,
+		"status":       "pending",
+		"qualifies_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	var pending []models.Referral
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	for _, referral := range pending {
+		_, err := db.Collection("referrals").UpdateOne(ctx, bson.M{"_id": referral.ID}, bson.M{
+			"$set": bson.M{"qualifies_at": activatedAt.AddDate(0, 0, referral.QualifyingDays)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findReferralProgram returns the active program for a club, falling back to the default program
+func findReferralProgram(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID) (*models.ReferralProgram, error) {
+	collection := db.Collection("referral_programs")
+
+	var program models.ReferralProgram
+	if clubID != nil {
+		err := collection.FindOne(ctx, bson.M{"club_id": *clubID, "active": true}).Decode(&program)
+		if err == nil {
+			return &program, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	err := collection.FindOne(ctx, bson.M{"club_id": bson.M{"$exists": false}, "active": true}).Decode(&program)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+// ensureReferralCode returns the member's referral code, assigning one if needed
+func ensureReferralCode(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID) (string, error) {
+	members := db.Collection("members")
+
+	var member models.Member
+	if err := members.FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		return "", err
+	}
+	if member.ReferralCode != "" {
+		return member.ReferralCode, nil
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newReferralCode(member.FirstName)
+		if err != nil {
+			return "", err
+		}
+		count, err := members.CountDocuments(ctx, bson.M{"referral_code": code})
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			continue
+		}
+
+		result, err := members.UpdateOne(ctx,
+			bson.M{"_id": memberID, "referral_code": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$set": bson.M{"referral_code": code}})
+		if err != nil {
+			return "", err
+		}
+		if result.ModifiedCount == 0 {
+			// Another request assigned a code first
+			if err := members.FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+				return "", err
+			}
+			return member.ReferralCode, nil
+		}
+		return code, nil
+	}
+	return "", errors.New("could not generate a unique referral code")
+}
+
+// newReferralCode builds a code like "JANE-7K3P" from the member's first name
+func newReferralCode(firstName string) (string, error) {
+	var prefix strings.Builder
+	for _, r := range strings.ToUpper(firstName) {
+		if r <= unicode.MaxASCII && unicode.IsLetter(r) {
+			prefix.WriteRune(r)
+		}
+		if prefix.Len() == 4 {
+			break
+		}
+	}
+	if prefix.Len() == 0 {
+		prefix.WriteString("FIT")
+	}
+
+	suffix := make([]byte, 4)
+	for i := range suffix {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		suffix[i] = referralCodeAlphabet[n.Int64()]
+	}
+	return prefix.String() + "-" + string(suffix), nil
+}
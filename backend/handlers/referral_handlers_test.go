@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewReferralCode(t *testing.T) {
+	tests := []struct {
+		firstName string
+		prefix    string
+	}{
+		{"Jane", "JANE-"},
+		{"Christopher", "CHRI-"},
+		{"Zoë", "ZO-"},
+		{"", "FIT-"},
+	}
+
+	for _, tt := range tests {
+		code, err := newReferralCode(tt.firstName)
+		if err != nil {
+			t.Fatalf("newReferralCode(%q) error: %v", tt.firstName, err)
+		}
+		if !strings.HasPrefix(code, tt.prefix) {
+			t.Errorf("newReferralCode(%q) = %q, want prefix %q", tt.firstName, code, tt.prefix)
+		}
+		suffix := strings.TrimPrefix(code, tt.prefix)
+		if len(suffix) != 4 {
+			t.Errorf("newReferralCode(%q) suffix %q should be 4 characters", tt.firstName, suffix)
+		}
+		for _, c := range suffix {
+			if !strings.ContainsRune(referralCodeAlphabet, c) {
+				t.Errorf("newReferralCode(%q) suffix contains unexpected %q", tt.firstName, c)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // GetReservations retrieves all reservations
@@ -89,6 +90,8 @@ func CreateReservation(collection *mongo.Collection) http.HandlerFunc {
 
 		reservation.CreatedAt = time.Now()
 		reservation.UpdatedAt = time.Now()
+		reservation.Discount = models.Money{}
+		reservation.GiftCardPaid = models.Money{}
 
 		// Default status if not provided
 		if reservation.Status == "" {
@@ -102,6 +105,9 @@ func CreateReservation(collection *mongo.Collection) http.HandlerFunc {
 		}
 
 		reservation.ID = result.InsertedID.(primitive.ObjectID)
+		if reservation.Status == "completed" {
+			trySyncReservationCharge(collection.Database(), reservation)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(reservation)
@@ -127,6 +133,15 @@ func UpdateReservation(collection *mongo.Collection) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		// Discounts and gift card payments stay in the bill's currency
+		var current models.Reservation
+		err = collection.FindOne(ctx, bson.M{"_id": objectID},
+			options.FindOne().SetProjection(bson.M{"discount": 1, "gift_card_paid": 1})).Decode(&current)
+		if err == nil && (!reservation.BillAmount.SameCurrency(current.Discount) || !reservation.BillAmount.SameCurrency(current.GiftCardPaid)) {
+			http.Error(w, models.ErrCurrencyMismatch.Error(), http.StatusConflict)
+			return
+		}
+
 		reservation.UpdatedAt = time.Now()
 
 		update := bson.M{
@@ -139,24 +154,36 @@ func UpdateReservation(collection *mongo.Collection) http.HandlerFunc {
 				"party_size":        reservation.PartySize,
 				"date_time":         reservation.DateTime,
 				"status":            reservation.Status,
+				"bill_amount":       reservation.BillAmount,
 				"special_requests":  reservation.SpecialReqs,
 				"notes":             reservation.Notes,
 				"updated_at":        reservation.UpdatedAt,
 			},
 		}
 
-		result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+		var previous models.Reservation
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update).Decode(&previous)
 		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				http.Error(w, "Reservation not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if result.MatchedCount == 0 {
-			http.Error(w, "Reservation not found", http.StatusNotFound)
-			return
+		// Completing a member's reservation earns points on the amount paid
+		if reservation.Status == "completed" && previous.Status != "completed" && reservation.MemberID != nil {
+			clubID, err := restaurantClubID(ctx, collection.Database(), reservation.RestaurantID)
+			if err == nil {
+				tryAwardPoints(collection.Database(), *reservation.MemberID, clubID, models.PointsSourceRestaurantSpend, objectID, reservation.BillAmount.Sub(previous.Discount))
+			}
 		}
 
 		reservation.ID = objectID
+		reservation.Discount = previous.Discount
+		reservation.GiftCardPaid = previous.GiftCardPaid
+		trySyncReservationCharge(collection.Database(), reservation)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(reservation)
 	}
@@ -186,6 +213,7 @@ func DeleteReservation(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
+		tryRemoveAccountCharge(collection.Database(), models.ProductTypeRestaurant, objectID)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
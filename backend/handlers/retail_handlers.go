@@ -0,0 +1,694 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+	"go-api-mongo/notify"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errProductUnavailable = errors.New("product is not sold at this club")
+
+// insufficientStockError reports a sale or adjustment that would take a
+// product's stock below zero
+type insufficientStockError struct {
+	product models.Product
+}
+
+func (e *insufficientStockError) Error() string {
+	return fmt.Sprintf("not enough %s in stock (%d left)", e.product.Name, e.product.Stock)
+}
+
+// RetailHandler runs the club shops: the product catalog, stock and sales
+type RetailHandler struct {
+	db       *mongo.Database
+	notifier notify.Notifier
+}
+
+func NewRetailHandler(db *mongo.Database, notifier notify.Notifier) *RetailHandler {
+	return &RetailHandler{db: db, notifier: notifier}
+}
+
+// GetProducts returns products by name, optionally filtered by club_id,
+// category, active and low_stock=true
+func (h *RetailHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	if value := query.Get("club_id"); value != "" {
+		clubID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = clubID
+	}
+	if category := query.Get("category"); category != "" {
+		filter["category"] = category
+	}
+	if active := query.Get("active"); active != "" {
+		filter["active"] = active == "true"
+	}
+	if query.Get("low_stock") == "true" {
+		filter["reorder_level"] = bson.M{"$gt": 0}
+		filter["$expr"] = bson.M{"$lte": bson.A{"$stock", "$reorder_level"}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := h.db.Collection("products").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if products == nil {
+		products = []models.Product{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// GetProduct returns a single product
+func (h *RetailHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var product models.Product
+	if err := h.db.Collection("products").FindOne(ctx, bson.M{"_id": id}).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// CreateProduct adds a product to a club's catalog with its opening stock
+func (h *RetailHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can manage products", http.StatusForbidden)
+		return
+	}
+
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if product.ClubID.IsZero() {
+		http.Error(w, "club_id is required", http.StatusBadRequest)
+		return
+	}
+	if product.Stock < 0 {
+		http.Error(w, "stock cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if err := validateProduct(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := h.db.Collection("products").CountDocuments(ctx, bson.M{"club_id": product.ClubID, "sku": product.SKU})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "A product with this SKU already exists at the club", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	product.ID = primitive.NewObjectID()
+	product.CreatedAt = now
+	product.UpdatedAt = now
+
+	if _, err := h.db.Collection("products").InsertOne(ctx, product); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product.Stock > 0 {
+		if _, err := h.db.Collection("stock_movements").InsertOne(ctx, models.StockMovement{
+			ProductID:  product.ID,
+			ClubID:     product.ClubID,
+			Type:       models.StockMovementAdjustment,
+			Quantity:   product.Stock,
+			StockAfter: product.Stock,
+			Reason:     "Opening stock",
+			CreatedBy:  &user.ID,
+			CreatedAt:  now,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// UpdateProduct changes a product's details. The club and stock cannot be
+// changed here; stock changes go through adjustments.
+func (h *RetailHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage products", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateProduct(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var existing models.Product
+	if err := h.db.Collection("products").FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product.SKU != existing.SKU {
+		count, err := h.db.Collection("products").CountDocuments(ctx, bson.M{"club_id": existing.ClubID, "sku": product.SKU})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "A product with this SKU already exists at the club", http.StatusConflict)
+			return
+		}
+	}
+
+	var updated models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.db.Collection("products").FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"sku":           product.SKU,
+		"name":          product.Name,
+		"category":      product.Category,
+		"price":         product.Price,
+		"reorder_level": product.ReorderLevel,
+		"active":        product.Active,
+		"updated_at":    time.Now(),
+	}}, opts).Decode(&updated)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// AdjustStock records a delivery, stock count correction, breakage or other
+// change to a product's stock
+func (h *RetailHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !isManager(user) {
+		http.Error(w, "Only admins and club managers can adjust stock", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Quantity int    `json:"quantity"` // negative to remove stock
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requestData.Reason = strings.TrimSpace(requestData.Reason)
+	if requestData.Quantity == 0 || requestData.Reason == "" {
+		http.Error(w, "quantity and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	movement := models.StockMovement{
+		ProductID: id,
+		Type:      models.StockMovementAdjustment,
+		Quantity:  requestData.Quantity,
+		Reason:    requestData.Reason,
+		CreatedBy: &user.ID,
+		CreatedAt: time.Now(),
+	}
+	product, err := moveStock(ctx, h.db, bson.M{"_id": id}, &movement)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		if _, ok := err.(*insufficientStockError); ok {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Collection("stock_movements").InsertOne(ctx, movement); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product.BecameLowStock(product.Stock - movement.Quantity) {
+		h.notifyLowStock(ctx, product.ClubID, []models.Product{*product})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// GetStockMovements returns a product's stock history, newest first
+func (h *RetailHandler) GetStockMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("stock_movements").Find(ctx, bson.M{"product_id": id}, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var movements []models.StockMovement
+	if err := cursor.All(ctx, &movements); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if movements == nil {
+		movements = []models.StockMovement{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// GetSales returns retail sales, newest first, optionally filtered by
+// club_id, member_id and a start_date/end_date range (YYYY-MM-DD)
+func (h *RetailHandler) GetSales(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	for _, param := range []string{"club_id", "member_id"} {
+		if value := query.Get(param); value != "" {
+			objID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid "+strings.TrimSuffix(param, "_id")+" ID", http.StatusBadRequest)
+				return
+			}
+			filter[param] = objID
+		}
+	}
+	soldAt := bson.M{}
+	if value := query.Get("start_date"); value != "" {
+		start, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid start_date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		soldAt["$gte"] = start
+	}
+	if value := query.Get("end_date"); value != "" {
+		end, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid end_date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		soldAt["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(soldAt) > 0 {
+		filter["sold_at"] = soldAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sold_at", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("retail_sales").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var sales []models.RetailSale
+	if err := cursor.All(ctx, &sales); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if sales == nil {
+		sales = []models.RetailSale{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sales)
+}
+
+// GetSale returns a single retail sale
+func (h *RetailHandler) GetSale(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var sale models.RetailSale
+	if err := h.db.Collection("retail_sales").FindOne(ctx, bson.M{"_id": id}).Decode(&sale); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sale)
+}
+
+// CreateSale rings up a sale at a club shop. Stock is taken off each product
+// and the sale is either paid at the till or charged to the member's account.
+func (h *RetailHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		ClubID   primitive.ObjectID  `json:"club_id"`
+		MemberID *primitive.ObjectID `json:"member_id"`
+		Items    []struct {
+			ProductID primitive.ObjectID `json:"product_id"`
+			Quantity  int                `json:"quantity"`
+		} `json:"items"`
+		PaymentMethod string `json:"payment_method"` // card, cash, bank_transfer, other, account
+		Reference     string `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.ClubID.IsZero() || len(requestData.Items) == 0 {
+		http.Error(w, "club_id and items are required", http.StatusBadRequest)
+		return
+	}
+	quantities := make(map[primitive.ObjectID]int)
+	productIDs := []primitive.ObjectID{}
+	for _, item := range requestData.Items {
+		if item.Quantity <= 0 {
+			http.Error(w, "Item quantities must be positive", http.StatusBadRequest)
+			return
+		}
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	if requestData.PaymentMethod == models.RetailPaymentAccount {
+		if requestData.MemberID == nil {
+			http.Error(w, "member_id is required to charge a sale to an account", http.StatusBadRequest)
+			return
+		}
+	} else if !validPaymentMethods[requestData.PaymentMethod] {
+		http.Error(w, "payment_method must be one of card, cash, bank_transfer, other, account", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if requestData.PaymentMethod == models.RetailPaymentAccount {
+		if err := requireClubAccess(ctx, h.db, *requestData.MemberID); err != nil {
+			writeClubAccessError(w, err)
+			return
+		}
+	}
+
+	now := time.Now()
+	sale := models.RetailSale{
+		ID:            primitive.NewObjectID(),
+		ClubID:        requestData.ClubID,
+		MemberID:      requestData.MemberID,
+		PaymentMethod: requestData.PaymentMethod,
+		Reference:     strings.TrimSpace(requestData.Reference),
+		SoldAt:        now,
+		CreatedAt:     now,
+	}
+	if user := currentUser(r); user != nil {
+		sale.SoldBy = &user.ID
+	}
+
+	// Take the stock first, so two tills cannot sell the last unit twice
+	movements := []models.StockMovement{}
+	products := []models.Product{}
+	for _, productID := range productIDs {
+		movement := models.StockMovement{
+			ProductID: productID,
+			Type:      models.StockMovementSale,
+			Quantity:  -quantities[productID],
+			SaleID:    &sale.ID,
+			CreatedBy: sale.SoldBy,
+			CreatedAt: now,
+		}
+		product, err := moveStock(ctx, h.db, bson.M{"_id": productID, "club_id": sale.ClubID, "active": true}, &movement)
+		if err != nil {
+			h.returnStock(movements)
+			if err == mongo.ErrNoDocuments {
+				err = errProductUnavailable
+			}
+			if _, ok := err.(*insufficientStockError); ok || err == errProductUnavailable {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		movements = append(movements, movement)
+		products = append(products, *product)
+		sale.Lines = append(sale.Lines, models.InvoiceLine{
+			Description: product.Name,
+			ProductType: models.ProductTypeRetail,
+			ProductID:   &product.ID,
+			Quantity:    quantities[productID],
+			UnitPrice:   product.Price,
+		})
+	}
+
+	for _, line := range sale.Lines {
+		if !line.UnitPrice.SameCurrency(sale.Lines[0].UnitPrice) {
+			h.returnStock(movements)
+			http.Error(w, "All items in a sale must be priced in the same currency", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.completeSale(ctx, &sale, movements); err != nil {
+		h.returnStock(movements)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	low := []models.Product{}
+	for i, product := range products {
+		if product.BecameLowStock(product.Stock - movements[i].Quantity) {
+			low = append(low, product)
+		}
+	}
+	if len(low) > 0 {
+		h.notifyLowStock(ctx, sale.ClubID, low)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sale)
+}
+
+// completeSale taxes, numbers and records a sale whose stock has been taken,
+// and charges it to the member's account if it is not paid at the till
+func (h *RetailHandler) completeSale(ctx context.Context, sale *models.RetailSale, movements []models.StockMovement) error {
+	if err := applyTaxRules(ctx, h.db, &sale.ClubID, sale.Lines); err != nil {
+		return err
+	}
+	sale.Recalculate()
+
+	seq, err := nextSequence(ctx, h.db, fmt.Sprintf("retail-sale-%d", sale.SoldAt.Year()))
+	if err != nil {
+		return err
+	}
+	sale.Number = fmt.Sprintf("POS-%d-%06d", sale.SoldAt.Year(), seq)
+
+	if _, err := h.db.Collection("retail_sales").InsertOne(ctx, sale); err != nil {
+		return err
+	}
+	if sale.PaymentMethod == models.RetailPaymentAccount {
+		if err := chargeToAccount(ctx, h.db, sale.AccountCharge()); err != nil {
+			if _, deleteErr := h.db.Collection("retail_sales").DeleteOne(ctx, bson.M{"_id": sale.ID}); deleteErr != nil {
+				log.Printf("retail: failed to remove sale %s after charging it failed: %v", sale.Number, deleteErr)
+			}
+			return err
+		}
+	}
+
+	documents := make([]interface{}, len(movements))
+	for i, movement := range movements {
+		movement.Reason = "Sale " + sale.Number
+		documents[i] = movement
+	}
+	if _, err := h.db.Collection("stock_movements").InsertMany(ctx, documents); err != nil {
+		// The sale stands; only its entries in the stock history are missing
+		log.Printf("retail: failed to record stock movements for sale %s: %v", sale.Number, err)
+	}
+	return nil
+}
+
+// returnStock puts back stock taken for a sale that did not go through
+func (h *RetailHandler) returnStock(movements []models.StockMovement) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, movement := range movements {
+		if _, err := h.db.Collection("products").UpdateOne(ctx, bson.M{"_id": movement.ProductID},
+			bson.M{"$inc": bson.M{"stock": -movement.Quantity}}); err != nil {
+			log.Printf("retail: failed to return %d units of product %s to stock: %v", -movement.Quantity, movement.ProductID.Hex(), err)
+		}
+	}
+}
+
+// notifyLowStock tells the club's managers which products need reordering
+func (h *RetailHandler) notifyLowStock(ctx context.Context, clubID primitive.ObjectID, products []models.Product) {
+	managers, err := clubManagerEmails(ctx, h.db, []primitive.ObjectID{clubID})
+	if err != nil {
+		log.Printf("retail: failed to find club managers for club %s: %v", clubID.Hex(), err)
+		return
+	}
+
+	lines := make([]string, 0, len(products))
+	for _, product := range products {
+		lines = append(lines, fmt.Sprintf("%s (%s): %d left, reorder level %d", product.Name, product.SKU, product.Stock, product.ReorderLevel))
+	}
+	body := "These products are running low and should be reordered:\n\n" + strings.Join(lines, "\n")
+
+	for _, email := range managers {
+		if err := h.notifier.Notify(ctx, notify.Message{To: email, Subject: "Low stock", Body: body}); err != nil {
+			log.Printf("retail: failed to notify %s: %v", email, err)
+		}
+	}
+}
+
+// moveStock applies a movement to the product matching filter and fills in
+// the movement's club and resulting stock. Stock never goes below zero: a
+// movement taking out more than is left fails with insufficientStockError.
+func moveStock(ctx context.Context, db *mongo.Database, filter bson.M, movement *models.StockMovement) (*models.Product, error) {
+	conditional := bson.M{}
+	for key, value := range filter {
+		conditional[key] = value
+	}
+	if movement.Quantity < 0 {
+		conditional["stock"] = bson.M{"$gte": -movement.Quantity}
+	}
+
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.Collection("products").FindOneAndUpdate(ctx, conditional, bson.M{
+		"$inc": bson.M{"stock": movement.Quantity},
+		"$set": bson.M{"updated_at": movement.CreatedAt},
+	}, opts).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		if findErr := db.Collection("products").FindOne(ctx, filter).Decode(&product); findErr != nil {
+			return nil, findErr
+		}
+		return nil, &insufficientStockError{product: product}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	movement.ClubID = product.ClubID
+	movement.StockAfter = product.Stock
+	return &product, nil
+}
+
+// validateProduct checks and normalizes a product's details
+func validateProduct(product *models.Product) error {
+	product.SKU = strings.ToUpper(strings.TrimSpace(product.SKU))
+	product.Name = strings.TrimSpace(product.Name)
+	product.Category = strings.ToLower(strings.TrimSpace(product.Category))
+	if product.SKU == "" || product.Name == "" {
+		return errors.New("sku and name are required")
+	}
+	if product.Price.IsNegative() {
+		return errors.New("price cannot be negative")
+	}
+	if product.Price.Currency == "" {
+		product.Price.Currency = models.DefaultCurrency
+	}
+	if product.ReorderLevel < 0 {
+		return errors.New("reorder_level cannot be negative")
+	}
+	return nil
+}
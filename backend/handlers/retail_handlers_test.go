@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestValidateProduct(t *testing.T) {
+	product := models.Product{SKU: " water-500 ", Name: " Still water ", Category: "Drinks", Price: models.Money{Amount: 250}}
+	if err := validateProduct(&product); err != nil {
+		t.Fatalf("validateProduct error: %v", err)
+	}
+	if product.SKU != "WATER-500" || product.Name != "Still water" || product.Category != "drinks" {
+		t.Errorf("product not normalized: %+v", product)
+	}
+	if product.Price.Currency != models.DefaultCurrency {
+		t.Errorf("price currency = %q, want %q", product.Price.Currency, models.DefaultCurrency)
+	}
+
+	invalid := []models.Product{
+		{Name: "No SKU", Price: models.Cents(100)},
+		{SKU: "NO-NAME", Price: models.Cents(100)},
+		{SKU: "NEG", Name: "Negative", Price: models.Cents(-100)},
+		{SKU: "REORDER", Name: "Reorder", Price: models.Cents(100), ReorderLevel: -1},
+	}
+	for _, p := range invalid {
+		if err := validateProduct(&p); err == nil {
+			t.Errorf("validateProduct(%+v) should fail", p)
+		}
+	}
+}
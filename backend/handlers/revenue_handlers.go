@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
+	"go-api-mongo/models"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -16,25 +19,35 @@ type RevenueDataPoint struct {
 	Revenue        float64 `json:"revenue"`
 	BookingRevenue float64 `json:"booking_revenue"`
 	BillingRevenue float64 `json:"billing_revenue"`
+	RetailRevenue  float64 `json:"retail_revenue"` // shop sales paid at the till
+	Discounts      float64 `json:"discounts"`      // given on invoices issued in the period
 	Count          int     `json:"count"`
 }
 
-// RevenueAnalyticsResponse contains the aggregated revenue data
+// RevenueAnalyticsResponse contains the aggregated revenue data. Amounts are
+// summed exactly in minor units and reported in major units for charting.
 type RevenueAnalyticsResponse struct {
-	Data         []RevenueDataPoint `json:"data"`
-	TotalRevenue float64            `json:"total_revenue"`
-	Period       string             `json:"period"`
-	StartDate    string             `json:"start_date"`
-	EndDate      string             `json:"end_date"`
+	Data           []RevenueDataPoint `json:"data"`
+	TotalRevenue   float64            `json:"total_revenue"`
+	TotalDiscounts float64            `json:"total_discounts"`
+	Currency       string             `json:"currency"`
+	Period         string             `json:"period"`
+	StartDate      string             `json:"start_date"`
+	EndDate        string             `json:"end_date"`
 }
 
-// GetRevenueAnalytics returns revenue data aggregated by day or month
-func GetRevenueAnalytics(bookingsCollection *mongo.Collection, membersCollection *mongo.Collection) http.HandlerFunc {
+// GetRevenueAnalytics returns revenue data aggregated by day or month. The
+// data covers one currency (default USD); amounts in others are left out.
+func GetRevenueAnalytics(bookingsCollection *mongo.Collection, paymentsCollection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get query parameters
 		startDateStr := r.URL.Query().Get("start_date")
 		endDateStr := r.URL.Query().Get("end_date")
 		groupBy := r.URL.Query().Get("group_by") // "day" or "month"
+		currency := strings.ToUpper(r.URL.Query().Get("currency"))
+		if currency == "" {
+			currency = models.DefaultCurrency
+		}
 
 		// Default to last 30 days if not specified
 		endDate := time.Now()
@@ -72,70 +85,168 @@ func GetRevenueAnalytics(bookingsCollection *mongo.Collection, membersCollection
 		}
 		defer cursor.Close(context.Background())
 
-		// Aggregate bookings by date
-		bookingsByDate := make(map[string]float64)
+		var bookings []models.OfficeBooking
 		for cursor.Next(context.Background()) {
-			var booking struct {
-				StartTime time.Time `bson:"start_time"`
-				TotalCost float64   `bson:"total_cost"`
-			}
+			var booking models.OfficeBooking
 			if err := cursor.Decode(&booking); err != nil {
 				continue
 			}
+			bookings = append(bookings, booking)
+		}
+
+		// Bookings billed to members are counted when their invoice is paid
+		billed, err := accountBilledBookingIDs(context.Background(), bookingsCollection.Database(), bookings)
+		if err != nil {
+			http.Error(w, "Failed to fetch billed bookings", http.StatusInternalServerError)
+			return
+		}
+
+		// Aggregate bookings by date
+		bookingsByDate := make(map[string]int64)
+		for _, booking := range bookings {
+			if billed[booking.ID] || booking.TotalCost.Currency != currency {
+				continue
+			}
 
 			dateKey := formatDateKey(booking.StartTime, groupBy)
-			bookingsByDate[dateKey] += booking.TotalCost
+			bookingsByDate[dateKey] += booking.TotalCost.Amount
+		}
+
+		// Fetch payments received within date range. Refunded payments were
+		// still received; their refunds are taken off when they were made.
+		// Account credit was counted when it was first paid, or is a reward.
+		paymentFilter := bson.M{
+			"received_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+			"status": bson.M{"$in": []string{models.PaymentStatusSucceeded, models.PaymentStatusRefunded}},
+			"method": bson.M{"$ne": "account_credit"},
+		}
+
+		paymentCursor, err := paymentsCollection.Find(context.Background(), paymentFilter)
+		if err != nil {
+			http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+			return
+		}
+		defer paymentCursor.Close(context.Background())
+
+		billingsByDate := make(map[string]int64)
+		for paymentCursor.Next(context.Background()) {
+			var payment models.Payment
+			if err := paymentCursor.Decode(&payment); err != nil || payment.Amount.Currency != currency {
+				continue
+			}
+
+			dateKey := formatDateKey(payment.ReceivedAt, groupBy)
+			billingsByDate[dateKey] += payment.Amount.Amount
+		}
+
+		// Refunds made within date range
+		refundCursor, err := paymentsCollection.Database().Collection("credit_notes").Find(context.Background(), bson.M{
+			"created_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+			"method": models.CreditNoteRefund,
+		})
+		if err != nil {
+			http.Error(w, "Failed to fetch refunds", http.StatusInternalServerError)
+			return
 		}
+		defer refundCursor.Close(context.Background())
+
+		for refundCursor.Next(context.Background()) {
+			var note models.CreditNote
+			if err := refundCursor.Decode(&note); err != nil || note.Amount.Currency != currency {
+				continue
+			}
 
-		// Fetch member billing entries within date range
-		memberCursor, err := membersCollection.Find(context.Background(), bson.M{})
+			dateKey := formatDateKey(note.CreatedAt, groupBy)
+			billingsByDate[dateKey] -= note.Amount.Amount
+		}
+
+		// Shop sales paid at the till within date range. Sales charged to a
+		// member's account are counted when their statement is paid.
+		saleCursor, err := paymentsCollection.Database().Collection("retail_sales").Find(context.Background(), bson.M{
+			"sold_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+			"payment_method": bson.M{"$ne": models.RetailPaymentAccount},
+		})
 		if err != nil {
-			http.Error(w, "Failed to fetch members", http.StatusInternalServerError)
+			http.Error(w, "Failed to fetch retail sales", http.StatusInternalServerError)
 			return
 		}
-		defer memberCursor.Close(context.Background())
+		defer saleCursor.Close(context.Background())
 
-		billingsByDate := make(map[string]float64)
-		for memberCursor.Next(context.Background()) {
-			var member struct {
-				BillingHistory []struct {
-					Date   time.Time `bson:"date"`
-					Amount float64   `bson:"amount"`
-					Status string    `bson:"status"`
-				} `bson:"billing_history"`
+		retailByDate := make(map[string]int64)
+		for saleCursor.Next(context.Background()) {
+			var sale models.RetailSale
+			if err := saleCursor.Decode(&sale); err != nil || sale.Total.Currency != currency {
+				continue
 			}
-			if err := memberCursor.Decode(&member); err != nil {
+
+			dateKey := formatDateKey(sale.SoldAt, groupBy)
+			retailByDate[dateKey] += sale.Total.Amount
+		}
+
+		// Discount lines on invoices issued within date range
+		invoiceCursor, err := paymentsCollection.Database().Collection("invoices").Find(context.Background(), bson.M{
+			"issued_at": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+			"status":             bson.M{"$ne": models.InvoiceStatusVoid},
+			"lines.product_type": models.ProductTypeDiscount,
+		})
+		if err != nil {
+			http.Error(w, "Failed to fetch invoices", http.StatusInternalServerError)
+			return
+		}
+		defer invoiceCursor.Close(context.Background())
+
+		discountsByDate := make(map[string]int64)
+		var totalDiscounts int64
+		for invoiceCursor.Next(context.Background()) {
+			var invoice models.Invoice
+			if err := invoiceCursor.Decode(&invoice); err != nil || invoice.IssuedAt == nil || invoice.Total.Currency != currency {
 				continue
 			}
 
-			for _, billing := range member.BillingHistory {
-				if billing.Date.Before(startDate) || billing.Date.After(endDate) {
-					continue
-				}
-				if billing.Status != "paid" {
-					continue
+			dateKey := formatDateKey(*invoice.IssuedAt, groupBy)
+			for _, line := range invoice.Lines {
+				if line.ProductType == models.ProductTypeDiscount {
+					discountsByDate[dateKey] -= line.Amount.Amount
+					totalDiscounts -= line.Amount.Amount
 				}
-
-				dateKey := formatDateKey(billing.Date, groupBy)
-				billingsByDate[dateKey] += billing.Amount
 			}
 		}
 
 		// Combine data and generate time series
-		dataPoints := generateTimeSeries(startDate, endDate, groupBy, bookingsByDate, billingsByDate)
+		dataPoints := generateTimeSeries(startDate, endDate, groupBy, bookingsByDate, billingsByDate, retailByDate, discountsByDate)
 
 		// Calculate total revenue
-		var totalRevenue float64
-		for _, dp := range dataPoints {
-			totalRevenue += dp.Revenue
+		var totalRevenue int64
+		for _, amount := range bookingsByDate {
+			totalRevenue += amount
+		}
+		for _, amount := range billingsByDate {
+			totalRevenue += amount
+		}
+		for _, amount := range retailByDate {
+			totalRevenue += amount
 		}
 
 		response := RevenueAnalyticsResponse{
-			Data:         dataPoints,
-			TotalRevenue: totalRevenue,
-			Period:       groupBy,
-			StartDate:    startDate.Format("2006-01-02"),
-			EndDate:      endDate.Format("2006-01-02"),
+			Data:           dataPoints,
+			TotalRevenue:   models.Cents(totalRevenue).Float64(),
+			TotalDiscounts: models.Cents(totalDiscounts).Float64(),
+			Currency:       currency,
+			Period:         groupBy,
+			StartDate:      startDate.Format("2006-01-02"),
+			EndDate:        endDate.Format("2006-01-02"),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -152,7 +263,7 @@ func formatDateKey(t time.Time, groupBy string) string {
 }
 
 // generateTimeSeries creates a complete time series with all dates, filling in zeros for missing data
-func generateTimeSeries(startDate, endDate time.Time, groupBy string, bookings, billings map[string]float64) []RevenueDataPoint {
+func generateTimeSeries(startDate, endDate time.Time, groupBy string, bookings, billings, retail, discounts map[string]int64) []RevenueDataPoint {
 	var dataPoints []RevenueDataPoint
 	current := startDate
 
@@ -160,12 +271,15 @@ func generateTimeSeries(startDate, endDate time.Time, groupBy string, bookings,
 		dateKey := formatDateKey(current, groupBy)
 		bookingRev := bookings[dateKey]
 		billingRev := billings[dateKey]
+		retailRev := retail[dateKey]
 
 		dataPoints = append(dataPoints, RevenueDataPoint{
 			Date:           dateKey,
-			Revenue:        bookingRev + billingRev,
-			BookingRevenue: bookingRev,
-			BillingRevenue: billingRev,
+			Revenue:        models.Cents(bookingRev + billingRev + retailRev).Float64(),
+			BookingRevenue: models.Cents(bookingRev).Float64(),
+			BillingRevenue: models.Cents(billingRev).Float64(),
+			RetailRevenue:  models.Cents(retailRev).Float64(),
+			Discounts:      models.Cents(discounts[dateKey]).Float64(),
 			Count:          0, // Can be extended to count transactions
 		})
 
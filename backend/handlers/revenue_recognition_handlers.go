@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RevenueRecognitionHandler reports invoiced revenue as it is earned rather
+// than when it is billed or paid
+type RevenueRecognitionHandler struct {
+	db *mongo.Database
+}
+
+func NewRevenueRecognitionHandler(db *mongo.Database) *RevenueRecognitionHandler {
+	return &RevenueRecognitionHandler{db: db}
+}
+
+// RecognitionMonth is one month of billed and recognized revenue, with the
+// deferred revenue balance at the end of it
+type RecognitionMonth struct {
+	Month           string       `json:"month"`
+	Billed          models.Money `json:"billed"`
+	Recognized      models.Money `json:"recognized"`
+	DeferredBalance models.Money `json:"deferred_balance"`
+}
+
+// RecognitionGroup is the revenue recognition of one club
+type RecognitionGroup struct {
+	ID                     *primitive.ObjectID `json:"id,omitempty"`
+	Name                   string              `json:"name"`
+	OpeningDeferredBalance models.Money        `json:"opening_deferred_balance"`
+	Billed                 models.Money        `json:"billed"`
+	Recognized             models.Money        `json:"recognized"`
+	DeferredBalance        models.Money        `json:"deferred_balance"`
+	Months                 []RecognitionMonth  `json:"months"`
+}
+
+// GetRecognitionReport returns invoiced revenue, excluding tax, billed and
+// recognized month by month, in total and by club, with the deferred
+// revenue balance: what has been billed but not yet earned. Invoice lines
+// with a service period are recognized evenly across it; other lines when
+// they are billed. Credit notes reduce billed revenue when they are given
+// and come out of deferred revenue first. The report covers one currency
+// (default USD) from start_month to end_month (default the last 12 months)
+// and can be narrowed with club_id. With format=csv the months of each club
+// are exported instead.
+func (h *RevenueRecognitionHandler) GetRecognitionReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var clubID *primitive.ObjectID
+	if value := query.Get("club_id"); value != "" {
+		objID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		clubID = &objID
+	}
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if value := query.Get("end_month"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			http.Error(w, "end_month must be formatted YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, -11, 0)
+	if value := query.Get("start_month"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			http.Error(w, "start_month must be formatted YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		start = parsed
+	}
+	if start.After(end) {
+		http.Error(w, "start_month cannot be after end_month", http.StatusBadRequest)
+		return
+	}
+	months := []string{}
+	for month := start; !month.After(end); month = month.AddDate(0, 1, 0) {
+		months = append(months, models.RevenueMonth(month))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ledgers, err := recognitionLedgers(ctx, h.db, clubID, currency, end.AddDate(0, 1, 0))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	clubNames, err := recognitionClubNames(ctx, h.db, ledgers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	total := newRecognitionLedger(currency)
+	byClub := []RecognitionGroup{}
+	for key, ledger := range ledgers {
+		total.merge(ledger)
+		group := ledger.group(months)
+		if key != (primitive.ObjectID{}) {
+			id := key
+			group.ID = &id
+			group.Name = clubNames[key]
+		}
+		byClub = append(byClub, group)
+	}
+	sort.Slice(byClub, func(i, j int) bool {
+		if c := byClub[i].DeferredBalance.Cmp(byClub[j].DeferredBalance); c != 0 {
+			return c > 0
+		}
+		return byClub[i].Name < byClub[j].Name
+	})
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"revenue-recognition-%s-%s.csv\"", months[0], months[len(months)-1]))
+		writeRecognitionCSV(w, byClub)
+		return
+	}
+
+	totals := total.group(months)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generated_at":             now,
+		"currency":                 currency,
+		"start_month":              months[0],
+		"end_month":                months[len(months)-1],
+		"opening_deferred_balance": totals.OpeningDeferredBalance,
+		"billed":                   totals.Billed,
+		"recognized":               totals.Recognized,
+		"deferred_balance":         totals.DeferredBalance,
+		"months":                   totals.Months,
+		"by_club":                  byClub,
+	})
+}
+
+// recognitionLedgers collects the revenue billed and recognized on invoices
+// issued before end, by club. Invoices without a club are under the zero ID.
+func recognitionLedgers(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID, currency string, end time.Time) (map[primitive.ObjectID]*recognitionLedger, error) {
+	filter := bson.M{
+		"status":    bson.M{"$nin": []string{models.InvoiceStatusDraft, models.InvoiceStatusVoid}},
+		"issued_at": bson.M{"$lt": end},
+		"currency":  currency,
+	}
+	if clubID != nil {
+		filter["club_id"] = *clubID
+	}
+	cursor, err := db.Collection("invoices").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+
+	noteFilter := bson.M{"created_at": bson.M{"$lt": end}}
+	if clubID != nil {
+		noteFilter["club_id"] = *clubID
+	}
+	cursor, err = db.Collection("credit_notes").Find(ctx, noteFilter)
+	if err != nil {
+		return nil, err
+	}
+	var notes []models.CreditNote
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].CreatedAt.Before(notes[j].CreatedAt) })
+	notesByInvoice := map[primitive.ObjectID][]models.CreditNote{}
+	for _, note := range notes {
+		notesByInvoice[note.InvoiceID] = append(notesByInvoice[note.InvoiceID], note)
+	}
+
+	ledgers := map[primitive.ObjectID]*recognitionLedger{}
+	for _, invoice := range invoices {
+		if invoice.IssuedAt == nil {
+			continue
+		}
+		var key primitive.ObjectID
+		if invoice.ClubID != nil {
+			key = *invoice.ClubID
+		}
+		ledger, ok := ledgers[key]
+		if !ok {
+			ledger = newRecognitionLedger(currency)
+			ledgers[key] = ledger
+		}
+
+		ledger.bill(models.RevenueMonth(*invoice.IssuedAt), invoice.Subtotal)
+		schedule := invoice.RecognitionSchedule()
+		for _, note := range notesByInvoice[invoice.ID] {
+			// Credit notes include tax; only the revenue part is reversed
+			credit := note.Amount
+			if invoice.Total.IsPositive() {
+				credit = note.Amount.Prorate(invoice.Subtotal.Amount, invoice.Total.Amount)
+			}
+			month := models.RevenueMonth(note.CreatedAt)
+			ledger.bill(month, credit.Neg())
+			schedule = models.ReduceSchedule(schedule, month, credit)
+		}
+		ledger.recognize(schedule)
+	}
+	return ledgers, nil
+}
+
+// recognitionLedger accumulates revenue billed and recognized by month
+type recognitionLedger struct {
+	currency   string
+	billed     map[string]models.Money
+	recognized map[string]models.Money
+}
+
+func newRecognitionLedger(currency string) *recognitionLedger {
+	return &recognitionLedger{currency: currency, billed: map[string]models.Money{}, recognized: map[string]models.Money{}}
+}
+
+func (l *recognitionLedger) bill(month string, amount models.Money) {
+	l.billed[month] = l.billed[month].Add(amount)
+}
+
+func (l *recognitionLedger) recognize(schedule []models.RecognizedAmount) {
+	for _, part := range schedule {
+		l.recognized[part.Month] = l.recognized[part.Month].Add(part.Amount)
+	}
+}
+
+func (l *recognitionLedger) merge(other *recognitionLedger) {
+	for month, amount := range other.billed {
+		l.bill(month, amount)
+	}
+	for month, amount := range other.recognized {
+		l.recognized[month] = l.recognized[month].Add(amount)
+	}
+}
+
+// group reports the given months, in order. Everything billed and
+// recognized before them makes up the opening deferred balance; revenue
+// recognized after them is still deferred at the end.
+func (l *recognitionLedger) group(months []string) RecognitionGroup {
+	zero := models.NewMoney(0, l.currency)
+	opening := zero
+	for month, amount := range l.billed {
+		if month < months[0] {
+			opening = opening.Add(amount)
+		}
+	}
+	for month, amount := range l.recognized {
+		if month < months[0] {
+			opening = opening.Sub(amount)
+		}
+	}
+
+	group := RecognitionGroup{
+		OpeningDeferredBalance: opening,
+		Billed:                 zero,
+		Recognized:             zero,
+		DeferredBalance:        opening,
+		Months:                 make([]RecognitionMonth, 0, len(months)),
+	}
+	for _, month := range months {
+		billed := zero.Add(l.billed[month])
+		recognized := zero.Add(l.recognized[month])
+		group.Billed = group.Billed.Add(billed)
+		group.Recognized = group.Recognized.Add(recognized)
+		group.DeferredBalance = group.DeferredBalance.Add(billed).Sub(recognized)
+		group.Months = append(group.Months, RecognitionMonth{
+			Month:           month,
+			Billed:          billed,
+			Recognized:      recognized,
+			DeferredBalance: group.DeferredBalance,
+		})
+	}
+	return group
+}
+
+// recognitionClubNames looks up the names of the clubs in the report
+func recognitionClubNames(ctx context.Context, db *mongo.Database, ledgers map[primitive.ObjectID]*recognitionLedger) (map[primitive.ObjectID]string, error) {
+	ids := []primitive.ObjectID{}
+	for id := range ledgers {
+		if id != (primitive.ObjectID{}) {
+			ids = append(ids, id)
+		}
+	}
+	names := make(map[primitive.ObjectID]string)
+	if len(ids) == 0 {
+		return names, nil
+	}
+	cursor, err := db.Collection("clubs").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var clubs []models.Club
+	if err := cursor.All(ctx, &clubs); err != nil {
+		return nil, err
+	}
+	for _, club := range clubs {
+		names[club.ID] = club.Name
+	}
+	return names, nil
+}
+
+// writeRecognitionCSV writes one row per club per month
+func writeRecognitionCSV(w http.ResponseWriter, groups []RecognitionGroup) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"month", "club", "billed", "recognized", "deferred_balance", "currency"})
+	for _, group := range groups {
+		for _, month := range group.Months {
+			out.Write([]string{
+				month.Month,
+				group.Name,
+				month.Billed.Major(),
+				month.Recognized.Major(),
+				month.DeferredBalance.Major(),
+				month.DeferredBalance.Currency,
+			})
+		}
+	}
+	out.Flush()
+}
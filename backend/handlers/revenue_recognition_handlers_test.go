@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+
+	"go-api-mongo/models"
+)
+
+func TestRecognitionLedgerGroup(t *testing.T) {
+	ledger := newRecognitionLedger(models.DefaultCurrency)
+	ledger.bill("2023-12", models.Cents(12000))
+	ledger.recognize([]models.RecognizedAmount{
+		{Month: "2023-12", Amount: models.Cents(1000)},
+		{Month: "2024-01", Amount: models.Cents(1000)},
+		{Month: "2024-02", Amount: models.Cents(1000)},
+	})
+	ledger.bill("2024-02", models.Cents(500))
+	ledger.recognize([]models.RecognizedAmount{{Month: "2024-02", Amount: models.Cents(500)}})
+
+	group := ledger.group([]string{"2024-01", "2024-02"})
+	if group.OpeningDeferredBalance.Amount != 11000 {
+		t.Errorf("opening deferred = %d, want 11000", group.OpeningDeferredBalance.Amount)
+	}
+	if group.Billed.Amount != 500 || group.Recognized.Amount != 2500 || group.DeferredBalance.Amount != 9000 {
+		t.Errorf("billed, recognized, deferred = %d, %d, %d, want 500, 2500, 9000",
+			group.Billed.Amount, group.Recognized.Amount, group.DeferredBalance.Amount)
+	}
+	if len(group.Months) != 2 || group.Months[0].DeferredBalance.Amount != 10000 {
+		t.Errorf("months = %+v, want January ending at 100.00 deferred", group.Months)
+	}
+
+	recorder := httptest.NewRecorder()
+	group.Name = "Downtown"
+	writeRecognitionCSV(recorder, []RecognitionGroup{group})
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	want := []string{"2024-02", "Downtown", "5.00", "15.00", "90.00", "USD"}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 months", len(rows))
+	}
+	for i, cell := range want {
+		if rows[2][i] != cell {
+			t.Errorf("column %s = %q, want %q", rows[0][i], rows[2][i], cell)
+		}
+	}
+}
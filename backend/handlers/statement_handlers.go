@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StatementHandler bills usage charged to member accounts on monthly statements
+type StatementHandler struct {
+	db *mongo.Database
+}
+
+func NewStatementHandler(db *mongo.Database) *StatementHandler {
+	return &StatementHandler{db: db}
+}
+
+// GetMemberAccountCharges returns a member's account charges, newest first,
+// optionally filtered by status
+func (h *StatementHandler) GetMemberAccountCharges(w http.ResponseWriter, r *http.Request) {
+	memberID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"member_id": memberID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "charged_at", Value: -1}}).SetLimit(500)
+	cursor, err := h.db.Collection("account_charges").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var charges []models.AccountCharge
+	if err := cursor.All(ctx, &charges); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if charges == nil {
+		charges = []models.AccountCharge{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(charges)
+}
+
+// RunStatements issues last month's statements now instead of waiting for the daily job
+func (h *StatementHandler) RunStatements(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can issue statements", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	issued, err := issueStatements(ctx, h.db, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"statements": issued})
+}
+
+// IssueStatements is the scheduled entry point for monthly statements
+func IssueStatements(db *mongo.Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := issueStatements(ctx, db, time.Now())
+		return err
+	}
+}
+
+// issueStatements issues a statement for last month to every member with
+// pending charges from it or a membership renewing since it began, unless
+// they already have one. Charges made later than that wait for next month.
+func issueStatements(ctx context.Context, db *mongo.Database, now time.Time) (int, error) {
+	start, end := models.StatementMonth(now)
+	month := start.Format("2006-01")
+
+	memberIDs := map[primitive.ObjectID]bool{}
+	ids, err := db.Collection("account_charges").Distinct(ctx, "member_id", bson.M{
+		"status":     models.AccountChargeStatusPending,
+		"charged_at": bson.M{"$lt": end},
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if memberID, ok := id.(primitive.ObjectID); ok {
+			memberIDs[memberID] = true
+		}
+	}
+	ids, err = db.Collection("members").Distinct(ctx, "_id", renewingMembersFilter(start, end))
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if memberID, ok := id.(primitive.ObjectID); ok {
+			memberIDs[memberID] = true
+		}
+	}
+
+	issued := 0
+	for memberID := range memberIDs {
+		count, err := db.Collection("invoices").CountDocuments(ctx, bson.M{
+			"member_id":       memberID,
+			"statement_month": month,
+			"status":          bson.M{"$ne": models.InvoiceStatusVoid},
+		})
+		if err != nil {
+			return issued, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		n, err := issueMemberStatement(ctx, db, memberID, start, end, now)
+		if err != nil {
+			return issued, err
+		}
+		issued += n
+	}
+	return issued, nil
+}
+
+// renewalWindow returns when renewals billed on a statement fall: from the
+// start of the statement month to a month after its end. Earlier renewals
+// were billed on earlier statements.
+func renewalWindow(start, end time.Time) (time.Time, time.Time) {
+	return start, end.AddDate(0, 1, 0)
+}
+
+// renewingMembersFilter matches active members on a plan with auto renewal
+// whose membership renews in the renewal window. Members sponsored by a
+// company are renewed by its monthly invoice instead.
+func renewingMembersFilter(start, end time.Time) bson.M {
+	from, to := renewalWindow(start, end)
+	return bson.M{
+		"status":               models.MemberStatusActive,
+		"auto_renewal":         true,
+		"plan_id":              bson.M{"$exists": true},
+		"corporate_account_id": bson.M{"$exists": false},
+		"expiry_date":          bson.M{"$gte": from, "$lt": to},
+	}
+}
+
+// renewsOnStatement reports whether the member's renewal is billed on the
+// statement for the month from start to end. It matches the members
+// renewingMembersFilter finds.
+func renewsOnStatement(member models.Member, start, end time.Time) bool {
+	from, to := renewalWindow(start, end)
+	return member.PlanID != nil && member.AutoRenewal && member.Status == models.MemberStatusActive &&
+		member.CorporateAccountID == nil && !member.ExpiryDate.Before(from) && member.ExpiryDate.Before(to)
+}
+
+// statementKey separates a member's statements by club and currency, so
+// each statement is taxed under one club's rules and totals in one currency
+type statementKey struct {
+	clubID   primitive.ObjectID
+	currency string
+}
+
+// issueMemberStatement bills a member's renewal and pending charges for the
+// month ending at end, one statement per club. Charges and the renewal are
+// claimed before the statement is written and released if that fails.
+func issueMemberStatement(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, start, end, now time.Time) (int, error) {
+	var member models.Member
+	if err := db.Collection("members").FindOne(ctx, bson.M{"_id": memberID}).Decode(&member); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	lines := map[statementKey][]models.InvoiceLine{}
+	clubs := map[statementKey]*primitive.ObjectID{}
+	keyFor := func(clubID *primitive.ObjectID, currency string) statementKey {
+		key := statementKey{currency: currency}
+		if clubID != nil {
+			key.clubID = *clubID
+		}
+		clubs[key] = clubID
+		return key
+	}
+
+	cursor, err := db.Collection("account_charges").Find(ctx, bson.M{
+		"member_id":  memberID,
+		"status":     models.AccountChargeStatusPending,
+		"charged_at": bson.M{"$lt": end},
+	}, options.Find().SetSort(bson.D{{Key: "charged_at", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	var pending []models.AccountCharge
+	if err := cursor.All(ctx, &pending); err != nil {
+		return 0, err
+	}
+	chargeIDs := map[statementKey][]primitive.ObjectID{}
+	for _, charge := range pending {
+		currency := charge.Amount.Currency
+		if currency == "" {
+			currency = models.DefaultCurrency
+		}
+		key := keyFor(charge.ClubID, currency)
+		chargeIDs[key] = append(chargeIDs[key], charge.ID)
+	}
+
+	dues, plan, renewedFrom, err := claimRenewal(ctx, db, member, start, end)
+	if err != nil {
+		return 0, err
+	}
+	if dues != nil {
+		clubID := plan.ClubID
+		if clubID == nil && len(member.ClubIDs) > 0 {
+			clubID = &member.ClubIDs[0]
+		}
+		key := keyFor(clubID, dues.UnitPrice.Currency)
+		lines[key] = append(lines[key], *dues)
+	}
+
+	keys := make([]statementKey, 0, len(clubs))
+	for key := range clubs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].clubID != keys[j].clubID {
+			return keys[i].clubID.Hex() < keys[j].clubID.Hex()
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	issued := 0
+	for _, key := range keys {
+		invoiceID := primitive.NewObjectID()
+		claimed, err := claimAccountCharges(ctx, db, chargeIDs[key], invoiceID, now)
+		if err != nil {
+			if len(lines[key]) > 0 {
+				releaseRenewal(ctx, db, member.ID, renewedFrom, plan)
+			}
+			return issued, err
+		}
+		statementLines := lines[key]
+		for _, charge := range claimed {
+			statementLines = append(statementLines, charge.Line())
+		}
+		if len(statementLines) == 0 {
+			continue
+		}
+
+		err = writeStatement(ctx, db, invoiceID, member.ID, clubs[key], start, statementLines, now)
+		if err != nil {
+			releaseAccountCharges(ctx, db, invoiceID)
+			if len(lines[key]) > 0 {
+				releaseRenewal(ctx, db, member.ID, renewedFrom, plan)
+			}
+			return issued, err
+		}
+		issued++
+	}
+	return issued, nil
+}
+
+// claimRenewal returns the dues line for a member renewing in the statement
+// window, with the plan billed and the previous expiry date. The member's
+// expiry date is moved to the end of the new period at the same time, so a
+// renewal is only billed once. A plan change scheduled for the renewal is
+// billed at the new plan's price.
+func claimRenewal(ctx context.Context, db *mongo.Database, member models.Member, start, end time.Time) (*models.InvoiceLine, *models.MembershipPlan, time.Time, error) {
+	if !renewsOnStatement(member, start, end) {
+		return nil, nil, time.Time{}, nil
+	}
+
+	planID := *member.PlanID
+	var scheduled models.PlanChange
+	err := db.Collection("plan_changes").FindOne(ctx, bson.M{
+		"member_id":    member.ID,
+		"status":       models.PlanChangeStatusScheduled,
+		"effective_at": bson.M{"$lte": member.ExpiryDate},
+	}).Decode(&scheduled)
+	if err == nil {
+		planID = scheduled.ToPlanID
+	} else if err != mongo.ErrNoDocuments {
+		return nil, nil, time.Time{}, err
+	}
+
+	plan, err := findPlan(ctx, db, planID)
+	if err == errPlanNotFound {
+		return nil, nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	periodStart := member.ExpiryDate
+	periodEnd := plan.PeriodEnd(periodStart)
+	result, err := db.Collection("members").UpdateOne(ctx,
+		bson.M{"_id": member.ID, "expiry_date": periodStart},
+		bson.M{"$set": bson.M{"expiry_date": periodEnd, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	if result.ModifiedCount == 0 {
+		return nil, nil, time.Time{}, nil
+	}
+
+	return &models.InvoiceLine{
+		Description:  fmt.Sprintf("%s, %s to %s", plan.Name, periodStart.Format("2006-01-02"), periodEnd.Format("2006-01-02")),
+		ProductType:  models.ProductTypeMembership,
+		ProductID:    &plan.ID,
+		Quantity:     1,
+		UnitPrice:    plan.Price,
+		ServiceStart: &periodStart,
+		ServiceEnd:   &periodEnd,
+	}, plan, periodStart, nil
+}
+
+// releaseRenewal puts a member's expiry date back after their statement could not be written
+func releaseRenewal(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, expiry time.Time, plan *models.MembershipPlan) {
+	_, err := db.Collection("members").UpdateOne(ctx,
+		bson.M{"_id": memberID, "expiry_date": plan.PeriodEnd(expiry)},
+		bson.M{"$set": bson.M{"expiry_date": expiry, "updated_at": time.Now()}})
+	if err != nil {
+		log.Printf("statements: failed to release renewal of member %s: %v", memberID.Hex(), err)
+	}
+}
+
+// claimAccountCharges marks pending charges billed on a statement and
+// returns the ones claimed, in the order they were made
+func claimAccountCharges(ctx context.Context, db *mongo.Database, ids []primitive.ObjectID, statementID primitive.ObjectID, now time.Time) ([]models.AccountCharge, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	charges := db.Collection("account_charges")
+	_, err := charges.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "status": models.AccountChargeStatusPending},
+		bson.M{"$set": bson.M{
+			"status":       models.AccountChargeStatusBilled,
+			"statement_id": statementID,
+			"billed_at":    now,
+			"updated_at":   now,
+		}})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := charges.Find(ctx, bson.M{"statement_id": statementID},
+		options.Find().SetSort(bson.D{{Key: "charged_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var claimed []models.AccountCharge
+	if err := cursor.All(ctx, &claimed); err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// releaseAccountCharges returns the charges claimed for a statement that
+// could not be written to pending
+func releaseAccountCharges(ctx context.Context, db *mongo.Database, statementID primitive.ObjectID) {
+	_, err := db.Collection("account_charges").UpdateMany(ctx,
+		bson.M{"statement_id": statementID},
+		bson.M{
+			"$set":   bson.M{"status": models.AccountChargeStatusPending, "updated_at": time.Now()},
+			"$unset": bson.M{"statement_id": "", "billed_at": ""},
+		})
+	if err != nil {
+		log.Printf("statements: failed to release charges of statement %s: %v", statementID.Hex(), err)
+	}
+}
+
+// writeStatement issues a statement invoice with tax from the club's rules
+func writeStatement(ctx context.Context, db *mongo.Database, id, memberID primitive.ObjectID, clubID *primitive.ObjectID, month time.Time, lines []models.InvoiceLine, now time.Time) error {
+	invoice := models.Invoice{
+		ID:             id,
+		MemberID:       &memberID,
+		ClubID:         clubID,
+		Status:         models.InvoiceStatusOpen,
+		Lines:          lines,
+		IssuedAt:       &now,
+		DueDate:        now.AddDate(0, 0, 14),
+		Notes:          "Statement for " + month.Format("January 2006"),
+		StatementMonth: month.Format("2006-01"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := applyTaxRules(ctx, db, clubID, invoice.Lines); err != nil {
+		return err
+	}
+	invoice.Recalculate()
+
+	number, err := nextInvoiceNumber(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	invoice.Number = number
+
+	if _, err := db.Collection("invoices").InsertOne(ctx, invoice); err != nil {
+		return err
+	}
+	tryApplyAccountCredit(db, invoice.ID)
+	return nil
+}
+
+// chargeToAccount records usage on a member's account. A charge still
+// pending is updated in place; one already billed is left alone.
+func chargeToAccount(ctx context.Context, db *mongo.Database, charge models.AccountCharge) error {
+	charges := db.Collection("account_charges")
+	now := time.Now()
+
+	result, err := charges.UpdateOne(ctx, bson.M{
+		"source":    charge.Source,
+		"source_id": charge.SourceID,
+		"status":    models.AccountChargeStatusPending,
+	}, bson.M{"$set": bson.M{
+		"member_id":     charge.MemberID,
+		"club_id":       charge.ClubID,
+		"description":   charge.Description,
+		"amount":        charge.Amount,
+		"tax_rate":      charge.TaxRate,
+		"tax_inclusive": charge.TaxInclusive,
+		"charged_at":    charge.ChargedAt,
+		"updated_at":    now,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	charge.ID = primitive.NewObjectID()
+	charge.Status = models.AccountChargeStatusPending
+	charge.CreatedAt, charge.UpdatedAt = now, now
+	_, err = charges.UpdateOne(ctx,
+		bson.M{"source": charge.Source, "source_id": charge.SourceID},
+		bson.M{"$setOnInsert": charge},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// removeAccountCharge drops a pending charge whose usage is no longer completed
+func removeAccountCharge(ctx context.Context, db *mongo.Database, source string, sourceID primitive.ObjectID) error {
+	_, err := db.Collection("account_charges").DeleteOne(ctx, bson.M{
+		"source":    source,
+		"source_id": sourceID,
+		"status":    models.AccountChargeStatusPending,
+	})
+	return err
+}
+
+// tryRemoveAccountCharge drops the pending charge of deleted usage without
+// failing the request that deleted it
+func tryRemoveAccountCharge(db *mongo.Database, source string, sourceID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := removeAccountCharge(ctx, db, source, sourceID); err != nil {
+		log.Printf("statements: failed to remove %s charge %s: %v", source, sourceID.Hex(), err)
+	}
+}
+
+// syncOfficeBookingCharge charges a member's completed office booking to
+// their account, unless it was invoiced directly, and withdraws the
+// pending charge when the booking is no longer completed
+func syncOfficeBookingCharge(ctx context.Context, db *mongo.Database, booking models.OfficeBooking) error {
+	if booking.Status != "completed" || booking.MemberID == nil {
+		return removeAccountCharge(ctx, db, models.ProductTypeOfficeBooking, booking.ID)
+	}
+
+	invoiced, err := invoicedBookingIDs(ctx, db, []models.OfficeBooking{booking})
+	if err != nil {
+		return err
+	}
+	if invoiced[booking.ID] || !booking.TotalCost.IsPositive() {
+		return removeAccountCharge(ctx, db, models.ProductTypeOfficeBooking, booking.ID)
+	}
+
+	description := "Office booking"
+	var clubID *primitive.ObjectID
+	if booking.OfficeID != nil {
+		var office models.Office
+		err := db.Collection("offices").FindOne(ctx, bson.M{"_id": *booking.OfficeID}).Decode(&office)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if err == nil {
+			description, clubID = office.Name, office.ClubID
+		}
+	}
+
+	return chargeToAccount(ctx, db, models.AccountCharge{
+		MemberID:     *booking.MemberID,
+		ClubID:       clubID,
+		Source:       models.ProductTypeOfficeBooking,
+		SourceID:     booking.ID,
+		Description:  fmt.Sprintf("%s, %s", description, booking.StartTime.Format("2006-01-02 15:04")),
+		Amount:       booking.TotalCost,
+		TaxRate:      booking.TaxRate,
+		TaxInclusive: booking.TaxInclusive,
+		ChargedAt:    booking.EndTime,
+	})
+}
+
+// syncReservationCharge charges a member's completed restaurant check, less
+// any loyalty discount and what was paid by gift card, to their account, and
+// withdraws the pending charge when the reservation is no longer completed
+func syncReservationCharge(ctx context.Context, db *mongo.Database, reservation models.Reservation) error {
+	amount := reservation.BillAmount
+	if !reservation.Discount.IsZero() {
+		amount = amount.Sub(reservation.Discount)
+	}
+	if !reservation.GiftCardPaid.IsZero() {
+		amount = amount.Sub(reservation.GiftCardPaid)
+	}
+	if reservation.Status != "completed" || reservation.MemberID == nil || !amount.IsPositive() {
+		return removeAccountCharge(ctx, db, models.ProductTypeRestaurant, reservation.ID)
+	}
+
+	description := "Restaurant"
+	var clubID *primitive.ObjectID
+	if reservation.RestaurantID != nil {
+		var restaurant models.Restaurant
+		err := db.Collection("restaurants").FindOne(ctx, bson.M{"_id": *reservation.RestaurantID}).Decode(&restaurant)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if err == nil {
+			description, clubID = restaurant.Name, restaurant.ClubID
+		}
+	}
+
+	return chargeToAccount(ctx, db, models.AccountCharge{
+		MemberID:    *reservation.MemberID,
+		ClubID:      clubID,
+		Source:      models.ProductTypeRestaurant,
+		SourceID:    reservation.ID,
+		Description: fmt.Sprintf("%s, party of %d, %s", description, reservation.PartySize, reservation.DateTime.Format("2006-01-02")),
+		Amount:      amount,
+		ChargedAt:   reservation.DateTime,
+	})
+}
+
+// trySyncOfficeBookingCharge keeps a booking's account charge in step
+// without failing the request that changed the booking
+func trySyncOfficeBookingCharge(db *mongo.Database, booking models.OfficeBooking) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := syncOfficeBookingCharge(ctx, db, booking); err != nil {
+		log.Printf("statements: failed to charge office booking %s to account: %v", booking.ID.Hex(), err)
+	}
+}
+
+// trySyncReservationCharge keeps a reservation's account charge in step
+// without failing the request that changed the reservation
+func trySyncReservationCharge(db *mongo.Database, reservation models.Reservation) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := syncReservationCharge(ctx, db, reservation); err != nil {
+		log.Printf("statements: failed to charge reservation %s to account: %v", reservation.ID.Hex(), err)
+	}
+}
+
+// accountBilledBookingIDs returns which bookings are billed to members
+// through invoices or account charges rather than paid for on their own
+func accountBilledBookingIDs(ctx context.Context, db *mongo.Database, bookings []models.OfficeBooking) (map[primitive.ObjectID]bool, error) {
+	billed, err := invoicedBookingIDs(ctx, db, bookings)
+	if err != nil || len(bookings) == 0 {
+		return billed, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(bookings))
+	for _, booking := range bookings {
+		ids = append(ids, booking.ID)
+	}
+	charged, err := db.Collection("account_charges").Distinct(ctx, "source_id", bson.M{
+		"source":    models.ProductTypeOfficeBooking,
+		"source_id": bson.M{"$in": ids},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range charged {
+		if bookingID, ok := id.(primitive.ObjectID); ok {
+			billed[bookingID] = true
+		}
+	}
+	return billed, nil
+}
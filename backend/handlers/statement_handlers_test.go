@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRenewsOnStatement(t *testing.T) {
+	start, end := models.StatementMonth(time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC))
+	planID := primitive.NewObjectID()
+	renewing := func(expiry time.Time) models.Member {
+		return models.Member{PlanID: &planID, AutoRenewal: true, Status: models.MemberStatusActive, ExpiryDate: expiry}
+	}
+	corporate := renewing(time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC))
+	corporate.CorporateAccountID = &planID
+	manual := renewing(time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC))
+	manual.AutoRenewal = false
+	frozen := renewing(time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC))
+	frozen.Status = models.MemberStatusFrozen
+
+	tests := []struct {
+		name   string
+		member models.Member
+		billed bool
+	}{
+		{"billed on the statement issued in March", renewing(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)), false},
+		{"missed by the statement issued in March", renewing(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)), true},
+		{"renews this month", renewing(time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)), true},
+		{"billed on the statement issued in May", renewing(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)), false},
+		{"sponsored by a company", corporate, false},
+		{"without auto renewal", manual, false},
+		{"frozen", frozen, false},
+		{"without a plan", models.Member{AutoRenewal: true, Status: models.MemberStatusActive, ExpiryDate: time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)}, false},
+	}
+	for _, tt := range tests {
+		if billed := renewsOnStatement(tt.member, start, end); billed != tt.billed {
+			t.Errorf("%s: renewsOnStatement = %v, want %v", tt.name, billed, tt.billed)
+		}
+	}
+}
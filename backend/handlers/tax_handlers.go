@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TaxHandler manages tax rules and the tax summary report. Rules are applied
+// to invoice lines when an invoice is saved and to office bookings when they
+// are created or updated.
+type TaxHandler struct {
+	db *mongo.Database
+}
+
+func NewTaxHandler(db *mongo.Database) *TaxHandler {
+	return &TaxHandler{db: db}
+}
+
+// GetTaxRules returns tax rules, optionally filtered by club_id or state
+func (h *TaxHandler) GetTaxRules(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if clubID := r.URL.Query().Get("club_id"); clubID != "" {
+		objID, err := primitive.ObjectIDFromHex(clubID)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		filter["club_id"] = objID
+	}
+	if state := r.URL.Query().Get("state"); state != "" {
+		filter["state"] = strings.ToUpper(state)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "product_type", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := h.db.Collection("tax_rules").Find(ctx, filter, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var rules []models.TaxRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = []models.TaxRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// SaveTaxRule creates or replaces the tax rule for a product type at a club,
+// in a state, or by default when neither club_id nor state is given
+func (h *TaxHandler) SaveTaxRule(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage tax rules", http.StatusForbidden)
+		return
+	}
+
+	var rule models.TaxRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.State = strings.ToUpper(strings.TrimSpace(rule.State))
+
+	if rule.ClubID != nil && rule.State != "" {
+		http.Error(w, "A tax rule applies to a club or a state, not both", http.StatusBadRequest)
+		return
+	}
+	if !validProductTypes[rule.ProductType] || models.IsAdjustmentType(rule.ProductType) {
+		http.Error(w, "Invalid product_type", http.StatusBadRequest)
+		return
+	}
+	if rule.Rate < 0 || rule.Rate >= 100 {
+		http.Error(w, "rate must be a percentage from 0 to under 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"product_type": rule.ProductType, "club_id": rule.ClubID, "state": rule.State}
+	if rule.ClubID == nil {
+		filter["club_id"] = bson.M{"$exists": false}
+	}
+	if rule.State == "" {
+		filter["state"] = bson.M{"$exists": false}
+	}
+
+	now := time.Now()
+	setOnInsert := bson.M{"product_type": rule.ProductType, "created_at": now}
+	if rule.ClubID != nil {
+		setOnInsert["club_id"] = rule.ClubID
+	}
+	if rule.State != "" {
+		setOnInsert["state"] = rule.State
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"name":       strings.TrimSpace(rule.Name),
+			"rate":       rule.Rate,
+			"inclusive":  rule.Inclusive,
+			"active":     rule.Active,
+			"updated_at": now,
+		},
+		"$setOnInsert": setOnInsert,
+	}
+
+	var saved models.TaxRule
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := h.db.Collection("tax_rules").FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DeleteTaxRule removes a tax rule. Invoices and bookings already saved keep
+// the tax they were calculated with.
+func (h *TaxHandler) DeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	if !isManager(currentUser(r)) {
+		http.Error(w, "Only admins and club managers can manage tax rules", http.StatusForbidden)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid tax rule ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.db.Collection("tax_rules").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		http.Error(w, "Tax rule not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TaxSummaryLine is the tax collected for one club, product type and rate
+type TaxSummaryLine struct {
+	ClubID        *primitive.ObjectID `json:"club_id,omitempty"`
+	ProductType   string              `json:"product_type"`
+	TaxRate       float64             `json:"tax_rate"`
+	TaxInclusive  bool                `json:"tax_inclusive"`
+	TaxableAmount models.Money        `json:"taxable_amount"` // net of tax
+	TaxAmount     models.Money        `json:"tax_amount"`
+	Count         int                 `json:"count"` // invoice lines and bookings
+}
+
+// TaxSummaryTotal is the report total for one currency
+type TaxSummaryTotal struct {
+	TaxableAmount models.Money `json:"taxable_amount"`
+	TaxAmount     models.Money `json:"tax_amount"`
+}
+
+type taxSummaryKey struct {
+	clubID      primitive.ObjectID
+	productType string
+	rate        float64
+	inclusive   bool
+	currency    string
+}
+
+// taxSummary accumulates taxable amounts and tax into report lines
+type taxSummary struct {
+	lines map[taxSummaryKey]*TaxSummaryLine
+}
+
+func (s *taxSummary) add(clubID *primitive.ObjectID, productType string, rate float64, inclusive bool, taxable, tax models.Money) {
+	currency := taxable.Currency
+	if currency == "" {
+		currency = tax.Currency
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	key := taxSummaryKey{productType: productType, rate: rate, inclusive: inclusive, currency: currency}
+	if clubID != nil {
+		key.clubID = *clubID
+	}
+	line, ok := s.lines[key]
+	if !ok {
+		zero := models.NewMoney(0, currency)
+		line = &TaxSummaryLine{
+			ClubID:        clubID,
+			ProductType:   productType,
+			TaxRate:       rate,
+			TaxInclusive:  inclusive,
+			TaxableAmount: zero,
+			TaxAmount:     zero,
+		}
+		s.lines[key] = line
+	}
+	line.TaxableAmount = line.TaxableAmount.Add(taxable)
+	line.TaxAmount = line.TaxAmount.Add(tax)
+	line.Count++
+}
+
+// result returns the report lines in a stable order and the totals by currency
+func (s *taxSummary) result() ([]TaxSummaryLine, map[string]TaxSummaryTotal) {
+	lines := []TaxSummaryLine{}
+	totals := map[string]TaxSummaryTotal{}
+	for key, line := range s.lines {
+		lines = append(lines, *line)
+		total, ok := totals[key.currency]
+		if !ok {
+			zero := models.NewMoney(0, key.currency)
+			total = TaxSummaryTotal{TaxableAmount: zero, TaxAmount: zero}
+		}
+		total.TaxableAmount = total.TaxableAmount.Add(line.TaxableAmount)
+		total.TaxAmount = total.TaxAmount.Add(line.TaxAmount)
+		totals[key.currency] = total
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		var aClub, bClub string
+		if a.ClubID != nil {
+			aClub = a.ClubID.Hex()
+		}
+		if b.ClubID != nil {
+			bClub = b.ClubID.Hex()
+		}
+		if aClub != bClub {
+			return aClub < bClub
+		}
+		if a.ProductType != b.ProductType {
+			return a.ProductType < b.ProductType
+		}
+		if a.TaxRate != b.TaxRate {
+			return a.TaxRate < b.TaxRate
+		}
+		if a.TaxInclusive != b.TaxInclusive {
+			return !a.TaxInclusive
+		}
+		return a.TaxableAmount.Currency < b.TaxableAmount.Currency
+	})
+	return lines, totals
+}
+
+// GetTaxReport summarises tax for filing over start_date to end_date
+// inclusive, optionally for one club. It covers invoices issued in the range
+// that are not void, confirmed or completed office bookings starting in
+// the range that have not been invoiced, and shop sales paid at the till in
+// the range. Credit notes are not netted off.
+func (h *TaxHandler) GetTaxReport(w http.ResponseWriter, r *http.Request) {
+	startDate, err := time.Parse("2006-01-02", r.URL.Query().Get("start_date"))
+	if err != nil {
+		http.Error(w, "start_date is required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", r.URL.Query().Get("end_date"))
+	if err != nil {
+		http.Error(w, "end_date is required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if endDate.Before(startDate) {
+		http.Error(w, "end_date cannot be before start_date", http.StatusBadRequest)
+		return
+	}
+	endExclusive := endDate.AddDate(0, 0, 1)
+
+	var clubID *primitive.ObjectID
+	if clubIDStr := r.URL.Query().Get("club_id"); clubIDStr != "" {
+		objID, err := primitive.ObjectIDFromHex(clubIDStr)
+		if err != nil {
+			http.Error(w, "Invalid club ID", http.StatusBadRequest)
+			return
+		}
+		clubID = &objID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	summary := &taxSummary{lines: map[taxSummaryKey]*TaxSummaryLine{}}
+
+	invoiceFilter := bson.M{
+		"issued_at": bson.M{"$gte": startDate, "$lt": endExclusive},
+		"status":    bson.M{"$nin": []string{models.InvoiceStatusDraft, models.InvoiceStatusVoid}},
+	}
+	if clubID != nil {
+		invoiceFilter["club_id"] = *clubID
+	}
+	cursor, err := h.db.Collection("invoices").Find(ctx, invoiceFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, invoice := range invoices {
+		for _, line := range invoice.Lines {
+			summary.add(invoice.ClubID, line.ProductType, line.TaxRate, line.TaxInclusive, line.Amount, line.TaxAmount)
+		}
+	}
+
+	// Office bookings, with the club taken from the office
+	officeFilter := bson.M{}
+	if clubID != nil {
+		officeFilter["club_id"] = *clubID
+	}
+	cursor, err = h.db.Collection("offices").Find(ctx, officeFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var offices []models.Office
+	if err := cursor.All(ctx, &offices); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	officeClubs := make(map[primitive.ObjectID]*primitive.ObjectID)
+	officeIDs := []primitive.ObjectID{}
+	for _, office := range offices {
+		officeClubs[office.ID] = office.ClubID
+		officeIDs = append(officeIDs, office.ID)
+	}
+
+	bookingFilter := bson.M{
+		"start_time": bson.M{"$gte": startDate, "$lt": endExclusive},
+		"status":     bson.M{"$in": []string{"confirmed", "completed"}},
+	}
+	if clubID != nil {
+		bookingFilter["office_id"] = bson.M{"$in": officeIDs}
+	}
+	cursor, err = h.db.Collection("office_bookings").Find(ctx, bookingFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var bookings []models.OfficeBooking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invoiced, err := invoicedBookingIDs(ctx, h.db, bookings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, booking := range bookings {
+		if invoiced[booking.ID] {
+			continue
+		}
+		var bookingClub *primitive.ObjectID
+		if booking.OfficeID != nil {
+			bookingClub = officeClubs[*booking.OfficeID]
+		}
+		taxable := booking.TotalCost
+		if booking.TaxInclusive {
+			taxable = taxable.Sub(booking.TaxAmount)
+		}
+		summary.add(bookingClub, models.ProductTypeOfficeBooking, booking.TaxRate, booking.TaxInclusive, taxable, booking.TaxAmount)
+	}
+
+	// Shop sales charged to an account are taxed on the member's statement
+	saleFilter := bson.M{
+		"sold_at":        bson.M{"$gte": startDate, "$lt": endExclusive},
+		"payment_method": bson.M{"$ne": models.RetailPaymentAccount},
+	}
+	if clubID != nil {
+		saleFilter["club_id"] = *clubID
+	}
+	cursor, err = h.db.Collection("retail_sales").Find(ctx, saleFilter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var sales []models.RetailSale
+	if err := cursor.All(ctx, &sales); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, sale := range sales {
+		for _, line := range sale.Lines {
+			summary.add(&sale.ClubID, line.ProductType, line.TaxRate, line.TaxInclusive, line.Amount, line.TaxAmount)
+		}
+	}
+
+	lines, totals := summary.result()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_date": startDate.Format("2006-01-02"),
+		"end_date":   endDate.Format("2006-01-02"),
+		"club_id":    clubID,
+		"lines":      lines,
+		"totals":     totals,
+	})
+}
+
+// invoicedBookingIDs returns which of the bookings are charged on an invoice
+// that is not void, so the tax report does not count them twice
+func invoicedBookingIDs(ctx context.Context, db *mongo.Database, bookings []models.OfficeBooking) (map[primitive.ObjectID]bool, error) {
+	invoiced := make(map[primitive.ObjectID]bool)
+	if len(bookings) == 0 {
+		return invoiced, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(bookings))
+	for _, booking := range bookings {
+		ids = append(ids, booking.ID)
+	}
+
+	cursor, err := db.Collection("invoices").Find(ctx, bson.M{
+		"status": bson.M{"$ne": models.InvoiceStatusVoid},
+		"lines": bson.M{"$elemMatch": bson.M{
+			"product_type": models.ProductTypeOfficeBooking,
+			"product_id":   bson.M{"$in": ids},
+		}},
+	}, options.Find().SetProjection(bson.M{"lines": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	for _, invoice := range invoices {
+		for _, line := range invoice.Lines {
+			if line.ProductType == models.ProductTypeOfficeBooking && line.ProductID != nil {
+				invoiced[*line.ProductID] = true
+			}
+		}
+	}
+	return invoiced, nil
+}
+
+// loadTaxRules returns the active tax rules and the state of a club, for
+// resolving the rule that applies there
+func loadTaxRules(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID) ([]models.TaxRule, string, error) {
+	var state string
+	if clubID != nil {
+		var club models.Club
+		err := db.Collection("clubs").FindOne(ctx, bson.M{"_id": *clubID}).Decode(&club)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, "", err
+		}
+		state = strings.ToUpper(club.State)
+	}
+
+	cursor, err := db.Collection("tax_rules").Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, "", err
+	}
+	var rules []models.TaxRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, "", err
+	}
+	return rules, state, nil
+}
+
+// applyTaxRules sets the tax rate and pricing of invoice lines from the
+// club's tax rules. Lines without a matching rule keep the rate they were
+// entered with; discount and credit lines keep the tax terms they were given.
+func applyTaxRules(ctx context.Context, db *mongo.Database, clubID *primitive.ObjectID, lines []models.InvoiceLine) error {
+	rules, state, err := loadTaxRules(ctx, db, clubID)
+	if err != nil {
+		return err
+	}
+	for i := range lines {
+		if models.IsAdjustmentType(lines[i].ProductType) {
+			continue
+		}
+		if rule := models.ResolveTaxRule(rules, clubID, state, lines[i].ProductType); rule != nil {
+			lines[i].TaxRate = rule.Rate
+			lines[i].TaxInclusive = rule.Inclusive
+		}
+	}
+	return nil
+}
+
+// applyBookingTax calculates an office booking's tax from the office_booking
+// rule of the club the office belongs to
+func applyBookingTax(ctx context.Context, db *mongo.Database, booking *models.OfficeBooking) error {
+	var clubID *primitive.ObjectID
+	if booking.OfficeID != nil {
+		var office models.Office
+		err := db.Collection("offices").FindOne(ctx, bson.M{"_id": *booking.OfficeID}).Decode(&office)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		clubID = office.ClubID
+	}
+
+	rules, state, err := loadTaxRules(ctx, db, clubID)
+	if err != nil {
+		return err
+	}
+	booking.ApplyTax(models.ResolveTaxRule(rules, clubID, state, models.ProductTypeOfficeBooking))
+	return nil
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTaxSummary(t *testing.T) {
+	clubID := primitive.NewObjectID()
+	summary := &taxSummary{lines: map[taxSummaryKey]*TaxSummaryLine{}}
+	summary.add(&clubID, models.ProductTypeMembership, 10, false, models.Cents(10000), models.Cents(1000))
+	summary.add(&clubID, models.ProductTypeMembership, 10, false, models.Cents(5000), models.Cents(500))
+	summary.add(&clubID, models.ProductTypeMembership, 10, true, models.Cents(2000), models.Cents(200))
+	summary.add(nil, models.ProductTypeOfficeBooking, 0, false, models.Cents(3000), models.Money{})
+	summary.add(&clubID, models.ProductTypeOther, 20, false, models.NewMoney(1000, "EUR"), models.NewMoney(200, "EUR"))
+
+	lines, totals := summary.result()
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %+v", len(lines), lines)
+	}
+	if lines[0].ClubID != nil {
+		t.Errorf("lines without a club should sort first, got %+v", lines[0])
+	}
+	first := lines[1]
+	if first.ProductType != models.ProductTypeMembership || first.TaxInclusive || first.Count != 2 ||
+		first.TaxableAmount != models.Cents(15000) || first.TaxAmount != models.Cents(1500) {
+		t.Errorf("unexpected membership line %+v", first)
+	}
+	if usd := totals["USD"]; usd.TaxableAmount != models.Cents(20000) || usd.TaxAmount != models.Cents(1700) {
+		t.Errorf("USD totals = %+v", usd)
+	}
+	if eur := totals["EUR"]; eur.TaxAmount != models.NewMoney(200, "EUR") {
+		t.Errorf("EUR totals = %+v", eur)
+	}
+}
@@ -0,0 +1,74 @@
+// Package jobs runs periodic background work such as nightly recalculations.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a named background task
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// next returns when the job should run after now
+	next func(now time.Time) time.Time
+}
+
+// Every returns a job that runs at a fixed interval
+func Every(name string, interval time.Duration, run func(ctx context.Context) error) Job {
+	return Job{
+		Name: name,
+		Run:  run,
+		next: func(now time.Time) time.Time { return now.Add(interval) },
+	}
+}
+
+// Daily returns a job that runs once a day at the given local hour
+func Daily(name string, hour int, run func(ctx context.Context) error) Job {
+	return Job{
+		Name: name,
+		Run:  run,
+		next: func(now time.Time) time.Time { return NextDailyRun(now, hour) },
+	}
+}
+
+// NextDailyRun returns the first time strictly after now at hour:00 local time
+func NextDailyRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Start runs each job on its own schedule until ctx is cancelled. A failing
+// run is logged and retried at the next scheduled time.
+func Start(ctx context.Context, jobs ...Job) {
+	for _, job := range jobs {
+		go run(ctx, job)
+	}
+}
+
+func run(ctx context.Context, job Job) {
+	for {
+		wait := time.Until(job.next(time.Now()))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		started := time.Now()
+		runCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		err := job.Run(runCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Job %s failed: %v", job.Name, err)
+			continue
+		}
+		log.Printf("Job %s completed in %s", job.Name, time.Since(started).Round(time.Millisecond))
+	}
+}
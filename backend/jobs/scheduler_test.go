@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDailyRun(t *testing.T) {
+	loc := time.UTC
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"later today", time.Date(2026, 3, 10, 1, 30, 0, 0, loc), time.Date(2026, 3, 10, 2, 0, 0, 0, loc)},
+		{"already ran today", time.Date(2026, 3, 10, 2, 0, 0, 0, loc), time.Date(2026, 3, 11, 2, 0, 0, 0, loc)},
+		{"month rollover", time.Date(2026, 3, 31, 23, 0, 0, 0, loc), time.Date(2026, 4, 1, 2, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextDailyRun(tt.now, 2); !got.Equal(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -11,7 +11,11 @@ import (
 	"go-api-mongo/config"
 	"go-api-mongo/database"
 	"go-api-mongo/handlers"
+	"go-api-mongo/jobs"
 	"go-api-mongo/middleware"
+	"go-api-mongo/notify"
+	"go-api-mongo/payments"
+	"go-api-mongo/storage"
 )
 
 // CORS middleware
@@ -57,6 +61,59 @@ func main() {
 	clubHandler := handlers.NewClubHandler(db.Client.Database(db.DatabaseName))
 	authMiddleware := middleware.NewAuthMiddleware(db.Client.Database(db.DatabaseName), jwtConfig)
 
+	// Initialize blob storage for signed documents and uploads
+	storageConfig := config.InitStorageConfig()
+	blobStore, err := storage.NewLocalStore(storageConfig.LocalPath)
+	if err != nil {
+		log.Fatal("Failed to initialize blob storage:", err)
+	}
+	proxyConfig := config.InitProxyConfig()
+	documentHandler := handlers.NewDocumentHandler(db.Client.Database(db.DatabaseName), blobStore, proxyConfig.TrustedProxies)
+	checkInHandler := handlers.NewCheckInHandler(db.Client.Database(db.DatabaseName))
+	attachmentHandler := handlers.NewAttachmentHandler(db.Client.Database(db.DatabaseName), blobStore)
+	referralHandler := handlers.NewReferralHandler(db.Client.Database(db.DatabaseName))
+	loyaltyHandler := handlers.NewLoyaltyHandler(db.Client.Database(db.DatabaseName))
+	churnHandler := handlers.NewChurnHandler(db.Client.Database(db.DatabaseName))
+
+	// Initialize the payment provider; only the local fake exists so far
+	paymentsConfig := config.InitPaymentsConfig()
+	var paymentProvider payments.Provider
+	switch paymentsConfig.Provider {
+	case "fake":
+		paymentProvider = payments.NewFakeProvider(paymentsConfig.WebhookSecret)
+	default:
+		log.Fatalf("Unknown payment provider %q", paymentsConfig.Provider)
+	}
+
+	// Failed membership payments are retried on the dunning schedule;
+	// notifications are written to the log until a mail sender is configured
+	dunningConfig := config.InitDunningConfig()
+	notifier := notify.NewLogNotifier(log.Default())
+	dunningHandler := handlers.NewDunningHandler(db.Client.Database(db.DatabaseName), paymentProvider, notifier, dunningConfig.RetryDays)
+	invoiceHandler := handlers.NewInvoiceHandler(db.Client.Database(db.DatabaseName), dunningHandler)
+	paymentHandler := handlers.NewPaymentHandler(db.Client.Database(db.DatabaseName), paymentProvider, dunningHandler)
+	creditNoteHandler := handlers.NewCreditNoteHandler(db.Client.Database(db.DatabaseName), paymentProvider)
+	accountCreditHandler := handlers.NewAccountCreditHandler(db.Client.Database(db.DatabaseName))
+	promoCodeHandler := handlers.NewPromoCodeHandler(db.Client.Database(db.DatabaseName))
+	taxHandler := handlers.NewTaxHandler(db.Client.Database(db.DatabaseName))
+	membershipPlanHandler := handlers.NewMembershipPlanHandler(db.Client.Database(db.DatabaseName))
+	receivablesHandler := handlers.NewReceivablesHandler(db.Client.Database(db.DatabaseName))
+	statementHandler := handlers.NewStatementHandler(db.Client.Database(db.DatabaseName))
+	giftCardHandler := handlers.NewGiftCardHandler(db.Client.Database(db.DatabaseName))
+	retailHandler := handlers.NewRetailHandler(db.Client.Database(db.DatabaseName), notifier)
+	corporateAccountHandler := handlers.NewCorporateAccountHandler(db.Client.Database(db.DatabaseName))
+	revenueRecognitionHandler := handlers.NewRevenueRecognitionHandler(db.Client.Database(db.DatabaseName))
+
+	// Class bookings allow a member one open booking per class
+	if err := handlers.EnsureClassBookingIndexes(context.Background(), db.Client.Database(db.DatabaseName)); err != nil {
+		log.Printf("Failed to create class booking indexes, run make migrate-class-bookings: %v", err)
+	}
+
+	// Document templates allow one of each version per type and club
+	if err := handlers.EnsureDocumentTemplateIndexes(context.Background(), db.Client.Database(db.DatabaseName)); err != nil {
+		log.Printf("Failed to create document template indexes: %v", err)
+	}
+
 	// Initialize restaurant and reservation collections
 	restaurantCollection := db.Client.Database(db.DatabaseName).Collection("restaurants")
 	reservationCollection := db.Client.Database(db.DatabaseName).Collection("reservations")
@@ -64,7 +121,7 @@ func main() {
 	officeBookingCollection := db.Client.Database(db.DatabaseName).Collection("office_bookings")
 	classBookingCollection := db.Client.Database(db.DatabaseName).Collection("class_bookings")
 	userCollection := db.Client.Database(db.DatabaseName).Collection("users")
-	membersCollection := db.Client.Database(db.DatabaseName).Collection("members")
+	paymentsCollection := db.Client.Database(db.DatabaseName).Collection("payments")
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -75,27 +132,165 @@ func main() {
 	// Local authentication routes
 	mux.HandleFunc("/auth/login", localAuthHandler.Login)
 
+	// Payment provider webhooks - authenticated by their signature
+	mux.HandleFunc("POST /api/payments/webhook", paymentHandler.HandleWebhook)
+
 	// Protected routes - require authentication
 	mux.HandleFunc("/api/me", authMiddleware.RequireAuth(handlers.Me))
 
 	// Revenue analytics routes - require authentication
-	mux.HandleFunc("GET /api/revenue", authMiddleware.RequireAuth(handlers.GetRevenueAnalytics(officeBookingCollection, membersCollection)))
+	mux.HandleFunc("GET /api/revenue", authMiddleware.RequireAuth(handlers.GetRevenueAnalytics(officeBookingCollection, paymentsCollection)))
 
 	// Member CRM routes - require authentication
 	mux.HandleFunc("/api/members", authMiddleware.RequireAuth(memberHandler.MembersHandler))
 	mux.HandleFunc("/api/members/", authMiddleware.RequireAuth(memberHandler.MemberHandler))
+	mux.HandleFunc("POST /api/members/{id}/status/{action}", authMiddleware.RequireAuth(memberHandler.ChangeMemberStatus))
+	mux.HandleFunc("GET /api/members/{id}/status-history", authMiddleware.RequireAuth(memberHandler.GetMemberStatusHistory))
+
+	// Waiver and contract routes - require authentication
+	mux.HandleFunc("GET /api/document-templates", authMiddleware.RequireAuth(documentHandler.GetTemplates))
+	mux.HandleFunc("POST /api/document-templates", authMiddleware.RequireAuth(documentHandler.CreateTemplate))
+	mux.HandleFunc("GET /api/document-templates/{id}", authMiddleware.RequireAuth(documentHandler.GetTemplate))
+	mux.HandleFunc("GET /api/members/{id}/documents", authMiddleware.RequireAuth(documentHandler.GetMemberDocuments))
+	mux.HandleFunc("POST /api/members/{id}/documents", authMiddleware.RequireAuth(documentHandler.SignDocument))
+	mux.HandleFunc("GET /api/members/{id}/waiver-status", authMiddleware.RequireAuth(documentHandler.GetWaiverStatus))
+	mux.HandleFunc("GET /api/signed-documents/{id}/pdf", authMiddleware.RequireAuth(documentHandler.DownloadSignedDocument))
+
+	// Photo and attachment routes - require authentication
+	mux.HandleFunc("POST /api/members/{id}/photo", authMiddleware.RequireAuth(attachmentHandler.UploadMemberPhoto))
+	mux.HandleFunc("POST /api/instructors/{id}/photo", authMiddleware.RequireAuth(attachmentHandler.UploadInstructorPhoto))
+	mux.HandleFunc("GET /api/members/{id}/attachments", authMiddleware.RequireAuth(attachmentHandler.GetMemberAttachments))
+	mux.HandleFunc("POST /api/members/{id}/attachments", authMiddleware.RequireAuth(attachmentHandler.UploadMemberAttachment))
+	mux.HandleFunc("GET /api/attachments/{id}", authMiddleware.RequireAuth(attachmentHandler.DownloadAttachment))
+	mux.HandleFunc("GET /api/attachments/{id}/thumbnail", authMiddleware.RequireAuth(attachmentHandler.DownloadThumbnail))
+	mux.HandleFunc("DELETE /api/attachments/{id}", authMiddleware.RequireAuth(attachmentHandler.DeleteAttachment))
+
+	// Referral routes
+	mux.HandleFunc("GET /api/referral-programs", authMiddleware.RequireAuth(referralHandler.GetPrograms))
+	mux.HandleFunc("PUT /api/referral-programs", authMiddleware.RequireAuth(referralHandler.SaveProgram))
+	mux.HandleFunc("GET /api/members/{id}/referrals", authMiddleware.RequireAuth(referralHandler.GetMemberReferrals))
+	mux.HandleFunc("GET /api/referrals/leaderboard", authMiddleware.RequireAuth(referralHandler.GetLeaderboard))
+	mux.HandleFunc("POST /api/referrals/process", authMiddleware.RequireAuth(referralHandler.ProcessRewards))
+
+	// Invoice routes
+	mux.HandleFunc("GET /api/invoices", authMiddleware.RequireAuth(invoiceHandler.GetInvoices))
+	mux.HandleFunc("POST /api/invoices", authMiddleware.RequireAuth(invoiceHandler.CreateInvoice))
+	mux.HandleFunc("GET /api/invoices/{id}", authMiddleware.RequireAuth(invoiceHandler.GetInvoice))
+	mux.HandleFunc("PUT /api/invoices/{id}", authMiddleware.RequireAuth(invoiceHandler.UpdateInvoice))
+	mux.HandleFunc("POST /api/invoices/{id}/status/{action}", authMiddleware.RequireAuth(invoiceHandler.ChangeInvoiceStatus))
+	mux.HandleFunc("POST /api/invoices/{id}/payments", authMiddleware.RequireAuth(invoiceHandler.RecordPayment))
+	mux.HandleFunc("GET /api/members/{id}/invoices", authMiddleware.RequireAuth(invoiceHandler.GetMemberInvoices))
+	mux.HandleFunc("GET /api/invoices/{id}/pdf", authMiddleware.RequireAuth(invoiceHandler.DownloadInvoicePDF))
+	mux.HandleFunc("GET /api/payments/{id}/receipt", authMiddleware.RequireAuth(invoiceHandler.DownloadReceipt))
+
+	// Card payment routes
+	mux.HandleFunc("POST /api/invoices/{id}/pay", authMiddleware.RequireAuth(paymentHandler.PayInvoice))
+	mux.HandleFunc("GET /api/members/{id}/payment-methods", authMiddleware.RequireAuth(paymentHandler.GetPaymentMethods))
+	mux.HandleFunc("POST /api/members/{id}/payment-methods", authMiddleware.RequireAuth(paymentHandler.SavePaymentMethod))
+	mux.HandleFunc("DELETE /api/payment-methods/{id}", authMiddleware.RequireAuth(paymentHandler.DeletePaymentMethod))
+
+	// Refund and account credit routes
+	mux.HandleFunc("GET /api/credit-notes", authMiddleware.RequireAuth(creditNoteHandler.GetCreditNotes))
+	mux.HandleFunc("POST /api/invoices/{id}/credit-notes", authMiddleware.RequireAuth(creditNoteHandler.CreateCreditNote))
+	mux.HandleFunc("GET /api/members/{id}/account-credit", authMiddleware.RequireAuth(accountCreditHandler.GetMemberAccountCredit))
+	mux.HandleFunc("POST /api/members/{id}/account-credit/adjust", authMiddleware.RequireAuth(accountCreditHandler.AdjustAccountCredit))
+
+	// Promo code routes
+	mux.HandleFunc("GET /api/promo-codes", authMiddleware.RequireAuth(promoCodeHandler.GetPromoCodes))
+	mux.HandleFunc("POST /api/promo-codes", authMiddleware.RequireAuth(promoCodeHandler.CreatePromoCode))
+	mux.HandleFunc("PUT /api/promo-codes/{id}", authMiddleware.RequireAuth(promoCodeHandler.UpdatePromoCode))
+	mux.HandleFunc("GET /api/promo-codes/{id}/redemptions", authMiddleware.RequireAuth(promoCodeHandler.GetPromoRedemptions))
+	mux.HandleFunc("POST /api/invoices/{id}/promo-code", authMiddleware.RequireAuth(promoCodeHandler.ApplyPromoCode))
+
+	// Membership plan routes
+	mux.HandleFunc("GET /api/membership-plans", authMiddleware.RequireAuth(membershipPlanHandler.GetPlans))
+	mux.HandleFunc("POST /api/membership-plans", authMiddleware.RequireAuth(membershipPlanHandler.CreatePlan))
+	mux.HandleFunc("PUT /api/membership-plans/{id}", authMiddleware.RequireAuth(membershipPlanHandler.UpdatePlan))
+	mux.HandleFunc("POST /api/members/{id}/plan-change/preview", authMiddleware.RequireAuth(membershipPlanHandler.PreviewPlanChange))
+	mux.HandleFunc("POST /api/members/{id}/plan-change", authMiddleware.RequireAuth(membershipPlanHandler.ChangePlan))
+	mux.HandleFunc("GET /api/members/{id}/plan-changes", authMiddleware.RequireAuth(membershipPlanHandler.GetMemberPlanChanges))
+	mux.HandleFunc("POST /api/plan-changes/{id}/cancel", authMiddleware.RequireAuth(membershipPlanHandler.CancelPlanChange))
+
+	// Tax routes
+	mux.HandleFunc("GET /api/tax-rules", authMiddleware.RequireAuth(taxHandler.GetTaxRules))
+	mux.HandleFunc("PUT /api/tax-rules", authMiddleware.RequireAuth(taxHandler.SaveTaxRule))
+	mux.HandleFunc("DELETE /api/tax-rules/{id}", authMiddleware.RequireAuth(taxHandler.DeleteTaxRule))
+	mux.HandleFunc("GET /api/reports/tax", authMiddleware.RequireAuth(taxHandler.GetTaxReport))
+
+	// Accounts receivable routes
+	mux.HandleFunc("GET /api/reports/ar-aging", authMiddleware.RequireAuth(receivablesHandler.GetAgingReport))
+	mux.HandleFunc("GET /api/reports/revenue-recognition", authMiddleware.RequireAuth(revenueRecognitionHandler.GetRecognitionReport))
+
+	// Account charge and statement routes
+	mux.HandleFunc("GET /api/members/{id}/account-charges", authMiddleware.RequireAuth(statementHandler.GetMemberAccountCharges))
+	mux.HandleFunc("POST /api/statements/run", authMiddleware.RequireAuth(statementHandler.RunStatements))
+
+	// Gift card routes
+	mux.HandleFunc("GET /api/gift-cards", authMiddleware.RequireAuth(giftCardHandler.GetGiftCards))
+	mux.HandleFunc("POST /api/gift-cards", authMiddleware.RequireAuth(giftCardHandler.IssueGiftCard))
+	mux.HandleFunc("GET /api/gift-cards/{id}", authMiddleware.RequireAuth(giftCardHandler.GetGiftCard))
+	mux.HandleFunc("POST /api/gift-cards/{id}/adjust", authMiddleware.RequireAuth(giftCardHandler.AdjustGiftCard))
+	mux.HandleFunc("POST /api/gift-cards/{id}/void", authMiddleware.RequireAuth(giftCardHandler.VoidGiftCard))
+	mux.HandleFunc("POST /api/invoices/{id}/gift-card", authMiddleware.RequireAuth(invoiceHandler.PayWithGiftCard))
+	mux.HandleFunc("POST /api/reservations/{id}/gift-card", authMiddleware.RequireAuth(giftCardHandler.PayReservation))
+	mux.HandleFunc("GET /api/reports/gift-card-liability", authMiddleware.RequireAuth(giftCardHandler.GetLiabilityReport))
+
+	// Retail routes
+	mux.HandleFunc("GET /api/products", authMiddleware.RequireAuth(retailHandler.GetProducts))
+	mux.HandleFunc("POST /api/products", authMiddleware.RequireAuth(retailHandler.CreateProduct))
+	mux.HandleFunc("GET /api/products/{id}", authMiddleware.RequireAuth(retailHandler.GetProduct))
+	mux.HandleFunc("PUT /api/products/{id}", authMiddleware.RequireAuth(retailHandler.UpdateProduct))
+	mux.HandleFunc("POST /api/products/{id}/stock-adjustments", authMiddleware.RequireAuth(retailHandler.AdjustStock))
+	mux.HandleFunc("GET /api/products/{id}/stock-movements", authMiddleware.RequireAuth(retailHandler.GetStockMovements))
+	mux.HandleFunc("GET /api/retail-sales", authMiddleware.RequireAuth(retailHandler.GetSales))
+	mux.HandleFunc("POST /api/retail-sales", authMiddleware.RequireAuth(retailHandler.CreateSale))
+	mux.HandleFunc("GET /api/retail-sales/{id}", authMiddleware.RequireAuth(retailHandler.GetSale))
+
+	// Corporate account routes
+	mux.HandleFunc("GET /api/corporate-accounts", authMiddleware.RequireAuth(corporateAccountHandler.GetCorporateAccounts))
+	mux.HandleFunc("POST /api/corporate-accounts", authMiddleware.RequireAuth(corporateAccountHandler.CreateCorporateAccount))
+	mux.HandleFunc("GET /api/corporate-accounts/{id}", authMiddleware.RequireAuth(corporateAccountHandler.GetCorporateAccount))
+	mux.HandleFunc("PUT /api/corporate-accounts/{id}", authMiddleware.RequireAuth(corporateAccountHandler.UpdateCorporateAccount))
+	mux.HandleFunc("GET /api/corporate-accounts/{id}/employees", authMiddleware.RequireAuth(corporateAccountHandler.GetEmployees))
+	mux.HandleFunc("POST /api/corporate-accounts/{id}/employees", authMiddleware.RequireAuth(corporateAccountHandler.AddEmployee))
+	mux.HandleFunc("PUT /api/corporate-accounts/{id}/employees/{employeeId}", authMiddleware.RequireAuth(corporateAccountHandler.UpdateEmployee))
+	mux.HandleFunc("DELETE /api/corporate-accounts/{id}/employees/{employeeId}", authMiddleware.RequireAuth(corporateAccountHandler.RemoveEmployee))
+	mux.HandleFunc("POST /api/corporate-billing/run", authMiddleware.RequireAuth(corporateAccountHandler.RunCorporateBilling))
+
+	// Dunning routes
+	mux.HandleFunc("GET /api/dunning-cases", authMiddleware.RequireAuth(dunningHandler.GetCases))
+	mux.HandleFunc("POST /api/dunning/run", authMiddleware.RequireAuth(dunningHandler.RunRetries))
+
+	// Loyalty routes
+	mux.HandleFunc("GET /api/loyalty-rules", authMiddleware.RequireAuth(loyaltyHandler.GetRules))
+	mux.HandleFunc("PUT /api/loyalty-rules", authMiddleware.RequireAuth(loyaltyHandler.SaveRule))
+	mux.HandleFunc("GET /api/members/{id}/loyalty", authMiddleware.RequireAuth(loyaltyHandler.GetMemberLoyalty))
+	mux.HandleFunc("POST /api/members/{id}/loyalty/redeem", authMiddleware.RequireAuth(loyaltyHandler.RedeemPoints))
+	mux.HandleFunc("POST /api/members/{id}/loyalty/adjust", authMiddleware.RequireAuth(loyaltyHandler.AdjustPoints))
+	mux.HandleFunc("POST /api/loyalty/expire", authMiddleware.RequireAuth(loyaltyHandler.ExpirePoints))
+
+	// Check-in routes - require authentication
+	mux.HandleFunc("GET /api/check-ins", authMiddleware.RequireAuth(checkInHandler.GetCheckIns))
+	mux.HandleFunc("POST /api/check-ins", authMiddleware.RequireAuth(checkInHandler.CreateCheckIn))
 
 	// Class schedule routes - require authentication
 	mux.HandleFunc("/api/classes", authMiddleware.RequireAuth(classHandler.ClassesHandler))
 	mux.HandleFunc("/api/classes/", authMiddleware.RequireAuth(classHandler.ClassHandler))
+	mux.HandleFunc("GET /api/class-series", authMiddleware.RequireAuth(classHandler.GetSeries))
+	mux.HandleFunc("POST /api/class-series", authMiddleware.RequireAuth(classHandler.CreateSeries))
+	mux.HandleFunc("GET /api/class-series/{id}", authMiddleware.RequireAuth(classHandler.GetSeriesByID))
+	mux.HandleFunc("POST /api/class-series/{id}/cancel", authMiddleware.RequireAuth(classHandler.CancelSeries))
 
 	// Instructor routes - require authentication
 	mux.HandleFunc("/api/instructors", authMiddleware.RequireAuth(instructorHandler.InstructorsHandler))
 	mux.HandleFunc("/api/instructors/", authMiddleware.RequireAuth(instructorHandler.InstructorHandler))
+	mux.HandleFunc("GET /api/instructors/{id}/schedule", authMiddleware.RequireAuth(instructorHandler.GetSchedule))
 
 	// Club routes - require authentication
 	mux.HandleFunc("/api/clubs", authMiddleware.RequireAuth(clubHandler.ClubsHandler))
 	mux.HandleFunc("/api/clubs/", authMiddleware.RequireAuth(clubHandler.ClubHandler))
+	mux.HandleFunc("GET /api/clubs/{id}/at-risk-members", authMiddleware.RequireAuth(churnHandler.GetAtRiskMembers))
+	mux.HandleFunc("POST /api/churn/score", authMiddleware.RequireAuth(churnHandler.ScoreMembers))
 
 	// Restaurant routes - require authentication
 	mux.HandleFunc("GET /api/restaurants", authMiddleware.RequireAuth(handlers.GetRestaurants(restaurantCollection)))
@@ -161,12 +356,27 @@ func main() {
 		}
 	}()
 
+	// Start background jobs; they stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobs.Start(jobsCtx,
+		jobs.Daily("gift-card-expiry", 0, handlers.ExpireGiftCards(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("plan-changes", 1, handlers.ApplyScheduledPlanChanges(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("referral-rewards", 2, handlers.ProcessReferralRewards(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("loyalty-expiry", 3, handlers.ExpireLoyaltyPoints(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("churn-scoring", 4, handlers.ScoreChurnRisks(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("statements", 5, handlers.IssueStatements(db.Client.Database(db.DatabaseName))),
+		jobs.Daily("dunning-retries", 6, dunningHandler.RetryDuePayments),
+		jobs.Daily("corporate-billing", 7, handlers.IssueCorporateInvoices(db.Client.Database(db.DatabaseName))),
+	)
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 
 	log.Println("Server shutting down...")
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
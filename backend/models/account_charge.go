@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Account charge statuses
+const (
+	AccountChargeStatusPending = "pending" // waiting for the member's next statement
+	AccountChargeStatusBilled  = "billed"
+)
+
+// AccountCharge is usage charged to a member's account: a completed office
+// booking, a restaurant check or a shop sale. Pending charges are billed together with
+// membership dues on the member's monthly statement.
+type AccountCharge struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID     primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	ClubID       *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Source       string              `json:"source" bson:"source"` // office_booking, restaurant, retail
+	SourceID     primitive.ObjectID  `json:"source_id" bson:"source_id"`
+	Description  string              `json:"description" bson:"description"`
+	Amount       Money               `json:"amount" bson:"amount"`     // price as charged
+	TaxRate      float64             `json:"tax_rate" bson:"tax_rate"` // percent, used when the club has no tax rule for the source
+	TaxInclusive bool                `json:"tax_inclusive" bson:"tax_inclusive"`
+	Status       string              `json:"status" bson:"status"` // pending, billed
+	StatementID  *primitive.ObjectID `json:"statement_id,omitempty" bson:"statement_id,omitempty"`
+	ChargedAt    time.Time           `json:"charged_at" bson:"charged_at"` // when the usage took place
+	BilledAt     *time.Time          `json:"billed_at,omitempty" bson:"billed_at,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Line returns the statement line for the charge
+func (c AccountCharge) Line() InvoiceLine {
+	return InvoiceLine{
+		Description:  c.Description,
+		ProductType:  c.Source,
+		ProductID:    &c.SourceID,
+		Quantity:     1,
+		UnitPrice:    c.Amount,
+		TaxRate:      c.TaxRate,
+		TaxInclusive: c.TaxInclusive,
+	}
+}
+
+// StatementMonth returns the calendar month before now in now's location,
+// which is the usage a statement issued at now covers
+func StatementMonth(now time.Time) (start, end time.Time) {
+	end = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return end.AddDate(0, -1, 0), end
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStatementMonth(t *testing.T) {
+	tests := []struct {
+		now   time.Time
+		start time.Time
+	}{
+		{time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 4, 30, 23, 59, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 15, 5, 0, 0, 0, time.UTC), time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start, end := StatementMonth(tt.now)
+		if !start.Equal(tt.start) || !end.Equal(tt.start.AddDate(0, 1, 0)) {
+			t.Errorf("StatementMonth(%v) = %v to %v, want the month from %v", tt.now, start, end, tt.start)
+		}
+	}
+}
+
+func TestAccountChargeLine(t *testing.T) {
+	charge := AccountCharge{
+		Source:       ProductTypeOfficeBooking,
+		SourceID:     primitive.NewObjectID(),
+		Description:  "Room 4, 2024-03-02 09:00",
+		Amount:       Cents(4500),
+		TaxRate:      20,
+		TaxInclusive: true,
+	}
+	line := charge.Line()
+	if line.ProductType != ProductTypeOfficeBooking || line.ProductID == nil || *line.ProductID != charge.SourceID {
+		t.Errorf("line does not point at the booking: %+v", line)
+	}
+
+	invoice := Invoice{Lines: []InvoiceLine{line}}
+	invoice.Recalculate()
+	if invoice.Total != Cents(4500) || invoice.TaxTotal != Cents(750) {
+		t.Errorf("total = %v with tax %v, want 45.00 with 7.50", invoice.Total, invoice.TaxTotal)
+	}
+}
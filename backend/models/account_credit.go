@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Account credit transaction sources
+const (
+	AccountCreditSourceCreditNote  = "credit_note" // credit note settled to account credit
+	AccountCreditSourceReferral    = "referral"    // referral reward
+	AccountCreditSourceInvoice     = "invoice"     // applied to an invoice
+	AccountCreditSourceManual      = "manual"      // adjustment by staff
+	AccountCreditSourcePlanChange  = "plan_change" // unused time on a downgraded plan
+	AccountCreditSourceOverpayment = "overpayment" // card payment its invoice could not take
+)
+
+// AccountCreditTransaction is an entry in the append-only account credit
+// ledger. Amount is positive for credits and negative for debits;
+// BalanceAfter is the member's balance once the entry was applied.
+type AccountCreditTransaction struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID     primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	Amount       Money               `json:"amount" bson:"amount"`
+	Source       string              `json:"source" bson:"source"` // credit_note, referral, invoice, manual
+	SourceID     *primitive.ObjectID `json:"source_id,omitempty" bson:"source_id,omitempty"`
+	Description  string              `json:"description" bson:"description"`
+	BalanceAfter Money               `json:"balance_after" bson:"balance_after"`
+	CreatedBy    *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Accounts receivable aging buckets, by days past due
+const (
+	AgingCurrent = "current" // not yet due
+	Aging1To30   = "1_30"
+	Aging31To60  = "31_60"
+	Aging61To90  = "61_90"
+	AgingOver90  = "90_plus"
+)
+
+// Accounts receivable item types
+const (
+	ARItemInvoice = "invoice"
+	ARItemBooking = "office_booking"
+)
+
+// AgingBuckets lists the buckets from newest to oldest
+var AgingBuckets = []string{AgingCurrent, Aging1To30, Aging31To60, Aging61To90, AgingOver90}
+
+// AgingBucket returns the bucket for money due at due, as of asOf, and how
+// many days past due it is, counting a part day as a day
+func AgingBucket(due, asOf time.Time) (string, int) {
+	if !asOf.After(due) {
+		return AgingCurrent, 0
+	}
+	days := int(math.Ceil(asOf.Sub(due).Hours() / 24))
+	switch {
+	case days <= 30:
+		return Aging1To30, days
+	case days <= 60:
+		return Aging31To60, days
+	case days <= 90:
+		return Aging61To90, days
+	}
+	return AgingOver90, days
+}
+
+// ARItem is one outstanding amount: the unpaid balance of an invoice, or an
+// office booking that has not been invoiced
+type ARItem struct {
+	Type        string              `json:"type"` // invoice, office_booking
+	ID          primitive.ObjectID  `json:"id"`
+	Number      string              `json:"number,omitempty"` // invoice number
+	Description string              `json:"description"`
+	MemberID    *primitive.ObjectID `json:"member_id,omitempty"`
+	MemberName  string              `json:"member_name"`
+	ClubID      *primitive.ObjectID `json:"club_id,omitempty"`
+	ClubName    string              `json:"club_name"`
+	DueDate     time.Time           `json:"due_date"`
+	DaysPastDue int                 `json:"days_past_due"`
+	Bucket      string              `json:"bucket"`
+	Amount      Money               `json:"amount"`
+}
+
+// AgingTotals sums outstanding amounts by bucket
+type AgingTotals struct {
+	Current    Money `json:"current"`
+	Days1To30  Money `json:"1_30"`
+	Days31To60 Money `json:"31_60"`
+	Days61To90 Money `json:"61_90"`
+	Over90     Money `json:"90_plus"`
+	Total      Money `json:"total"`
+	Count      int   `json:"count"`
+}
+
+// NewAgingTotals returns empty totals in a currency
+func NewAgingTotals(currency string) AgingTotals {
+	zero := NewMoney(0, currency)
+	return AgingTotals{Current: zero, Days1To30: zero, Days31To60: zero, Days61To90: zero, Over90: zero, Total: zero}
+}
+
+// Add counts an item's amount in its bucket
+func (t *AgingTotals) Add(item ARItem) {
+	switch item.Bucket {
+	case AgingCurrent:
+		t.Current = t.Current.Add(item.Amount)
+	case Aging1To30:
+		t.Days1To30 = t.Days1To30.Add(item.Amount)
+	case Aging31To60:
+		t.Days31To60 = t.Days31To60.Add(item.Amount)
+	case Aging61To90:
+		t.Days61To90 = t.Days61To90.Add(item.Amount)
+	default:
+		t.Over90 = t.Over90.Add(item.Amount)
+	}
+	t.Total = t.Total.Add(item.Amount)
+	t.Count++
+}
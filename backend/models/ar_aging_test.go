@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgingBucket(t *testing.T) {
+	due := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		asOf   time.Time
+		bucket string
+		days   int
+	}{
+		{due.Add(-time.Hour), AgingCurrent, 0},
+		{due, AgingCurrent, 0},
+		{due.Add(time.Hour), Aging1To30, 1},
+		{due.AddDate(0, 0, 30), Aging1To30, 30},
+		{due.AddDate(0, 0, 31), Aging31To60, 31},
+		{due.AddDate(0, 0, 60), Aging31To60, 60},
+		{due.AddDate(0, 0, 90), Aging61To90, 90},
+		{due.AddDate(0, 0, 91), AgingOver90, 91},
+	}
+	for _, tt := range tests {
+		bucket, days := AgingBucket(due, tt.asOf)
+		if bucket != tt.bucket || days != tt.days {
+			t.Errorf("AgingBucket(%v) = %s, %d; want %s, %d", tt.asOf, bucket, days, tt.bucket, tt.days)
+		}
+	}
+}
+
+func TestAgingTotals(t *testing.T) {
+	totals := NewAgingTotals(DefaultCurrency)
+	totals.Add(ARItem{Bucket: AgingCurrent, Amount: Cents(1000)})
+	totals.Add(ARItem{Bucket: Aging61To90, Amount: Cents(250)})
+	totals.Add(ARItem{Bucket: AgingOver90, Amount: Cents(99)})
+	totals.Add(ARItem{Bucket: AgingOver90, Amount: Cents(1)})
+
+	if totals.Current != Cents(1000) || totals.Days61To90 != Cents(250) || totals.Over90 != Cents(100) {
+		t.Errorf("unexpected bucket totals %+v", totals)
+	}
+	if totals.Total != Cents(1350) || totals.Count != 4 || !totals.Days1To30.IsZero() {
+		t.Errorf("total = %v over %d items, want 13.50 over 4", totals.Total, totals.Count)
+	}
+}
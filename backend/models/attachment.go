@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attachment is an uploaded file belonging to a member or instructor, such as
+// a profile photo, medical note or ID scan. The file itself lives in blob storage.
+type Attachment struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	OwnerType    string              `json:"owner_type" bson:"owner_type"` // member, instructor
+	OwnerID      primitive.ObjectID  `json:"owner_id" bson:"owner_id"`
+	Category     string              `json:"category" bson:"category"` // photo, medical, identification, other
+	FileName     string              `json:"file_name" bson:"file_name"`
+	ContentType  string              `json:"content_type" bson:"content_type"`
+	Size         int64               `json:"size" bson:"size"`
+	BlobKey      string              `json:"-" bson:"blob_key"`
+	ThumbnailKey string              `json:"-" bson:"thumbnail_key,omitempty"`
+	HasThumbnail bool                `json:"has_thumbnail" bson:"has_thumbnail"`
+	UploadedBy   *primitive.ObjectID `json:"uploaded_by,omitempty" bson:"uploaded_by,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CheckIn records a member's visit to a club
+type CheckIn struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID    primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	ClubID      primitive.ObjectID  `json:"club_id" bson:"club_id"`
+	CheckedInAt time.Time           `json:"checked_in_at" bson:"checked_in_at"`
+	StaffUserID *primitive.ObjectID `json:"staff_user_id,omitempty" bson:"staff_user_id,omitempty"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+}
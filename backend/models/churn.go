@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Churn risk levels
+const (
+	ChurnRiskLow    = "low"
+	ChurnRiskMedium = "medium"
+	ChurnRiskHigh   = "high"
+)
+
+// ChurnInputs is the activity summary a member's churn risk is scored from
+type ChurnInputs struct {
+	JoinDate         time.Time
+	ExpiryDate       time.Time
+	AutoRenewal      bool
+	CheckInsLast30   int // check-ins in the last 30 days
+	CheckInsPrior60  int // check-ins in the 60 days before that
+	Bookings90       int // class bookings made in the last 90 days
+	Cancellations90  int // of which cancelled or no-show
+	FailedPayments90 int // failed payments in the last 90 days
+}
+
+// ChurnFactor is one rule that contributed to a churn risk score
+type ChurnFactor struct {
+	Code        string `bson:"code" json:"code"`
+	Description string `bson:"description" json:"description"`
+	Points      int    `bson:"points" json:"points"`
+}
+
+// ChurnRisk is a member's rule-based churn risk score from 0 to 100
+type ChurnRisk struct {
+	Score      int           `bson:"score" json:"score"`
+	Level      string        `bson:"level" json:"level"` // low, medium, high
+	Factors    []ChurnFactor `bson:"factors" json:"factors"`
+	ComputedAt time.Time     `bson:"computed_at" json:"computed_at"`
+}
+
+// ScoreChurnRisk applies the churn rules to a member's activity. Each rule
+// that matches adds points and an explanation; the total is capped at 100.
+func ScoreChurnRisk(in ChurnInputs, now time.Time) ChurnRisk {
+	factors := []ChurnFactor{}
+	add := func(code string, points int, description string) {
+		factors = append(factors, ChurnFactor{Code: code, Description: description, Points: points})
+	}
+
+	priorMonthlyAverage := float64(in.CheckInsPrior60) / 2
+	switch {
+	case in.CheckInsLast30 == 0:
+		add("no_recent_visits", 30, "No check-ins in the last 30 days")
+	case priorMonthlyAverage >= 2 && float64(in.CheckInsLast30) <= priorMonthlyAverage/2:
+		drop := 100 - int(float64(in.CheckInsLast30)/priorMonthlyAverage*100)
+		add("visits_declining", 20, fmt.Sprintf("Check-ins down %d%% on the previous two months", drop))
+	}
+
+	if in.Bookings90 >= 3 {
+		rate := in.Cancellations90 * 100 / in.Bookings90
+		if rate >= 30 {
+			add("frequent_cancellations", 15, fmt.Sprintf("%d%% of class bookings cancelled or missed in the last 90 days", rate))
+		}
+	}
+
+	if in.FailedPayments90 > 0 {
+		points := 15 * in.FailedPayments90
+		if points > 30 {
+			points = 30
+		}
+		add("failed_payments", points, fmt.Sprintf("%d failed payment(s) in the last 90 days", in.FailedPayments90))
+	}
+
+	if !in.JoinDate.IsZero() && now.Sub(in.JoinDate) < 90*24*time.Hour {
+		add("new_member", 10, "Member for less than 90 days")
+	}
+
+	if !in.AutoRenewal {
+		add("no_auto_renewal", 15, "Auto-renewal is off")
+		if !in.ExpiryDate.IsZero() && in.ExpiryDate.After(now) && in.ExpiryDate.Sub(now) <= 30*24*time.Hour {
+			add("expiring_soon", 10, "Membership expires within 30 days")
+		}
+	}
+
+	score := 0
+	for _, factor := range factors {
+		score += factor.Points
+	}
+	if score > 100 {
+		score = 100
+	}
+
+	level := ChurnRiskLow
+	switch {
+	case score >= 60:
+		level = ChurnRiskHigh
+	case score >= 30:
+		level = ChurnRiskMedium
+	}
+
+	return ChurnRisk{Score: score, Level: level, Factors: factors, ComputedAt: now}
+}
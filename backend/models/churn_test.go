@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreChurnRisk(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	established := now.AddDate(-2, 0, 0)
+
+	tests := []struct {
+		name    string
+		in      ChurnInputs
+		score   int
+		level   string
+		factors []string
+	}{
+		{
+			name:    "engaged member",
+			in:      ChurnInputs{JoinDate: established, AutoRenewal: true, CheckInsLast30: 12, CheckInsPrior60: 24},
+			score:   0,
+			level:   ChurnRiskLow,
+			factors: []string{},
+		},
+		{
+			name:    "declining visits",
+			in:      ChurnInputs{JoinDate: established, AutoRenewal: true, CheckInsLast30: 3, CheckInsPrior60: 20},
+			score:   20,
+			level:   ChurnRiskLow,
+			factors: []string{"visits_declining"},
+		},
+		{
+			name: "disengaged and leaving",
+			in: ChurnInputs{
+				JoinDate:         established,
+				ExpiryDate:       now.AddDate(0, 0, 10),
+				Bookings90:       4,
+				Cancellations90:  2,
+				FailedPayments90: 1,
+			},
+			score:   85,
+			level:   ChurnRiskHigh,
+			factors: []string{"no_recent_visits", "frequent_cancellations", "failed_payments", "no_auto_renewal", "expiring_soon"},
+		},
+		{
+			name:    "new member with failed payments",
+			in:      ChurnInputs{JoinDate: now.AddDate(0, 0, -20), AutoRenewal: true, CheckInsLast30: 5, FailedPayments90: 3},
+			score:   40,
+			level:   ChurnRiskMedium,
+			factors: []string{"failed_payments", "new_member"},
+		},
+		{
+			name: "capped at 100",
+			in: ChurnInputs{
+				JoinDate:         now.AddDate(0, 0, -10),
+				ExpiryDate:       now.AddDate(0, 0, 5),
+				Bookings90:       3,
+				Cancellations90:  3,
+				FailedPayments90: 2,
+			},
+			score:   100,
+			level:   ChurnRiskHigh,
+			factors: []string{"no_recent_visits", "frequent_cancellations", "failed_payments", "new_member", "no_auto_renewal", "expiring_soon"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk := ScoreChurnRisk(tt.in, now)
+			if risk.Score != tt.score || risk.Level != tt.level {
+				t.Errorf("score = %d (%s), want %d (%s)", risk.Score, risk.Level, tt.score, tt.level)
+			}
+			if len(risk.Factors) != len(tt.factors) {
+				t.Fatalf("factors = %+v, want codes %v", risk.Factors, tt.factors)
+			}
+			for i, code := range tt.factors {
+				if risk.Factors[i].Code != code {
+					t.Errorf("factor %d = %q, want %q", i, risk.Factors[i].Code, code)
+				}
+				if risk.Factors[i].Description == "" {
+					t.Errorf("factor %q has no description", code)
+				}
+			}
+		})
+	}
+}
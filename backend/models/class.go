@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,16 +10,19 @@ import (
 type Class struct {
 	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
 	ClubID          *primitive.ObjectID  `bson:"club_id,omitempty" json:"club_id,omitempty"`
+	SeriesID        *primitive.ObjectID  `bson:"series_id,omitempty" json:"series_id,omitempty"` // set on occurrences of a class series
 	Name            string               `bson:"name" json:"name"`
 	Description     string               `bson:"description" json:"description"`
-	Instructor      string               `bson:"instructor" json:"instructor"`
+	InstructorID    *primitive.ObjectID  `bson:"instructor_id,omitempty" json:"instructor_id,omitempty"`
+	Instructor      string               `bson:"instructor" json:"instructor"` // the instructor's name
 	Date            time.Time            `bson:"date" json:"date"`
 	StartTime       string               `bson:"start_time" json:"start_time"` // Format: "HH:MM"
 	EndTime         string               `bson:"end_time" json:"end_time"`     // Format: "HH:MM"
 	Duration        int                  `bson:"duration" json:"duration"`     // Duration in minutes
 	Capacity        int                  `bson:"capacity" json:"capacity"`
-	EnrolledMembers []primitive.ObjectID `bson:"enrolled_members" json:"enrolled_members"`
-	WaitList        []primitive.ObjectID `bson:"wait_list" json:"wait_list"`
+	EnrolledMembers []primitive.ObjectID `bson:"-" json:"enrolled_members"` // from its seated class bookings
+	WaitList        []primitive.ObjectID `bson:"-" json:"wait_list"`        // from its waitlisted class bookings, in order
+	BookedCount     int                  `bson:"booked_count" json:"-"`     // places taken, kept with the bookings
 	Recurring       bool                 `bson:"recurring" json:"recurring"`
 	RecurringDays   []string             `bson:"recurring_days" json:"recurring_days"` // ["Monday", "Wednesday", "Friday"]
 	Status          string               `bson:"status" json:"status"`                 // "scheduled", "in-progress", "completed", "cancelled"
@@ -31,3 +35,61 @@ type ClassWithMembers struct {
 	EnrolledMembersDetails []Member `json:"enrolled_members_details"`
 	WaitListDetails        []Member `json:"wait_list_details"`
 }
+
+// Errors for class times that cannot be placed in the day
+var (
+	ErrInvalidClassTime     = errors.New("start_time and end_time must be formatted HH:MM")
+	ErrClassEndsBeforeStart = errors.New("end_time must be after start_time")
+	ErrCapacityBelowBooked  = errors.New("capacity cannot be below the places already booked")
+)
+
+// FitsCapacity reports whether the places already booked in the class fit
+// in capacity. Places are never taken away from booked members.
+func (c Class) FitsCapacity(capacity int) bool {
+	return c.BookedCount <= capacity
+}
+
+// Period returns when the class starts and ends: on its date from
+// StartTime to EndTime, or for Duration minutes when it has no end time
+func (c Class) Period() (time.Time, time.Time, error) {
+	clock := func(value string) (time.Duration, error) {
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return 0, ErrInvalidClassTime
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+
+	day := time.Date(c.Date.Year(), c.Date.Month(), c.Date.Day(), 0, 0, 0, 0, c.Date.Location())
+	startsAt, err := clock(c.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start := day.Add(startsAt)
+	if c.EndTime == "" {
+		return start, start.Add(time.Duration(c.Duration) * time.Minute), nil
+	}
+	endsAt, err := clock(c.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end := day.Add(endsAt)
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, ErrClassEndsBeforeStart
+	}
+	return start, end, nil
+}
+
+// Overlaps reports whether two classes are on at the same time. Classes
+// that only meet, one ending as the other starts, do not overlap.
+func (c Class) Overlaps(other Class) bool {
+	start, end, err := c.Period()
+	if err != nil {
+		return false
+	}
+	otherStart, otherEnd, err := other.Period()
+	if err != nil {
+		return false
+	}
+	return start.Before(otherEnd) && otherStart.Before(end)
+}
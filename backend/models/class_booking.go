@@ -6,14 +6,40 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// ClassBooking represents a member's class booking/enrollment
+// Class booking statuses
+const (
+	ClassBookingConfirmed = "confirmed"
+	ClassBookingWaitlist  = "waitlist"
+	ClassBookingCancelled = "cancelled"
+	ClassBookingAttended  = "attended"
+	ClassBookingNoShow    = "no-show"
+)
+
+// ClassBookingSeated are the statuses of bookings that take a place in the
+// class
+var ClassBookingSeated = []string{ClassBookingConfirmed, ClassBookingAttended, ClassBookingNoShow}
+
+// ClassBooking represents a member's class booking/enrollment. Bookings are
+// the record of who is in a class: its roster is its seated bookings and
+// its waitlist its waitlisted ones, in the order they were booked.
 type ClassBooking struct {
-	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
-	ClassID   *primitive.ObjectID `json:"class_id" bson:"class_id,omitempty"`
-	MemberID  *primitive.ObjectID `json:"member_id" bson:"member_id,omitempty"`
-	Status    string              `json:"status" bson:"status"` // confirmed, waitlist, cancelled, attended, no-show
-	BookedAt  time.Time           `json:"booked_at" bson:"booked_at"`
-	Notes     string              `json:"notes" bson:"notes"`
-	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClassID     *primitive.ObjectID `json:"class_id" bson:"class_id,omitempty"`
+	MemberID    *primitive.ObjectID `json:"member_id" bson:"member_id,omitempty"`
+	Status      string              `json:"status" bson:"status"` // confirmed, waitlist, cancelled, attended, no-show
+	BookedAt    time.Time           `json:"booked_at" bson:"booked_at"`
+	Notes       string              `json:"notes" bson:"notes"`
+	CancelledAt *time.Time          `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// IsSeated reports whether the booking takes a place in the class
+func (b ClassBooking) IsSeated() bool {
+	for _, status := range ClassBookingSeated {
+		if b.Status == status {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Class series statuses
+const (
+	ClassSeriesActive    = "active"
+	ClassSeriesCancelled = "cancelled"
+)
+
+// MaxSeriesOccurrences caps how many classes one series can create
+const MaxSeriesOccurrences = 366
+
+// MaxSeriesYears caps how far after its start a series' classes can fall
+const MaxSeriesYears = 2
+
+// The longest INTERVAL a rule can have, a year either way
+const (
+	maxDailyInterval  = 366
+	maxWeeklyInterval = 52
+)
+
+// ClassSeries defines a class that repeats, such as yoga every Monday,
+// Wednesday and Friday. Its occurrences are stored as classes of their own,
+// each with its own enrollment, and can be edited or cancelled one at a time.
+type ClassSeries struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	ClubID       *primitive.ObjectID `bson:"club_id,omitempty" json:"club_id,omitempty"`
+	Name         string              `bson:"name" json:"name"`
+	Description  string              `bson:"description" json:"description"`
+	InstructorID *primitive.ObjectID `bson:"instructor_id,omitempty" json:"instructor_id,omitempty"`
+	Instructor   string              `bson:"instructor" json:"instructor"` // the instructor's name
+	StartDate    time.Time           `bson:"start_date" json:"start_date"` // first day of the series
+	RRule        string              `bson:"rrule" json:"rrule"`           // e.g. "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=24"
+	StartTime    string              `bson:"start_time" json:"start_time"` // Format: "HH:MM"
+	EndTime      string              `bson:"end_time" json:"end_time"`     // Format: "HH:MM"
+	Duration     int                 `bson:"duration" json:"duration"`     // Duration in minutes
+	Capacity     int                 `bson:"capacity" json:"capacity"`
+	Status       string              `bson:"status" json:"status"` // active, cancelled
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Occurrence returns the series' class on a date
+func (s ClassSeries) Occurrence(date time.Time, days []string) Class {
+	seriesID := s.ID
+	return Class{
+		ClubID:        s.ClubID,
+		SeriesID:      &seriesID,
+		Name:          s.Name,
+		Description:   s.Description,
+		InstructorID:  s.InstructorID,
+		Instructor:    s.Instructor,
+		Date:          date,
+		StartTime:     s.StartTime,
+		EndTime:       s.EndTime,
+		Duration:      s.Duration,
+		Capacity:      s.Capacity,
+		Recurring:     true,
+		RecurringDays: days,
+		Status:        "scheduled",
+	}
+}
+
+// RecurrenceRule is the subset of an iCalendar RRULE that class series
+// support: daily or weekly, every Interval days or weeks, on the weekdays
+// in ByDay, ending after Count occurrences or on the Until date
+type RecurrenceRule struct {
+	Frequency string // DAILY, WEEKLY
+	Interval  int
+	ByDay     []time.Weekday
+	Count     int
+	Until     *time.Time // last possible date, inclusive
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// ParseRecurrenceRule parses an RRULE such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;UNTIL=20241231". The rule must end,
+// with either COUNT or UNTIL.
+func ParseRecurrenceRule(rule string) (RecurrenceRule, error) {
+	parsed := RecurrenceRule{Interval: 1}
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return parsed, fmt.Errorf("rrule: %q is not KEY=VALUE", part)
+		}
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" {
+				return parsed, errors.New("rrule: FREQ must be DAILY or WEEKLY")
+			}
+			parsed.Frequency = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return parsed, errors.New("rrule: INTERVAL must be a positive number")
+			}
+			parsed.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return parsed, errors.New("rrule: COUNT must be a positive number")
+			}
+			parsed.Count = n
+		case "UNTIL":
+			if len(value) < 8 {
+				return parsed, errors.New("rrule: UNTIL must be a date such as 20241231")
+			}
+			until, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return parsed, errors.New("rrule: UNTIL must be a date such as 20241231")
+			}
+			parsed.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return parsed, fmt.Errorf("rrule: unknown BYDAY %q", day)
+				}
+				parsed.ByDay = append(parsed.ByDay, weekday)
+			}
+		default:
+			return parsed, fmt.Errorf("rrule: %s is not supported", key)
+		}
+	}
+
+	if parsed.Frequency == "" {
+		return parsed, errors.New("rrule: FREQ is required")
+	}
+	if (parsed.Count == 0) == (parsed.Until == nil) {
+		return parsed, errors.New("rrule: give either COUNT or UNTIL")
+	}
+	if parsed.Frequency == "DAILY" && len(parsed.ByDay) > 0 {
+		return parsed, errors.New("rrule: BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if parsed.Frequency == "DAILY" && parsed.Interval > maxDailyInterval {
+		return parsed, fmt.Errorf("rrule: INTERVAL can be at most %d days", maxDailyInterval)
+	}
+	if parsed.Frequency == "WEEKLY" && parsed.Interval > maxWeeklyInterval {
+		return parsed, fmt.Errorf("rrule: INTERVAL can be at most %d weeks", maxWeeklyInterval)
+	}
+	return parsed, nil
+}
+
+// Dates returns the dates the rule falls on, starting from start, which
+// counts as an occurrence only if it matches the rule. Weeks start on
+// Monday. Dates are at midnight UTC, like class dates. Whatever COUNT or
+// UNTIL say, dates end MaxSeriesYears after start.
+func (r RecurrenceRule) Dates(start time.Time) ([]time.Time, error) {
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(MaxSeriesYears, 0, 0)
+	if r.Until != nil && r.Until.Before(end) {
+		end = *r.Until
+	}
+
+	dates := []time.Time{}
+	// add adds a date, reporting whether the series is complete
+	add := func(date time.Time) (bool, error) {
+		if date.After(end) || (r.Count > 0 && len(dates) == r.Count) {
+			return true, nil
+		}
+		if len(dates) == MaxSeriesOccurrences {
+			return true, fmt.Errorf("a series can have at most %d occurrences", MaxSeriesOccurrences)
+		}
+		dates = append(dates, date)
+		return false, nil
+	}
+
+	if r.Frequency != "WEEKLY" {
+		for date := start; ; date = date.AddDate(0, 0, r.Interval) {
+			if done, err := add(date); done {
+				if err != nil {
+					return nil, err
+				}
+				return dates, nil
+			}
+		}
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, day := range r.ByDay {
+		days[day] = true
+	}
+	if len(days) == 0 {
+		days[start.Weekday()] = true
+	}
+	week := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	for ; !week.After(end); week = week.AddDate(0, 0, 7*r.Interval) {
+		for i := 0; i < 7; i++ {
+			date := week.AddDate(0, 0, i)
+			if date.Before(start) || !days[date.Weekday()] {
+				continue
+			}
+			if done, err := add(date); done {
+				if err != nil {
+					return nil, err
+				}
+				return dates, nil
+			}
+		}
+	}
+	return dates, nil
+}
+
+// WeekdayNames returns the rule's weekdays by name, e.g. "Monday", in the
+// form classes list their recurring days
+func (r RecurrenceRule) WeekdayNames(start time.Time) []string {
+	if r.Frequency != "WEEKLY" {
+		return []string{}
+	}
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	names := make([]string, 0, len(days))
+	for _, day := range days {
+		names = append(names, day.String())
+	}
+	return names
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func formatDates(dates []time.Time) []string {
+	formatted := make([]string, 0, len(dates))
+	for _, date := range dates {
+		formatted = append(formatted, date.Format("2006-01-02"))
+	}
+	return formatted
+}
+
+func TestRecurrenceRuleDates(t *testing.T) {
+	// 2024-06-03 is a Monday
+	start := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=5", []string{"2024-06-03", "2024-06-05", "2024-06-07", "2024-06-10", "2024-06-12"}},
+		{"FREQ=WEEKLY;BYDAY=TU;UNTIL=20240618", []string{"2024-06-04", "2024-06-11", "2024-06-18"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=4", []string{"2024-06-03", "2024-06-06", "2024-06-17", "2024-06-20"}},
+		{"FREQ=WEEKLY;COUNT=3", []string{"2024-06-03", "2024-06-10", "2024-06-17"}},
+		{"FREQ=DAILY;INTERVAL=3;UNTIL=20240612T235959Z", []string{"2024-06-03", "2024-06-06", "2024-06-09", "2024-06-12"}},
+		{"RRULE:FREQ=WEEKLY;BYDAY=SU;UNTIL=20240601", []string{}},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRecurrenceRule(tt.rule)
+		if err != nil {
+			t.Errorf("ParseRecurrenceRule(%q) error: %v", tt.rule, err)
+			continue
+		}
+		dates, err := rule.Dates(start)
+		if err != nil {
+			t.Errorf("%s: Dates error: %v", tt.rule, err)
+			continue
+		}
+		got := formatDates(dates)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: dates = %v, want %v", tt.rule, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: dates = %v, want %v", tt.rule, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"FREQ=MONTHLY;COUNT=3",
+		"FREQ=WEEKLY",
+		"FREQ=WEEKLY;COUNT=3;UNTIL=20241231",
+		"FREQ=WEEKLY;BYDAY=XX;COUNT=3",
+		"FREQ=DAILY;BYDAY=MO;COUNT=3",
+		"FREQ=WEEKLY;INTERVAL=0;COUNT=3",
+		"FREQ=WEEKLY;INTERVAL=53;COUNT=3",
+		"FREQ=DAILY;INTERVAL=300000000;COUNT=2",
+		"FREQ=WEEKLY;BYMONTH=1;COUNT=3",
+	}
+	for _, rule := range invalid {
+		if _, err := ParseRecurrenceRule(rule); err == nil {
+			t.Errorf("ParseRecurrenceRule(%q) should fail", rule)
+		}
+	}
+}
+
+func TestRecurrenceRuleDatesLimit(t *testing.T) {
+	rule, err := ParseRecurrenceRule("FREQ=DAILY;COUNT=1000")
+	if err != nil {
+		t.Fatalf("ParseRecurrenceRule error: %v", err)
+	}
+	if _, err := rule.Dates(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("a rule with more than MaxSeriesOccurrences dates should fail")
+	}
+}
+
+func TestRecurrenceRuleDatesEndAfterMaxSeriesYears(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule string
+		want int
+	}{
+		{"FREQ=DAILY;INTERVAL=366;COUNT=5", 2},
+		{"FREQ=WEEKLY;INTERVAL=52;COUNT=5", 3},
+		{"FREQ=WEEKLY;INTERVAL=4;UNTIL=20991231", 27},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRecurrenceRule(tt.rule)
+		if err != nil {
+			t.Errorf("ParseRecurrenceRule(%q) error: %v", tt.rule, err)
+			continue
+		}
+		dates, err := rule.Dates(start)
+		if err != nil {
+			t.Errorf("%s: Dates error: %v", tt.rule, err)
+			continue
+		}
+		if len(dates) != tt.want {
+			t.Errorf("%s: %d dates, want %d: %v", tt.rule, len(dates), tt.want, formatDates(dates))
+		}
+		if last := dates[len(dates)-1]; last.After(start.AddDate(MaxSeriesYears, 0, 0)) {
+			t.Errorf("%s: last date %s is more than %d years after the start", tt.rule, last.Format("2006-01-02"), MaxSeriesYears)
+		}
+	}
+}
+
+func TestRecurrenceRuleWeekdayNames(t *testing.T) {
+	start := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	rule, _ := ParseRecurrenceRule("FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=3")
+	names := rule.WeekdayNames(start)
+	if len(names) != 3 || names[0] != "Monday" || names[2] != "Friday" {
+		t.Errorf("WeekdayNames() = %v, want Monday, Wednesday, Friday", names)
+	}
+	daily, _ := ParseRecurrenceRule("FREQ=DAILY;COUNT=3")
+	if names := daily.WeekdayNames(start); len(names) != 0 {
+		t.Errorf("daily WeekdayNames() = %v, want none", names)
+	}
+}
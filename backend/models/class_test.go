@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClassPeriod(t *testing.T) {
+	date := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+
+	start, end, err := Class{Date: date, StartTime: "09:30", EndTime: "10:45"}.Period()
+	if err != nil {
+		t.Fatalf("Period error: %v", err)
+	}
+	if !start.Equal(date.Add(9*time.Hour+30*time.Minute)) || !end.Equal(date.Add(10*time.Hour+45*time.Minute)) {
+		t.Errorf("Period = %v to %v", start, end)
+	}
+
+	// Without an end time the class lasts its duration
+	_, end, err = Class{Date: date, StartTime: "18:00", Duration: 90}.Period()
+	if err != nil {
+		t.Fatalf("Period error: %v", err)
+	}
+	if !end.Equal(date.Add(19*time.Hour + 30*time.Minute)) {
+		t.Errorf("end = %v, want 19:30", end)
+	}
+
+	if _, _, err := (Class{Date: date, StartTime: "9am", EndTime: "10:00"}).Period(); err != ErrInvalidClassTime {
+		t.Errorf("invalid start_time: got %v", err)
+	}
+	if _, _, err := (Class{Date: date, StartTime: "10:00", EndTime: "09:00"}).Period(); err != ErrClassEndsBeforeStart {
+		t.Errorf("end before start: got %v", err)
+	}
+}
+
+func TestClassOverlaps(t *testing.T) {
+	monday := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	class := Class{Date: monday, StartTime: "09:00", EndTime: "10:00"}
+	tests := []struct {
+		name  string
+		other Class
+		want  bool
+	}{
+		{"same time", Class{Date: monday, StartTime: "09:00", EndTime: "10:00"}, true},
+		{"starts during", Class{Date: monday, StartTime: "09:30", EndTime: "10:30"}, true},
+		{"contains", Class{Date: monday, StartTime: "08:00", EndTime: "11:00"}, true},
+		{"by duration", Class{Date: monday, StartTime: "08:30", Duration: 45}, true},
+		{"back to back", Class{Date: monday, StartTime: "10:00", EndTime: "11:00"}, false},
+		{"earlier", Class{Date: monday, StartTime: "07:00", EndTime: "08:00"}, false},
+		{"another day", Class{Date: monday.AddDate(0, 0, 1), StartTime: "09:00", EndTime: "10:00"}, false},
+		{"invalid time", Class{Date: monday, StartTime: "nine"}, false},
+	}
+	for _, tt := range tests {
+		if got := class.Overlaps(tt.other); got != tt.want {
+			t.Errorf("%s: Overlaps = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.other.Overlaps(class); got != tt.want {
+			t.Errorf("%s: reversed Overlaps = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstructorTeachesAt(t *testing.T) {
+	downtown, north := primitive.NewObjectID(), primitive.NewObjectID()
+	instructor := Instructor{ClubIDs: []primitive.ObjectID{downtown}}
+	if !instructor.TeachesAt(downtown) {
+		t.Error("expected the instructor to teach at their club")
+	}
+	if instructor.TeachesAt(north) {
+		t.Error("expected the instructor not to teach at another club")
+	}
+}
+
+func TestClassFitsCapacity(t *testing.T) {
+	class := Class{Capacity: 10, BookedCount: 8}
+	tests := map[int]bool{12: true, 10: true, 8: true, 7: false, 0: false}
+	for capacity, want := range tests {
+		if got := class.FitsCapacity(capacity); got != want {
+			t.Errorf("FitsCapacity(%d) with 8 booked = %v, want %v", capacity, got, want)
+		}
+	}
+	if !(Class{}).FitsCapacity(0) {
+		t.Error("Expected an unbooked class to fit any capacity")
+	}
+}
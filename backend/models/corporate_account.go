@@ -0,0 +1,93 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Corporate account statuses
+const (
+	CorporateAccountActive   = "active"
+	CorporateAccountInactive = "inactive" // no new employees and no further invoices
+)
+
+// Corporate employee statuses
+const (
+	CorporateEmployeeActive  = "active"
+	CorporateEmployeeRemoved = "removed"
+)
+
+// CorporateAccount is a company paying for its employees' memberships at a
+// contract rate per employee per month. The company pays its share of the
+// rate on one invoice a month and each employee pays the rest, which is
+// charged to their own account. Zero MaxSponsored means no cap.
+type CorporateAccount struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name           string              `json:"name" bson:"name"`
+	ClubID         *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"` // club the contract is with; invoices are taxed under its rules
+	ContactName    string              `json:"contact_name" bson:"contact_name"`
+	BillingEmail   string              `json:"billing_email" bson:"billing_email"`
+	ContractRate   Money               `json:"contract_rate" bson:"contract_rate"`     // per employee per month, before tax
+	EmployerShare  float64             `json:"employer_share" bson:"employer_share"`   // percent of the rate the company pays by default
+	MaxSponsored   int                 `json:"max_sponsored" bson:"max_sponsored"`     // cap on active employees
+	SponsoredCount int                 `json:"sponsored_count" bson:"sponsored_count"` // active employees, maintained by the server
+	Status         string              `json:"status" bson:"status"`                   // active, inactive
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// CorporateEmployee puts a member on a company's roster. Sponsorship is
+// billed up to BilledThrough; an employee removed before that is not
+// credited for the rest of the month.
+type CorporateEmployee struct {
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateAccountID primitive.ObjectID `json:"corporate_account_id" bson:"corporate_account_id"`
+	MemberID           primitive.ObjectID `json:"member_id" bson:"member_id"`
+	EmployeeRef        string             `json:"employee_ref" bson:"employee_ref"`     // the company's employee number
+	EmployerShare      float64            `json:"employer_share" bson:"employer_share"` // percent of the rate the company pays for this employee
+	Status             string             `json:"status" bson:"status"`                 // active, removed
+	StartDate          time.Time          `json:"start_date" bson:"start_date"`
+	EndDate            *time.Time         `json:"end_date,omitempty" bson:"end_date,omitempty"`
+	BilledThrough      time.Time          `json:"billed_through" bson:"billed_through"`
+	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// BillableUntil returns the end of the sponsorship to bill on an invoice
+// covering up to end: the removal date if the employee left earlier
+func (e CorporateEmployee) BillableUntil(end time.Time) time.Time {
+	if e.EndDate != nil && e.EndDate.Before(end) {
+		return *e.EndDate
+	}
+	return end
+}
+
+// ContractCharge returns a monthly rate for the time from from to to,
+// prorated by day within each calendar month
+func ContractCharge(rate Money, from, to time.Time) Money {
+	total := NewMoney(0, rate.Currency)
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()) }
+	from, to = day(from), day(to)
+	for from.Before(to) {
+		monthStart := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+		monthEnd := monthStart.AddDate(0, 1, 0)
+		until := to
+		if monthEnd.Before(until) {
+			until = monthEnd
+		}
+		days := int64(math.Round(until.Sub(from).Hours() / 24))
+		inMonth := int64(math.Round(monthEnd.Sub(monthStart).Hours() / 24))
+		total = total.Add(rate.Prorate(days, inMonth))
+		from = until
+	}
+	return total
+}
+
+// SplitContractCharge divides a charge into the employer's share, a
+// percentage, and the employee's remainder
+func SplitContractCharge(charge Money, employerShare float64) (employer, employee Money) {
+	employer = charge.Percent(employerShare)
+	return employer, charge.Sub(employer)
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContractCharge(t *testing.T) {
+	rate := Cents(3100)
+	day := func(month time.Month, d, hour int) time.Time {
+		return time.Date(2024, month, d, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int64
+	}{
+		{"whole month", day(time.April, 1, 0), day(time.May, 1, 0), 3100},
+		{"half month", day(time.April, 16, 0), day(time.May, 1, 0), 1550},
+		{"joined last month", day(time.March, 17, 0), day(time.May, 1, 0), 1500 + 3100},
+		{"joined mid-day", day(time.April, 10, 14), day(time.May, 1, 0), 2170},
+		{"nothing to bill", day(time.April, 10, 0), day(time.April, 10, 9), 0},
+	}
+	for _, tt := range tests {
+		got := ContractCharge(rate, tt.from, tt.to)
+		if got.Amount != tt.want || got.Currency != "USD" {
+			t.Errorf("%s: ContractCharge() = %+v, want %d USD", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitContractCharge(t *testing.T) {
+	tests := []struct {
+		charge         int64
+		share          float64
+		employer, paid int64
+	}{
+		{4600, 75, 3450, 1150},
+		{1001, 50, 501, 500},
+		{3100, 100, 3100, 0},
+		{3100, 0, 0, 3100},
+	}
+	for _, tt := range tests {
+		employer, employee := SplitContractCharge(Cents(tt.charge), tt.share)
+		if employer.Amount != tt.employer || employee.Amount != tt.paid {
+			t.Errorf("SplitContractCharge(%d, %v) = %d, %d, want %d, %d", tt.charge, tt.share, employer.Amount, employee.Amount, tt.employer, tt.paid)
+		}
+	}
+}
+
+func TestCorporateEmployeeBillableUntil(t *testing.T) {
+	end := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	if got := (CorporateEmployee{}).BillableUntil(end); !got.Equal(end) {
+		t.Errorf("active employee billable until %v, want %v", got, end)
+	}
+	left := time.Date(2024, time.April, 20, 0, 0, 0, 0, time.UTC)
+	if got := (CorporateEmployee{EndDate: &left}).BillableUntil(end); !got.Equal(left) {
+		t.Errorf("removed employee billable until %v, want %v", got, left)
+	}
+	later := end.AddDate(0, 0, 3)
+	if got := (CorporateEmployee{EndDate: &later}).BillableUntil(end); !got.Equal(end) {
+		t.Errorf("employee leaving later billable until %v, want %v", got, end)
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How a credit note is settled
+const (
+	CreditNoteRefund        = "refund"         // money returned to the payment it came from
+	CreditNoteAccountCredit = "account_credit" // added to the member's account credit
+)
+
+// CreditNote reverses part or all of what was paid on an invoice. Refunds
+// reference the payment they return money to; account credit is posted to
+// the member's account credit ledger and used on their next invoice.
+type CreditNote struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Number    string              `json:"number" bson:"number"`
+	InvoiceID primitive.ObjectID  `json:"invoice_id" bson:"invoice_id"`
+	MemberID  *primitive.ObjectID `json:"member_id,omitempty" bson:"member_id,omitempty"`
+	ClubID    *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Amount    Money               `json:"amount" bson:"amount"`
+	Method    string              `json:"method" bson:"method"` // refund, account_credit
+	Reason    string              `json:"reason" bson:"reason"`
+	PaymentID *primitive.ObjectID `json:"payment_id,omitempty" bson:"payment_id,omitempty"` // payment refunded
+	RefundID  string              `json:"refund_id,omitempty" bson:"refund_id,omitempty"`   // provider refund, for card payments
+	ProductID *primitive.ObjectID `json:"product_id,omitempty" bson:"product_id,omitempty"` // e.g. the cancelled office booking credited
+	CreatedBy *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DocumentTemplate is a versioned legal document members sign, such as a
+// liability waiver or membership contract. Publishing a new version of a type
+// deactivates the previous one; existing signatures keep their version.
+type DocumentTemplate struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClubID    *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"` // nil applies to all clubs
+	Type      string              `json:"type" bson:"type"`                           // waiver, membership_contract
+	Title     string              `json:"title" bson:"title"`
+	Body      string              `json:"body" bson:"body"`
+	Version   int                 `json:"version" bson:"version"`
+	ValidDays int                 `json:"valid_days" bson:"valid_days"` // 0 means a signature never expires
+	Active    bool                `json:"active" bson:"active"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// SignedDocument records a member's signature of a specific template version
+type SignedDocument struct {
+	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TemplateID      primitive.ObjectID  `json:"template_id" bson:"template_id"`
+	TemplateType    string              `json:"template_type" bson:"template_type"`
+	TemplateVersion int                 `json:"template_version" bson:"template_version"`
+	MemberID        primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	ClubID          *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	SignedName      string              `json:"signed_name" bson:"signed_name"`
+	SignedAt        time.Time           `json:"signed_at" bson:"signed_at"`
+	IPAddress       string              `json:"ip_address" bson:"ip_address"`
+	UserAgent       string              `json:"user_agent" bson:"user_agent"`
+	DocumentHash    string              `json:"document_hash" bson:"document_hash"` // SHA-256 of the template content signed
+	PDFKey          string              `json:"-" bson:"pdf_key"`
+	ExpiresAt       *time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dunning case statuses
+const (
+	DunningStatusOpen      = "open"      // retries scheduled
+	DunningStatusExhausted = "exhausted" // every retry failed; the member is suspended
+	DunningStatusRecovered = "recovered" // the invoice was paid
+	DunningStatusClosed    = "closed"    // the invoice was voided or written off
+)
+
+// DunningSchedule lists the days after the first failed payment on which
+// payment is retried, e.g. [1, 3, 7]
+type DunningSchedule []int
+
+// NextRetry returns when the retry after retriesMade earlier retries is due.
+// ok is false once the schedule is exhausted.
+func (s DunningSchedule) NextRetry(firstFailedAt time.Time, retriesMade int) (at time.Time, ok bool) {
+	if retriesMade < 0 || retriesMade >= len(s) {
+		return time.Time{}, false
+	}
+	return firstFailedAt.AddDate(0, 0, s[retriesMade]), true
+}
+
+// DunningAttempt is one automatic retry of a failed membership payment
+type DunningAttempt struct {
+	AttemptedAt time.Time           `json:"attempted_at" bson:"attempted_at"`
+	PaymentID   *primitive.ObjectID `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
+	Status      string              `json:"status" bson:"status"` // succeeded, pending, failed
+	FailureCode string              `json:"failure_code,omitempty" bson:"failure_code,omitempty"`
+}
+
+// DunningCase tracks the recovery of one unpaid membership invoice after a
+// failed payment: scheduled retries, the member's past due and suspended
+// statuses, and reactivation once the invoice is paid.
+type DunningCase struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	InvoiceID     primitive.ObjectID  `json:"invoice_id" bson:"invoice_id"`
+	MemberID      primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	ClubID        *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Status        string              `json:"status" bson:"status"` // open, exhausted, recovered, closed
+	FirstFailedAt time.Time           `json:"first_failed_at" bson:"first_failed_at"`
+	RetriesMade   int                 `json:"retries_made" bson:"retries_made"`
+	NextRetryAt   *time.Time          `json:"next_retry_at,omitempty" bson:"next_retry_at,omitempty"`
+	Attempts      []DunningAttempt    `json:"attempts" bson:"attempts"`
+	ResolvedAt    *time.Time          `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDunningScheduleNextRetry(t *testing.T) {
+	schedule := DunningSchedule{1, 3, 7}
+	failedAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for retries, wantDay := range []int{2, 4, 8} {
+		got, ok := schedule.NextRetry(failedAt, retries)
+		if !ok {
+			t.Fatalf("NextRetry after %d retries: schedule exhausted too early", retries)
+		}
+		if got.Day() != wantDay {
+			t.Errorf("NextRetry after %d retries = %v, want March %d", retries, got, wantDay)
+		}
+	}
+
+	if _, ok := schedule.NextRetry(failedAt, 3); ok {
+		t.Error("Expected the schedule to be exhausted after three retries")
+	}
+	if _, ok := (DunningSchedule{}).NextRetry(failedAt, 0); ok {
+		t.Error("Expected an empty schedule to have no retries")
+	}
+}
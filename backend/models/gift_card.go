@@ -0,0 +1,131 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Gift card statuses
+const (
+	GiftCardStatusActive = "active"
+	GiftCardStatusVoid   = "void"
+)
+
+// Gift card transaction types
+const (
+	GiftCardTxnIssue  = "issue"
+	GiftCardTxnRedeem = "redeem" // spent on an invoice or a restaurant bill
+	GiftCardTxnRefund = "refund" // returned to the card, e.g. by a credit note
+	GiftCardTxnAdjust = "adjust" // adjustment by staff
+	GiftCardTxnExpire = "expire" // balance left when the card expired
+	GiftCardTxnVoid   = "void"   // balance left when the card was voided
+)
+
+// GiftCardProductTypes are the invoice line product types a gift card can pay for
+var GiftCardProductTypes = []string{ProductTypeMembership, ProductTypeClassPack, ProductTypeRestaurant}
+
+// GiftCard is prepaid stored value sold at the front desk. The balance is
+// kept on the card and every change to it is recorded as a transaction.
+type GiftCard struct {
+	ID                primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Code              string              `json:"code" bson:"code"`                           // e.g. GC-7K3P-QX2M-9HTA
+	ClubID            *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"` // where it was sold
+	IssuedAmount      Money               `json:"issued_amount" bson:"issued_amount"`
+	Balance           Money               `json:"balance" bson:"balance"`
+	Status            string              `json:"status" bson:"status"` // active, void
+	ExpiresAt         *time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	PurchaserName     string              `json:"purchaser_name" bson:"purchaser_name"`
+	PurchaserMemberID *primitive.ObjectID `json:"purchaser_member_id,omitempty" bson:"purchaser_member_id,omitempty"`
+	RecipientName     string              `json:"recipient_name" bson:"recipient_name"`
+	RecipientEmail    string              `json:"recipient_email" bson:"recipient_email"`
+	PaymentMethod     string              `json:"payment_method" bson:"payment_method"` // how the card was paid for: card, cash, bank_transfer, other
+	IssuedBy          *primitive.ObjectID `json:"issued_by,omitempty" bson:"issued_by,omitempty"`
+	CreatedAt         time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// ExpiredAt reports whether the card has expired by t
+func (g GiftCard) ExpiredAt(t time.Time) bool {
+	return g.ExpiresAt != nil && !t.Before(*g.ExpiresAt)
+}
+
+// GiftCardTransaction is an entry in a gift card's history. Amount is
+// positive when value is added to the card and negative when it is taken
+// off; BalanceAfter is the card's balance once the entry was applied.
+type GiftCardTransaction struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	GiftCardID    primitive.ObjectID  `json:"gift_card_id" bson:"gift_card_id"`
+	Type          string              `json:"type" bson:"type"` // issue, redeem, refund, adjust, expire, void
+	Amount        Money               `json:"amount" bson:"amount"`
+	BalanceAfter  Money               `json:"balance_after" bson:"balance_after"`
+	InvoiceID     *primitive.ObjectID `json:"invoice_id,omitempty" bson:"invoice_id,omitempty"`
+	ReservationID *primitive.ObjectID `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	Description   string              `json:"description" bson:"description"`
+	CreatedBy     *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// GiftCardAllowance returns how much of an invoice gift cards can still pay:
+// its membership, class pack and restaurant lines with tax, less what gift
+// cards have already paid on it, and no more than the amount due
+func GiftCardAllowance(invoice Invoice, giftCardPaid Money) Money {
+	eligible := NewMoney(0, invoice.Total.Currency)
+	for _, line := range invoice.Lines {
+		for _, productType := range GiftCardProductTypes {
+			if line.ProductType == productType {
+				eligible = eligible.Add(line.Amount).Add(line.TaxAmount)
+			}
+		}
+	}
+	allowance := eligible.Sub(giftCardPaid).Min(invoice.AmountDue)
+	if allowance.IsNegative() {
+		return NewMoney(0, invoice.Total.Currency)
+	}
+	return allowance
+}
+
+// GiftCardLiability is the value held on gift cards in one currency: the
+// outstanding balance still owed to card holders, and what has been issued,
+// redeemed, expired and voided over the cards' lifetime
+type GiftCardLiability struct {
+	Currency         string `json:"currency"`
+	Outstanding      Money  `json:"outstanding"`
+	OutstandingCards int    `json:"outstanding_cards"`
+	Issued           Money  `json:"issued"`
+	Redeemed         Money  `json:"redeemed"` // net of refunds back onto cards
+	Adjusted         Money  `json:"adjusted"`
+	Expired          Money  `json:"expired"`
+	Voided           Money  `json:"voided"`
+}
+
+// NewGiftCardLiability returns empty totals in a currency
+func NewGiftCardLiability(currency string) GiftCardLiability {
+	zero := NewMoney(0, currency)
+	return GiftCardLiability{
+		Currency:    currency,
+		Outstanding: zero,
+		Issued:      zero,
+		Redeemed:    zero,
+		Adjusted:    zero,
+		Expired:     zero,
+		Voided:      zero,
+	}
+}
+
+// AddTransactions adds the total of one type of transaction. Amounts taken
+// off cards are reported as positive figures.
+func (l *GiftCardLiability) AddTransactions(txnType string, total Money) {
+	switch txnType {
+	case GiftCardTxnIssue:
+		l.Issued = l.Issued.Add(total)
+	case GiftCardTxnRedeem, GiftCardTxnRefund:
+		l.Redeemed = l.Redeemed.Sub(total)
+	case GiftCardTxnAdjust:
+		l.Adjusted = l.Adjusted.Add(total)
+	case GiftCardTxnExpire:
+		l.Expired = l.Expired.Sub(total)
+	case GiftCardTxnVoid:
+		l.Voided = l.Voided.Sub(total)
+	}
+}
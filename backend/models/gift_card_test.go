@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGiftCardAllowance(t *testing.T) {
+	invoice := Invoice{
+		Lines: []InvoiceLine{
+			{ProductType: ProductTypeMembership, Amount: Cents(8000), TaxAmount: Cents(800)},
+			{ProductType: ProductTypeOther, Amount: Cents(1500)},
+			{ProductType: ProductTypeRestaurant, Amount: Cents(2000)},
+		},
+		Total:     Cents(12300),
+		AmountDue: Cents(12300),
+	}
+
+	if got := GiftCardAllowance(invoice, Money{}); got.Cmp(Cents(10800)) != 0 {
+		t.Errorf("allowance = %v, want 108.00", got)
+	}
+	if got := GiftCardAllowance(invoice, Cents(10000)); got.Cmp(Cents(800)) != 0 {
+		t.Errorf("allowance after 100.00 on gift cards = %v, want 8.00", got)
+	}
+	if got := GiftCardAllowance(invoice, Cents(20000)); !got.IsZero() {
+		t.Errorf("allowance when gift cards paid more than the eligible lines = %v, want 0", got)
+	}
+
+	// Other payments reduce what is due, and the allowance with it
+	invoice.AmountDue = Cents(5000)
+	if got := GiftCardAllowance(invoice, Money{}); got.Cmp(Cents(5000)) != 0 {
+		t.Errorf("allowance capped by amount due = %v, want 50.00", got)
+	}
+}
+
+func TestGiftCardExpiredAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiry := now.Add(time.Hour)
+	card := GiftCard{ExpiresAt: &expiry}
+
+	if card.ExpiredAt(now) {
+		t.Error("card expired before its expiry")
+	}
+	if !card.ExpiredAt(expiry) {
+		t.Error("card still valid at its expiry")
+	}
+	if (GiftCard{}).ExpiredAt(now.AddDate(10, 0, 0)) {
+		t.Error("card without an expiry expired")
+	}
+}
+
+func TestGiftCardLiabilityAddTransactions(t *testing.T) {
+	liability := NewGiftCardLiability("USD")
+	liability.AddTransactions(GiftCardTxnIssue, Cents(10000))
+	liability.AddTransactions(GiftCardTxnRedeem, Cents(-4000))
+	liability.AddTransactions(GiftCardTxnRefund, Cents(500))
+	liability.AddTransactions(GiftCardTxnExpire, Cents(-1500))
+	liability.AddTransactions(GiftCardTxnAdjust, Cents(-200))
+
+	if liability.Issued.Cmp(Cents(10000)) != 0 {
+		t.Errorf("issued = %v, want 100.00", liability.Issued)
+	}
+	if liability.Redeemed.Cmp(Cents(3500)) != 0 {
+		t.Errorf("redeemed = %v, want 35.00 net of the refund", liability.Redeemed)
+	}
+	if liability.Expired.Cmp(Cents(1500)) != 0 {
+		t.Errorf("expired = %v, want 15.00", liability.Expired)
+	}
+	if liability.Adjusted.Cmp(Cents(-200)) != 0 {
+		t.Errorf("adjusted = %v, want -2.00", liability.Adjusted)
+	}
+	if !liability.Voided.IsZero() {
+		t.Errorf("voided = %v, want 0", liability.Voided)
+	}
+}
@@ -14,7 +14,18 @@ type Instructor struct {
 	Phone     string               `bson:"phone" json:"phone"`
 	Specialty string               `bson:"specialty" json:"specialty"`
 	Bio       string               `bson:"bio" json:"bio"`
+	PhotoID   *primitive.ObjectID  `bson:"photo_id,omitempty" json:"photo_id,omitempty"`
 	Active    bool                 `bson:"active" json:"active"`
 	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
 }
+
+// TeachesAt reports whether the instructor is assigned to a club
+func (i Instructor) TeachesAt(clubID primitive.ObjectID) bool {
+	for _, id := range i.ClubIDs {
+		if id == clubID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invoice statuses
+const (
+	InvoiceStatusDraft         = "draft"
+	InvoiceStatusOpen          = "open"
+	InvoiceStatusPartiallyPaid = "partially_paid"
+	InvoiceStatusPaid          = "paid"
+	InvoiceStatusVoid          = "void"
+	InvoiceStatusUncollectible = "uncollectible"
+)
+
+// Invoice line product types
+const (
+	ProductTypeMembership    = "membership"
+	ProductTypeClassPack     = "class_pack"
+	ProductTypeOfficeBooking = "office_booking"
+	ProductTypeRestaurant    = "restaurant"
+	ProductTypeRetail        = "retail" // club shop sales
+	ProductTypeOther         = "other"
+	ProductTypeDiscount      = "discount" // negative line, e.g. from a promo code
+	ProductTypeCredit        = "credit"   // negative line for unused time, e.g. on a plan change
+)
+
+// IsAdjustmentType reports whether lines of a product type reduce the
+// invoice rather than charge for something
+func IsAdjustmentType(productType string) bool {
+	return productType == ProductTypeDiscount || productType == ProductTypeCredit
+}
+
+// InvoiceStatusAction is an explicit invoice operation. Payments move an
+// open invoice to partially paid and paid; everything else goes through these.
+type InvoiceStatusAction struct {
+	Name string
+	From []string
+	To   string
+}
+
+// InvoiceStatusActions defines the manual invoice transitions
+var InvoiceStatusActions = map[string]InvoiceStatusAction{
+	"issue": {
+		Name: "issue",
+		From: []string{InvoiceStatusDraft},
+		To:   InvoiceStatusOpen,
+	},
+	"void": {
+		Name: "void",
+		From: []string{InvoiceStatusDraft, InvoiceStatusOpen},
+		To:   InvoiceStatusVoid,
+	},
+	"write-off": {
+		Name: "write-off",
+		From: []string{InvoiceStatusOpen, InvoiceStatusPartiallyPaid},
+		To:   InvoiceStatusUncollectible,
+	},
+}
+
+// Allows reports whether the action can be applied to an invoice in the given status
+func (a InvoiceStatusAction) Allows(from string) bool {
+	for _, status := range a.From {
+		if status == from {
+			return true
+		}
+	}
+	return false
+}
+
+// InvoiceLine is a single charge on an invoice. ProductID links the line to
+// the record it charges for, such as an office booking.
+type InvoiceLine struct {
+	Description  string              `json:"description" bson:"description"`
+	ProductType  string              `json:"product_type" bson:"product_type"` // membership, class_pack, office_booking, restaurant, retail, other, discount, credit
+	ProductID    *primitive.ObjectID `json:"product_id,omitempty" bson:"product_id,omitempty"`
+	Quantity     int                 `json:"quantity" bson:"quantity"`
+	UnitPrice    Money               `json:"unit_price" bson:"unit_price"`
+	TaxRate      float64             `json:"tax_rate" bson:"tax_rate"`           // percent
+	TaxInclusive bool                `json:"tax_inclusive" bson:"tax_inclusive"` // unit price already includes the tax
+	Amount       Money               `json:"amount" bson:"amount"`               // quantity x unit price, excluding tax
+	TaxAmount    Money               `json:"tax_amount" bson:"tax_amount"`
+	ServiceStart *time.Time          `json:"service_start,omitempty" bson:"service_start,omitempty"` // period the line pays for; revenue is recognized across it
+	ServiceEnd   *time.Time          `json:"service_end,omitempty" bson:"service_end,omitempty"`
+}
+
+// Invoice is a numbered bill for a member, or for a company sponsoring members
+type Invoice struct {
+	ID                 primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Number             string              `json:"number" bson:"number"`
+	MemberID           *primitive.ObjectID `json:"member_id,omitempty" bson:"member_id,omitempty"`
+	CorporateAccountID *primitive.ObjectID `json:"corporate_account_id,omitempty" bson:"corporate_account_id,omitempty"` // set on a company's monthly invoice instead of a member
+	ClubID             *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Status             string              `json:"status" bson:"status"` // draft, open, partially_paid, paid, void, uncollectible
+	Lines              []InvoiceLine       `json:"lines" bson:"lines"`
+	Currency           string              `json:"currency" bson:"currency"`
+	Subtotal           Money               `json:"subtotal" bson:"subtotal"`
+	TaxTotal           Money               `json:"tax_total" bson:"tax_total"`
+	Total              Money               `json:"total" bson:"total"`
+	AmountPaid         Money               `json:"amount_paid" bson:"amount_paid"`
+	AmountDue          Money               `json:"amount_due" bson:"amount_due"`
+	AmountCredited     Money               `json:"amount_credited" bson:"amount_credited"` // total of credit notes issued against the invoice
+	IssuedAt           *time.Time          `json:"issued_at,omitempty" bson:"issued_at,omitempty"`
+	DueDate            time.Time           `json:"due_date" bson:"due_date"`
+	PaidAt             *time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	VoidedAt           *time.Time          `json:"voided_at,omitempty" bson:"voided_at,omitempty"`
+	Notes              string              `json:"notes" bson:"notes"`
+	StatementMonth     string              `json:"statement_month,omitempty" bson:"statement_month,omitempty"` // month of usage a monthly statement covers, e.g. 2024-03
+	SourceRef          string              `json:"-" bson:"source_ref,omitempty"`                              // set on invoices migrated from billing history
+	CreatedAt          time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Recalculate derives line amounts, tax and totals from the lines and the
+// amount paid. Tax is rounded to the cent per line. For tax inclusive lines
+// the tax is taken out of quantity x unit price, so the line amount is the
+// price net of tax.
+func (inv *Invoice) Recalculate() {
+	if inv.Currency == "" {
+		inv.Currency = DefaultCurrency
+		if len(inv.Lines) > 0 && inv.Lines[0].UnitPrice.Currency != "" {
+			inv.Currency = inv.Lines[0].UnitPrice.Currency
+		}
+	}
+	zero := NewMoney(0, inv.Currency)
+	inv.Subtotal, inv.TaxTotal = zero, zero
+	for i := range inv.Lines {
+		line := &inv.Lines[i]
+		if line.Quantity == 0 {
+			line.Quantity = 1
+		}
+		gross := line.UnitPrice.Mul(int64(line.Quantity))
+		if line.TaxInclusive {
+			line.TaxAmount = gross.IncludedPercent(line.TaxRate)
+			line.Amount = gross.Sub(line.TaxAmount)
+		} else {
+			line.Amount = gross
+			line.TaxAmount = gross.Percent(line.TaxRate)
+		}
+		inv.Subtotal = inv.Subtotal.Add(line.Amount)
+		inv.TaxTotal = inv.TaxTotal.Add(line.TaxAmount)
+	}
+	inv.Total = inv.Subtotal.Add(inv.TaxTotal)
+	inv.AmountDue = inv.Total.Sub(inv.AmountPaid)
+}
@@ -0,0 +1,62 @@
+package models
+
+import "testing"
+
+func TestInvoiceRecalculate(t *testing.T) {
+	invoice := Invoice{
+		Lines: []InvoiceLine{
+			{Description: "Membership", ProductType: ProductTypeMembership, Quantity: 1, UnitPrice: Cents(8900), TaxRate: 8.875},
+			{Description: "Class pack", ProductType: ProductTypeClassPack, UnitPrice: Cents(1250), TaxRate: 0},
+			{Description: "Towels", ProductType: ProductTypeOther, Quantity: 3, UnitPrice: Cents(199), TaxRate: 10},
+		},
+		AmountPaid: Cents(5000),
+	}
+	invoice.Recalculate()
+
+	if invoice.Currency != DefaultCurrency {
+		t.Errorf("currency = %q, want %q", invoice.Currency, DefaultCurrency)
+	}
+	if invoice.Lines[1].Quantity != 1 {
+		t.Errorf("missing quantity should default to 1, got %d", invoice.Lines[1].Quantity)
+	}
+	if invoice.Lines[0].TaxAmount != Cents(790) {
+		t.Errorf("line tax = %v, want 7.90", invoice.Lines[0].TaxAmount)
+	}
+	if invoice.Lines[2].Amount != Cents(597) || invoice.Lines[2].TaxAmount != Cents(60) {
+		t.Errorf("line amount/tax = %v/%v, want 5.97/0.60", invoice.Lines[2].Amount, invoice.Lines[2].TaxAmount)
+	}
+	if invoice.Subtotal != Cents(10747) {
+		t.Errorf("subtotal = %v, want 107.47", invoice.Subtotal)
+	}
+	if invoice.TaxTotal != Cents(850) {
+		t.Errorf("tax total = %v, want 8.50", invoice.TaxTotal)
+	}
+	if invoice.Total != Cents(11597) {
+		t.Errorf("total = %v, want 115.97", invoice.Total)
+	}
+	if invoice.AmountDue != Cents(6597) {
+		t.Errorf("amount due = %v, want 65.97", invoice.AmountDue)
+	}
+}
+
+func TestInvoiceStatusActions(t *testing.T) {
+	tests := []struct {
+		action string
+		from   string
+		want   bool
+	}{
+		{"issue", InvoiceStatusDraft, true},
+		{"issue", InvoiceStatusOpen, false},
+		{"void", InvoiceStatusOpen, true},
+		{"void", InvoiceStatusPartiallyPaid, false},
+		{"void", InvoiceStatusPaid, false},
+		{"write-off", InvoiceStatusPartiallyPaid, true},
+		{"write-off", InvoiceStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		if got := InvoiceStatusActions[tt.action].Allows(tt.from); got != tt.want {
+			t.Errorf("%s from %s = %v, want %v", tt.action, tt.from, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Points transaction types
+const (
+	PointsEarn   = "earn"
+	PointsRedeem = "redeem"
+	PointsExpire = "expire"
+	PointsAdjust = "adjust"
+)
+
+// Points transaction sources
+const (
+	PointsSourceCheckIn            = "check_in"
+	PointsSourceClassAttendance    = "class_attendance"
+	PointsSourceRestaurantSpend    = "restaurant_spend"
+	PointsSourceClassCredit        = "class_credit"
+	PointsSourceRestaurantDiscount = "restaurant_discount"
+	PointsSourceExpiry             = "expiry"
+	PointsSourceManual             = "manual"
+)
+
+// LoyaltyRule configures how members earn and redeem points at a club. A rule
+// without a club applies wherever no club specific rule exists.
+type LoyaltyRule struct {
+	ID                    primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClubID                *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	PointsPerCheckIn      int                 `json:"points_per_check_in" bson:"points_per_check_in"`
+	PointsPerClass        int                 `json:"points_per_class" bson:"points_per_class"`
+	PointsPerCurrencyUnit float64             `json:"points_per_currency_unit" bson:"points_per_currency_unit"` // restaurant spend
+	ClassCreditCost       int                 `json:"class_credit_cost" bson:"class_credit_cost"`               // points per class credit
+	PointsPerDiscountUnit int                 `json:"points_per_discount_unit" bson:"points_per_discount_unit"` // points per 1.00 of restaurant discount
+	ExpiryMonths          int                 `json:"expiry_months" bson:"expiry_months"`                       // 0 means points never expire
+	Active                bool                `json:"active" bson:"active"`
+	CreatedAt             time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// PointsFor returns the points earned for an activity. spend is only used
+// for restaurant spend and is rounded down to whole points.
+func (r LoyaltyRule) PointsFor(source string, spend Money) int {
+	switch source {
+	case PointsSourceCheckIn:
+		return r.PointsPerCheckIn
+	case PointsSourceClassAttendance:
+		return r.PointsPerClass
+	case PointsSourceRestaurantSpend:
+		if !spend.IsPositive() {
+			return 0
+		}
+		return int(math.Floor(float64(spend.Amount) * r.PointsPerCurrencyUnit / 100))
+	}
+	return 0
+}
+
+// ExpiresAt returns when points earned at the given time expire, or nil if they don't
+func (r LoyaltyRule) ExpiresAt(earnedAt time.Time) *time.Time {
+	if r.ExpiryMonths <= 0 {
+		return nil
+	}
+	expiresAt := earnedAt.AddDate(0, r.ExpiryMonths, 0)
+	return &expiresAt
+}
+
+// PointsTransaction is an entry in the append-only loyalty ledger. Points is
+// positive for credits and negative for debits; BalanceAfter is the member's
+// balance once the entry was applied.
+type PointsTransaction struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID     primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	ClubID       *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Type         string              `json:"type" bson:"type"`     // earn, redeem, expire, adjust
+	Source       string              `json:"source" bson:"source"` // check_in, class_attendance, restaurant_spend, class_credit, restaurant_discount, expiry, manual
+	SourceID     *primitive.ObjectID `json:"source_id,omitempty" bson:"source_id,omitempty"`
+	Points       int                 `json:"points" bson:"points"`
+	BalanceAfter int                 `json:"balance_after" bson:"balance_after"`
+	Description  string              `json:"description,omitempty" bson:"description,omitempty"`
+	ExpiresAt    *time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedBy    *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoyaltyRulePointsFor(t *testing.T) {
+	rule := LoyaltyRule{PointsPerCheckIn: 10, PointsPerClass: 25, PointsPerCurrencyUnit: 1.5}
+
+	tests := []struct {
+		source string
+		spend  Money
+		want   int
+	}{
+		{PointsSourceCheckIn, Money{}, 10},
+		{PointsSourceClassAttendance, Money{}, 25},
+		{PointsSourceRestaurantSpend, Cents(4299), 64},
+		{PointsSourceRestaurantSpend, Cents(-500), 0},
+		{PointsSourceManual, Cents(10000), 0},
+	}
+
+	for _, tt := range tests {
+		if got := rule.PointsFor(tt.source, tt.spend); got != tt.want {
+			t.Errorf("PointsFor(%q, %v) = %d, want %d", tt.source, tt.spend, got, tt.want)
+		}
+	}
+}
+
+func TestLoyaltyRuleExpiresAt(t *testing.T) {
+	earnedAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	if got := (LoyaltyRule{}).ExpiresAt(earnedAt); got != nil {
+		t.Errorf("ExpiresAt with no expiry = %v, want nil", got)
+	}
+
+	got := LoyaltyRule{ExpiryMonths: 12}.ExpiresAt(earnedAt)
+	want := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	if got == nil || !got.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", got, want)
+	}
+}
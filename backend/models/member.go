@@ -7,20 +7,31 @@ import (
 )
 
 type Member struct {
-	ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
-	ClubIDs          []primitive.ObjectID `bson:"club_ids,omitempty" json:"club_ids,omitempty"` // Support multiple clubs
-	FirstName        string               `bson:"first_name" json:"first_name"`
-	LastName         string               `bson:"last_name" json:"last_name"`
-	Email            string               `bson:"email" json:"email"`
-	Phone            string               `bson:"phone" json:"phone"`
-	MembershipType   string               `bson:"membership_type" json:"membership_type"`
-	Status           string               `bson:"status" json:"status"`
-	JoinDate         time.Time            `bson:"join_date" json:"join_date"`
-	ExpiryDate       time.Time            `bson:"expiry_date" json:"expiry_date"`
-	AutoRenewal      bool                 `bson:"auto_renewal" json:"auto_renewal"`
-	EmergencyContact string               `bson:"emergency_contact" json:"emergency_contact"`
-	Notes            string               `bson:"notes" json:"notes"`
-	BillingHistory   []BillingEntry       `bson:"billing_history" json:"billing_history"`
-	CreatedAt        time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt        time.Time            `bson:"updated_at" json:"updated_at"`
+	ID                 primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	ClubIDs            []primitive.ObjectID `bson:"club_ids,omitempty" json:"club_ids,omitempty"` // Support multiple clubs
+	FirstName          string               `bson:"first_name" json:"first_name"`
+	LastName           string               `bson:"last_name" json:"last_name"`
+	Email              string               `bson:"email" json:"email"`
+	Phone              string               `bson:"phone" json:"phone"`
+	MembershipType     string               `bson:"membership_type" json:"membership_type"`
+	PlanID             *primitive.ObjectID  `bson:"plan_id,omitempty" json:"plan_id,omitempty"` // changed through plan changes
+	Status             string               `bson:"status" json:"status"`
+	StatusReason       string               `bson:"status_reason,omitempty" json:"status_reason,omitempty"`
+	StatusChangedAt    *time.Time           `bson:"status_changed_at,omitempty" json:"status_changed_at,omitempty"`
+	FrozenAt           *time.Time           `bson:"frozen_at,omitempty" json:"frozen_at,omitempty"`
+	JoinDate           time.Time            `bson:"join_date" json:"join_date"`
+	ExpiryDate         time.Time            `bson:"expiry_date" json:"expiry_date"`
+	AutoRenewal        bool                 `bson:"auto_renewal" json:"auto_renewal"`
+	EmergencyContact   string               `bson:"emergency_contact" json:"emergency_contact"`
+	Notes              string               `bson:"notes" json:"notes"`
+	PhotoID            *primitive.ObjectID  `bson:"photo_id,omitempty" json:"photo_id,omitempty"`
+	ReferralCode       string               `bson:"referral_code,omitempty" json:"referral_code,omitempty"`
+	ReferredBy         *primitive.ObjectID  `bson:"referred_by,omitempty" json:"referred_by,omitempty"`
+	AccountCredit      Money                `bson:"account_credit" json:"account_credit"`
+	LoyaltyPoints      int                  `bson:"loyalty_points" json:"loyalty_points"` // cached ledger balance
+	ClassCredits       int                  `bson:"class_credits" json:"class_credits"`
+	CorporateAccountID *primitive.ObjectID  `bson:"corporate_account_id,omitempty" json:"corporate_account_id,omitempty"` // employer sponsoring the membership
+	ChurnRisk          *ChurnRisk           `bson:"churn_risk,omitempty" json:"churn_risk,omitempty"`                     // recomputed nightly
+	CreatedAt          time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time            `bson:"updated_at" json:"updated_at"`
 }
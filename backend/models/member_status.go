@@ -0,0 +1,155 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Member lifecycle statuses
+const (
+	MemberStatusProspect  = "prospect"
+	MemberStatusActive    = "active"
+	MemberStatusFrozen    = "frozen"
+	MemberStatusPastDue   = "past_due"
+	MemberStatusSuspended = "suspended" // unpaid after all payment retries; cannot check in or book
+	MemberStatusExpired   = "expired"
+	MemberStatusCancelled = "cancelled"
+	MemberStatusBanned    = "banned"
+)
+
+// MemberStatusAction is an explicit lifecycle operation such as freezing or
+// cancelling a membership. Status only changes through these actions.
+type MemberStatusAction struct {
+	Name           string
+	From           []string
+	To             string
+	RequiresReason bool
+}
+
+// MemberStatusActions defines every allowed lifecycle transition
+var MemberStatusActions = map[string]MemberStatusAction{
+	"activate": {
+		Name: "activate",
+		From: []string{MemberStatusProspect, MemberStatusExpired, MemberStatusCancelled},
+		To:   MemberStatusActive,
+	},
+	"freeze": {
+		Name:           "freeze",
+		From:           []string{MemberStatusActive},
+		To:             MemberStatusFrozen,
+		RequiresReason: true,
+	},
+	"unfreeze": {
+		Name: "unfreeze",
+		From: []string{MemberStatusFrozen},
+		To:   MemberStatusActive,
+	},
+	"mark-past-due": {
+		Name: "mark-past-due",
+		From: []string{MemberStatusActive},
+		To:   MemberStatusPastDue,
+	},
+	"suspend": {
+		Name: "suspend",
+		From: []string{MemberStatusPastDue},
+		To:   MemberStatusSuspended,
+	},
+	"settle": {
+		Name: "settle",
+		From: []string{MemberStatusPastDue, MemberStatusSuspended},
+		To:   MemberStatusActive,
+	},
+	"expire": {
+		Name: "expire",
+		From: []string{MemberStatusActive, MemberStatusPastDue, MemberStatusSuspended, MemberStatusFrozen},
+		To:   MemberStatusExpired,
+	},
+	"cancel": {
+		Name:           "cancel",
+		From:           []string{MemberStatusProspect, MemberStatusActive, MemberStatusFrozen, MemberStatusPastDue, MemberStatusSuspended, MemberStatusExpired},
+		To:             MemberStatusCancelled,
+		RequiresReason: true,
+	},
+	"ban": {
+		Name:           "ban",
+		From:           []string{MemberStatusProspect, MemberStatusActive, MemberStatusFrozen, MemberStatusPastDue, MemberStatusSuspended, MemberStatusExpired, MemberStatusCancelled},
+		To:             MemberStatusBanned,
+		RequiresReason: true,
+	},
+	"reinstate": {
+		Name:           "reinstate",
+		From:           []string{MemberStatusBanned},
+		To:             MemberStatusActive,
+		RequiresReason: true,
+	},
+}
+
+// Allows reports whether the action can be applied to a member in status from
+func (a MemberStatusAction) Allows(from string) bool {
+	for _, s := range a.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// CanUseClub reports whether a member in status can check in, book classes
+// and offices and charge purchases to their account. Past-due members keep
+// access while their payment is retried; legacy values are normalized first.
+func CanUseClub(status string) bool {
+	normalized, ok := NormalizeMemberStatus(status)
+	return ok && (normalized == MemberStatusActive || normalized == MemberStatusPastDue)
+}
+
+// IsValidMemberStatus reports whether s is one of the lifecycle statuses
+func IsValidMemberStatus(s string) bool {
+	switch s {
+	case MemberStatusProspect, MemberStatusActive, MemberStatusFrozen, MemberStatusPastDue,
+		MemberStatusSuspended, MemberStatusExpired, MemberStatusCancelled, MemberStatusBanned:
+		return true
+	}
+	return false
+}
+
+// legacyMemberStatuses maps free-text values written before the lifecycle existed
+var legacyMemberStatuses = map[string]string{
+	"actve":    MemberStatusActive,
+	"inactive": MemberStatusExpired,
+	"paused":   MemberStatusFrozen,
+	"on_hold":  MemberStatusFrozen,
+	"pastdue":  MemberStatusPastDue,
+	"canceled": MemberStatusCancelled,
+	"lead":     MemberStatusProspect,
+}
+
+// NormalizeMemberStatus maps legacy or mistyped status values such as
+// "Active" or "actve" onto a lifecycle status. ok is false when the value
+// cannot be mapped.
+func NormalizeMemberStatus(s string) (status string, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("-", "_", " ", "_").Replace(s)
+	if IsValidMemberStatus(s) {
+		return s, true
+	}
+	if mapped, found := legacyMemberStatuses[s]; found {
+		return mapped, true
+	}
+	return "", false
+}
+
+// MemberStatusChange is an audit record of one lifecycle transition
+type MemberStatusChange struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID  primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	Action    string              `json:"action" bson:"action"`
+	From      string              `json:"from" bson:"from"`
+	To        string              `json:"to" bson:"to"`
+	Reason    string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	Effects   []string            `json:"effects,omitempty" bson:"effects,omitempty"` // side effects applied, e.g. "cancelled 2 class bookings"
+	ChangedBy *primitive.ObjectID `json:"changed_by,omitempty" bson:"changed_by,omitempty"`
+	ChangedAt time.Time           `json:"changed_at" bson:"changed_at"`
+	Pending   bool                `json:"pending,omitempty" bson:"pending,omitempty"` // side effects not yet applied
+}
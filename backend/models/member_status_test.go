@@ -0,0 +1,86 @@
+package models
+
+import "testing"
+
+func TestNormalizeMemberStatus(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"active", MemberStatusActive, true},
+		{"Active", MemberStatusActive, true},
+		{" ACTIVE ", MemberStatusActive, true},
+		{"actve", MemberStatusActive, true},
+		{"Past Due", MemberStatusPastDue, true},
+		{"past-due", MemberStatusPastDue, true},
+		{"inactive", MemberStatusExpired, true},
+		{"canceled", MemberStatusCancelled, true},
+		{"Suspended", MemberStatusSuspended, true},
+		{"gold", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizeMemberStatus(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeMemberStatus(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMemberStatusActions(t *testing.T) {
+	for name, action := range MemberStatusActions {
+		if action.Name != name {
+			t.Errorf("Action %q has mismatched name %q", name, action.Name)
+		}
+		if !IsValidMemberStatus(action.To) {
+			t.Errorf("Action %q targets unknown status %q", name, action.To)
+		}
+		for _, from := range action.From {
+			if !IsValidMemberStatus(from) {
+				t.Errorf("Action %q starts from unknown status %q", name, from)
+			}
+		}
+	}
+
+	if !MemberStatusActions["freeze"].Allows(MemberStatusActive) {
+		t.Error("Expected active members to be freezable")
+	}
+	if MemberStatusActions["freeze"].Allows(MemberStatusBanned) {
+		t.Error("Expected banned members not to be freezable")
+	}
+	if MemberStatusActions["unfreeze"].Allows(MemberStatusCancelled) {
+		t.Error("Expected unfreeze to require a frozen member")
+	}
+	if MemberStatusActions["suspend"].Allows(MemberStatusActive) {
+		t.Error("Expected only past due members to be suspendable")
+	}
+	if !MemberStatusActions["settle"].Allows(MemberStatusSuspended) {
+		t.Error("Expected suspended members to be reactivated by settling")
+	}
+	if !MemberStatusActions["cancel"].RequiresReason {
+		t.Error("Expected cancellation to require a reason")
+	}
+}
+
+func TestCanUseClub(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{MemberStatusActive, true},
+		{"Past Due", true},
+		{MemberStatusFrozen, false},
+		{MemberStatusSuspended, false},
+		{MemberStatusCancelled, false},
+		{MemberStatusExpired, false},
+		{MemberStatusBanned, false},
+		{"gold", false},
+	}
+
+	for _, tt := range tests {
+		if got := CanUseClub(tt.status); got != tt.want {
+			t.Errorf("CanUseClub(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
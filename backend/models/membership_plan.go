@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Membership plan billing periods
+const (
+	PlanPeriodMonthly = "monthly"
+	PlanPeriodAnnual  = "annual"
+)
+
+// Plan change timings
+const (
+	PlanChangeNow       = "now"     // prorated for the rest of the current period
+	PlanChangeAtRenewal = "renewal" // switches at the member's expiry date
+)
+
+// Plan change statuses
+const (
+	PlanChangeStatusScheduled = "scheduled"
+	PlanChangeStatusApplied   = "applied"
+	PlanChangeStatusCancelled = "cancelled"
+)
+
+// MembershipPlan is a membership a member can be on, such as "Premium
+// monthly". Plans without a club are offered at every club.
+type MembershipPlan struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClubID        *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Name          string              `json:"name" bson:"name"` // copied to the member's membership_type
+	Description   string              `json:"description" bson:"description"`
+	Price         Money               `json:"price" bson:"price"`                   // per billing period, before tax
+	BillingPeriod string              `json:"billing_period" bson:"billing_period"` // monthly, annual
+	Active        bool                `json:"active" bson:"active"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// PeriodStart returns the start of the billing period that ends at end
+func (p MembershipPlan) PeriodStart(end time.Time) time.Time {
+	if p.BillingPeriod == PlanPeriodAnnual {
+		return end.AddDate(-1, 0, 0)
+	}
+	return end.AddDate(0, -1, 0)
+}
+
+// PeriodEnd returns the end of the billing period that starts at start
+func (p MembershipPlan) PeriodEnd(start time.Time) time.Time {
+	if p.BillingPeriod == PlanPeriodAnnual {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// PlanChange moves a member from one plan to another, now with prorated
+// amounts or at the next renewal. Changes taking effect now are billed with
+// the invoice lines on the change: a positive total is invoiced and a
+// negative total is added to the member's account credit.
+type PlanChange struct {
+	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	MemberID        primitive.ObjectID  `json:"member_id" bson:"member_id"`
+	FromPlanID      *primitive.ObjectID `json:"from_plan_id,omitempty" bson:"from_plan_id,omitempty"`
+	ToPlanID        primitive.ObjectID  `json:"to_plan_id" bson:"to_plan_id"`
+	FromPlan        string              `json:"from_plan" bson:"from_plan"` // plan names at the time of the change
+	ToPlan          string              `json:"to_plan" bson:"to_plan"`
+	Timing          string              `json:"timing" bson:"timing"` // now, renewal
+	Status          string              `json:"status" bson:"status"` // scheduled, applied, cancelled
+	EffectiveAt     time.Time           `json:"effective_at" bson:"effective_at"`
+	PeriodStart     time.Time           `json:"period_start" bson:"period_start"`
+	PeriodEnd       time.Time           `json:"period_end" bson:"period_end"`
+	DaysRemaining   int                 `json:"days_remaining" bson:"days_remaining"`
+	DaysInPeriod    int                 `json:"days_in_period" bson:"days_in_period"`
+	Credit          Money               `json:"credit" bson:"credit"` // unused part of the current plan, before tax
+	Charge          Money               `json:"charge" bson:"charge"` // new plan for the rest of the period, before tax
+	Lines           []InvoiceLine       `json:"lines" bson:"lines"`
+	Total           Money               `json:"total" bson:"total"` // lines with tax
+	InvoiceID       *primitive.ObjectID `json:"invoice_id,omitempty" bson:"invoice_id,omitempty"`
+	AccountCreditID *primitive.ObjectID `json:"account_credit_id,omitempty" bson:"account_credit_id,omitempty"`
+	CreatedBy       *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
+	AppliedAt       *time.Time          `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+	CancelledAt     *time.Time          `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
+}
+
+// NewPlanChange works out a change from one plan (nil when the member has
+// none) to another for a member whose billing period ends at periodEnd.
+// A change now credits the unused days of the current plan and charges the
+// new plan for the same days; a change at renewal has no amounts. Lines
+// carry no tax yet; call Recalculate once tax terms are set.
+func NewPlanChange(memberID primitive.ObjectID, from *MembershipPlan, to MembershipPlan, timing string, periodEnd, now time.Time) PlanChange {
+	change := PlanChange{
+		MemberID:  memberID,
+		ToPlanID:  to.ID,
+		ToPlan:    to.Name,
+		Timing:    timing,
+		Status:    PlanChangeStatusScheduled,
+		PeriodEnd: periodEnd,
+		Credit:    NewMoney(0, to.Price.Currency),
+		Charge:    NewMoney(0, to.Price.Currency),
+		Lines:     []InvoiceLine{},
+		CreatedAt: now,
+	}
+	current := to
+	if from != nil {
+		change.FromPlanID = &from.ID
+		change.FromPlan = from.Name
+		current = *from
+	}
+	change.PeriodStart = current.PeriodStart(periodEnd)
+
+	if timing == PlanChangeAtRenewal {
+		change.EffectiveAt = periodEnd
+		change.Recalculate()
+		return change
+	}
+
+	change.EffectiveAt = now
+	if periodEnd.After(now) {
+		change.DaysInPeriod = int(math.Round(periodEnd.Sub(change.PeriodStart).Hours() / 24))
+		change.DaysRemaining = int(math.Ceil(periodEnd.Sub(now).Hours() / 24))
+		if change.DaysRemaining > change.DaysInPeriod {
+			change.DaysRemaining = change.DaysInPeriod
+		}
+	}
+	days, total := int64(change.DaysRemaining), int64(change.DaysInPeriod)
+	serviceStart, serviceEnd := now, periodEnd
+	dates := fmt.Sprintf("%d of %d days to %s", days, total, periodEnd.Format("2006-01-02"))
+
+	if from != nil {
+		change.Credit = from.Price.Prorate(days, total)
+	}
+	change.Charge = to.Price.Prorate(days, total)
+	if change.Charge.IsPositive() {
+		change.Lines = append(change.Lines, InvoiceLine{
+			Description:  fmt.Sprintf("%s, %s", to.Name, dates),
+			ProductType:  ProductTypeMembership,
+			ProductID:    &to.ID,
+			Quantity:     1,
+			UnitPrice:    change.Charge,
+			ServiceStart: &serviceStart,
+			ServiceEnd:   &serviceEnd,
+		})
+	}
+	if change.Credit.IsPositive() {
+		change.Lines = append(change.Lines, InvoiceLine{
+			Description:  fmt.Sprintf("Unused %s, %s", from.Name, dates),
+			ProductType:  ProductTypeCredit,
+			ProductID:    &from.ID,
+			Quantity:     1,
+			UnitPrice:    change.Credit.Neg(),
+			ServiceStart: &serviceStart,
+			ServiceEnd:   &serviceEnd,
+		})
+	}
+	change.Recalculate()
+	return change
+}
+
+// Recalculate derives the line amounts, tax and total of the change
+func (c *PlanChange) Recalculate() {
+	invoice := Invoice{Lines: c.Lines, Currency: c.Charge.Currency}
+	invoice.Recalculate()
+	c.Total = invoice.Total
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewPlanChange(t *testing.T) {
+	basic := MembershipPlan{ID: primitive.NewObjectID(), Name: "Basic", Price: Cents(3100), BillingPeriod: PlanPeriodMonthly}
+	premium := MembershipPlan{ID: primitive.NewObjectID(), Name: "Premium", Price: Cents(6200), BillingPeriod: PlanPeriodMonthly}
+	memberID := primitive.NewObjectID()
+	periodEnd := time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 31, 9, 30, 0, 0, time.UTC)
+
+	upgrade := NewPlanChange(memberID, &basic, premium, PlanChangeNow, periodEnd, now)
+	if upgrade.DaysInPeriod != 31 || upgrade.DaysRemaining != 15 {
+		t.Fatalf("days = %d of %d, want 15 of 31", upgrade.DaysRemaining, upgrade.DaysInPeriod)
+	}
+	if upgrade.Credit != Cents(1500) || upgrade.Charge != Cents(3000) {
+		t.Errorf("credit/charge = %v/%v, want 15.00/30.00", upgrade.Credit, upgrade.Charge)
+	}
+	if len(upgrade.Lines) != 2 || upgrade.Lines[1].ProductType != ProductTypeCredit || upgrade.Lines[1].UnitPrice != Cents(-1500) {
+		t.Errorf("unexpected lines %+v", upgrade.Lines)
+	}
+	if upgrade.Total != Cents(1500) || !upgrade.EffectiveAt.Equal(now) {
+		t.Errorf("total = %v effective %v, want 15.00 now", upgrade.Total, upgrade.EffectiveAt)
+	}
+
+	// Tax on both lines nets out to tax on the difference
+	for i := range upgrade.Lines {
+		upgrade.Lines[i].TaxRate = 10
+	}
+	upgrade.Recalculate()
+	if upgrade.Total != Cents(1650) {
+		t.Errorf("total with tax = %v, want 16.50", upgrade.Total)
+	}
+
+	downgrade := NewPlanChange(memberID, &premium, basic, PlanChangeNow, periodEnd, now)
+	if downgrade.Total != Cents(-1500) {
+		t.Errorf("downgrade total = %v, want -15.00", downgrade.Total)
+	}
+
+	first := NewPlanChange(memberID, nil, basic, PlanChangeNow, periodEnd, now)
+	if first.FromPlanID != nil || len(first.Lines) != 1 || first.Total != Cents(1500) {
+		t.Errorf("change without a current plan = %+v", first)
+	}
+
+	renewal := NewPlanChange(memberID, &basic, premium, PlanChangeAtRenewal, periodEnd, now)
+	if !renewal.EffectiveAt.Equal(periodEnd) || len(renewal.Lines) != 0 || !renewal.Total.IsZero() || renewal.Status != PlanChangeStatusScheduled {
+		t.Errorf("renewal change = %+v", renewal)
+	}
+
+	expired := NewPlanChange(memberID, &basic, premium, PlanChangeNow, now.AddDate(0, 0, -1), now)
+	if len(expired.Lines) != 0 || !expired.Total.IsZero() {
+		t.Errorf("change after the period ended should have no amounts, got %+v", expired)
+	}
+}
+
+func TestPlanPeriodStart(t *testing.T) {
+	end := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	monthly := MembershipPlan{BillingPeriod: PlanPeriodMonthly}
+	annual := MembershipPlan{BillingPeriod: PlanPeriodAnnual}
+	if got := monthly.PeriodStart(end); !got.Equal(time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthly start = %v", got)
+	}
+	if got := annual.PeriodStart(end); !got.Equal(time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("annual start = %v", got)
+	}
+	if got := monthly.PeriodEnd(end); !got.Equal(time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthly end = %v", got)
+	}
+	if got := annual.PeriodEnd(end); !got.Equal(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("annual end = %v", got)
+	}
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// DefaultCurrency is used for amounts stored or sent without a currency
+const DefaultCurrency = "USD"
+
+// ErrCurrencyMismatch is returned when combining amounts in different currencies
+var ErrCurrencyMismatch = errors.New("money: currency mismatch")
+
+// Money is an exact amount in minor units (cents) of a currency. All
+// supported currencies have two decimal places.
+//
+// It is stored in BSON and sent in JSON as {"amount": 1250, "currency": "USD"}.
+// For documents written before amounts were exact, and for older clients, a
+// bare number or decimal string is also accepted and read as major units
+// in the default currency.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// NewMoney returns an amount in minor units of the given currency
+func NewMoney(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: currency}
+}
+
+// Cents returns an amount in minor units of the default currency
+func Cents(minor int64) Money {
+	return Money{Amount: minor, Currency: DefaultCurrency}
+}
+
+// MoneyFromFloat converts a major-unit float such as 12.5 to Money, rounding
+// half away from zero. It is only meant for reading legacy values.
+func MoneyFromFloat(major float64, currency string) Money {
+	return Money{Amount: int64(math.Round(major * 100)), Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "12.50" or "-3" exactly
+func ParseMoney(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && (!hasFrac || frac == "") {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		return Money{}, fmt.Errorf("money: %q has more than two decimal places", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || units > (math.MaxInt64-99)/100 {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+
+	minor := units*100 + cents
+	if negative {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// combinedCurrency resolves the currency of two operands. A zero amount or
+// an amount without a currency takes the currency of the other operand.
+func combinedCurrency(a, b Money) (string, bool) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, true
+	case a.Currency == "" || a.Amount == 0:
+		return b.Currency, true
+	case b.Currency == "" || b.Amount == 0:
+		return a.Currency, true
+	}
+	return "", false
+}
+
+// mustCombine panics on mixed currencies. Handlers check SameCurrency where
+// amounts from different requests or records meet, and reports cover one
+// currency at a time, so a panic here is a missing check.
+func mustCombine(a, b Money) string {
+	currency, ok := combinedCurrency(a, b)
+	if !ok {
+		panic(fmt.Sprintf("%v: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency))
+	}
+	return currency
+}
+
+// SameCurrency reports whether two amounts can be combined
+func (m Money) SameCurrency(o Money) bool {
+	_, ok := combinedCurrency(m, o)
+	return ok
+}
+
+// Add returns m + o. Amounts must share a currency.
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: mustCombine(m, o)}
+}
+
+// Sub returns m - o. Amounts must share a currency.
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: mustCombine(m, o)}
+}
+
+// Mul returns m multiplied by a whole quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Percent returns the given percentage of m (e.g. 8.875 for a tax rate),
+// rounded half away from zero to the nearest minor unit
+func (m Money) Percent(rate float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate / 100)), Currency: m.Currency}
+}
+
+// IncludedPercent returns the part of m that is a tax at the given rate on
+// the rest, for prices that include tax (e.g. 10 of 110 at 10%), rounded
+// half away from zero to the nearest minor unit
+func (m Money) IncludedPercent(rate float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate / (100 + rate))), Currency: m.Currency}
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// IsPositive reports whether the amount is above zero
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Cmp compares two amounts in the same currency, returning -1, 0 or 1
+func (m Money) Cmp(o Money) int {
+	mustCombine(m, o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Min returns the smaller of two amounts in the same currency
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m
+	}
+	return o
+}
+
+// Major formats the amount in major units, e.g. "-12.50"
+func (m Money) Major() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// Float64 returns the amount in major units for display and charting only
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / 100
+}
+
+// String formats the amount with its currency, e.g. "12.50 USD"
+func (m Money) String() string {
+	return m.Major() + " " + m.currency()
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// MarshalJSON writes {"amount": <minor units>, "currency": "..."}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Amount, m.currency()})
+}
+
+// UnmarshalJSON reads the object form, or a bare number or decimal string in
+// major units of the default currency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	switch {
+	case trimmed == "null":
+		*m = Money{}
+		return nil
+	case strings.HasPrefix(trimmed, "{"):
+		var v struct {
+			Amount   *int64 `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if v.Amount == nil {
+			return errors.New("money: amount is required")
+		}
+		*m = Money{Amount: *v.Amount, Currency: strings.ToUpper(v.Currency)}
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+	case strings.HasPrefix(trimmed, `"`):
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(s, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	// Parse the number's text exactly rather than through a float
+	parsed, err := ParseMoney(trimmed, DefaultCurrency)
+	if err != nil {
+		var f float64
+		if jsonErr := json.Unmarshal(data, &f); jsonErr != nil {
+			return jsonErr
+		}
+		parsed = MoneyFromFloat(f, DefaultCurrency)
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalBSONValue stores Money as an embedded {amount, currency} document
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(bson.D{
+		{Key: "amount", Value: m.Amount},
+		{Key: "currency", Value: m.currency()},
+	})
+}
+
+// UnmarshalBSONValue reads the embedded document form, or a legacy number in
+// major units of the default currency
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var v struct {
+			Amount   int64  `bson:"amount"`
+			Currency string `bson:"currency"`
+		}
+		if err := raw.Unmarshal(&v); err != nil {
+			return err
+		}
+		*m = Money{Amount: v.Amount, Currency: v.Currency}
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+	case bsontype.Double:
+		*m = MoneyFromFloat(raw.Double(), DefaultCurrency)
+	case bsontype.Int32:
+		*m = Cents(int64(raw.Int32()) * 100)
+	case bsontype.Int64:
+		*m = Cents(raw.Int64() * 100)
+	case bsontype.Decimal128:
+		parsed, err := ParseMoney(raw.Decimal128().String(), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("money: cannot decode BSON %s", t)
+	}
+	return nil
+}
+
+var (
+	_ bson.ValueMarshaler   = Money{}
+	_ bson.ValueUnmarshaler = (*Money)(nil)
+)
+
+// Prorate returns part/whole of m, such as the unused days of a billing
+// period, rounded half away from zero to the nearest minor unit
+func (m Money) Prorate(part, whole int64) Money {
+	if whole == 0 {
+		return Money{Currency: m.Currency}
+	}
+	return Money{Amount: int64(math.Round(float64(m.Amount) * float64(part) / float64(whole))), Currency: m.Currency}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"12.50", 1250, false},
+		{"12.5", 1250, false},
+		{"-3", -300, false},
+		{".99", 99, false},
+		{"0.1", 10, false},
+		{"1.234", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, DefaultCurrency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.Amount != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	// 0.1 + 0.2 is exact in minor units
+	if got := Cents(10).Add(Cents(20)); got != Cents(30) {
+		t.Errorf("0.10 + 0.20 = %v, want 0.30", got)
+	}
+	if got := Cents(1999).Mul(3).Sub(Cents(997)); got != Cents(5000) {
+		t.Errorf("3 x 19.99 - 9.97 = %v, want 50.00", got)
+	}
+	if got := Cents(1999).Percent(8.875); got != Cents(177) {
+		t.Errorf("8.875%% of 19.99 = %v, want 1.77", got)
+	}
+	if got := Cents(1100).IncludedPercent(10); got != Cents(100) {
+		t.Errorf("10%% tax included in 11.00 = %v, want 1.00", got)
+	}
+	if got := Cents(4999).Prorate(10, 30); got != Cents(1666) {
+		t.Errorf("10/30 of 49.99 = %v, want 16.66", got)
+	}
+	if got := Cents(-1250).Major(); got != "-12.50" {
+		t.Errorf("Major() = %q, want -12.50", got)
+	}
+	if got := (Money{}).Add(NewMoney(500, "EUR")); got.Currency != "EUR" {
+		t.Errorf("zero amount should adopt the other currency, got %q", got.Currency)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("adding USD to EUR should panic")
+		}
+	}()
+	Cents(100).Add(NewMoney(100, "EUR"))
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(Cents(1250))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":1250,"currency":"USD"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	tests := map[string]Money{
+		`{"amount":1250,"currency":"eur"}`: NewMoney(1250, "EUR"),
+		`{"amount":99}`:                    Cents(99),
+		`12.5`:                             Cents(1250),
+		`"19.99"`:                          Cents(1999),
+		`0.30000000000000004`:              Cents(30),
+	}
+	for in, want := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(in), &got); err != nil {
+			t.Errorf("Unmarshal(%s) error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", in, got, want)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`{"currency":"USD"}`), &m); err == nil {
+		t.Error("an object without amount should be rejected")
+	}
+}
+
+func TestMoneyBSON(t *testing.T) {
+	type doc struct {
+		Price Money `bson:"price"`
+	}
+
+	data, err := bson.Marshal(doc{Price: NewMoney(4599, "EUR")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded doc
+	if err := bson.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Price != NewMoney(4599, "EUR") {
+		t.Errorf("round trip = %+v", decoded.Price)
+	}
+	if amount := bson.Raw(data).Lookup("price", "amount"); amount.Type != bson.TypeInt64 {
+		t.Errorf("amount stored as %s, want int64", amount.Type)
+	}
+
+	// Documents written before the migration hold major units as numbers
+	legacy := []bson.M{{"price": 45.99}, {"price": int32(45)}, {"price": int64(45)}}
+	want := []Money{Cents(4599), Cents(4500), Cents(4500)}
+	for i, raw := range legacy {
+		data, err := bson.Marshal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got doc
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Errorf("legacy %v: %v", raw, err)
+			continue
+		}
+		if got.Price != want[i] {
+			t.Errorf("legacy %v = %+v, want %+v", raw, got.Price, want[i])
+		}
+	}
+}
@@ -15,8 +15,8 @@ type Office struct {
 	Type        string              `json:"type" bson:"type"` // private, shared, meeting_room, phone_booth
 	Capacity    int                 `json:"capacity" bson:"capacity"`
 	Amenities   []string            `json:"amenities" bson:"amenities"` // wifi, monitor, whiteboard, etc.
-	HourlyRate  float64             `json:"hourly_rate" bson:"hourly_rate"`
-	DailyRate   float64             `json:"daily_rate" bson:"daily_rate"`
+	HourlyRate  Money               `json:"hourly_rate" bson:"hourly_rate"`
+	DailyRate   Money               `json:"daily_rate" bson:"daily_rate"`
 	Active      bool                `json:"active" bson:"active"`
 	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
@@ -24,14 +24,31 @@ type Office struct {
 
 // OfficeBooking represents a member's office booking
 type OfficeBooking struct {
-	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
-	OfficeID  *primitive.ObjectID `json:"office_id" bson:"office_id,omitempty"`
-	MemberID  *primitive.ObjectID `json:"member_id" bson:"member_id,omitempty"`
-	StartTime time.Time           `json:"start_time" bson:"start_time"`
-	EndTime   time.Time           `json:"end_time" bson:"end_time"`
-	Status    string              `json:"status" bson:"status"` // confirmed, cancelled, completed, no-show
-	TotalCost float64             `json:"total_cost" bson:"total_cost"`
-	Notes     string              `json:"notes" bson:"notes"`
-	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	OfficeID     *primitive.ObjectID `json:"office_id" bson:"office_id,omitempty"`
+	MemberID     *primitive.ObjectID `json:"member_id" bson:"member_id,omitempty"`
+	StartTime    time.Time           `json:"start_time" bson:"start_time"`
+	EndTime      time.Time           `json:"end_time" bson:"end_time"`
+	Status       string              `json:"status" bson:"status"` // confirmed, cancelled, completed, no-show
+	TotalCost    Money               `json:"total_cost" bson:"total_cost"`
+	TaxRate      float64             `json:"tax_rate" bson:"tax_rate"` // percent, from the club's office_booking tax rule
+	TaxInclusive bool                `json:"tax_inclusive" bson:"tax_inclusive"`
+	TaxAmount    Money               `json:"tax_amount" bson:"tax_amount"`
+	TotalWithTax Money               `json:"total_with_tax" bson:"total_with_tax"`
+	Notes        string              `json:"notes" bson:"notes"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// ApplyTax sets the booking's tax from a rule, or clears it when rule is
+// nil. TotalCost stays the price as entered; TotalWithTax is what the member pays.
+func (b *OfficeBooking) ApplyTax(rule *TaxRule) {
+	b.TaxRate, b.TaxInclusive = 0, false
+	net, tax := b.TotalCost, NewMoney(0, b.TotalCost.Currency)
+	if rule != nil {
+		b.TaxRate, b.TaxInclusive = rule.Rate, rule.Inclusive
+		net, tax = rule.Tax(b.TotalCost)
+	}
+	b.TaxAmount = tax
+	b.TotalWithTax = net.Add(tax)
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment statuses
+const (
+	PaymentStatusPending   = "pending"
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusRefunded  = "refunded"
+)
+
+// Payment is money received (or attempted) against an invoice. Only
+// succeeded payments count towards the invoice's amount paid; a payment
+// becomes refunded once all of it has been refunded. Card payments
+// made through a payment provider keep the provider's charge ID; pending
+// charges are settled by the provider's webhook.
+type Payment struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	InvoiceID  primitive.ObjectID  `json:"invoice_id" bson:"invoice_id"`
+	MemberID   *primitive.ObjectID `json:"member_id,omitempty" bson:"member_id,omitempty"`
+	ClubID     *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Amount     Money               `json:"amount" bson:"amount"`
+	Method     string              `json:"method" bson:"method"` // card, cash, bank_transfer, account_credit, other
+	Status     string              `json:"status" bson:"status"` // pending, succeeded, failed, refunded
+	Reference  string              `json:"reference" bson:"reference"`
+	Notes      string              `json:"notes" bson:"notes"`
+	ReceivedAt time.Time           `json:"received_at" bson:"received_at"`
+	CreatedBy  *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+
+	// Set for charges made through a payment provider
+	Provider        string              `json:"provider,omitempty" bson:"provider,omitempty"`
+	ChargeID        string              `json:"charge_id,omitempty" bson:"charge_id,omitempty"`
+	PaymentMethodID *primitive.ObjectID `json:"payment_method_id,omitempty" bson:"payment_method_id,omitempty"`
+	FailureCode     string              `json:"failure_code,omitempty" bson:"failure_code,omitempty"`
+	FailureMessage  string              `json:"failure_message,omitempty" bson:"failure_message,omitempty"`
+
+	// Total returned through refund credit notes
+	AmountRefunded Money `json:"amount_refunded" bson:"amount_refunded"`
+
+	// Allocated when the receipt is first downloaded, e.g. RCT-2024-000042
+	ReceiptNumber string `json:"receipt_number,omitempty" bson:"receipt_number,omitempty"`
+}
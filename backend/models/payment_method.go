@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentMethod is a member's card saved with the payment provider. Only the
+// provider's token and display details are stored, never the card number.
+type PaymentMethod struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	MemberID  primitive.ObjectID `json:"member_id" bson:"member_id"`
+	Provider  string             `json:"provider" bson:"provider"`
+	Token     string             `json:"-" bson:"token"`
+	Brand     string             `json:"brand" bson:"brand"`
+	Last4     string             `json:"last4" bson:"last4"`
+	ExpMonth  int                `json:"exp_month" bson:"exp_month"`
+	ExpYear   int                `json:"exp_year" bson:"exp_year"`
+	IsDefault bool               `json:"is_default" bson:"is_default"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
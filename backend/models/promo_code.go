@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promo code discount types
+const (
+	PromoDiscountPercent = "percent"
+	PromoDiscountFixed   = "fixed"
+)
+
+// PromoCode is a discount sales can hand out, such as "first month 50% off"
+// or "waive joining fee". A code applies to invoice lines of the listed
+// product types (all types when empty) at the listed clubs (all clubs when
+// empty). Zero limits mean unlimited.
+type PromoCode struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Code           string               `json:"code" bson:"code"` // stored upper case
+	Description    string               `json:"description" bson:"description"`
+	DiscountType   string               `json:"discount_type" bson:"discount_type"` // percent, fixed
+	PercentOff     float64              `json:"percent_off,omitempty" bson:"percent_off,omitempty"`
+	AmountOff      Money                `json:"amount_off" bson:"amount_off"`
+	AppliesTo      []string             `json:"applies_to" bson:"applies_to"` // membership, office_booking, class_pack, ...
+	ClubIDs        []primitive.ObjectID `json:"club_ids" bson:"club_ids"`
+	ValidFrom      *time.Time           `json:"valid_from,omitempty" bson:"valid_from,omitempty"`
+	ValidUntil     *time.Time           `json:"valid_until,omitempty" bson:"valid_until,omitempty"`
+	MaxRedemptions int                  `json:"max_redemptions" bson:"max_redemptions"`
+	MaxPerMember   int                  `json:"max_per_member" bson:"max_per_member"`
+	NewMembersOnly bool                 `json:"new_members_only" bson:"new_members_only"` // introductory offers: members without an earlier membership invoice
+	Redemptions    int                  `json:"redemptions" bson:"redemptions"`
+	Active         bool                 `json:"active" bson:"active"`
+	CreatedBy      *primitive.ObjectID  `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt      time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// ValidAt reports whether the code is active and inside its validity window
+func (p PromoCode) ValidAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.ValidFrom != nil && t.Before(*p.ValidFrom) {
+		return false
+	}
+	if p.ValidUntil != nil && !t.Before(*p.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// ValidForClub reports whether the code can be used at a club
+func (p PromoCode) ValidForClub(clubID *primitive.ObjectID) bool {
+	if len(p.ClubIDs) == 0 {
+		return true
+	}
+	if clubID == nil {
+		return false
+	}
+	for _, id := range p.ClubIDs {
+		if id == *clubID {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesToProduct reports whether the code discounts lines of a product type
+func (p PromoCode) AppliesToProduct(productType string) bool {
+	if IsAdjustmentType(productType) {
+		return false
+	}
+	if len(p.AppliesTo) == 0 {
+		return true
+	}
+	for _, t := range p.AppliesTo {
+		if t == productType {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscountLines returns one discount line for each line the code applies to.
+// Lines must already be calculated. A discount line carries the tax terms of
+// the line it discounts, so tax is reduced with the price. A fixed discount
+// is taken from the eligible lines in order and never exceeds their amount.
+func (p PromoCode) DiscountLines(lines []InvoiceLine) []InvoiceLine {
+	discounts := []InvoiceLine{}
+	remaining := p.AmountOff
+	for _, line := range lines {
+		if !p.AppliesToProduct(line.ProductType) || !line.Amount.IsPositive() {
+			continue
+		}
+
+		// Discount the price as it was entered, with tax when it includes tax
+		price := line.Amount
+		if line.TaxInclusive {
+			price = price.Add(line.TaxAmount)
+		}
+
+		var off Money
+		switch p.DiscountType {
+		case PromoDiscountPercent:
+			off = price.Percent(p.PercentOff)
+		case PromoDiscountFixed:
+			if !remaining.SameCurrency(price) {
+				continue
+			}
+			off = remaining.Min(price)
+			remaining = remaining.Sub(off)
+		}
+		if !off.IsPositive() {
+			continue
+		}
+
+		discounts = append(discounts, InvoiceLine{
+			Description:  fmt.Sprintf("%s: %s", p.Code, line.Description),
+			ProductType:  ProductTypeDiscount,
+			ProductID:    &p.ID,
+			Quantity:     1,
+			UnitPrice:    off.Neg(),
+			TaxRate:      line.TaxRate,
+			TaxInclusive: line.TaxInclusive,
+		})
+	}
+	return discounts
+}
+
+// PromoRedemption records a promo code used on an invoice. Voiding the
+// invoice releases the redemption so the code can be used again.
+type PromoRedemption struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	PromoCodeID primitive.ObjectID  `json:"promo_code_id" bson:"promo_code_id"`
+	Code        string              `json:"code" bson:"code"`
+	MemberID    *primitive.ObjectID `json:"member_id,omitempty" bson:"member_id,omitempty"`
+	ClubID      *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	InvoiceID   primitive.ObjectID  `json:"invoice_id" bson:"invoice_id"`
+	Amount      Money               `json:"amount" bson:"amount"` // discount before tax
+	ReleasedAt  *time.Time          `json:"released_at,omitempty" bson:"released_at,omitempty"`
+	CreatedBy   *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+}
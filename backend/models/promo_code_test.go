@@ -0,0 +1,95 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func calculatedLines(lines ...InvoiceLine) []InvoiceLine {
+	inv := Invoice{Lines: lines}
+	inv.Recalculate()
+	return inv.Lines
+}
+
+func TestPromoCodePercentDiscountLines(t *testing.T) {
+	promo := PromoCode{ID: primitive.NewObjectID(), Code: "INTRO50", DiscountType: PromoDiscountPercent, PercentOff: 50, AppliesTo: []string{ProductTypeMembership}}
+	lines := calculatedLines(
+		InvoiceLine{Description: "Monthly membership", ProductType: ProductTypeMembership, UnitPrice: Cents(8900), TaxRate: 8.875},
+		InvoiceLine{Description: "Class pack", ProductType: ProductTypeClassPack, UnitPrice: Cents(5000)},
+	)
+
+	discounts := promo.DiscountLines(lines)
+	if len(discounts) != 1 {
+		t.Fatalf("got %d discount lines, want 1", len(discounts))
+	}
+	line := discounts[0]
+	if line.ProductType != ProductTypeDiscount || *line.ProductID != promo.ID {
+		t.Errorf("discount line = %+v, want a discount line linked to the promo code", line)
+	}
+	if line.UnitPrice != Cents(-4450) || line.TaxRate != 8.875 {
+		t.Errorf("discount = %v at %v%%, want -44.50 at 8.875%%", line.UnitPrice, line.TaxRate)
+	}
+
+	inv := Invoice{Lines: append(lines, discounts...)}
+	inv.Recalculate()
+	if inv.Subtotal != Cents(9450) {
+		t.Errorf("Subtotal = %v, want 94.50", inv.Subtotal)
+	}
+}
+
+func TestPromoCodeFixedDiscountIsCapped(t *testing.T) {
+	promo := PromoCode{Code: "NOJOIN", DiscountType: PromoDiscountFixed, AmountOff: Cents(7500)}
+	lines := calculatedLines(
+		InvoiceLine{Description: "Joining fee", ProductType: ProductTypeOther, UnitPrice: Cents(5000)},
+		InvoiceLine{Description: "Towel", ProductType: ProductTypeOther, UnitPrice: Cents(1000)},
+		InvoiceLine{Description: "Locker", ProductType: ProductTypeOther, UnitPrice: Cents(4000)},
+	)
+
+	discounts := promo.DiscountLines(lines)
+	want := []Money{Cents(-5000), Cents(-1000), Cents(-1500)}
+	if len(discounts) != len(want) {
+		t.Fatalf("got %d discount lines, want %d", len(discounts), len(want))
+	}
+	for i, line := range discounts {
+		if line.UnitPrice != want[i] {
+			t.Errorf("discount %d = %v, want %v", i, line.UnitPrice, want[i])
+		}
+	}
+}
+
+func TestPromoCodeValidity(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	clubID := primitive.NewObjectID()
+	promo := PromoCode{Active: true, ValidFrom: &from, ValidUntil: &until, ClubIDs: []primitive.ObjectID{clubID}}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{from.Add(-time.Second), false},
+		{from, true},
+		{until.Add(-time.Second), true},
+		{until, false},
+	}
+	for _, tt := range tests {
+		if got := promo.ValidAt(tt.at); got != tt.want {
+			t.Errorf("ValidAt(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	promo.Active = false
+	if promo.ValidAt(from) {
+		t.Error("Expected an inactive code to be invalid")
+	}
+
+	other := primitive.NewObjectID()
+	if !promo.ValidForClub(&clubID) || promo.ValidForClub(&other) || promo.ValidForClub(nil) {
+		t.Error("Expected the code to be valid only at its club")
+	}
+	if !(PromoCode{}).ValidForClub(nil) {
+		t.Error("Expected a code without clubs to be valid everywhere")
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Referral reward types
+const (
+	ReferralRewardAccountCredit = "account_credit"
+	ReferralRewardFreeMonth     = "free_month"
+)
+
+// ReferralProgram configures the reward for referrals at a club. A program
+// without a club applies wherever no club specific program exists.
+type ReferralProgram struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClubID         *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	RewardType     string              `json:"reward_type" bson:"reward_type"`         // account_credit, free_month
+	RewardAmount   Money               `json:"reward_amount" bson:"reward_amount"`     // credit amount for account_credit
+	QualifyingDays int                 `json:"qualifying_days" bson:"qualifying_days"` // days the referee must stay active
+	Active         bool                `json:"active" bson:"active"`
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Referral attributes a new member or lead to the member whose code they used.
+// The reward terms are copied from the program when the referral is made.
+type Referral struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ReferrerID     primitive.ObjectID  `json:"referrer_id" bson:"referrer_id"`
+	RefereeID      primitive.ObjectID  `json:"referee_id" bson:"referee_id"`
+	ClubID         *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	Code           string              `json:"code" bson:"code"`
+	Status         string              `json:"status" bson:"status"` // pending, rewarded, void
+	RewardType     string              `json:"reward_type" bson:"reward_type"`
+	RewardAmount   Money               `json:"reward_amount" bson:"reward_amount"`
+	QualifyingDays int                 `json:"qualifying_days" bson:"qualifying_days"`
+	QualifiesAt    *time.Time          `json:"qualifies_at,omitempty" bson:"qualifies_at,omitempty"` // set once the referee is active
+	ReferredAt     time.Time           `json:"referred_at" bson:"referred_at"`
+	RewardedAt     *time.Time          `json:"rewarded_at,omitempty" bson:"rewarded_at,omitempty"`
+	VoidReason     string              `json:"void_reason,omitempty" bson:"void_reason,omitempty"`
+}
@@ -17,6 +17,9 @@ type Reservation struct {
 	PartySize    int                 `json:"party_size" bson:"party_size"`
 	DateTime     time.Time           `json:"date_time" bson:"date_time"`
 	Status       string              `json:"status" bson:"status"` // confirmed, cancelled, completed, no-show
+	BillAmount   Money               `json:"bill_amount" bson:"bill_amount"`
+	Discount     Money               `json:"discount" bson:"discount"`             // loyalty discount applied to the bill
+	GiftCardPaid Money               `json:"gift_card_paid" bson:"gift_card_paid"` // paid on the bill with gift cards
 	SpecialReqs  string              `json:"special_requests" bson:"special_requests"`
 	Notes        string              `json:"notes" bson:"notes"`
 	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stock movement types
+const (
+	StockMovementSale       = "sale"
+	StockMovementAdjustment = "adjustment" // deliveries, counts, damage and other changes by staff
+)
+
+// RetailPaymentAccount is the retail sale payment method that charges the
+// sale to the member's account for their next statement
+const RetailPaymentAccount = "account"
+
+// Product is an item sold in a club's shop, such as water, supplements or
+// apparel. Stock is counted in units; the product is low on stock once it
+// falls to its reorder level.
+type Product struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ClubID       primitive.ObjectID `json:"club_id" bson:"club_id"`
+	SKU          string             `json:"sku" bson:"sku"` // unique within the club, stored upper case
+	Name         string             `json:"name" bson:"name"`
+	Category     string             `json:"category" bson:"category"` // e.g. drinks, supplements, apparel
+	Price        Money              `json:"price" bson:"price"`       // taxed by the club's retail tax rule
+	Stock        int                `json:"stock" bson:"stock"`
+	ReorderLevel int                `json:"reorder_level" bson:"reorder_level"` // 0 turns off low stock alerts
+	Active       bool               `json:"active" bson:"active"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// LowStock reports whether the product is at or below its reorder level
+func (p Product) LowStock() bool {
+	return p.ReorderLevel > 0 && p.Stock <= p.ReorderLevel
+}
+
+// BecameLowStock reports whether a change from stock before left the
+// product low on stock when it was not already
+func (p Product) BecameLowStock(before int) bool {
+	return p.LowStock() && before > p.ReorderLevel
+}
+
+// StockMovement is a change to a product's stock. Quantity is negative when
+// stock goes out; StockAfter is the product's stock once it was applied.
+type StockMovement struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID  primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	ClubID     primitive.ObjectID  `json:"club_id" bson:"club_id"`
+	Type       string              `json:"type" bson:"type"` // sale, adjustment
+	Quantity   int                 `json:"quantity" bson:"quantity"`
+	StockAfter int                 `json:"stock_after" bson:"stock_after"`
+	SaleID     *primitive.ObjectID `json:"sale_id,omitempty" bson:"sale_id,omitempty"`
+	Reason     string              `json:"reason" bson:"reason"`
+	CreatedBy  *primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// RetailSale is a numbered point of sale transaction in a club shop. It is
+// paid at the till, or charged to the member's account when the payment
+// method is "account".
+type RetailSale struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Number        string              `json:"number" bson:"number"` // e.g. POS-2024-000123
+	ClubID        primitive.ObjectID  `json:"club_id" bson:"club_id"`
+	MemberID      *primitive.ObjectID `json:"member_id,omitempty" bson:"member_id,omitempty"`
+	Lines         []InvoiceLine       `json:"lines" bson:"lines"`
+	Currency      string              `json:"currency" bson:"currency"`
+	Subtotal      Money               `json:"subtotal" bson:"subtotal"`
+	TaxTotal      Money               `json:"tax_total" bson:"tax_total"`
+	Total         Money               `json:"total" bson:"total"`
+	PaymentMethod string              `json:"payment_method" bson:"payment_method"` // card, cash, bank_transfer, other, account
+	Reference     string              `json:"reference" bson:"reference"`
+	SoldBy        *primitive.ObjectID `json:"sold_by,omitempty" bson:"sold_by,omitempty"`
+	SoldAt        time.Time           `json:"sold_at" bson:"sold_at"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// Recalculate derives line amounts, tax and totals the way invoices do
+func (s *RetailSale) Recalculate() {
+	inv := Invoice{Lines: s.Lines, Currency: s.Currency}
+	inv.Recalculate()
+	s.Currency = inv.Currency
+	s.Subtotal, s.TaxTotal, s.Total = inv.Subtotal, inv.TaxTotal, inv.Total
+}
+
+// AccountCharge returns the charge that bills the sale on the member's
+// statement. Every line of a sale is taxed under the same retail rule, so
+// the charge carries the lines' prices with that rule's rate.
+func (s RetailSale) AccountCharge() AccountCharge {
+	amount := NewMoney(0, s.Currency)
+	items := make([]string, 0, len(s.Lines))
+	var rate float64
+	var inclusive bool
+	for _, line := range s.Lines {
+		amount = amount.Add(line.UnitPrice.Mul(int64(line.Quantity)))
+		items = append(items, fmt.Sprintf("%d x %s", line.Quantity, line.Description))
+		rate, inclusive = line.TaxRate, line.TaxInclusive
+	}
+
+	charge := AccountCharge{
+		ClubID:       &s.ClubID,
+		Source:       ProductTypeRetail,
+		SourceID:     s.ID,
+		Description:  "Shop " + s.Number + ": " + strings.Join(items, ", "),
+		Amount:       amount,
+		TaxRate:      rate,
+		TaxInclusive: inclusive,
+		ChargedAt:    s.SoldAt,
+	}
+	if s.MemberID != nil {
+		charge.MemberID = *s.MemberID
+	}
+	return charge
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductLowStock(t *testing.T) {
+	tests := []struct {
+		stock, reorderLevel, before int
+		low, became                 bool
+	}{
+		{stock: 5, reorderLevel: 0, before: 6},
+		{stock: 13, reorderLevel: 12, before: 14},
+		{stock: 12, reorderLevel: 12, before: 14, low: true, became: true},
+		{stock: 3, reorderLevel: 12, before: 5, low: true},
+		{stock: 0, reorderLevel: 1, before: 2, low: true, became: true},
+	}
+	for _, tt := range tests {
+		product := Product{Stock: tt.stock, ReorderLevel: tt.reorderLevel}
+		if got := product.LowStock(); got != tt.low {
+			t.Errorf("stock %d, reorder level %d: LowStock() = %v, want %v", tt.stock, tt.reorderLevel, got, tt.low)
+		}
+		if got := product.BecameLowStock(tt.before); got != tt.became {
+			t.Errorf("stock %d from %d, reorder level %d: BecameLowStock() = %v, want %v", tt.stock, tt.before, tt.reorderLevel, got, tt.became)
+		}
+	}
+}
+
+func TestRetailSaleAccountCharge(t *testing.T) {
+	memberID := primitive.NewObjectID()
+	sale := RetailSale{
+		ID:       primitive.NewObjectID(),
+		Number:   "POS-2024-000042",
+		ClubID:   primitive.NewObjectID(),
+		MemberID: &memberID,
+		Lines: []InvoiceLine{
+			{Description: "Water", ProductType: ProductTypeRetail, Quantity: 2, UnitPrice: Cents(250), TaxRate: 8, TaxInclusive: true},
+			{Description: "T-shirt", ProductType: ProductTypeRetail, Quantity: 1, UnitPrice: Cents(2500), TaxRate: 8, TaxInclusive: true},
+		},
+		SoldAt: time.Date(2024, 3, 9, 18, 30, 0, 0, time.UTC),
+	}
+	sale.Recalculate()
+	if sale.Total.Cmp(Cents(3000)) != 0 {
+		t.Fatalf("total = %v, want 30.00 with tax included", sale.Total)
+	}
+
+	charge := sale.AccountCharge()
+	if charge.Source != ProductTypeRetail || charge.SourceID != sale.ID || charge.MemberID != memberID {
+		t.Errorf("charge does not point at the sale: %+v", charge)
+	}
+	if charge.Amount.Cmp(Cents(3000)) != 0 || charge.TaxRate != 8 || !charge.TaxInclusive {
+		t.Errorf("charge = %v at %v%% inclusive %v, want 30.00 at 8%% inclusive", charge.Amount, charge.TaxRate, charge.TaxInclusive)
+	}
+	if want := "Shop POS-2024-000042: 2 x Water, 1 x T-shirt"; charge.Description != want {
+		t.Errorf("description = %q, want %q", charge.Description, want)
+	}
+	if !charge.ChargedAt.Equal(sale.SoldAt) {
+		t.Errorf("charged at %v, want the time of sale", charge.ChargedAt)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// RecognizedAmount is revenue recognized in a month, e.g. "2024-03"
+type RecognizedAmount struct {
+	Month  string `json:"month"`
+	Amount Money  `json:"amount"`
+}
+
+// RevenueMonth formats the month a time falls in
+func RevenueMonth(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// HasServicePeriod reports whether the line pays for a period of time
+func (l InvoiceLine) HasServicePeriod() bool {
+	return l.ServiceStart != nil && l.ServiceEnd != nil && l.ServiceEnd.After(*l.ServiceStart)
+}
+
+// RecognitionSchedule returns how the line's amount, excluding tax, is
+// recognized: evenly across its service period month by month, or all in
+// the month it was billed when it has none. Revenue is never recognized
+// before it is billed, so any part of the period before billedAt counts in
+// the month billed. The amounts add up to the line's amount exactly.
+func (l InvoiceLine) RecognitionSchedule(billedAt time.Time) []RecognizedAmount {
+	billedMonth := RevenueMonth(billedAt)
+	if !l.HasServicePeriod() || !l.ServiceEnd.After(billedAt) {
+		return []RecognizedAmount{{Month: billedMonth, Amount: l.Amount}}
+	}
+
+	start, end := *l.ServiceStart, *l.ServiceEnd
+	whole := int64(end.Sub(start))
+	byMonth := map[string]Money{}
+	recognized := NewMoney(0, l.Amount.Currency)
+	for from := start; from.Before(end); {
+		until := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location()).AddDate(0, 1, 0)
+		if until.After(end) {
+			until = end
+		}
+		// Rounding the running total keeps the months adding up exactly
+		through := l.Amount.Prorate(int64(until.Sub(start)), whole)
+		month := RevenueMonth(from)
+		if month < billedMonth {
+			month = billedMonth
+		}
+		byMonth[month] = byMonth[month].Add(through.Sub(recognized))
+		recognized = through
+		from = until
+	}
+	return sortedSchedule(byMonth, l.Amount.Currency)
+}
+
+// RecognitionSchedule returns how the invoice's revenue, excluding tax, is
+// recognized by month. Discounts and credits without a service period of
+// their own are spread over the rest of the invoice in proportion, so a
+// discount on a year's membership is recognized over the year.
+func (inv Invoice) RecognitionSchedule() []RecognizedAmount {
+	billedAt := inv.CreatedAt
+	if inv.IssuedAt != nil {
+		billedAt = *inv.IssuedAt
+	}
+
+	byMonth := map[string]Money{}
+	base := NewMoney(0, inv.Currency)
+	adjustments := NewMoney(0, inv.Currency)
+	for _, line := range inv.Lines {
+		if IsAdjustmentType(line.ProductType) && !line.HasServicePeriod() {
+			adjustments = adjustments.Add(line.Amount)
+			continue
+		}
+		for _, part := range line.RecognitionSchedule(billedAt) {
+			byMonth[part.Month] = byMonth[part.Month].Add(part.Amount)
+			base = base.Add(part.Amount)
+		}
+	}
+	if adjustments.IsZero() {
+		return sortedSchedule(byMonth, inv.Currency)
+	}
+	if !base.IsPositive() {
+		byMonth[RevenueMonth(billedAt)] = byMonth[RevenueMonth(billedAt)].Add(adjustments)
+		return sortedSchedule(byMonth, inv.Currency)
+	}
+
+	schedule := sortedSchedule(byMonth, inv.Currency)
+	cumulative, allocated := NewMoney(0, inv.Currency), NewMoney(0, inv.Currency)
+	for i := range schedule {
+		cumulative = cumulative.Add(schedule[i].Amount)
+		through := adjustments.Prorate(cumulative.Amount, base.Amount)
+		schedule[i].Amount = schedule[i].Amount.Add(through.Sub(allocated))
+		allocated = through
+	}
+	return schedule
+}
+
+// ReduceSchedule takes a credit, excluding tax, off a recognition schedule
+// in the month it was given. It comes out of revenue not yet recognized
+// first, in proportion across the later months, and anything more out of
+// the month itself.
+func ReduceSchedule(schedule []RecognizedAmount, month string, credit Money) []RecognizedAmount {
+	byMonth := map[string]Money{}
+	later := NewMoney(0, credit.Currency)
+	for _, part := range schedule {
+		byMonth[part.Month] = byMonth[part.Month].Add(part.Amount)
+		if part.Month > month {
+			later = later.Add(part.Amount)
+		}
+	}
+
+	deferred := credit
+	if later.Cmp(credit) < 0 {
+		deferred = later
+	}
+	if later.IsPositive() && deferred.IsPositive() {
+		cumulative, taken := NewMoney(0, credit.Currency), NewMoney(0, credit.Currency)
+		for _, part := range schedule {
+			if part.Month <= month {
+				continue
+			}
+			cumulative = cumulative.Add(part.Amount)
+			through := deferred.Prorate(cumulative.Amount, later.Amount)
+			byMonth[part.Month] = byMonth[part.Month].Sub(through.Sub(taken))
+			taken = through
+		}
+	} else {
+		deferred = NewMoney(0, credit.Currency)
+	}
+	byMonth[month] = byMonth[month].Sub(credit.Sub(deferred))
+	return sortedSchedule(byMonth, credit.Currency)
+}
+
+func sortedSchedule(byMonth map[string]Money, currency string) []RecognizedAmount {
+	schedule := make([]RecognizedAmount, 0, len(byMonth))
+	for month, amount := range byMonth {
+		if amount.Currency == "" {
+			amount.Currency = currency
+		}
+		schedule = append(schedule, RecognizedAmount{Month: month, Amount: amount})
+	}
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i].Month < schedule[j].Month })
+	return schedule
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func scheduleTotal(schedule []RecognizedAmount) int64 {
+	var total int64
+	for _, part := range schedule {
+		total += part.Amount.Amount
+	}
+	return total
+}
+
+func servicePeriod(start, end time.Time) (*time.Time, *time.Time) {
+	return &start, &end
+}
+
+func TestLineRecognitionScheduleAnnual(t *testing.T) {
+	billed := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	line := InvoiceLine{ProductType: ProductTypeMembership, Amount: Cents(12000)}
+	line.ServiceStart, line.ServiceEnd = servicePeriod(billed, billed.AddDate(1, 0, 0))
+
+	schedule := line.RecognitionSchedule(billed)
+	if len(schedule) != 12 {
+		t.Fatalf("got %d months, want 12", len(schedule))
+	}
+	if schedule[0].Month != "2024-01" || schedule[11].Month != "2024-12" {
+		t.Errorf("months run %s to %s, want 2024-01 to 2024-12", schedule[0].Month, schedule[11].Month)
+	}
+	// January is 31 of 366 days, February 29
+	if schedule[0].Amount.Amount != 1016 || schedule[1].Amount.Amount != 951 {
+		t.Errorf("January, February = %d, %d, want 1016, 951", schedule[0].Amount.Amount, schedule[1].Amount.Amount)
+	}
+	if total := scheduleTotal(schedule); total != 12000 {
+		t.Errorf("schedule adds up to %d, want 12000", total)
+	}
+}
+
+func TestLineRecognitionScheduleWithoutPeriod(t *testing.T) {
+	billed := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+	schedule := InvoiceLine{Amount: Cents(2500)}.RecognitionSchedule(billed)
+	if len(schedule) != 1 || schedule[0].Month != "2024-03" || schedule[0].Amount.Amount != 2500 {
+		t.Errorf("schedule = %+v, want 25.00 in 2024-03", schedule)
+	}
+}
+
+func TestLineRecognitionScheduleBilledLate(t *testing.T) {
+	line := InvoiceLine{Amount: Cents(9200)}
+	line.ServiceStart, line.ServiceEnd = servicePeriod(
+		time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+	// March is recognized when the line is billed in April
+	schedule := line.RecognitionSchedule(time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC))
+	if len(schedule) != 2 || schedule[0].Month != "2024-04" || schedule[1].Month != "2024-05" {
+		t.Fatalf("schedule = %+v, want April and May", schedule)
+	}
+	if schedule[0].Amount.Amount != 6100 || schedule[1].Amount.Amount != 3100 {
+		t.Errorf("April, May = %d, %d, want 6100, 3100", schedule[0].Amount.Amount, schedule[1].Amount.Amount)
+	}
+}
+
+func TestInvoiceRecognitionScheduleSpreadsDiscounts(t *testing.T) {
+	issued := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	membership := InvoiceLine{ProductType: ProductTypeMembership, Quantity: 1, UnitPrice: Cents(12000)}
+	membership.ServiceStart, membership.ServiceEnd = servicePeriod(issued, issued.AddDate(1, 0, 0))
+	invoice := Invoice{
+		IssuedAt: &issued,
+		Lines: []InvoiceLine{
+			membership,
+			{ProductType: ProductTypeDiscount, Quantity: 1, UnitPrice: Cents(-1200)},
+		},
+	}
+	invoice.Recalculate()
+
+	schedule := invoice.RecognitionSchedule()
+	if len(schedule) != 12 {
+		t.Fatalf("got %d months, want 12", len(schedule))
+	}
+	if total := scheduleTotal(schedule); total != 10800 {
+		t.Errorf("schedule adds up to %d, want 10800", total)
+	}
+	if schedule[0].Amount.Amount != 914 {
+		t.Errorf("January = %d, want 914", schedule[0].Amount.Amount)
+	}
+}
+
+func TestReduceSchedule(t *testing.T) {
+	schedule := []RecognizedAmount{
+		{Month: "2024-01", Amount: Cents(1000)},
+		{Month: "2024-02", Amount: Cents(1000)},
+		{Month: "2024-03", Amount: Cents(1000)},
+	}
+	tests := []struct {
+		credit int64
+		want   []int64
+	}{
+		{credit: 1500, want: []int64{1000, 250, 250}},
+		{credit: 2500, want: []int64{500, 0, 0}},
+	}
+	for _, tt := range tests {
+		got := ReduceSchedule(schedule, "2024-01", Cents(tt.credit))
+		if len(got) != len(tt.want) {
+			t.Fatalf("credit %d: schedule = %+v", tt.credit, got)
+		}
+		for i, amount := range tt.want {
+			if got[i].Amount.Amount != amount {
+				t.Errorf("credit %d: %s = %d, want %d", tt.credit, got[i].Month, got[i].Amount.Amount, amount)
+			}
+		}
+	}
+
+	// A credit after the last month comes out of that month
+	got := ReduceSchedule(schedule, "2024-05", Cents(400))
+	if len(got) != 4 || got[3].Month != "2024-05" || got[3].Amount.Amount != -400 {
+		t.Errorf("late credit: schedule = %+v", got)
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRule sets the tax on one product type. A rule belongs to a club, to
+// every club in a state, or, with neither set, to every club. The most
+// specific active rule wins: club, then state, then the default.
+type TaxRule struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ClubID      *primitive.ObjectID `json:"club_id,omitempty" bson:"club_id,omitempty"`
+	State       string              `json:"state,omitempty" bson:"state,omitempty"`
+	ProductType string              `json:"product_type" bson:"product_type"` // membership, class_pack, office_booking, restaurant, retail, other
+	Name        string              `json:"name" bson:"name"`                 // e.g. "NY sales tax"
+	Rate        float64             `json:"rate" bson:"rate"`                 // percent
+	Inclusive   bool                `json:"inclusive" bson:"inclusive"`       // prices include the tax
+	Active      bool                `json:"active" bson:"active"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// ResolveTaxRule returns the rule for a product type at a club in a state,
+// or nil when no rule applies
+func ResolveTaxRule(rules []TaxRule, clubID *primitive.ObjectID, state, productType string) *TaxRule {
+	var byState, byDefault *TaxRule
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Active || rule.ProductType != productType {
+			continue
+		}
+		switch {
+		case rule.ClubID != nil:
+			if clubID != nil && *rule.ClubID == *clubID {
+				return rule
+			}
+		case rule.State != "":
+			if rule.State == state {
+				byState = rule
+			}
+		default:
+			byDefault = rule
+		}
+	}
+	if byState != nil {
+		return byState
+	}
+	return byDefault
+}
+
+// Tax splits a price into its net amount and tax under the rule. A price
+// that includes tax has the tax taken out; otherwise it is added on top.
+func (r TaxRule) Tax(price Money) (net, tax Money) {
+	if r.Inclusive {
+		tax = price.IncludedPercent(r.Rate)
+		return price.Sub(tax), tax
+	}
+	return price, price.Percent(r.Rate)
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResolveTaxRule(t *testing.T) {
+	clubID := primitive.NewObjectID()
+	otherClub := primitive.NewObjectID()
+	rules := []TaxRule{
+		{Name: "default", ProductType: ProductTypeMembership, Rate: 5, Active: true},
+		{Name: "state", State: "NY", ProductType: ProductTypeMembership, Rate: 8.875, Active: true},
+		{Name: "club", ClubID: &clubID, ProductType: ProductTypeMembership, Rate: 10, Active: true},
+		{Name: "inactive", ClubID: &otherClub, ProductType: ProductTypeMembership, Rate: 20, Active: false},
+		{Name: "booking", ProductType: ProductTypeOfficeBooking, Rate: 20, Inclusive: true, Active: true},
+	}
+
+	tests := []struct {
+		name        string
+		clubID      *primitive.ObjectID
+		state       string
+		productType string
+		want        string
+	}{
+		{"club rule wins", &clubID, "NY", ProductTypeMembership, "club"},
+		{"state rule", &otherClub, "NY", ProductTypeMembership, "state"},
+		{"default rule", &otherClub, "NJ", ProductTypeMembership, "default"},
+		{"no club", nil, "", ProductTypeMembership, "default"},
+		{"other product type", &clubID, "NY", ProductTypeOfficeBooking, "booking"},
+		{"no rule", &clubID, "NY", ProductTypeRestaurant, ""},
+	}
+	for _, tt := range tests {
+		rule := ResolveTaxRule(rules, tt.clubID, tt.state, tt.productType)
+		got := ""
+		if rule != nil {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s: got rule %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTaxInclusivePricing(t *testing.T) {
+	invoice := Invoice{
+		Lines: []InvoiceLine{
+			{Description: "Day pass", ProductType: ProductTypeOther, Quantity: 2, UnitPrice: Cents(1100), TaxRate: 10, TaxInclusive: true},
+			{Description: "Discount", ProductType: ProductTypeDiscount, UnitPrice: Cents(-550), TaxRate: 10, TaxInclusive: true},
+		},
+	}
+	invoice.Recalculate()
+
+	if invoice.Lines[0].Amount != Cents(2000) || invoice.Lines[0].TaxAmount != Cents(200) {
+		t.Errorf("line amount/tax = %v/%v, want 20.00/2.00", invoice.Lines[0].Amount, invoice.Lines[0].TaxAmount)
+	}
+	if invoice.Lines[1].Amount != Cents(-500) || invoice.Lines[1].TaxAmount != Cents(-50) {
+		t.Errorf("discount amount/tax = %v/%v, want -5.00/-0.50", invoice.Lines[1].Amount, invoice.Lines[1].TaxAmount)
+	}
+	if invoice.Total != Cents(1650) {
+		t.Errorf("total = %v, want 16.50 (prices as entered)", invoice.Total)
+	}
+
+	booking := OfficeBooking{TotalCost: Cents(12000)}
+	booking.ApplyTax(&TaxRule{Rate: 20, Inclusive: true})
+	if booking.TaxAmount != Cents(2000) || booking.TotalWithTax != Cents(12000) {
+		t.Errorf("inclusive booking tax/total = %v/%v, want 20.00/120.00", booking.TaxAmount, booking.TotalWithTax)
+	}
+	booking.ApplyTax(&TaxRule{Rate: 20})
+	if booking.TaxAmount != Cents(2400) || booking.TotalWithTax != Cents(14400) {
+		t.Errorf("exclusive booking tax/total = %v/%v, want 24.00/144.00", booking.TaxAmount, booking.TotalWithTax)
+	}
+	booking.ApplyTax(nil)
+	if booking.TaxRate != 0 || !booking.TaxAmount.IsZero() || booking.TotalWithTax != Cents(12000) {
+		t.Errorf("untaxed booking = %+v", booking)
+	}
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Message is a notification to one recipient
+type Message struct {
+	To      string // email address
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notifications to members and staff
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes notifications to a log instead of sending them. It is
+// used until an email provider is configured.
+type LogNotifier struct {
+	logger *log.Logger
+}
+
+// NewLogNotifier creates a LogNotifier writing to logger
+func NewLogNotifier(logger *log.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify logs the message
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.logger.Printf("notify: to=%s subject=%q body=%q", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+var _ Notifier = (*LogNotifier)(nil)
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := NewLogNotifier(log.New(&buf, "", 0))
+
+	err := notifier.Notify(context.Background(), Message{To: "jane@example.com", Subject: "Payment failed", Body: "Please update your card."})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"jane@example.com", `"Payment failed"`, "update your card"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain %q, got %q", want, out)
+		}
+	}
+}
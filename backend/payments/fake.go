@@ -0,0 +1,246 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Test card numbers understood by FakeProvider. Any other card number that
+// passes the Luhn check succeeds.
+const (
+	TestCardSuccess           = "4242424242424242"
+	TestCardDeclined          = "4000000000000002"
+	TestCardInsufficientFunds = "4000000000009995"
+	TestCardPending           = "4000000000003220" // settled later by a webhook
+)
+
+// fake outcomes, encoded in the card token so saved cards survive restarts
+const (
+	fakeOutcomeSucceed      = "ok"
+	fakeOutcomeDecline      = "declined"
+	fakeOutcomeInsufficient = "nsf"
+	fakeOutcomePending      = "pending"
+)
+
+const fakeTokenPrefix = "fake_card_"
+
+// FakeProvider is a fully local Provider for development and tests. It never
+// contacts a network; outcomes are determined by the test card numbers.
+type FakeProvider struct {
+	webhookSecret string
+	now           func() time.Time
+
+	mu      sync.Mutex
+	charges map[string]*Charge // by idempotency key
+}
+
+// NewFakeProvider creates a FakeProvider that signs and verifies webhooks
+// with the given secret
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		webhookSecret: webhookSecret,
+		now:           time.Now,
+		charges:       make(map[string]*Charge),
+	}
+}
+
+// Name identifies the provider on stored payments and cards
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// SaveCard validates the card and returns a token for it
+func (p *FakeProvider) SaveCard(ctx context.Context, card CardDetails) (*Card, error) {
+	number := strings.ReplaceAll(strings.ReplaceAll(card.Number, " ", ""), "-", "")
+	if len(number) < 12 || len(number) > 19 || !luhnValid(number) {
+		return nil, fmt.Errorf("%w: card number", ErrInvalidCard)
+	}
+	if card.ExpMonth < 1 || card.ExpMonth > 12 {
+		return nil, fmt.Errorf("%w: expiry month", ErrInvalidCard)
+	}
+	now := p.now()
+	if card.ExpYear < now.Year() || (card.ExpYear == now.Year() && card.ExpMonth < int(now.Month())) {
+		return nil, fmt.Errorf("%w: card has expired", ErrInvalidCard)
+	}
+	if len(card.CVC) < 3 || len(card.CVC) > 4 {
+		return nil, fmt.Errorf("%w: cvc", ErrInvalidCard)
+	}
+
+	outcome := fakeOutcomeSucceed
+	switch number {
+	case TestCardDeclined:
+		outcome = fakeOutcomeDecline
+	case TestCardInsufficientFunds:
+		outcome = fakeOutcomeInsufficient
+	case TestCardPending:
+		outcome = fakeOutcomePending
+	}
+
+	last4 := number[len(number)-4:]
+	return &Card{
+		Token:    fakeTokenPrefix + outcome + "_" + last4,
+		Brand:    cardBrand(number),
+		Last4:    last4,
+		ExpMonth: card.ExpMonth,
+		ExpYear:  card.ExpYear,
+	}, nil
+}
+
+// Charge charges a card token saved by SaveCard
+func (p *FakeProvider) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("charge amount must be positive")
+	}
+	outcome, ok := fakeTokenOutcome(req.CardToken)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown card token", ErrInvalidCard)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.IdempotencyKey != "" {
+		if previous, ok := p.charges[req.IdempotencyKey]; ok {
+			copied := *previous
+			return &copied, nil
+		}
+	}
+
+	charge := &Charge{
+		ID:        "fake_ch_" + randomHex(12),
+		Status:    ChargeSucceeded,
+		Amount:    req.Amount,
+		CreatedAt: p.now(),
+	}
+	switch outcome {
+	case fakeOutcomeDecline:
+		charge.Status = ChargeFailed
+		charge.FailureCode = "card_declined"
+		charge.FailureMessage = "Your card was declined."
+	case fakeOutcomeInsufficient:
+		charge.Status = ChargeFailed
+		charge.FailureCode = "insufficient_funds"
+		charge.FailureMessage = "Your card has insufficient funds."
+	case fakeOutcomePending:
+		charge.Status = ChargePending
+	}
+
+	if req.IdempotencyKey != "" {
+		p.charges[req.IdempotencyKey] = charge
+	}
+	copied := *charge
+	return &copied, nil
+}
+
+// Refund refunds a charge made by this provider. Tracking how much of a
+// charge has already been refunded is left to the caller.
+func (p *FakeProvider) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	if !strings.HasPrefix(req.ChargeID, "fake_ch_") {
+		return nil, ErrChargeNotFound
+	}
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("refund amount must be positive")
+	}
+	return &Refund{
+		ID:        "fake_re_" + randomHex(12),
+		ChargeID:  req.ChargeID,
+		Amount:    req.Amount,
+		Status:    ChargeSucceeded,
+		CreatedAt: p.now(),
+	}, nil
+}
+
+// ParseWebhook verifies the signature and decodes the event
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	if err := VerifySignature(p.webhookSecret, payload, signature, p.now()); err != nil {
+		return nil, err
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ID == "" || event.Type == "" || event.ChargeID == "" {
+		return nil, errors.New("invalid webhook payload: id, type and charge_id are required")
+	}
+	return &event, nil
+}
+
+// SignedEvent builds a signed webhook for a charge, as the provider would
+// send it, so settlement can be exercised locally
+func (p *FakeProvider) SignedEvent(eventType string, charge *Charge) (payload []byte, signature string, err error) {
+	event := Event{
+		ID:        "fake_evt_" + randomHex(12),
+		Type:      eventType,
+		ChargeID:  charge.ID,
+		Amount:    charge.Amount,
+		CreatedAt: p.now(),
+	}
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, SignPayload(p.webhookSecret, payload, p.now()), nil
+}
+
+func fakeTokenOutcome(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, fakeTokenPrefix)
+	if !ok {
+		return "", false
+	}
+	outcome, _, ok := strings.Cut(rest, "_")
+	switch outcome {
+	case fakeOutcomeSucceed, fakeOutcomeDecline, fakeOutcomeInsufficient, fakeOutcomePending:
+		return outcome, ok
+	}
+	return "", false
+}
+
+// luhnValid reports whether a string of digits passes the Luhn checksum
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func cardBrand(number string) string {
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "visa"
+	case number[0] == '5' && number[1] >= '1' && number[1] <= '5':
+		return "mastercard"
+	case strings.HasPrefix(number, "34"), strings.HasPrefix(number, "37"):
+		return "amex"
+	}
+	return "card"
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+var _ Provider = (*FakeProvider)(nil)
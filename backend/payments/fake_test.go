@@ -0,0 +1,114 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-api-mongo/models"
+)
+
+func TestFakeProviderCharge(t *testing.T) {
+	provider := NewFakeProvider("whsec_test")
+	ctx := context.Background()
+
+	tests := []struct {
+		number      string
+		wantStatus  string
+		wantFailure string
+	}{
+		{TestCardSuccess, ChargeSucceeded, ""},
+		{"5555 5555 5555 4444", ChargeSucceeded, ""},
+		{TestCardDeclined, ChargeFailed, "card_declined"},
+		{TestCardInsufficientFunds, ChargeFailed, "insufficient_funds"},
+		{TestCardPending, ChargePending, ""},
+	}
+
+	for _, tt := range tests {
+		card, err := provider.SaveCard(ctx, CardDetails{Number: tt.number, ExpMonth: 12, ExpYear: time.Now().Year() + 1, CVC: "123"})
+		if err != nil {
+			t.Fatalf("SaveCard(%s) failed: %v", tt.number, err)
+		}
+		charge, err := provider.Charge(ctx, ChargeRequest{Amount: models.Cents(4999), CardToken: card.Token})
+		if err != nil {
+			t.Fatalf("Charge(%s) failed: %v", tt.number, err)
+		}
+		if charge.Status != tt.wantStatus || charge.FailureCode != tt.wantFailure {
+			t.Errorf("Charge(%s) = %s/%s, want %s/%s", tt.number, charge.Status, charge.FailureCode, tt.wantStatus, tt.wantFailure)
+		}
+	}
+}
+
+func TestFakeProviderSaveCardValidation(t *testing.T) {
+	provider := NewFakeProvider("whsec_test")
+	nextYear := time.Now().Year() + 1
+
+	invalid := []CardDetails{
+		{Number: "4242424242424241", ExpMonth: 12, ExpYear: nextYear, CVC: "123"}, // fails Luhn
+		{Number: TestCardSuccess, ExpMonth: 13, ExpYear: nextYear, CVC: "123"},
+		{Number: TestCardSuccess, ExpMonth: 1, ExpYear: 2020, CVC: "123"},
+		{Number: TestCardSuccess, ExpMonth: 12, ExpYear: nextYear, CVC: "1"},
+	}
+	for _, card := range invalid {
+		if _, err := provider.SaveCard(context.Background(), card); !errors.Is(err, ErrInvalidCard) {
+			t.Errorf("SaveCard(%+v) error = %v, want ErrInvalidCard", card, err)
+		}
+	}
+
+	card, err := provider.SaveCard(context.Background(), CardDetails{Number: TestCardSuccess, ExpMonth: 12, ExpYear: nextYear, CVC: "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Brand != "visa" || card.Last4 != "4242" {
+		t.Errorf("card = %s/%s, want visa/4242", card.Brand, card.Last4)
+	}
+}
+
+func TestFakeProviderIdempotentCharge(t *testing.T) {
+	provider := NewFakeProvider("whsec_test")
+	ctx := context.Background()
+	card, _ := provider.SaveCard(ctx, CardDetails{Number: TestCardSuccess, ExpMonth: 12, ExpYear: time.Now().Year() + 1, CVC: "123"})
+
+	req := ChargeRequest{Amount: models.Cents(1000), CardToken: card.Token, IdempotencyKey: "invoice-1"}
+	first, _ := provider.Charge(ctx, req)
+	second, _ := provider.Charge(ctx, req)
+	if first.ID != second.ID {
+		t.Errorf("retried charge got a new ID: %s != %s", first.ID, second.ID)
+	}
+
+	if _, err := provider.Charge(ctx, ChargeRequest{Amount: models.Cents(1000), CardToken: "tok_unknown"}); !errors.Is(err, ErrInvalidCard) {
+		t.Errorf("unknown token error = %v, want ErrInvalidCard", err)
+	}
+}
+
+func TestFakeProviderWebhook(t *testing.T) {
+	provider := NewFakeProvider("whsec_test")
+	charge := &Charge{ID: "fake_ch_123", Amount: models.Cents(2500)}
+
+	payload, signature, err := provider.SignedEvent(EventChargeSucceeded, charge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := provider.ParseWebhook(payload, signature)
+	if err != nil {
+		t.Fatalf("ParseWebhook failed: %v", err)
+	}
+	if event.Type != EventChargeSucceeded || event.ChargeID != "fake_ch_123" || event.Amount != models.Cents(2500) {
+		t.Errorf("event = %+v", event)
+	}
+
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-2] ^= 1
+	if _, err := provider.ParseWebhook(tampered, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered payload error = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := NewFakeProvider("other_secret").ParseWebhook(payload, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret error = %v, want ErrInvalidSignature", err)
+	}
+
+	stale := SignPayload("whsec_test", payload, time.Now().Add(-time.Hour))
+	if _, err := provider.ParseWebhook(payload, stale); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("stale signature error = %v, want ErrInvalidSignature", err)
+	}
+}
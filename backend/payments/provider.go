@@ -0,0 +1,109 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-api-mongo/models"
+)
+
+// ErrInvalidCard is returned when card details fail validation
+var ErrInvalidCard = errors.New("invalid card details")
+
+// ErrChargeNotFound is returned when refunding a charge the provider does not know
+var ErrChargeNotFound = errors.New("charge not found")
+
+// ErrInvalidSignature is returned when a webhook signature is missing, wrong or stale
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Charge statuses. A pending charge is settled later through a webhook.
+const (
+	ChargeSucceeded = "succeeded"
+	ChargePending   = "pending"
+	ChargeFailed    = "failed"
+)
+
+// Webhook event types
+const (
+	EventChargeSucceeded = "charge.succeeded"
+	EventChargeFailed    = "charge.failed"
+	EventChargeRefunded  = "charge.refunded"
+)
+
+// Provider is a payment processor. Card numbers are only ever passed to
+// SaveCard; everything else works with the provider's card token.
+//
+// A declined charge is not an error: Charge returns it with status failed
+// and a failure code. Errors are reserved for requests the provider could
+// not process at all.
+type Provider interface {
+	Name() string
+	Charge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+	SaveCard(ctx context.Context, card CardDetails) (*Card, error)
+	ParseWebhook(payload []byte, signature string) (*Event, error)
+}
+
+// ChargeRequest charges a saved card. IdempotencyKey makes retries of the
+// same request return the original charge instead of charging twice.
+type ChargeRequest struct {
+	Amount         models.Money
+	CardToken      string
+	Description    string
+	IdempotencyKey string
+	Metadata       map[string]string
+}
+
+// Charge is the provider's record of a charge attempt
+type Charge struct {
+	ID             string
+	Status         string // succeeded, pending, failed
+	Amount         models.Money
+	FailureCode    string // e.g. card_declined, insufficient_funds
+	FailureMessage string
+	CreatedAt      time.Time
+}
+
+// RefundRequest refunds all or part of a charge
+type RefundRequest struct {
+	ChargeID string
+	Amount   models.Money
+	Reason   string
+}
+
+// Refund is the provider's record of a refund
+type Refund struct {
+	ID        string
+	ChargeID  string
+	Amount    models.Money
+	Status    string
+	CreatedAt time.Time
+}
+
+// CardDetails are raw card details as entered by the member
+type CardDetails struct {
+	Number   string
+	ExpMonth int
+	ExpYear  int
+	CVC      string
+}
+
+// Card is a saved card; Token is what later charges use
+type Card struct {
+	Token    string
+	Brand    string
+	Last4    string
+	ExpMonth int
+	ExpYear  int
+}
+
+// Event is a verified webhook notification about a charge
+type Event struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	ChargeID  string            `json:"charge_id"`
+	Amount    models.Money      `json:"amount"` // for charge.refunded, the total refunded so far
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
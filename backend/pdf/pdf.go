@@ -0,0 +1,283 @@
+// Package pdf is a small, dependency free PDF writer for text documents such
+// as signed waivers, invoices and receipts. Output is deterministic: the same
+// calls always produce the same bytes, which keeps rendered documents hashable
+// and testable.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// US Letter page size in points
+const (
+	PageWidth  = 612.0
+	PageHeight = 792.0
+)
+
+// Font selects one of the built-in Helvetica faces
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+)
+
+func (f Font) resource() string {
+	if f == Bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Document is an in-memory PDF made of text pages
+type Document struct {
+	title string
+	pages []*Page
+}
+
+// Page holds the content stream for a single page. Coordinates passed to
+// drawing methods are measured from the top-left corner of the page.
+type Page struct {
+	content bytes.Buffer
+}
+
+// New creates an empty document with the given title in its metadata
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage appends a blank page and returns it
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Text draws s with its baseline at (x, y)
+func (p *Page) Text(x, y, size float64, font Font, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font.resource(), num(size), num(x), num(PageHeight-y), escape(s))
+}
+
+// TextRight draws s so that it ends at x, for right aligned columns
+func (p *Page) TextRight(x, y, size float64, font Font, s string) {
+	p.Text(x-TextWidth(s, size), y, size, font, s)
+}
+
+// Line draws a thin horizontal or vertical rule
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %s %s m %s %s l S\n",
+		num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// TextWidth estimates the rendered width of s. Helvetica glyphs average a
+// little over half an em; the estimate errs wide so wrapped text never
+// overflows its column.
+func TextWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.556
+}
+
+// Wrap splits s into lines no wider than width, honouring explicit newlines
+func Wrap(s string, size, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		words := strings.Fields(para)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := words[0]
+		for _, word := range words[1:] {
+			if TextWidth(line+" "+word, size) > width {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Flow lays text out from top to bottom, starting new pages as needed
+type Flow struct {
+	doc    *Document
+	page   *Page
+	margin float64
+	y      float64
+}
+
+// NewFlow starts a flow on a new page with equal margins on every side
+func (d *Document) NewFlow(margin float64) *Flow {
+	f := &Flow{doc: d, margin: margin}
+	f.newPage()
+	return f
+}
+
+func (f *Flow) newPage() {
+	f.page = f.doc.AddPage()
+	f.y = f.margin
+}
+
+func (f *Flow) ensure(height float64) {
+	if f.y+height > PageHeight-f.margin {
+		f.newPage()
+	}
+}
+
+// Paragraph writes wrapped text followed by a small gap
+func (f *Flow) Paragraph(s string, size float64, font Font) {
+	leading := size * 1.4
+	for _, line := range Wrap(s, size, PageWidth-2*f.margin) {
+		f.ensure(leading)
+		f.y += leading
+		f.page.Text(f.margin, f.y, size, font, line)
+	}
+	f.y += size * 0.6
+}
+
+// Cell is one column of a Row. X is measured from the left margin; a right
+// aligned cell ends at X. Text in a cell with a Width wraps within it.
+type Cell struct {
+	X     float64
+	Text  string
+	Right bool
+	Width float64
+}
+
+// Row writes cells side by side, as one line of a table. The row is as tall
+// as its longest wrapped cell and is never split across pages.
+func (f *Flow) Row(size float64, font Font, cells ...Cell) {
+	leading := size * 1.4
+	lines := make([][]string, len(cells))
+	height := 1
+	for i, cell := range cells {
+		lines[i] = []string{cell.Text}
+		if cell.Width > 0 {
+			lines[i] = Wrap(cell.Text, size, cell.Width)
+		}
+		if len(lines[i]) > height {
+			height = len(lines[i])
+		}
+	}
+
+	f.ensure(leading * float64(height))
+	for n := 0; n < height; n++ {
+		f.y += leading
+		for i, cell := range cells {
+			if n >= len(lines[i]) {
+				continue
+			}
+			if cell.Right {
+				f.page.TextRight(f.margin+cell.X, f.y, size, font, lines[i][n])
+			} else {
+				f.page.Text(f.margin+cell.X, f.y, size, font, lines[i][n])
+			}
+		}
+	}
+	f.y += size * 0.4
+}
+
+// Width returns the width between the margins
+func (f *Flow) Width() float64 {
+	return PageWidth - 2*f.margin
+}
+
+// Gap advances the cursor by h points
+func (f *Flow) Gap(h float64) {
+	f.y += h
+}
+
+// Rule draws a full width line at the cursor
+func (f *Flow) Rule() {
+	f.ensure(8)
+	f.y += 4
+	f.page.Line(f.margin, f.y, PageWidth-f.margin, f.y)
+	f.y += 4
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo renders the document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// Object layout: 1 catalog, 2 page tree, 3-4 fonts, 5 info,
+	// then a page object and a content stream object per page
+	var objects []string
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (go-api-mongo) >>", escape(d.title)),
+	)
+	for i, p := range d.pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				num(PageWidth), num(PageHeight), 7+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// num formats a coordinate without trailing zeros
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// escape encodes s as the body of a PDF literal string in WinAnsi encoding.
+// Characters outside Latin-1 are replaced with '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDocumentBytes(t *testing.T) {
+	render := func() []byte {
+		doc := New("Liability Waiver")
+		flow := doc.NewFlow(54)
+		flow.Paragraph("Liability Waiver (v2)", 16, Bold)
+		flow.Paragraph(strings.Repeat("I accept the risks of exercise. ", 400), 10, Regular)
+		return doc.Bytes()
+	}
+
+	first := render()
+	if !bytes.HasPrefix(first, []byte("%PDF-1.4")) {
+		t.Error("Expected PDF header")
+	}
+	if !bytes.HasSuffix(first, []byte("%%EOF\n")) {
+		t.Error("Expected PDF trailer")
+	}
+	if !bytes.Contains(first, []byte(`Liability Waiver \(v2\)`)) {
+		t.Error("Expected parentheses to be escaped")
+	}
+	if bytes.Contains(first, []byte("/Count 1 ")) {
+		t.Error("Expected long text to flow onto more pages")
+	}
+	if !bytes.Equal(first, render()) {
+		t.Error("Expected identical output for identical input")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	lines := Wrap("one two three four five six", 10, TextWidth("one two three", 10))
+	if len(lines) != 2 || lines[0] != "one two three" {
+		t.Errorf("Unexpected wrap result: %q", lines)
+	}
+	if got := Wrap("a\n\nb", 10, 100); len(got) != 3 {
+		t.Errorf("Expected blank lines to be preserved, got %q", got)
+	}
+}
+
+func TestRow(t *testing.T) {
+	doc := New("Invoice")
+	flow := doc.NewFlow(54)
+	flow.Row(10, Bold, Cell{X: 0, Text: "Description"}, Cell{X: flow.Width(), Text: "Amount", Right: true})
+	flow.Row(10, Regular, Cell{X: 0, Text: strings.Repeat("long ", 20), Width: 100}, Cell{X: flow.Width(), Text: "12.50 USD", Right: true})
+	out := doc.Bytes()
+
+	if got := bytes.Count(out, []byte(" Tj ET")); got < 5 {
+		t.Errorf("Expected the long cell to wrap over several lines, got %d text runs", got)
+	}
+	if !bytes.Contains(out, []byte("(12.50 USD) Tj")) {
+		t.Error("Expected the amount cell")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api-mongo/database"
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyBillingEntry is an element of the old members.billing_history array
+type legacyBillingEntry struct {
+	Date        time.Time    `bson:"date"`
+	Amount      models.Money `bson:"amount"` // legacy doubles decode as major units
+	Description string       `bson:"description"`
+	Status      string       `bson:"status"` // paid, pending, failed, refunded
+}
+
+// Moves the billing_history array embedded in each member into the invoices
+// and payments collections, one invoice per entry:
+//
+//	paid     → paid invoice with a succeeded payment
+//	pending  → open invoice
+//	failed   → open invoice with a failed payment
+//	refunded → void invoice with a refunded payment
+//
+// Each invoice remembers the entry it came from, so the script can be re-run
+// safely. billing_history is removed from a member once all of its entries
+// have been migrated.
+func main() {
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer db.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	mongoDB := db.Client.Database(db.DatabaseName)
+	members := mongoDB.Collection("members")
+
+	cursor, err := members.Find(ctx, bson.M{"billing_history.0": bson.M{"$exists": true}})
+	if err != nil {
+		log.Fatal("Failed to read members:", err)
+	}
+	defer cursor.Close(ctx)
+
+	migratedMembers, created := 0, 0
+	for cursor.Next(ctx) {
+		var member struct {
+			ID             primitive.ObjectID   `bson:"_id"`
+			ClubIDs        []primitive.ObjectID `bson:"club_ids"`
+			BillingHistory []legacyBillingEntry `bson:"billing_history"`
+		}
+		if err := cursor.Decode(&member); err != nil {
+			log.Fatal("Failed to decode member:", err)
+		}
+
+		var clubID *primitive.ObjectID
+		if len(member.ClubIDs) > 0 {
+			clubID = &member.ClubIDs[0]
+		}
+
+		for i, entry := range member.BillingHistory {
+			ref := fmt.Sprintf("billing_history:%s:%d", member.ID.Hex(), i)
+			ok, err := migrateEntry(ctx, mongoDB, member.ID, clubID, entry, ref)
+			if err != nil {
+				log.Fatalf("Failed to migrate %s: %v", ref, err)
+			}
+			if ok {
+				created++
+			}
+		}
+
+		if _, err := members.UpdateOne(ctx, bson.M{"_id": member.ID}, bson.M{
+			"$unset": bson.M{"billing_history": ""},
+		}); err != nil {
+			log.Fatalf("Failed to clear billing history for %s: %v", member.ID.Hex(), err)
+		}
+		migratedMembers++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal("Failed to read members:", err)
+	}
+
+	fmt.Printf("✓ Created %d invoices for %d members\n", created, migratedMembers)
+	fmt.Println("✅ Billing history migration complete")
+}
+
+// migrateEntry creates the invoice and payment for one billing entry. It
+// returns false if the entry was migrated by an earlier run.
+func migrateEntry(ctx context.Context, db *mongo.Database, memberID primitive.ObjectID, clubID *primitive.ObjectID, entry legacyBillingEntry, ref string) (bool, error) {
+	invoices := db.Collection("invoices")
+	count, err := invoices.CountDocuments(ctx, bson.M{"source_ref": ref})
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	number, err := nextInvoiceNumber(ctx, db, entry.Date)
+	if err != nil {
+		return false, err
+	}
+
+	issuedAt := entry.Date
+	invoice := models.Invoice{
+		Number:   number,
+		MemberID: &memberID,
+		ClubID:   clubID,
+		Status:   models.InvoiceStatusOpen,
+		Lines: []models.InvoiceLine{{
+			Description: entry.Description,
+			ProductType: models.ProductTypeMembership,
+			Quantity:    1,
+			UnitPrice:   entry.Amount,
+		}},
+		IssuedAt:  &issuedAt,
+		DueDate:   entry.Date.AddDate(0, 0, 14),
+		Notes:     "Migrated from billing history",
+		SourceRef: ref,
+		CreatedAt: entry.Date,
+		UpdatedAt: time.Now(),
+	}
+
+	var payment *models.Payment
+	switch entry.Status {
+	case "paid":
+		invoice.AmountPaid = entry.Amount
+		invoice.Status = models.InvoiceStatusPaid
+		invoice.PaidAt = &issuedAt
+		payment = &models.Payment{Status: models.PaymentStatusSucceeded}
+	case "failed":
+		payment = &models.Payment{Status: models.PaymentStatusFailed}
+	case "refunded":
+		invoice.Status = models.InvoiceStatusVoid
+		invoice.VoidedAt = &issuedAt
+		payment = &models.Payment{Status: models.PaymentStatusRefunded}
+	}
+	invoice.Recalculate()
+	if invoice.Status == models.InvoiceStatusVoid {
+		invoice.AmountDue = models.NewMoney(0, invoice.Currency)
+	}
+
+	result, err := invoices.InsertOne(ctx, invoice)
+	if err != nil {
+		return false, err
+	}
+
+	if payment != nil {
+		payment.InvoiceID = result.InsertedID.(primitive.ObjectID)
+		payment.MemberID = &memberID
+		payment.ClubID = clubID
+		payment.Amount = entry.Amount
+		payment.Method = "other"
+		payment.Notes = "Migrated from billing history"
+		payment.ReceivedAt = entry.Date
+		payment.CreatedAt = time.Now()
+		if _, err := db.Collection("payments").InsertOne(ctx, payment); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// nextInvoiceNumber allocates numbers from the same counters the API uses
+func nextInvoiceNumber(ctx context.Context, db *mongo.Database, date time.Time) (string, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := db.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": fmt.Sprintf("invoice-%d", date.Year())},
+		bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV-%d-%06d", date.Year(), counter.Seq), nil
+}
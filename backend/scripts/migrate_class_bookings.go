@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api-mongo/database"
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyClass holds the rosters classes used to keep themselves
+type legacyClass struct {
+	ID              primitive.ObjectID   `bson:"_id"`
+	EnrolledMembers []primitive.ObjectID `bson:"enrolled_members"`
+	WaitList        []primitive.ObjectID `bson:"wait_list"`
+	CreatedAt       time.Time            `bson:"created_at"`
+}
+
+// Makes class bookings the record of who is in each class:
+//
+//  1. Members in a class's enrolled_members or wait_list get a confirmed or
+//     waitlisted booking, in roster order. Where the member already has an
+//     open booking its status is brought in line with the roster.
+//  2. A member with several open bookings for a class keeps the earliest;
+//     the others are cancelled. Cancelled bookings get a cancelled_at.
+//  3. Each class's booked_count is recounted from its bookings and the
+//     enrolled_members and wait_list arrays are removed.
+//  4. The class booking indexes are created.
+//
+// Bookings made through /api/class-bookings never checked capacity, so a
+// class can come out over capacity; those are reported. The script can be
+// re-run safely.
+func main() {
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer db.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	mongoDB := db.Client.Database(db.DatabaseName)
+	classes := mongoDB.Collection("classes")
+	bookings := mongoDB.Collection("class_bookings")
+
+	// 1. Rosters become bookings
+	cursor, err := classes.Find(ctx, bson.M{"$or": []bson.M{
+		{"enrolled_members": bson.M{"$exists": true}},
+		{"wait_list": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		log.Fatal("Failed to read classes:", err)
+	}
+	created, synced := 0, 0
+	for cursor.Next(ctx) {
+		var class legacyClass
+		if err := cursor.Decode(&class); err != nil {
+			log.Fatal("Failed to decode class:", err)
+		}
+		roster := append(append([]primitive.ObjectID{}, class.EnrolledMembers...), class.WaitList...)
+		for i, memberID := range roster {
+			status := models.ClassBookingConfirmed
+			if i >= len(class.EnrolledMembers) {
+				status = models.ClassBookingWaitlist
+			}
+			// Keeps the roster's order, which the waitlist is promoted in
+			bookedAt := class.CreatedAt.Add(time.Duration(i) * time.Millisecond)
+			isNew, changed, err := migrateRosterEntry(ctx, bookings, class.ID, memberID, status, bookedAt)
+			if err != nil {
+				log.Fatalf("Failed to migrate member %s of class %s: %v", memberID.Hex(), class.ID.Hex(), err)
+			}
+			if isNew {
+				created++
+			} else if changed {
+				synced++
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal("Failed to read classes:", err)
+	}
+	cursor.Close(ctx)
+	fmt.Printf("✓ Bookings from class rosters: %d created, %d updated to match\n", created, synced)
+
+	// 2. One open booking per member and class
+	duplicates, err := cancelDuplicateBookings(ctx, bookings)
+	if err != nil {
+		log.Fatal("Failed to cancel duplicate bookings:", err)
+	}
+	fmt.Printf("✓ Cancelled %d duplicate bookings\n", duplicates)
+	stamped, err := stampCancelledBookings(ctx, bookings)
+	if err != nil {
+		log.Fatal("Failed to set cancelled_at:", err)
+	}
+	fmt.Printf("✓ Set cancelled_at on %d cancelled bookings\n", stamped)
+
+	// 3. Places taken, counted from the bookings
+	over, err := recountBookedPlaces(ctx, classes, bookings)
+	if err != nil {
+		log.Fatal("Failed to recount booked places:", err)
+	}
+	for _, class := range over {
+		fmt.Printf("⚠ Class %s has %d bookings for %d places - review manually\n", class.ID.Hex(), class.BookedCount, class.Capacity)
+	}
+	result, err := classes.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"enrolled_members": "", "wait_list": ""}})
+	if err != nil {
+		log.Fatal("Failed to remove class rosters:", err)
+	}
+	fmt.Printf("✓ Removed rosters from %d classes\n", result.ModifiedCount)
+
+	// 4. Indexes, as the server creates them
+	if _, err := bookings.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "class_id", Value: 1}, {Key: "member_id", Value: 1}, {Key: "cancelled_at", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("one_open_booking_per_member"),
+		},
+		{
+			Keys:    bson.D{{Key: "class_id", Value: 1}, {Key: "status", Value: 1}, {Key: "booked_at", Value: 1}},
+			Options: options.Index().SetName("class_roster"),
+		},
+	}); err != nil {
+		log.Fatal("Failed to create class booking indexes:", err)
+	}
+
+	fmt.Println("✅ Class booking migration complete")
+}
+
+// migrateRosterEntry gives a member on a class roster a booking with the
+// roster's status, creating one if they have no open booking
+func migrateRosterEntry(ctx context.Context, bookings *mongo.Collection, classID, memberID primitive.ObjectID, status string, bookedAt time.Time) (bool, bool, error) {
+	open := bson.M{
+		"class_id":  classID,
+		"member_id": memberID,
+		"status":    bson.M{"$ne": models.ClassBookingCancelled},
+	}
+	var existing models.ClassBooking
+	err := bookings.FindOne(ctx, open, options.FindOne().SetSort(bson.D{{Key: "booked_at", Value: 1}})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		now := time.Now()
+		_, err := bookings.InsertOne(ctx, models.ClassBooking{
+			ID:        primitive.NewObjectID(),
+			ClassID:   &classID,
+			MemberID:  &memberID,
+			Status:    status,
+			BookedAt:  bookedAt,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		return err == nil, false, err
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	// Attendance already recorded stands; otherwise the roster wins
+	if existing.Status == status || (status == models.ClassBookingConfirmed && existing.IsSeated()) {
+		return false, false, nil
+	}
+	_, err = bookings.UpdateOne(ctx, bson.M{"_id": existing.ID},
+		bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}})
+	return false, err == nil, err
+}
+
+// cancelDuplicateBookings keeps each member's earliest open booking for a
+// class and cancels the rest
+func cancelDuplicateBookings(ctx context.Context, bookings *mongo.Collection) (int, error) {
+	cursor, err := bookings.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$ne": models.ClassBookingCancelled}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "booked_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"class_id": "$class_id", "member_id": "$member_id"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	now := time.Now()
+	for _, group := range groups {
+		for i, id := range group.IDs[1:] {
+			// Each cancelled booking needs its own cancelled_at
+			cancelledAt := now.Add(time.Duration(i) * time.Millisecond)
+			if _, err := bookings.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+				"status":       models.ClassBookingCancelled,
+				"cancelled_at": cancelledAt,
+				"updated_at":   now,
+			}}); err != nil {
+				return cancelled, err
+			}
+			cancelled++
+		}
+	}
+	return cancelled, nil
+}
+
+// stampCancelledBookings sets cancelled_at on cancelled bookings that have
+// none, from when they were last updated
+func stampCancelledBookings(ctx context.Context, bookings *mongo.Collection) (int, error) {
+	cursor, err := bookings.Find(ctx, bson.M{
+		"status":       models.ClassBookingCancelled,
+		"cancelled_at": bson.M{"$exists": false},
+	}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	var cancelled []models.ClassBooking
+	if err := cursor.All(ctx, &cancelled); err != nil {
+		return 0, err
+	}
+
+	used := map[string]bool{}
+	for _, booking := range cancelled {
+		// Dates are stored to the millisecond; two cancellations of the
+		// same member and class must not share one
+		cancelledAt := booking.UpdatedAt.Truncate(time.Millisecond)
+		prefix := fmt.Sprintf("%v:%v:", booking.ClassID, booking.MemberID)
+		for used[prefix+cancelledAt.String()] {
+			cancelledAt = cancelledAt.Add(time.Millisecond)
+		}
+		used[prefix+cancelledAt.String()] = true
+		if _, err := bookings.UpdateOne(ctx, bson.M{"_id": booking.ID},
+			bson.M{"$set": bson.M{"cancelled_at": cancelledAt}}); err != nil {
+			return 0, err
+		}
+	}
+	return len(cancelled), nil
+}
+
+// recountBookedPlaces sets each class's booked_count to its seated
+// bookings, returning the classes over capacity
+func recountBookedPlaces(ctx context.Context, classes, bookings *mongo.Collection) ([]models.Class, error) {
+	cursor, err := bookings.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$in": models.ClassBookingSeated}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$class_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ClassID primitive.ObjectID `bson:"_id"`
+		Count   int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		counts[row.ClassID] = row.Count
+	}
+
+	cursor, err = classes.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Class
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	var over []models.Class
+	for _, class := range all {
+		class.BookedCount = counts[class.ID]
+		if _, err := classes.UpdateOne(ctx, bson.M{"_id": class.ID},
+			bson.M{"$set": bson.M{"booked_count": class.BookedCount}}); err != nil {
+			return nil, err
+		}
+		if class.BookedCount > class.Capacity {
+			over = append(over, class)
+		}
+	}
+	return over, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-api-mongo/database"
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Links classes and class series to their instructor by ID. The free-text
+// instructor is matched against the instructors' IDs (the seed data stored
+// those) and then their names, ignoring case. Names that match no
+// instructor, or more than one, are reported and left for manual review.
+// Upcoming classes the same instructor teaches at the same time are
+// reported too. The script can be re-run safely.
+func main() {
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer db.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	mongoDB := db.Client.Database(db.DatabaseName)
+	cursor, err := mongoDB.Collection("instructors").Find(ctx, bson.M{})
+	if err != nil {
+		log.Fatal("Failed to read instructors:", err)
+	}
+	var instructors []models.Instructor
+	if err := cursor.All(ctx, &instructors); err != nil {
+		log.Fatal("Failed to read instructors:", err)
+	}
+
+	byID := make(map[string]models.Instructor, len(instructors))
+	byName := make(map[string][]models.Instructor, len(instructors))
+	for _, instructor := range instructors {
+		byID[instructor.ID.Hex()] = instructor
+		name := strings.ToLower(strings.TrimSpace(instructor.Name))
+		byName[name] = append(byName[name], instructor)
+	}
+
+	for _, collection := range []string{"classes", "class_series"} {
+		values, err := mongoDB.Collection(collection).Distinct(ctx, "instructor", bson.M{
+			"instructor_id": nil,
+			"instructor":    bson.M{"$ne": ""},
+		})
+		if err != nil {
+			log.Fatalf("Failed to read %s instructors: %v", collection, err)
+		}
+
+		for _, raw := range values {
+			value, _ := raw.(string)
+			instructor, ok := byID[strings.TrimSpace(value)]
+			if !ok {
+				matches := byName[strings.ToLower(strings.TrimSpace(value))]
+				if len(matches) != 1 {
+					count, _ := mongoDB.Collection(collection).CountDocuments(ctx, bson.M{"instructor": value, "instructor_id": nil})
+					fmt.Printf("⚠ %d %s have instructor %q, which matches %d instructors - review manually\n", count, collection, value, len(matches))
+					continue
+				}
+				instructor = matches[0]
+			}
+
+			result, err := mongoDB.Collection(collection).UpdateMany(ctx,
+				bson.M{"instructor": value, "instructor_id": nil},
+				bson.M{"$set": bson.M{"instructor_id": instructor.ID, "instructor": instructor.Name}})
+			if err != nil {
+				log.Fatalf("Failed to link %s to instructor %q: %v", collection, value, err)
+			}
+			fmt.Printf("✓ %q → %s (%s): %d %s\n", value, instructor.Name, instructor.ID.Hex(), result.ModifiedCount, collection)
+		}
+	}
+
+	reportDoubleBookings(ctx, mongoDB.Collection("classes"))
+	fmt.Println("✅ Class instructor migration complete")
+}
+
+// reportDoubleBookings lists upcoming classes an instructor teaches at the
+// same time, which could be scheduled before instructors were linked
+func reportDoubleBookings(ctx context.Context, classes *mongo.Collection) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	cursor, err := classes.Find(ctx, bson.M{
+		"instructor_id": bson.M{"$ne": nil},
+		"status":        bson.M{"$ne": "cancelled"},
+		"date":          bson.M{"$gte": today},
+	}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "start_time", Value: 1}}))
+	if err != nil {
+		log.Fatal("Failed to read upcoming classes:", err)
+	}
+	var upcoming []models.Class
+	if err := cursor.All(ctx, &upcoming); err != nil {
+		log.Fatal("Failed to read upcoming classes:", err)
+	}
+
+	byInstructor := map[primitive.ObjectID][]models.Class{}
+	for _, class := range upcoming {
+		byInstructor[*class.InstructorID] = append(byInstructor[*class.InstructorID], class)
+	}
+	for _, schedule := range byInstructor {
+		for i := range schedule {
+			for j := i + 1; j < len(schedule); j++ {
+				if schedule[i].Overlaps(schedule[j]) {
+					fmt.Printf("⚠ %s teaches %s (%s) and %s (%s) at the same time on %s - review manually\n",
+						schedule[i].Instructor, schedule[i].Name, schedule[i].ID.Hex(),
+						schedule[j].Name, schedule[j].ID.Hex(), schedule[i].Date.Format("2006-01-02"))
+				}
+			}
+		}
+	}
+}
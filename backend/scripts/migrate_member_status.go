@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api-mongo/database"
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Normalizes free-text member statuses ("Active", "actve", "inactive", ...)
+// onto the member lifecycle statuses. Values that cannot be mapped are
+// reported and left untouched for manual review.
+func main() {
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer db.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	members := db.Client.Database(db.DatabaseName).Collection("members")
+	statuses, err := members.Distinct(ctx, "status", bson.M{})
+	if err != nil {
+		log.Fatal("Failed to read member statuses:", err)
+	}
+
+	for _, raw := range statuses {
+		current, _ := raw.(string)
+		status, ok := models.NormalizeMemberStatus(current)
+		if current == "" {
+			status, ok = models.MemberStatusActive, true
+		}
+		if !ok {
+			count, _ := members.CountDocuments(ctx, bson.M{"status": current})
+			fmt.Printf("⚠ %d members have unrecognized status %q - review manually\n", count, current)
+			continue
+		}
+		if status == current {
+			continue
+		}
+
+		result, err := members.UpdateMany(ctx, bson.M{"status": current}, bson.M{
+			"$set": bson.M{"status": status, "updated_at": time.Now()},
+		})
+		if err != nil {
+			log.Fatalf("Failed to migrate status %q: %v", current, err)
+		}
+		fmt.Printf("✓ %q → %q: %d members\n", current, status, result.ModifiedCount)
+	}
+
+	fmt.Println("✅ Member status migration complete")
+}
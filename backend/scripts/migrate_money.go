@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api-mongo/database"
+	"go-api-mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// moneyFields lists the amount fields of a collection that used to be
+// stored as floating point numbers in major units
+type moneyFields struct {
+	collection string
+	fields     []string
+}
+
+var moneyCollections = []moneyFields{
+	{"offices", []string{"hourly_rate", "daily_rate"}},
+	{"office_bookings", []string{"total_cost"}},
+	{"members", []string{"account_credit"}},
+	{"reservations", []string{"bill_amount", "discount"}},
+	{"referral_programs", []string{"reward_amount"}},
+	{"referrals", []string{"reward_amount"}},
+	{"payments", []string{"amount"}},
+	{"invoices", []string{"subtotal", "tax_total", "total", "amount_paid", "amount_due"}},
+}
+
+// invoiceLineFields are the amount fields inside each invoices.lines element
+var invoiceLineFields = []string{"unit_price", "amount", "tax_amount"}
+
+// Converts amounts stored as numbers (e.g. 12.5) into exact
+// {"amount": 1250, "currency": "USD"} documents. Documents that are already
+// converted are skipped, so the script can be re-run safely.
+func main() {
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer db.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	mongoDB := db.Client.Database(db.DatabaseName)
+	for _, spec := range moneyCollections {
+		converted, err := migrateMoneyFields(ctx, mongoDB.Collection(spec.collection), spec.fields)
+		if err != nil {
+			log.Fatalf("Failed to migrate %s: %v", spec.collection, err)
+		}
+		fmt.Printf("✓ %s: %d documents converted\n", spec.collection, converted)
+	}
+
+	fmt.Println("✅ Money migration complete")
+}
+
+// migrateMoneyFields rewrites the numeric amount fields of every document
+// in the collection that still has one
+func migrateMoneyFields(ctx context.Context, collection *mongo.Collection, fields []string) (int, error) {
+	isInvoices := collection.Name() == "invoices"
+
+	var legacy bson.A
+	for _, field := range fields {
+		legacy = append(legacy, bson.M{field: bson.M{"$type": "number"}})
+	}
+	if isInvoices {
+		for _, field := range invoiceLineFields {
+			legacy = append(legacy, bson.M{"lines." + field: bson.M{"$type": "number"}})
+		}
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"$or": legacy})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	converted := 0
+	for cursor.Next(ctx) {
+		set := bson.M{}
+		for _, field := range fields {
+			value, err := cursor.Current.LookupErr(field)
+			if err != nil || value.Type == bson.TypeEmbeddedDocument {
+				continue
+			}
+			var amount models.Money
+			if err := amount.UnmarshalBSONValue(value.Type, value.Value); err != nil {
+				return converted, fmt.Errorf("%s: %v", field, err)
+			}
+			set[field] = amount
+		}
+
+		if isInvoices {
+			// Line amounts decode from either form, so rewriting the whole
+			// array converts any legacy values in it
+			var invoice models.Invoice
+			if err := cursor.Decode(&invoice); err != nil {
+				return converted, err
+			}
+			set["lines"] = invoice.Lines
+			if invoice.Currency == "" {
+				set["currency"] = models.DefaultCurrency
+			}
+		}
+
+		if len(set) == 0 {
+			continue
+		}
+		id := cursor.Current.Lookup("_id")
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+			return converted, err
+		}
+		converted++
+	}
+	return converted, cursor.Err()
+}
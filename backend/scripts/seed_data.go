@@ -7,6 +7,8 @@ import (
 	"math/rand"
 	"time"
 
+	"go-api-mongo/models"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -75,23 +77,23 @@ type Restaurant struct {
 }
 
 type Class struct {
-	ID              primitive.ObjectID   `bson:"_id,omitempty"`
-	ClubID          *primitive.ObjectID  `bson:"club_id,omitempty"`
-	Name            string               `bson:"name"`
-	Description     string               `bson:"description"`
-	Instructor      string               `bson:"instructor"`
-	Date            time.Time            `bson:"date"`
-	StartTime       string               `bson:"start_time"`
-	EndTime         string               `bson:"end_time"`
-	Duration        int                  `bson:"duration"`
-	Capacity        int                  `bson:"capacity"`
-	EnrolledMembers []primitive.ObjectID `bson:"enrolled_members"`
-	WaitList        []primitive.ObjectID `bson:"wait_list"`
-	Recurring       bool                 `bson:"recurring"`
-	RecurringDays   []string             `bson:"recurring_days"`
-	Status          string               `bson:"status"`
-	CreatedAt       time.Time            `bson:"created_at"`
-	UpdatedAt       time.Time            `bson:"updated_at"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	ClubID        *primitive.ObjectID `bson:"club_id,omitempty"`
+	Name          string              `bson:"name"`
+	Description   string              `bson:"description"`
+	Instructor    string              `bson:"instructor"`
+	InstructorID  *primitive.ObjectID `bson:"instructor_id,omitempty"`
+	Date          time.Time           `bson:"date"`
+	StartTime     string              `bson:"start_time"`
+	EndTime       string              `bson:"end_time"`
+	Duration      int                 `bson:"duration"`
+	Capacity      int                 `bson:"capacity"`
+	BookedCount   int                 `bson:"booked_count"`
+	Recurring     bool                `bson:"recurring"`
+	RecurringDays []string            `bson:"recurring_days"`
+	Status        string              `bson:"status"`
+	CreatedAt     time.Time           `bson:"created_at"`
+	UpdatedAt     time.Time           `bson:"updated_at"`
 }
 
 type Reservation struct {
@@ -118,8 +120,8 @@ type Office struct {
 	Type        string              `bson:"type"`
 	Capacity    int                 `bson:"capacity"`
 	Amenities   []string            `bson:"amenities"`
-	HourlyRate  float64             `bson:"hourly_rate"`
-	DailyRate   float64             `bson:"daily_rate"`
+	HourlyRate  models.Money        `bson:"hourly_rate"`
+	DailyRate   models.Money        `bson:"daily_rate"`
 	Active      bool                `bson:"active"`
 	CreatedAt   time.Time           `bson:"created_at"`
 	UpdatedAt   time.Time           `bson:"updated_at"`
@@ -132,17 +134,17 @@ type OfficeBooking struct {
 	StartTime time.Time           `bson:"start_time"`
 	EndTime   time.Time           `bson:"end_time"`
 	Status    string              `bson:"status"`
-	TotalCost float64             `bson:"total_cost"`
+	TotalCost models.Money        `bson:"total_cost"`
 	Notes     string              `bson:"notes"`
 	CreatedAt time.Time           `bson:"created_at"`
 	UpdatedAt time.Time           `bson:"updated_at"`
 }
 
 type BillingEntry struct {
-	Date        time.Time `bson:"date" json:"date"`
-	Amount      float64   `bson:"amount" json:"amount"`
-	Description string    `bson:"description" json:"description"`
-	Status      string    `bson:"status" json:"status"`
+	Date        time.Time    `bson:"date" json:"date"`
+	Amount      models.Money `bson:"amount" json:"amount"`
+	Description string       `bson:"description" json:"description"`
+	Status      string       `bson:"status" json:"status"`
 }
 
 var firstNames = []string{
@@ -340,15 +342,15 @@ func seedClubs(ctx context.Context, db *mongo.Database) []primitive.ObjectID {
 	return clubIDs
 }
 
-func seedInstructors(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID) []primitive.ObjectID {
+func seedInstructors(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID) []Instructor {
 	collection := db.Collection("instructors")
 
 	// Clear existing instructors
 	collection.DeleteMany(ctx, bson.M{})
 
 	numInstructors := 15
-	instructors := make([]interface{}, numInstructors)
-	instructorIDs := make([]primitive.ObjectID, numInstructors)
+	instructors := make([]Instructor, numInstructors)
+	docs := make([]interface{}, numInstructors)
 	now := time.Now()
 
 	for i := 0; i < numInstructors; i++ {
@@ -386,19 +388,20 @@ func seedInstructors(ctx context.Context, db *mongo.Database, clubIDs []primitiv
 		}
 
 		instructors[i] = instructor
+		docs[i] = instructor
 	}
 
-	result, err := collection.InsertMany(ctx, instructors)
+	result, err := collection.InsertMany(ctx, docs)
 	if err != nil {
 		log.Fatal("Failed to insert instructors:", err)
 	}
 
 	for i, id := range result.InsertedIDs {
-		instructorIDs[i] = id.(primitive.ObjectID)
+		instructors[i].ID = id.(primitive.ObjectID)
 	}
 
-	fmt.Printf("✓ Successfully inserted %d instructors\n", len(instructorIDs))
-	return instructorIDs
+	fmt.Printf("✓ Successfully inserted %d instructors\n", len(instructors))
+	return instructors
 }
 
 func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID) []primitive.ObjectID {
@@ -410,6 +413,8 @@ func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 	numMembers := 100
 	members := make([]interface{}, numMembers)
 	memberIDs := make([]primitive.ObjectID, numMembers)
+	memberClubIDs := make([]*primitive.ObjectID, numMembers)
+	billing := make([][]BillingEntry, numMembers)
 	now := time.Now()
 
 	for i := 0; i < numMembers; i++ {
@@ -426,15 +431,15 @@ func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 		// Random auto-renewal (80% chance of true)
 		autoRenewal := rand.Float32() < 0.8
 
-		// Random status (85% active, 10% inactive, 5% suspended)
+		// Random status (85% active, 10% expired, 5% frozen)
 		var status string
 		r := rand.Float32()
 		if r < 0.85 {
 			status = "active"
 		} else if r < 0.95 {
-			status = "inactive"
+			status = "expired"
 		} else {
-			status = "suspended"
+			status = "frozen"
 		}
 
 		// 90% of members are assigned to a club
@@ -444,11 +449,11 @@ func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 			clubID = &randomClubID
 		}
 
-		// Generate billing history: one entry per month from join to expiry
+		// Generate billing: one bill per month from join to expiry
 		var billingHistory []BillingEntry
 		billDate := joinDate
 		for billDate.Before(expiryDate) {
-			amount := 50.0 + rand.Float64()*100.0 // $50-$150
+			amount := models.Cents(5000 + rand.Int63n(10000)) // $50-$150
 			statusIdx := rand.Intn(100)
 			var billStatus string
 			if statusIdx < 85 {
@@ -484,9 +489,10 @@ func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 			"notes":             randomString(memberNotes),
 			"created_at":        joinDate,
 			"updated_at":        now,
-			"billing_history":   billingHistory,
 		}
 		members[i] = memberMap
+		memberClubIDs[i] = clubID
+		billing[i] = billingHistory
 	}
 
 	// Insert all members
@@ -499,10 +505,126 @@ func seedMembers(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 		memberIDs[i] = id.(primitive.ObjectID)
 	}
 
-	fmt.Printf("✓ Successfully inserted %d members (with billing history)\n", len(memberIDs))
+	fmt.Printf("✓ Successfully inserted %d members\n", len(memberIDs))
+
+	seedInvoices(ctx, db, memberIDs, memberClubIDs, billing)
 	return memberIDs
 }
 
+// seedInvoices turns each member's monthly bills into invoices, with a payment
+// for paid bills, a failed attempt for failed bills and a refunded payment
+// (on a void invoice) for refunded bills
+func seedInvoices(ctx context.Context, db *mongo.Database, memberIDs []primitive.ObjectID, clubIDs []*primitive.ObjectID, billing [][]BillingEntry) {
+	invoicesCollection := db.Collection("invoices")
+	paymentsCollection := db.Collection("payments")
+	countersCollection := db.Collection("counters")
+
+	// Clear existing invoices, payments and invoice numbers
+	invoicesCollection.DeleteMany(ctx, bson.M{})
+	paymentsCollection.DeleteMany(ctx, bson.M{})
+	countersCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$regex": "^invoice-"}})
+
+	var invoices []interface{}
+	var payments []interface{}
+	sequences := make(map[int]int)
+	now := time.Now()
+
+	for i, memberID := range memberIDs {
+		for _, bill := range billing[i] {
+			year := bill.Date.Year()
+			sequences[year]++
+			invoiceID := primitive.NewObjectID()
+			amount := bill.Amount
+			zero := models.Cents(0)
+
+			status := "open"
+			amountPaid, amountDue := zero, amount
+			var paymentStatus string
+			switch bill.Status {
+			case "paid":
+				status, amountPaid, amountDue, paymentStatus = "paid", amount, zero, "succeeded"
+			case "failed":
+				paymentStatus = "failed"
+			case "refunded":
+				status, amountDue, paymentStatus = "void", zero, "refunded"
+			}
+
+			invoice := bson.M{
+				"_id":       invoiceID,
+				"number":    fmt.Sprintf("INV-%d-%06d", year, sequences[year]),
+				"member_id": memberID,
+				"status":    status,
+				"lines": []bson.M{{
+					"description":  bill.Description,
+					"product_type": "membership",
+					"quantity":     1,
+					"unit_price":   amount,
+					"tax_rate":     0.0,
+					"amount":       amount,
+					"tax_amount":   zero,
+				}},
+				"currency":    amount.Currency,
+				"subtotal":    amount,
+				"tax_total":   zero,
+				"total":       amount,
+				"amount_paid": amountPaid,
+				"amount_due":  amountDue,
+				"issued_at":   bill.Date,
+				"due_date":    bill.Date.AddDate(0, 0, 14),
+				"notes":       "",
+				"created_at":  bill.Date,
+				"updated_at":  now,
+			}
+			if clubIDs[i] != nil {
+				invoice["club_id"] = clubIDs[i]
+			}
+			if status == "paid" {
+				invoice["paid_at"] = bill.Date
+			}
+			if status == "void" {
+				invoice["voided_at"] = bill.Date
+			}
+			invoices = append(invoices, invoice)
+
+			if paymentStatus != "" {
+				payment := bson.M{
+					"invoice_id":  invoiceID,
+					"member_id":   memberID,
+					"amount":      amount,
+					"method":      "card",
+					"status":      paymentStatus,
+					"reference":   "",
+					"notes":       "",
+					"received_at": bill.Date,
+					"created_at":  bill.Date,
+				}
+				if clubIDs[i] != nil {
+					payment["club_id"] = clubIDs[i]
+				}
+				payments = append(payments, payment)
+			}
+		}
+	}
+
+	if len(invoices) > 0 {
+		if _, err := invoicesCollection.InsertMany(ctx, invoices); err != nil {
+			log.Fatal("Failed to insert invoices:", err)
+		}
+	}
+	if len(payments) > 0 {
+		if _, err := paymentsCollection.InsertMany(ctx, payments); err != nil {
+			log.Fatal("Failed to insert payments:", err)
+		}
+	}
+	for year, seq := range sequences {
+		if _, err := countersCollection.InsertOne(ctx, bson.M{"_id": fmt.Sprintf("invoice-%d", year), "seq": seq}); err != nil {
+			log.Fatal("Failed to set invoice counter:", err)
+		}
+	}
+
+	fmt.Printf("✓ Successfully inserted %d invoices and %d payments\n", len(invoices), len(payments))
+}
+
 func seedRestaurants(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID) []primitive.ObjectID {
 	collection := db.Collection("restaurants")
 
@@ -548,23 +670,25 @@ func seedRestaurants(ctx context.Context, db *mongo.Database, clubIDs []primitiv
 	return restaurantIDs
 }
 
-func seedClasses(ctx context.Context, db *mongo.Database, clubIDs []primitive.ObjectID, instructorIDs []primitive.ObjectID, memberIDs []primitive.ObjectID) []primitive.ObjectID {
+func seedClasses(ctx context.Context, db *mongo.Database, instructors []Instructor, memberIDs []primitive.ObjectID) []primitive.ObjectID {
 	collection := db.Collection("classes")
 
-	// Clear existing classes
+	// Clear existing classes and their bookings
 	collection.DeleteMany(ctx, bson.M{})
+	db.Collection("class_bookings").DeleteMany(ctx, bson.M{})
 
 	numClasses := 30
 	classes := make([]interface{}, numClasses)
 	classIDs := make([]primitive.ObjectID, numClasses)
+	rosters := make([][]primitive.ObjectID, numClasses)
 	now := time.Now()
 
 	for i := 0; i < numClasses; i++ {
 		classInfo := classData[rand.Intn(len(classData))]
-		clubID := clubIDs[rand.Intn(len(clubIDs))]
 
-		// Get a random instructor
-		instructorID := instructorIDs[rand.Intn(len(instructorIDs))]
+		// Get a random instructor, teaching at one of their clubs
+		instructor := instructors[rand.Intn(len(instructors))]
+		clubID := instructor.ClubIDs[rand.Intn(len(instructor.ClubIDs))]
 
 		// Random date within next 14 days or past 7 days
 		daysOffset := rand.Intn(21) - 7 // -7 to +14 days
@@ -619,25 +743,26 @@ func seedClasses(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 		}
 
 		class := Class{
-			ClubID:          &clubID,
-			Name:            classInfo.name,
-			Description:     classInfo.description,
-			Instructor:      instructorID.Hex(),
-			Date:            classDate,
-			StartTime:       startTime,
-			EndTime:         endTime,
-			Duration:        classInfo.duration,
-			Capacity:        classInfo.capacity,
-			EnrolledMembers: enrolledMembers,
-			WaitList:        []primitive.ObjectID{},
-			Recurring:       rand.Float32() < 0.3, // 30% are recurring
-			RecurringDays:   []string{},
-			Status:          status,
-			CreatedAt:       now.AddDate(0, 0, -14),
-			UpdatedAt:       now,
+			ClubID:        &clubID,
+			Name:          classInfo.name,
+			Description:   classInfo.description,
+			Instructor:    instructor.Name,
+			InstructorID:  &instructor.ID,
+			Date:          classDate,
+			StartTime:     startTime,
+			EndTime:       endTime,
+			Duration:      classInfo.duration,
+			Capacity:      classInfo.capacity,
+			BookedCount:   len(enrolledMembers),
+			Recurring:     rand.Float32() < 0.3, // 30% are recurring
+			RecurringDays: []string{},
+			Status:        status,
+			CreatedAt:     now.AddDate(0, 0, -14),
+			UpdatedAt:     now,
 		}
 
 		classes[i] = class
+		rosters[i] = enrolledMembers
 	}
 
 	result, err := collection.InsertMany(ctx, classes)
@@ -649,7 +774,29 @@ func seedClasses(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 		classIDs[i] = id.(primitive.ObjectID)
 	}
 
-	fmt.Printf("✓ Successfully inserted %d classes\n", len(classIDs))
+	// Class rosters are kept as bookings
+	var bookings []interface{}
+	for i, roster := range rosters {
+		for j, memberID := range roster {
+			bookedAt := now.AddDate(0, 0, -14).Add(time.Duration(j) * time.Minute)
+			bookings = append(bookings, bson.M{
+				"class_id":   classIDs[i],
+				"member_id":  memberID,
+				"status":     "confirmed",
+				"booked_at":  bookedAt,
+				"notes":      "",
+				"created_at": bookedAt,
+				"updated_at": bookedAt,
+			})
+		}
+	}
+	if len(bookings) > 0 {
+		if _, err := db.Collection("class_bookings").InsertMany(ctx, bookings); err != nil {
+			log.Fatal("Failed to insert class bookings:", err)
+		}
+	}
+
+	fmt.Printf("✓ Successfully inserted %d classes with %d bookings\n", len(classIDs), len(bookings))
 	return classIDs
 }
 
@@ -780,25 +927,21 @@ func seedOffices(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 			name := names[rand.Intn(len(names))]
 
 			var capacity int
-			var hourlyRate, dailyRate float64
+			var hourlyRate models.Money
 
 			switch officeType {
 			case "private":
 				capacity = 1
-				hourlyRate = 15.0 + float64(rand.Intn(15))
-				dailyRate = hourlyRate * 6
+				hourlyRate = models.Cents(int64(15+rand.Intn(15)) * 100)
 			case "shared":
 				capacity = rand.Intn(8) + 4 // 4-12 people
-				hourlyRate = 10.0 + float64(rand.Intn(10))
-				dailyRate = hourlyRate * 6
+				hourlyRate = models.Cents(int64(10+rand.Intn(10)) * 100)
 			case "meeting_room":
 				capacity = rand.Intn(6) + 6 // 6-12 people
-				hourlyRate = 25.0 + float64(rand.Intn(20))
-				dailyRate = hourlyRate * 6
+				hourlyRate = models.Cents(int64(25+rand.Intn(20)) * 100)
 			case "phone_booth":
 				capacity = 1
-				hourlyRate = 5.0 + float64(rand.Intn(5))
-				dailyRate = hourlyRate * 6
+				hourlyRate = models.Cents(int64(5+rand.Intn(5)) * 100)
 			}
 
 			office := Office{
@@ -809,7 +952,7 @@ func seedOffices(ctx context.Context, db *mongo.Database, clubIDs []primitive.Ob
 				Capacity:    capacity,
 				Amenities:   amenities[rand.Intn(len(amenities))],
 				HourlyRate:  hourlyRate,
-				DailyRate:   dailyRate,
+				DailyRate:   hourlyRate.Mul(6),
 				Active:      rand.Float32() > 0.1, // 90% active
 				CreatedAt:   now,
 				UpdatedAt:   now,
@@ -893,8 +1036,8 @@ func seedOfficeBookings(ctx context.Context, db *mongo.Database, officeIDs []pri
 		}
 
 		// Calculate cost (hourly rate * hours)
-		hourlyRate := 10.0 + float64(rand.Intn(20))
-		totalCost := hourlyRate * float64(durationHours)
+		hourlyRate := models.Cents(int64(10+rand.Intn(20)) * 100)
+		totalCost := hourlyRate.Mul(int64(durationHours))
 
 		booking := OfficeBooking{
 			OfficeID:  &officeID,
@@ -940,9 +1083,9 @@ func main() {
 	// Seed data in order
 	clubIDs := seedClubs(ctx, db)
 	restaurantIDs := seedRestaurants(ctx, db, clubIDs)
-	instructorIDs := seedInstructors(ctx, db, clubIDs)
+	instructors := seedInstructors(ctx, db, clubIDs)
 	memberIDs := seedMembers(ctx, db, clubIDs)
-	classIDs := seedClasses(ctx, db, clubIDs, instructorIDs, memberIDs)
+	classIDs := seedClasses(ctx, db, instructors, memberIDs)
 	seedReservations(ctx, db, restaurantIDs, memberIDs)
 	officeIDs := seedOffices(ctx, db, clubIDs)
 	seedOfficeBookings(ctx, db, officeIDs, memberIDs)
@@ -953,7 +1096,7 @@ func main() {
 	fmt.Println("Summary:")
 	fmt.Printf("  - %d clubs\n", len(clubIDs))
 	fmt.Printf("  - %d restaurants\n", len(restaurantIDs))
-	fmt.Printf("  - %d instructors\n", len(instructorIDs))
+	fmt.Printf("  - %d instructors\n", len(instructors))
 	fmt.Printf("  - %d members\n", len(memberIDs))
 	fmt.Printf("  - %d classes\n", len(classIDs))
 	fmt.Println("  - 50 reservations")
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned when a blob key is empty or escapes the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores opaque binary objects such as signed documents and uploads.
+// Keys are slash separated paths, e.g. "signed-documents/<member>/<id>.pdf".
+// Content type and other metadata are kept alongside the owning record in MongoDB.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
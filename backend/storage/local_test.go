@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	t.Run("round trips a blob", func(t *testing.T) {
+		if err := store.Put(ctx, "docs/a/b.pdf", strings.NewReader("hello")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		rc, err := store.Get(ctx, "docs/a/b.pdf")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		if string(data) != "hello" {
+			t.Errorf("Expected 'hello', got '%s'", data)
+		}
+	})
+
+	t.Run("missing blob returns ErrNotFound", func(t *testing.T) {
+		if _, err := store.Get(ctx, "docs/missing.pdf"); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("rejects keys outside the root", func(t *testing.T) {
+		for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b"} {
+			if err := store.Put(ctx, key, strings.NewReader("x")); err != ErrInvalidKey {
+				t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+			}
+		}
+	})
+
+	t.Run("delete is idempotent", func(t *testing.T) {
+		if err := store.Delete(ctx, "docs/a/b.pdf"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if err := store.Delete(ctx, "docs/a/b.pdf"); err != nil {
+			t.Errorf("Second delete failed: %v", err)
+		}
+	})
+}
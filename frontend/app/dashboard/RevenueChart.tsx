@@ -9,6 +9,8 @@ interface RevenueDataPoint {
   revenue: number;
   booking_revenue: number;
   billing_revenue: number;
+  retail_revenue: number;
+  discounts: number;
 }
 
 interface RevenueChartProps {
@@ -19,11 +21,14 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
   const [loading, setLoading] = useState(true);
   const [data, setData] = useState<RevenueDataPoint[]>([]);
   const [totalRevenue, setTotalRevenue] = useState(0);
+  const [totalDiscounts, setTotalDiscounts] = useState(0);
   const [groupBy, setGroupBy] = useState<'day' | 'month'>('day');
   const [visibleLines, setVisibleLines] = useState({
     revenue: true,
     booking_revenue: true,
     billing_revenue: true,
+    retail_revenue: true,
+    discounts: true,
   });
   const [dateRange, setDateRange] = useState({
     start: new Date(Date.now() - 30 * 24 * 60 * 60 * 1000).toISOString().split('T')[0], // 30 days ago
@@ -40,6 +45,7 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
       });
       setData(response.data || []);
       setTotalRevenue(response.total_revenue || 0);
+      setTotalDiscounts(response.total_discounts || 0);
     } catch (error) {
       console.error('Failed to load revenue data:', error);
     } finally {
@@ -94,6 +100,8 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
         revenue: dataKey === 'revenue',
         booking_revenue: dataKey === 'booking_revenue',
         billing_revenue: dataKey === 'billing_revenue',
+        retail_revenue: dataKey === 'retail_revenue',
+        discounts: dataKey === 'discounts',
       });
     } else {
       // If only this line is visible, show all lines
@@ -101,6 +109,8 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
         revenue: true,
         booking_revenue: true,
         billing_revenue: true,
+        retail_revenue: true,
+        discounts: true,
       });
     }
   };
@@ -185,6 +195,9 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
           <div className="text-3xl font-bold text-blue-900">
             {formatCurrency(totalRevenue)}
           </div>
+          <div className="text-sm text-blue-700 mt-1">
+            Discounts given: {formatCurrency(totalDiscounts)}
+          </div>
         </div>
       </div>
 
@@ -259,6 +272,27 @@ export default function RevenueChart({ className = '' }: RevenueChartProps) {
                 dot={{ r: 3, fill: '#f59e0b' }}
               />
             )}
+            {visibleLines.retail_revenue && (
+              <Line
+                type="monotone"
+                dataKey="retail_revenue"
+                stroke="#8b5cf6"
+                strokeWidth={2}
+                name="Shop Sales"
+                dot={{ r: 3, fill: '#8b5cf6' }}
+              />
+            )}
+            {visibleLines.discounts && (
+              <Line
+                type="monotone"
+                dataKey="discounts"
+                stroke="#ef4444"
+                strokeWidth={2}
+                strokeDasharray="5 5"
+                name="Discounts"
+                dot={{ r: 3, fill: '#ef4444' }}
+              />
+            )}
           </LineChart>
         </ResponsiveContainer>
       )}
@@ -28,6 +28,7 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
   });
   const [loading, setLoading] = useState(true);
   const [saving, setSaving] = useState(false);
+  const [scope, setScope] = useState<'this' | 'following' | 'all'>('this');
 
   const weekDays = ['Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday', 'Sunday'];
 
@@ -43,7 +44,11 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
       ]);
       // Format date for input
       const formattedDate = classData.date ? new Date(classData.date).toISOString().split('T')[0] : '';
-      setFormData({ ...classData, date: formattedDate });
+      // Classes from before instructors were linked by ID name them instead
+      const instructorId = classData.instructor_id
+        || (instructorsData || []).find((inst: Instructor) => inst.name === classData.instructor)?.id
+        || '';
+      setFormData({ ...classData, date: formattedDate, instructor_id: instructorId });
       setInstructors(instructorsData || []);
     } catch (error) {
       console.error('Failed to load class:', error);
@@ -67,6 +72,11 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
     }
   };
 
+  const handleInstructorChange = (e: React.ChangeEvent<HTMLSelectElement>) => {
+    const instructor = instructors.find(inst => inst.id === e.target.value);
+    setFormData(prev => ({ ...prev, instructor_id: e.target.value, instructor: instructor?.name || '' }));
+  };
+
   const handleDayToggle = (day: string) => {
     setFormData(prev => ({
       ...prev,
@@ -81,7 +91,7 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
     setSaving(true);
 
     try {
-      await updateClass(resolvedParams.id, formData);
+      await updateClass(resolvedParams.id, formData, scope);
       router.push('/dashboard/classes');
     } catch (error: any) {
       console.error('Failed to update class:', error);
@@ -157,18 +167,18 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
                     Instructor *
                   </label>
                   <select
-                    name="instructor"
+                    name="instructor_id"
                     id="instructor"
                     required
-                    value={formData.instructor}
-                    onChange={handleChange}
+                    value={formData.instructor_id || ''}
+                    onChange={handleInstructorChange}
                     className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-green-500 focus:border-green-500 text-gray-900"
                   >
                     <option value="">Select an instructor</option>
                     {instructors
                       .filter(inst => inst.active)
                       .map(instructor => (
-                        <option key={instructor.id} value={instructor.name}>
+                        <option key={instructor.id} value={instructor.id}>
                           {instructor.name} - {instructor.specialty}
                         </option>
                       ))}
@@ -323,7 +333,18 @@ export default function EditClassPage({ params }: { params: Promise<{ id: string
             </div>
 
             {/* Action Buttons */}
-            <div className="flex justify-end gap-4 pt-4 border-t">
+            <div className="flex justify-end items-center gap-4 pt-4 border-t">
+              {formData.series_id && (
+                <select
+                  value={scope}
+                  onChange={(e) => setScope(e.target.value as 'this' | 'following' | 'all')}
+                  className="px-3 py-2 text-sm text-gray-900 border border-gray-300 rounded-md"
+                >
+                  <option value="this">This class only</option>
+                  <option value="following">This and following classes</option>
+                  <option value="all">All classes in the series</option>
+                </select>
+              )}
               <button
                 type="button"
                 onClick={() => router.push('/dashboard/classes')}
@@ -3,7 +3,7 @@
 import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import Link from 'next/link';
-import { createClass, getInstructors } from '@/lib/api';
+import { createClass, createClassSeries, getInstructors } from '@/lib/api';
 import type { Instructor } from '@/types';
 
 export default function NewClassPage() {
@@ -12,6 +12,7 @@ export default function NewClassPage() {
   const [formData, setFormData] = useState({
     name: '',
     description: '',
+    instructor_id: '',
     instructor: '',
     date: new Date().toISOString().split('T')[0],
     start_time: '09:00',
@@ -53,6 +54,11 @@ export default function NewClassPage() {
     }
   };
 
+  const handleInstructorChange = (e: React.ChangeEvent<HTMLSelectElement>) => {
+    const instructor = instructors.find(inst => inst.id === e.target.value);
+    setFormData(prev => ({ ...prev, instructor_id: e.target.value, instructor: instructor?.name || '' }));
+  };
+
   const handleDayToggle = (day: string) => {
     setFormData(prev => ({
       ...prev,
@@ -68,58 +74,34 @@ export default function NewClassPage() {
 
     try {
       if (formData.recurring && formData.recurring_days.length > 0 && formData.recurring_weeks > 0) {
-        // Generate multiple instances for recurring classes
-        const baseDate = new Date(formData.date);
-        const dayNameToNumber: { [key: string]: number } = {
-          'Sunday': 0,
-          'Monday': 1,
-          'Tuesday': 2,
-          'Wednesday': 3,
-          'Thursday': 4,
-          'Friday': 5,
-          'Saturday': 6
+        // Create a class series; the server creates each class in it
+        const dayCodes: { [key: string]: string } = {
+          'Monday': 'MO',
+          'Tuesday': 'TU',
+          'Wednesday': 'WE',
+          'Thursday': 'TH',
+          'Friday': 'FR',
+          'Saturday': 'SA',
+          'Sunday': 'SU'
         };
+        const until = new Date(formData.date);
+        until.setDate(until.getDate() + formData.recurring_weeks * 7 - 1);
+        const byDay = formData.recurring_days.map(day => dayCodes[day]).join(',');
 
-        const instances = [];
-        
-        // Generate instances for each week
-        for (let week = 0; week < formData.recurring_weeks; week++) {
-          // For each selected day
-          for (const dayName of formData.recurring_days) {
-            const targetDay = dayNameToNumber[dayName];
-            const instanceDate = new Date(baseDate);
-            
-            // Calculate the date for this instance
-            // Start from the base date and find the next occurrence of the target day
-            const currentDay = instanceDate.getDay();
-            let daysToAdd = targetDay - currentDay;
-            
-            // If the target day is before or same as current day in week 0, move to next occurrence
-            if (daysToAdd <= 0) {
-              daysToAdd += 7;
-            }
-            
-            // Add the week offset (week 0 uses the first occurrence, week 1 adds 7 days, etc.)
-            daysToAdd += (week * 7);
-            
-            instanceDate.setDate(instanceDate.getDate() + daysToAdd);
-            
-            instances.push({
-              ...formData,
-              date: instanceDate.toISOString().split('T')[0],
-            });
-          }
-        }
+        const result = await createClassSeries({
+          name: formData.name,
+          description: formData.description,
+          instructor_id: formData.instructor_id,
+          instructor: formData.instructor,
+          start_date: formData.date,
+          rrule: `FREQ=WEEKLY;BYDAY=${byDay};UNTIL=${until.toISOString().split('T')[0].replace(/-/g, '')}`,
+          start_time: formData.start_time,
+          end_time: formData.end_time,
+          duration: formData.duration,
+          capacity: formData.capacity,
+        });
 
-        // Sort instances by date
-        instances.sort((a, b) => new Date(a.date).getTime() - new Date(b.date).getTime());
-
-        // Create all instances
-        for (const instance of instances) {
-          await createClass(instance);
-        }
-        
-        alert(`Successfully created ${instances.length} class instances!`);
+        alert(`Successfully created ${result.occurrences.length} class instances!`);
       } else {
         // Single class creation
         await createClass(formData);
@@ -194,18 +176,18 @@ export default function NewClassPage() {
                     Instructor *
                   </label>
                   <select
-                    name="instructor"
+                    name="instructor_id"
                     id="instructor"
                     required
-                    value={formData.instructor}
-                    onChange={handleChange}
+                    value={formData.instructor_id || ''}
+                    onChange={handleInstructorChange}
                     className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-green-500 focus:border-green-500 text-gray-900"
                   >
                     <option value="">Select an instructor</option>
                     {instructors
                       .filter(inst => inst.active)
                       .map(instructor => (
-                        <option key={instructor.id} value={instructor.name}>
+                        <option key={instructor.id} value={instructor.id}>
                           {instructor.name} - {instructor.specialty}
                         </option>
                       ))}
@@ -30,7 +30,7 @@ export default function InstructorDetailPage({ params }: { params: Promise<{ id:
       
       // Filter classes taught by this instructor
       const instructorClasses = classesData.filter(
-        (c: Class) => c.instructor === instructorData.name
+        (c: Class) => c.instructor_id === resolvedParams.id || (!c.instructor_id && c.instructor === instructorData.name)
       );
       setClasses(instructorClasses);
     } catch (error) {
@@ -3,13 +3,15 @@
 import { useState, useEffect, use } from 'react';
 import { useRouter } from 'next/navigation';
 import Link from 'next/link';
-import { getMember, deleteMember, getClasses, enrollMember } from '@/lib/api';
-import type { Member, Class } from '@/types';
+import { getMember, deleteMember, getClasses, enrollMember, getMemberInvoices } from '@/lib/api';
+import type { Member, Class, Invoice } from '@/types';
+import { formatMoney } from '@/lib/money';
 
 export default function MemberDetailPage({ params }: { params: Promise<{ id: string }> }) {
   const router = useRouter();
   const { id } = use(params);
   const [member, setMember] = useState<Member | null>(null);
+  const [invoices, setInvoices] = useState<Invoice[]>([]);
   const [enrolledClasses, setEnrolledClasses] = useState<Class[]>([]);
   const [waitlistClasses, setWaitlistClasses] = useState<Class[]>([]);
   const [availableClasses, setAvailableClasses] = useState<Class[]>([]);
@@ -25,11 +27,13 @@ export default function MemberDetailPage({ params }: { params: Promise<{ id: str
 
   const loadMember = async () => {
     try {
-      const [memberData, classesData] = await Promise.all([
+      const [memberData, classesData, invoicesData] = await Promise.all([
         getMember(id),
-        getClasses()
+        getClasses(),
+        getMemberInvoices(id)
       ]);
       setMember(memberData);
+      setInvoices(invoicesData);
       
       // Filter classes where this member is enrolled or on waitlist
       const enrolled = classesData.filter((cls: Class) => 
@@ -283,35 +287,40 @@ export default function MemberDetailPage({ params }: { params: Promise<{ id: str
               </div>
             </div>
 
-            {/* Billing History */}
-            {member.billing_history && member.billing_history.length > 0 && (
+            {/* Invoices */}
+            {invoices.length > 0 && (
               <div className="mb-8">
-                <h3 className="text-lg font-semibold text-gray-900 mb-4 pb-2 border-b">Billing History</h3>
+                <h3 className="text-lg font-semibold text-gray-900 mb-4 pb-2 border-b">Invoices</h3>
                 <div className="overflow-x-auto">
                   <table className="min-w-full divide-y divide-gray-200">
                     <thead>
                       <tr>
-                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Date</th>
-                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Amount</th>
+                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Number</th>
+                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Issued</th>
+                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Due</th>
                         <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Description</th>
+                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Total</th>
+                        <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Amount Due</th>
                         <th className="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Status</th>
                       </tr>
                     </thead>
                     <tbody className="bg-white divide-y divide-gray-200">
-                      {member.billing_history.map((entry, idx) => (
-                        <tr key={idx}>
-                          <td className="px-4 py-2 whitespace-nowrap">{new Date(entry.date).toLocaleDateString()}</td>
-                          <td className="px-4 py-2 whitespace-nowrap">${entry.amount.toFixed(2)}</td>
-                          <td className="px-4 py-2 whitespace-nowrap">{entry.description}</td>
+                      {invoices.map((invoice) => (
+                        <tr key={invoice.id}>
+                          <td className="px-4 py-2 whitespace-nowrap font-mono text-sm">{invoice.number}</td>
+                          <td className="px-4 py-2 whitespace-nowrap">{invoice.issued_at ? new Date(invoice.issued_at).toLocaleDateString() : '-'}</td>
+                          <td className="px-4 py-2 whitespace-nowrap">{new Date(invoice.due_date).toLocaleDateString()}</td>
+                          <td className="px-4 py-2 whitespace-nowrap">{invoice.lines.map((line) => line.description).join(', ')}</td>
+                          <td className="px-4 py-2 whitespace-nowrap">{formatMoney(invoice.total)}</td>
+                          <td className="px-4 py-2 whitespace-nowrap">{formatMoney(invoice.amount_due)}</td>
                           <td className="px-4 py-2 whitespace-nowrap">
                             <span className={`px-2 py-1 rounded-full text-xs font-semibold ${
-                              entry.status === 'paid' ? 'bg-green-100 text-green-800' :
-                              entry.status === 'pending' ? 'bg-yellow-100 text-yellow-800' :
-                              entry.status === 'failed' ? 'bg-red-100 text-red-800' :
-                              entry.status === 'refunded' ? 'bg-blue-100 text-blue-800' :
+                              invoice.status === 'paid' ? 'bg-green-100 text-green-800' :
+                              invoice.status === 'open' || invoice.status === 'partially_paid' ? 'bg-yellow-100 text-yellow-800' :
+                              invoice.status === 'uncollectible' ? 'bg-red-100 text-red-800' :
                               'bg-gray-100 text-gray-800'
                             }`}>
-                              {entry.status.charAt(0).toUpperCase() + entry.status.slice(1)}
+                              {(invoice.status.charAt(0).toUpperCase() + invoice.status.slice(1)).replace('_', ' ')}
                             </span>
                           </td>
                         </tr>
@@ -3,7 +3,8 @@
 import { useState, useEffect } from 'react';
 import { useRouter, useParams } from 'next/navigation';
 import { createOfficeBooking, getOffice, getMembers } from '@/lib/api';
-import { Office, Member } from '@/types';
+import { Office, Member, Money } from '@/types';
+import { formatMoney } from '@/lib/money';
 
 export default function NewBookingPage() {
   const router = useRouter();
@@ -69,16 +70,16 @@ export default function NewBookingPage() {
     }
   };
 
-  const calculateCost = () => {
+  const calculateCost = (): Money => {
     if (!office || !formData.start_date || !formData.start_time || !formData.end_date || !formData.end_time) {
-      return 0;
+      return { amount: 0, currency: office?.hourly_rate.currency || 'USD' };
     }
 
     const startDateTime = new Date(`${formData.start_date}T${formData.start_time}`);
     const endDateTime = new Date(`${formData.end_date}T${formData.end_time}`);
     const hours = Math.ceil((endDateTime.getTime() - startDateTime.getTime()) / (1000 * 60 * 60));
     
-    return hours * office.hourly_rate;
+    return { amount: hours * office.hourly_rate.amount, currency: office.hourly_rate.currency };
   };
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -257,9 +258,9 @@ export default function NewBookingPage() {
           {/* Cost Display */}
           <div className="bg-gray-50 border border-gray-300 rounded-md p-4">
             <p className="text-sm text-gray-600">Estimated Cost</p>
-            <p className="text-2xl font-bold text-gray-900">${calculateCost().toFixed(2)}</p>
+            <p className="text-2xl font-bold text-gray-900">{formatMoney(calculateCost())}</p>
             <p className="text-sm text-gray-600 mt-1">
-              Rate: ${office.hourly_rate}/hour
+              Rate: {formatMoney(office.hourly_rate)}/hour
             </p>
           </div>
 
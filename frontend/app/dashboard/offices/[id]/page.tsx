@@ -4,6 +4,7 @@ import { useState, useEffect } from 'react';
 import { useRouter, useParams } from 'next/navigation';
 import { getOffice, getOfficeBookings, getClubs, deleteOffice } from '@/lib/api';
 import { Office, OfficeBooking, Club } from '@/types';
+import { formatMoney } from '@/lib/money';
 
 export default function OfficeDetailsPage() {
   const router = useRouter();
@@ -125,8 +126,8 @@ export default function OfficeDetailsPage() {
             <div className="space-y-2 text-gray-700">
               <p><span className="font-medium">Type:</span> {getOfficeTypeLabel(office.type)}</p>
               <p><span className="font-medium">Capacity:</span> {office.capacity} {office.capacity === 1 ? 'person' : 'people'}</p>
-              <p><span className="font-medium">Hourly Rate:</span> ${office.hourly_rate}/hour</p>
-              <p><span className="font-medium">Daily Rate:</span> ${office.daily_rate}/day</p>
+              <p><span className="font-medium">Hourly Rate:</span> {formatMoney(office.hourly_rate)}/hour</p>
+              <p><span className="font-medium">Daily Rate:</span> {formatMoney(office.daily_rate)}/day</p>
               <p><span className="font-medium">Status:</span> {office.active ? 'Active' : 'Inactive'}</p>
             </div>
           </div>
@@ -199,7 +200,7 @@ export default function OfficeDetailsPage() {
                         {durationHours} {durationHours === 1 ? 'hour' : 'hours'}
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
-                        ${booking.total_cost.toFixed(2)}
+                        {formatMoney(booking.total_cost)}
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap">
                         <span className={`px-2 inline-flex text-xs leading-5 font-semibold rounded-full ${getStatusColor(booking.status)}`}>
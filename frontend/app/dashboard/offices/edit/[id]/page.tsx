@@ -4,6 +4,7 @@ import { useState, useEffect } from 'react';
 import { useRouter, useParams } from 'next/navigation';
 import { getOffice, updateOffice, getClubs } from '@/lib/api';
 import { Office, Club } from '@/types';
+import { fromMajor, toMajor } from '@/lib/money';
 
 export default function EditOfficePage() {
   const router = useRouter();
@@ -46,8 +47,8 @@ export default function EditOfficePage() {
         type: officeData.type,
         capacity: officeData.capacity,
         amenities: officeData.amenities?.join(', ') || '',
-        hourly_rate: officeData.hourly_rate,
-        daily_rate: officeData.daily_rate,
+        hourly_rate: toMajor(officeData.hourly_rate),
+        daily_rate: toMajor(officeData.daily_rate),
         active: officeData.active,
       });
     } catch (error) {
@@ -73,8 +74,8 @@ export default function EditOfficePage() {
         club_id: formData.club_id || undefined,
         amenities: amenitiesArray,
         capacity: Number(formData.capacity),
-        hourly_rate: Number(formData.hourly_rate),
-        daily_rate: Number(formData.daily_rate),
+        hourly_rate: fromMajor(Number(formData.hourly_rate)),
+        daily_rate: fromMajor(Number(formData.daily_rate)),
       };
 
       await updateOffice(id, officeData);
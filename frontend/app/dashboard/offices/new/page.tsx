@@ -4,6 +4,7 @@ import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import { createOffice, getClubs } from '@/lib/api';
 import { Club } from '@/types';
+import { fromMajor } from '@/lib/money';
 
 export default function NewOfficePage() {
   const router = useRouter();
@@ -50,8 +51,8 @@ export default function NewOfficePage() {
         club_id: formData.club_id || undefined,
         amenities: amenitiesArray,
         capacity: Number(formData.capacity),
-        hourly_rate: Number(formData.hourly_rate),
-        daily_rate: Number(formData.daily_rate),
+        hourly_rate: fromMajor(Number(formData.hourly_rate)),
+        daily_rate: fromMajor(Number(formData.daily_rate)),
       };
 
       await createOffice(officeData);
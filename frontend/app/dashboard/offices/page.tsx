@@ -4,6 +4,7 @@ import { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import { getOffices, getClubs } from '@/lib/api';
 import { Office, Club } from '@/types';
+import { formatMoney } from '@/lib/money';
 
 export default function OfficesPage() {
   const router = useRouter();
@@ -141,10 +142,10 @@ export default function OfficesPage() {
                   </td>
                   <td className="px-4 py-4 whitespace-nowrap">
                     <div className="text-sm text-gray-600">
-                      ${office.hourly_rate}/hr
+                      {formatMoney(office.hourly_rate)}/hr
                     </div>
                     <div className="text-xs text-gray-500">
-                      ${office.daily_rate}/day
+                      {formatMoney(office.daily_rate)}/day
                     </div>
                   </td>
                   <td className="px-4 py-4 whitespace-nowrap">
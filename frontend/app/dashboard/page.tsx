@@ -6,6 +6,7 @@ import Link from 'next/link';
 import { getCurrentUser, logout, getMembers, getClubs, getRestaurants, getClasses, getInstructors, getOffices, getOfficeBookings } from '@/lib/api';
 import { PieChart, Pie, Cell, BarChart, Bar, XAxis, YAxis, CartesianGrid, Tooltip, Legend, ResponsiveContainer } from 'recharts';
 import type { User } from '@/types';
+import { toMajor } from '@/lib/money';
 import RevenueChart from './RevenueChart';
 
 export default function DashboardPage() {
@@ -52,7 +53,7 @@ export default function DashboardPage() {
       
       // Calculate stats
       const activeMembers = membersData?.filter((m: any) => m.status === 'active').length || 0;
-      const totalRevenue = bookingsData?.reduce((sum: number, booking: any) => sum + (booking.total_cost || 0), 0) || 0;
+      const totalRevenue = bookingsData?.reduce((sum: number, booking: any) => sum + toMajor(booking.total_cost), 0) || 0;
       
       setStats({
         totalMembers: membersData?.length || 0,
@@ -133,6 +133,10 @@ export const deleteMember = async (id: string) => {
   });
 };
 
+export const getMemberInvoices = async (id: string) => {
+  return authenticatedFetch(`${API_BASE_URL}/api/members/${id}/invoices`);
+};
+
 // Class APIs
 export const getClasses = async () => {
   return authenticatedFetch(`${API_BASE_URL}/api/classes`);
@@ -153,8 +157,9 @@ export const createClass = async (classData: any) => {
   });
 };
 
-export const updateClass = async (id: string, classData: any) => {
-  return authenticatedFetch(`${API_BASE_URL}/api/classes/${id}`, {
+export const updateClass = async (id: string, classData: any, scope: 'this' | 'following' | 'all' = 'this') => {
+  const query = scope === 'this' ? '' : `?scope=${scope}`;
+  return authenticatedFetch(`${API_BASE_URL}/api/classes/${id}${query}`, {
     method: 'PUT',
     body: JSON.stringify(classData),
   });
@@ -166,6 +171,19 @@ export const deleteClass = async (id: string) => {
   });
 };
 
+export const cancelClass = async (id: string) => {
+  return authenticatedFetch(`${API_BASE_URL}/api/classes/${id}/cancel`, {
+    method: 'POST',
+  });
+};
+
+export const createClassSeries = async (seriesData: any) => {
+  return authenticatedFetch(`${API_BASE_URL}/api/class-series`, {
+    method: 'POST',
+    body: JSON.stringify(seriesData),
+  });
+};
+
 export const enrollMember = async (classId: string, memberId: string) => {
   return authenticatedFetch(`${API_BASE_URL}/api/classes/${classId}/enroll`, {
     method: 'POST',
@@ -202,6 +220,14 @@ export const updateInstructor = async (id: string, instructorData: any) => {
   });
 };
 
+export const getInstructorSchedule = async (id: string, startDate?: string, endDate?: string) => {
+  const params = new URLSearchParams();
+  if (startDate) params.append('start_date', startDate);
+  if (endDate) params.append('end_date', endDate);
+  const query = params.toString();
+  return authenticatedFetch(`${API_BASE_URL}/api/instructors/${id}/schedule${query ? `?${query}` : ''}`);
+};
+
 export const deleteInstructor = async (id: string) => {
   return authenticatedFetch(`${API_BASE_URL}/api/instructors/${id}`, {
     method: 'DELETE',
@@ -0,0 +1,16 @@
+import type { Money } from '@/types';
+
+// Amounts are exact minor units; convert to major units only for display and inputs
+
+export function toMajor(money?: Money | null): number {
+  return money ? money.amount / 100 : 0;
+}
+
+export function fromMajor(major: number, currency = 'USD'): Money {
+  return { amount: Math.round(major * 100), currency };
+}
+
+export function formatMoney(money?: Money | null): string {
+  const currency = money?.currency || 'USD';
+  return new Intl.NumberFormat('en-US', { style: 'currency', currency }).format(toMajor(money));
+}
@@ -14,21 +14,55 @@ export interface Member {
   notes?: string;
   created_at?: string;
   updated_at?: string;
-  billing_history?: BillingEntry[];
 }
 
-export interface BillingEntry {
-  date: string;
+// Exact amount in minor units (cents), e.g. { amount: 1250, currency: "USD" } is $12.50
+export interface Money {
   amount: number;
+  currency: string;
+}
+
+export interface InvoiceLine {
   description: string;
-  status: string; // paid, pending, failed, refunded
+  product_type: string; // membership, class_pack, office_booking, restaurant, other, discount, credit
+  product_id?: string;
+  quantity: number;
+  unit_price: Money;
+  tax_rate: number;
+  tax_inclusive?: boolean;
+  amount: Money;
+  tax_amount: Money;
+}
+
+export interface Invoice {
+  id: string;
+  number: string;
+  member_id?: string;
+  club_id?: string;
+  status: string; // draft, open, partially_paid, paid, void, uncollectible
+  lines: InvoiceLine[];
+  currency: string;
+  subtotal: Money;
+  tax_total: Money;
+  total: Money;
+  amount_paid: Money;
+  amount_due: Money;
+  issued_at?: string;
+  due_date: string;
+  paid_at?: string;
+  notes: string;
+  statement_month?: string; // set on monthly statements, e.g. 2024-03
+  created_at: string;
+  updated_at: string;
 }
 
 export interface Class {
   id?: string;
   club_id?: string;
+  series_id?: string;
   name: string;
   description: string;
+  instructor_id?: string;
   instructor: string;
   date: string;
   start_time: string;
@@ -44,6 +78,32 @@ export interface Class {
   updated_at?: string;
 }
 
+export interface ClassSeries {
+  id?: string;
+  club_id?: string;
+  name: string;
+  description: string;
+  instructor_id?: string;
+  instructor: string;
+  start_date: string;
+  rrule: string;
+  start_time: string;
+  end_time: string;
+  duration: number;
+  capacity: number;
+  status: string;
+  created_at?: string;
+  updated_at?: string;
+}
+
+export interface InstructorSchedule {
+  instructor: Instructor;
+  start_date: string;
+  end_date: string;
+  classes: Class[];
+  conflicts: { class_id: string; other_class_id: string }[];
+}
+
 export interface ClassWithMembers extends Class {
   enrolled_members_details: Member[];
   wait_list_details: Member[];
@@ -130,8 +190,8 @@ export interface Office {
   type: string; // private, shared, meeting_room, phone_booth
   capacity: number;
   amenities: string[];
-  hourly_rate: number;
-  daily_rate: number;
+  hourly_rate: Money;
+  daily_rate: Money;
   active: boolean;
   created_at?: string;
   updated_at?: string;
@@ -144,7 +204,11 @@ export interface OfficeBooking {
   start_time: string;
   end_time: string;
   status: string; // confirmed, cancelled, completed, no-show
-  total_cost: number;
+  total_cost: Money;
+  tax_rate?: number;
+  tax_inclusive?: boolean;
+  tax_amount?: Money;
+  total_with_tax?: Money;
   notes?: string;
   created_at?: string;
   updated_at?: string;
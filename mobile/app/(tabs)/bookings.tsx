@@ -180,7 +180,7 @@ export default function BookingsScreen() {
           <Text style={styles.statusText}>{item.status}</Text>
         </View>
       </View>
-      {item.total_cost && <Text style={styles.details}>Cost: ${item.total_cost}</Text>}
+      {item.total_cost && <Text style={styles.details}>Cost: ${(item.total_cost.amount / 100).toFixed(2)}</Text>}
       {item.notes && <Text style={styles.notes}>Notes: {item.notes}</Text>}
       {item.status !== 'cancelled' && (
         <TouchableOpacity
@@ -100,8 +100,8 @@ export default function OfficesScreen() {
 
       <View style={styles.details}>
         {item.capacity && <Text style={styles.detailText}>👥 Capacity: {item.capacity}</Text>}
-        {item.hourly_rate && <Text style={styles.detailText}>💰 ${item.hourly_rate}/hour</Text>}
-        {item.daily_rate && <Text style={styles.detailText}>💵 ${item.daily_rate}/day</Text>}
+        {item.hourly_rate && <Text style={styles.detailText}>💰 ${(item.hourly_rate.amount / 100).toFixed(2)}/hour</Text>}
+        {item.daily_rate && <Text style={styles.detailText}>💵 ${(item.daily_rate.amount / 100).toFixed(2)}/day</Text>}
       </View>
 
       {item.amenities && item.amenities.length > 0 && (
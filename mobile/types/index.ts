@@ -84,6 +84,12 @@ export interface AuthResponse {
   user: User;
 }
 
+// Exact amount in minor units (cents), e.g. { amount: 1250, currency: "USD" }
+export interface Money {
+  amount: number;
+  currency: string;
+}
+
 export interface Office {
   id?: string;
   club_id?: string;
@@ -92,8 +98,8 @@ export interface Office {
   type: string; // private, shared, meeting_room, phone_booth
   capacity?: number;
   amenities?: string[];
-  hourly_rate?: number;
-  daily_rate?: number;
+  hourly_rate?: Money;
+  daily_rate?: Money;
   active: boolean;
   created_at?: string;
   updated_at?: string;
@@ -106,6 +112,7 @@ export interface ClassBooking {
   status: string; // confirmed, waitlist, cancelled, attended, no-show
   booked_at?: string;
   notes?: string;
+  cancelled_at?: string;
   created_at?: string;
   updated_at?: string;
 }
@@ -117,7 +124,11 @@ export interface OfficeBooking {
   start_time: string;
   end_time: string;
   status: string; // confirmed, cancelled, completed, no-show
-  total_cost?: number;
+  total_cost?: Money;
+  tax_rate?: number;
+  tax_inclusive?: boolean;
+  tax_amount?: Money;
+  total_with_tax?: Money;
   notes?: string;
   created_at?: string;
   updated_at?: string;